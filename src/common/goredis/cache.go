@@ -0,0 +1,496 @@
+package goredis
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"common/goredis/internal/backoff"
+)
+
+const (
+	// DefaultCacheMaxEntries is the default number of the keys kept by a Cache
+	DefaultCacheMaxEntries = 10000
+
+	// DefaultCacheTTL is the default time a key is kept by a Cache without being invalidated
+	DefaultCacheTTL = time.Minute
+
+	// invalidateChannel is the channel of the invalidation messages of RESP2
+	invalidateChannel = "__redis__:invalidate"
+)
+
+var (
+	// ErrCacheClosed is returned by the reads of a closed Cache.
+	ErrCacheClosed = errors.New("cache closed")
+
+	errCacheDisconnected = errors.New("cache invalidation connection is down")
+)
+
+// CacheConfig is the parameters of a Cache.
+// MaxEntries and MaxBytes bound the cached keys, the least recently used ones are evicted first,
+// MaxEntries is DefaultCacheMaxEntries if it is not positive, and MaxBytes is unlimited if it is not positive.
+// TTL bounds the time a key is cached even if it is never invalidated, DefaultCacheTTL if it is not positive.
+// The invalidation connection is rebuilt with an exponential backoff between MinBackoff(default 100ms)
+// and MaxBackoff(default 10s).
+type CacheConfig struct {
+	MaxEntries int
+	MaxBytes   int64
+	TTL        time.Duration
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// CacheStats is the counters of a Cache.
+type CacheStats struct {
+	Hits          int64 // reads served by the cache
+	Misses        int64 // reads sent to redis
+	Invalidations int64 // keys removed by the invalidation messages
+	Evictions     int64 // keys removed by MaxEntries, MaxBytes or TTL
+	Entries       int   // keys cached now
+	Bytes         int64 // approximate size of the keys and values cached now
+}
+
+func (s CacheStats) String() string {
+	return fmt.Sprintf("Hits: %d, Misses: %d, Invalidations: %d, Evictions: %d, Entries: %d, Bytes: %d",
+		s.Hits, s.Misses, s.Invalidations, s.Evictions, s.Entries, s.Bytes)
+}
+
+// Cache is a client side cache of the reads of a Redis, kept in sync by the server assisted invalidation
+// of CLIENT TRACKING (Redis 6):
+// the reads are sent by the connections of its own pool, which are tracked with REDIRECT to an invalidation
+// connection, and the cached keys are removed when their invalidation messages arrive there.
+// With RESP2 the invalidation connection subscribes __redis__:invalidate, with RESP3 it receives push messages.
+//
+// While the invalidation connection is rebuilt, the cache is cleared and the reads are sent to the Redis directly.
+// For a client of DialSentinel it is rebuilt on the new master after a failover too.
+// The invalidation arrives shortly after a write of another client, so a read may return the old value
+// for a moment, which is the nature of client side caching.
+type Cache struct {
+	origin *Redis
+	redis  *Redis
+	pool   *connPool
+	cfg    CacheConfig
+
+	mutex    sync.Mutex
+	lru      *list.List
+	entries  map[string]*list.Element
+	pending  map[string]uint64
+	token    uint64
+	bytes    int64
+	stats    CacheStats
+	conn     *connection
+	redirect int64
+	closed   bool
+	unwatch  func()
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+type cacheEntry struct {
+	key      string
+	command  string
+	value    interface{}
+	size     int64
+	expireAt time.Time
+}
+
+// NewCache connects the invalidation connection and returns a Cache of r, cfg maybe nil for the defaults.
+// Redis Cluster is not supported.
+func (r *Redis) NewCache(cfg *CacheConfig) (*Cache, error) {
+	if r.cluster != nil {
+		return nil, errors.New("client side caching is not supported by cluster")
+	}
+	c := &Cache{
+		origin:  r,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		pending: make(map[string]uint64),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if cfg != nil {
+		c.cfg = *cfg
+	}
+	if c.cfg.MaxEntries <= 0 {
+		c.cfg.MaxEntries = DefaultCacheMaxEntries
+	}
+	if c.cfg.TTL <= 0 {
+		c.cfg.TTL = DefaultCacheTTL
+	}
+	if c.cfg.MinBackoff <= 0 {
+		c.cfg.MinBackoff = 100 * time.Millisecond
+	}
+	if c.cfg.MaxBackoff < c.cfg.MinBackoff {
+		c.cfg.MaxBackoff = 10 * time.Second
+	}
+	c.pool = &connPool{
+		MaxIdle:         r.pool.MaxIdle,
+		MaxActive:       r.pool.MaxActive,
+		WaitTimeout:     r.pool.WaitTimeout,
+		IdleTimeout:     r.pool.IdleTimeout,
+		MaxConnLifetime: r.pool.MaxConnLifetime,
+		TestOnBorrow:    r.pool.TestOnBorrow,
+		PingTimeout:     r.pool.PingTimeout,
+		Dial:            c.dial,
+		idle:            list.New(),
+		waiters:         list.New(),
+	}
+	view := *r
+	view.pool, view.sentinel = c.pool, nil
+	c.redis = &view
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	if r.sentinel != nil {
+		c.unwatch = r.sentinel.onSwitch(c.reset)
+	}
+	go c.run(conn)
+	return c, nil
+}
+
+// reset closes the invalidation connection after a failover of the sentinel client,
+// so the keys are flushed and the tracking is rebuilt on the new master by run.
+func (c *Cache) reset() {
+	c.mutex.Lock()
+	if c.conn != nil {
+		c.conn.Conn.Close()
+	}
+	c.flush()
+	c.mutex.Unlock()
+	c.pool.Drain()
+}
+
+// dial opens a connection of the pool tracked with REDIRECT to the invalidation connection.
+func (c *Cache) dial() (*connection, error) {
+	c.mutex.Lock()
+	redirect := c.redirect
+	c.mutex.Unlock()
+	if redirect == 0 {
+		return nil, errCacheDisconnected
+	}
+	conn, err := c.origin.dialConnection()
+	if err != nil {
+		return nil, err
+	}
+	rp, err := conn.execute(nil, "CLIENT", "TRACKING", "ON", "REDIRECT", redirect)
+	if err == nil {
+		_, err = rp.StatusValue()
+	}
+	if err != nil {
+		conn.Conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// connect opens the invalidation connection, the connections of the pool dialed before are drained.
+func (c *Cache) connect() (*connection, error) {
+	conn, err := c.origin.dialConnection()
+	if err != nil {
+		return nil, err
+	}
+	// with RESP3 the invalidation messages are push replies, which are read by receive
+	conn.push = nil
+	id, err := c.subscribe(conn)
+	if err != nil {
+		conn.Conn.Close()
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		conn.Conn.Close()
+		return nil, ErrCacheClosed
+	}
+	c.conn, c.redirect = conn, id
+	c.pool.Drain()
+	return conn, nil
+}
+
+// subscribe returns the client id of the invalidation connection, and subscribes the invalidation channel for RESP2.
+func (c *Cache) subscribe(conn *connection) (int64, error) {
+	rp, err := conn.execute(nil, "CLIENT", "ID")
+	if err != nil {
+		return 0, err
+	}
+	id, err := rp.IntegerValue()
+	if err != nil || c.origin.protocol == 3 {
+		return id, err
+	}
+	if rp, err = conn.execute(nil, "SUBSCRIBE", invalidateChannel); err != nil {
+		return 0, err
+	}
+	if rp.Type == ErrorReply {
+		return 0, errors.New(rp.Error)
+	}
+	return id, nil
+}
+
+// run receives the invalidation messages, and rebuilds the invalidation connection until Close.
+func (c *Cache) run(conn *connection) {
+	defer close(c.done)
+	for conn != nil {
+		c.receive(conn)
+		conn.Conn.Close()
+		c.mutex.Lock()
+		c.conn, c.redirect = nil, 0
+		c.flush()
+		closed := c.closed
+		c.mutex.Unlock()
+		if closed {
+			return
+		}
+		conn = c.reconnect()
+	}
+}
+
+func (c *Cache) reconnect() *connection {
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-c.quit:
+			return nil
+		case <-time.After(backoff.Exponential(c.cfg.MinBackoff, c.cfg.MaxBackoff, attempt)):
+		}
+		conn, err := c.connect()
+		if err == nil {
+			return conn
+		}
+		if err == ErrCacheClosed {
+			return nil
+		}
+	}
+}
+
+func (c *Cache) receive(conn *connection) error {
+	for {
+		rp, err := conn.RecvReply()
+		if err != nil {
+			return err
+		}
+		if keys, all, ok := parseInvalidation(rp); ok {
+			c.invalidate(keys, all)
+		}
+	}
+}
+
+// parseInvalidation returns the keys of an invalidation message, all is true for the null keys of a flush.
+func parseInvalidation(rp *Reply) (keys []string, all bool, ok bool) {
+	if !rp.isMulti() || len(rp.Multi) < 2 {
+		return nil, false, false
+	}
+	var payload *Reply
+	kind, _ := rp.Multi[0].StringValue()
+	switch {
+	case rp.Type == PushReply && len(rp.Multi) == 2 && strings.ToLower(kind) == "invalidate":
+		payload = rp.Multi[1]
+	case len(rp.Multi) == 3 && strings.ToLower(kind) == "message":
+		if channel, _ := rp.Multi[1].StringValue(); channel != invalidateChannel {
+			return nil, false, false
+		}
+		payload = rp.Multi[2]
+	default:
+		return nil, false, false
+	}
+	if payload.isNilMulti() {
+		return nil, true, true
+	}
+	keys, err := payload.ListValue()
+	return keys, false, err == nil
+}
+
+// Get returns the value of key like Redis.Get, from the cache if it is cached.
+func (c *Cache) Get(key string) ([]byte, error) {
+	value, err := c.load("GET", key, func(rp *Reply) (interface{}, int64, error) {
+		b, err := rp.BytesValue()
+		return b, int64(len(b)), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	b := value.([]byte)
+	if b != nil {
+		b = append(make([]byte, 0, len(b)), b...)
+	}
+	return b, nil
+}
+
+// HGetAll returns the fields and values of the hash at key like Redis.HGetAll, from the cache if it is cached.
+func (c *Cache) HGetAll(key string) (map[string]string, error) {
+	value, err := c.load("HGETALL", key, func(rp *Reply) (interface{}, int64, error) {
+		m, err := rp.HashValue()
+		var size int64
+		for field, v := range m {
+			size += int64(len(field) + len(v))
+		}
+		return m, size, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	m := value.(map[string]string)
+	copied := make(map[string]string, len(m))
+	for field, v := range m {
+		copied[field] = v
+	}
+	return copied, nil
+}
+
+// load returns the cached result of command on key,
+// or sends it by a tracked connection and caches the result parsed by parse, whose size is returned too.
+// The result is not cached if the key is invalidated before the reply is received.
+func (c *Cache) load(command, key string, parse func(rp *Reply) (interface{}, int64, error)) (interface{}, error) {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil, ErrCacheClosed
+	}
+	if value, ok := c.lookup(command, key); ok {
+		c.stats.Hits++
+		c.mutex.Unlock()
+		return value, nil
+	}
+	c.stats.Misses++
+	redis := c.origin
+	var token uint64
+	if c.redirect != 0 {
+		redis = c.redis
+		c.token++
+		token = c.token
+		c.pending[key] = token
+	}
+	c.mutex.Unlock()
+
+	rp, err := redis.ExecuteCommand(command, key)
+	var value interface{}
+	var size int64
+	if err == nil {
+		value, size, err = parse(rp)
+	}
+	if token == 0 {
+		return value, err
+	}
+	c.mutex.Lock()
+	if c.pending[key] == token {
+		delete(c.pending, key)
+		if err == nil {
+			c.store(command, key, value, size)
+		}
+	}
+	c.mutex.Unlock()
+	return value, err
+}
+
+// lookup returns the cached result of command on key, must be called with mutex held.
+func (c *Cache) lookup(command, key string) (interface{}, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*cacheEntry)
+	if !time.Now().Before(e.expireAt) {
+		c.remove(elem)
+		c.stats.Evictions++
+		return nil, false
+	}
+	if e.command != command {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return e.value, true
+}
+
+// store caches the result of command on key, and evicts the least recently used keys out of the bounds.
+func (c *Cache) store(command, key string, value interface{}, size int64) {
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	e := &cacheEntry{
+		key:      key,
+		command:  command,
+		value:    value,
+		size:     int64(len(key)) + size,
+		expireAt: time.Now().Add(c.cfg.TTL),
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	c.bytes += e.size
+	for c.lru.Len() > c.cfg.MaxEntries || c.cfg.MaxBytes > 0 && c.bytes > c.cfg.MaxBytes {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	e := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.bytes -= e.size
+}
+
+// invalidate removes keys, or all the keys if all is true.
+func (c *Cache) invalidate(keys []string, all bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if all {
+		c.stats.Invalidations += int64(c.lru.Len())
+		c.flush()
+		return
+	}
+	for _, key := range keys {
+		delete(c.pending, key)
+		if elem, ok := c.entries[key]; ok {
+			c.remove(elem)
+			c.stats.Invalidations++
+		}
+	}
+}
+
+// flush removes all the keys, must be called with mutex held.
+func (c *Cache) flush() {
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.pending = make(map[string]uint64)
+	c.bytes = 0
+}
+
+// Flush removes all the cached keys.
+func (c *Cache) Flush() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.flush()
+}
+
+// Stats returns a snapshot of the counters.
+func (c *Cache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// Close closes the invalidation connection and the pool of the cache, the Redis is left open.
+func (c *Cache) Close() error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return ErrCacheClosed
+	}
+	c.closed = true
+	close(c.quit)
+	if c.conn != nil {
+		c.conn.Conn.Close()
+	}
+	c.flush()
+	c.mutex.Unlock()
+	if c.unwatch != nil {
+		c.unwatch()
+	}
+	<-c.done
+	c.pool.Close()
+	return nil
+}
@@ -0,0 +1,160 @@
+package goredis
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"common/goredis/redistest"
+)
+
+func TestCache(t *testing.T) {
+	cache, err := r.NewCache(&CacheConfig{MaxEntries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	r.Del("cache:key", "cache:hash", "cache:missing")
+	r.Set("cache:key", "value", 0, 0, false, false)
+	for i := 0; i < 2; i++ {
+		if b, err := cache.Get("cache:key"); err != nil || string(b) != "value" {
+			t.Error(string(b), err)
+		}
+	}
+	if b, err := cache.Get("cache:missing"); err != nil || b != nil {
+		t.Error(b, err)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Error(stats)
+	}
+	r.Set("cache:key", "new", 0, 0, false, false)
+	waitFor(t, func() bool {
+		b, _ := cache.Get("cache:key")
+		return string(b) == "new"
+	})
+	if stats := cache.Stats(); stats.Invalidations != 1 {
+		t.Error(stats)
+	}
+
+	r.HSet("cache:hash", "field", "value")
+	if m, err := cache.HGetAll("cache:hash"); err != nil || m["field"] != "value" {
+		t.Error(m, err)
+	}
+	if _, err := cache.Get("cache:hash"); err == nil {
+		t.Error("GET of a hash cached")
+	}
+	m, _ := cache.HGetAll("cache:hash")
+	m["field"] = "changed"
+	if m, _ := cache.HGetAll("cache:hash"); m["field"] != "value" {
+		t.Error("cached hash modified")
+	}
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Evictions != 1 {
+		t.Error(stats)
+	}
+	r.HSet("cache:hash", "field", "new")
+	waitFor(t, func() bool {
+		m, _ := cache.HGetAll("cache:hash")
+		return m["field"] == "new"
+	})
+}
+
+func TestCacheTTL(t *testing.T) {
+	cache, err := r.NewCache(&CacheConfig{TTL: 50 * time.Millisecond, MaxBytes: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	r.Set("cache:key", "value", 0, 0, false, false)
+	r.Set("cache:large", "a value larger than MaxBytes", 0, 0, false, false)
+	cache.Get("cache:key")
+	cache.Get("cache:large")
+	if stats := cache.Stats(); stats.Entries != 0 || stats.Evictions != 2 {
+		t.Error(stats)
+	}
+	cache.Get("cache:key")
+	if stats := cache.Stats(); stats.Entries != 1 || stats.Bytes != int64(len("cache:key")+len("value")) {
+		t.Error(stats)
+	}
+	time.Sleep(60 * time.Millisecond)
+	cache.Get("cache:key")
+	if stats := cache.Stats(); stats.Hits != 0 || stats.Evictions != 3 {
+		t.Error(stats)
+	}
+}
+
+func TestCacheReconnect(t *testing.T) {
+	cache, err := r.NewCache(&CacheConfig{MinBackoff: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Set("cache:key", "value", 0, 0, false, false)
+	cache.Get("cache:key")
+	cache.mutex.Lock()
+	redirect := cache.redirect
+	cache.mutex.Unlock()
+	if _, err := r.ExecuteCommand("CLIENT", "KILL", "ID", redirect); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		cache.mutex.Lock()
+		defer cache.mutex.Unlock()
+		return cache.redirect != 0 && cache.redirect != redirect
+	})
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Error("cache not cleared", stats)
+	}
+	cache.Get("cache:key")
+	r.Set("cache:key", "new", 0, 0, false, false)
+	waitFor(t, func() bool {
+		b, _ := cache.Get("cache:key")
+		return string(b) == "new"
+	})
+	if err := cache.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := cache.Get("cache:key"); err != ErrCacheClosed {
+		t.Error(err)
+	}
+}
+
+func TestCacheSentinelSwitch(t *testing.T) {
+	var clients [2]*Redis
+	for i := range clients {
+		server, err := redistest.NewServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Close()
+		if clients[i], err = Dial(&DialConfig{Address: server.Addr()}); err != nil {
+			t.Fatal(err)
+		}
+		defer clients[i].ClosePool()
+		clients[i].Set("cache:key", strconv.Itoa(i), 0, 0, false, false)
+	}
+	sentinel := newFakeSentinel(t, clients[0].address)
+	client, err := DialSentinel(&SentinelConfig{Sentinels: []string{sentinel.Addr()}, MasterName: "mymaster"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	cache, err := client.NewCache(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	if b, err := cache.Get("cache:key"); err != nil || string(b) != "0" {
+		t.Fatal(string(b), err)
+	}
+	waitFor(t, sentinel.subscribed)
+	sentinel.switchMaster(clients[1].address)
+	// the value cached from the old master is flushed, and the new master is tracked
+	waitFor(t, func() bool {
+		b, _ := cache.Get("cache:key")
+		return string(b) == "1"
+	})
+	clients[1].Set("cache:key", "new", 0, 0, false, false)
+	waitFor(t, func() bool {
+		b, _ := cache.Get("cache:key")
+		return string(b) == "new"
+	})
+}
@@ -0,0 +1,620 @@
+package goredis
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HashSlots is the number of hash slots of a redis cluster.
+const HashSlots = 16384
+
+const (
+	// DefaultMaxRedirects is the default value of MOVED/ASK redirects followed per command
+	DefaultMaxRedirects = 16
+)
+
+// ClusterConfig is redis cluster client connect to server parameters.
+// Addrs are the seed nodes, any reachable one is enough to learn the whole slot map.
+// The other fields are used to dial every node, see DialConfig,
+// Scripts are loaded on every new connection of every node.
+type ClusterConfig struct {
+	Addrs           []string
+	Username        string
+	Password        string
+	TLSConfig       *tls.Config
+	Timeout         time.Duration
+	MaxIdle         int
+	MaxActive       int
+	WaitTimeout     time.Duration
+	IdleTimeout     time.Duration
+	MaxConnLifetime time.Duration
+	TestOnBorrow    bool
+	MaxRedirects    int
+	Scripts         []*Script
+}
+
+type redisCluster struct {
+	dial         DialConfig // the config of the nodes without Address
+	maxRedirects int
+
+	seeds     []string
+	slots     [HashSlots]string
+	nodes     map[string]*Redis
+	mutex     sync.RWMutex
+	reloading bool
+}
+
+// DialCluster new a redis client which talks to a redis cluster.
+// The slot map is learned via CLUSTER SLOTS, every command sent by ExecuteCommand
+// is routed to the master owning the slot of its key, MOVED and ASK redirects are
+// followed and the slot map is reloaded whenever the topology changes.
+// KEYS, SCAN, DBSIZE, FLUSHDB, FLUSHALL, RANDOMKEY and SCRIPT LOAD/EXISTS/FLUSH
+// are sent to every master and the replies are merged, so Keys, ScanIter, DelPattern and LoadScripts
+// cover the whole keyspace.
+// A Pipeline sends its commands to the masters of their slots, one pipeline per node,
+// and a TxPipeline runs on the master of the slot of its first key.
+// Pipelining, Transaction, PubSub and Monitor run on the first reachable seed node,
+// so all the keys used by them, and by a TxPipeline, must be hashed into one slot(use {hashtag}).
+func DialCluster(cfg *ClusterConfig) (*Redis, error) {
+	if cfg == nil || len(cfg.Addrs) == 0 {
+		return nil, errors.New("cluster seed addresses required")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxIdle == 0 {
+		cfg.MaxIdle = DefaultMaxIdle
+	}
+	if cfg.MaxRedirects == 0 {
+		cfg.MaxRedirects = DefaultMaxRedirects
+	}
+	c := &redisCluster{
+		dial: DialConfig{
+			Network:         DefaultNetwork,
+			Username:        cfg.Username,
+			Password:        cfg.Password,
+			TLSConfig:       cfg.TLSConfig,
+			Timeout:         cfg.Timeout,
+			MaxIdle:         cfg.MaxIdle,
+			MaxActive:       cfg.MaxActive,
+			WaitTimeout:     cfg.WaitTimeout,
+			IdleTimeout:     cfg.IdleTimeout,
+			MaxConnLifetime: cfg.MaxConnLifetime,
+			TestOnBorrow:    cfg.TestOnBorrow,
+			Scripts:         cfg.Scripts,
+		},
+		maxRedirects: cfg.MaxRedirects,
+		seeds:        cfg.Addrs,
+		nodes:        make(map[string]*Redis),
+	}
+	if err := c.reload(); err != nil {
+		c.close()
+		return nil, err
+	}
+	var seed *Redis
+	for _, addr := range cfg.Addrs {
+		if node, err := c.node(addr); err == nil {
+			seed = node
+			break
+		}
+	}
+	if seed == nil {
+		seed = c.slotNode(0)
+	}
+	return &Redis{
+		network:  seed.network,
+		address:  seed.address,
+		password: seed.password,
+		timeout:  seed.timeout,
+		pool:     seed.pool,
+		cluster:  c,
+		hooks:    &hookList{},
+	}, nil
+}
+
+// ClusterSlots returns the slot map of the cluster as [start, end, master address] entries.
+func (r *Redis) ClusterSlots() ([]*ClusterSlotRange, error) {
+	rp, err := r.ExecuteCommand("CLUSTER", "SLOTS")
+	if err != nil {
+		return nil, err
+	}
+	return parseClusterSlots(rp)
+}
+
+// ClusterSlotRange is one entry of CLUSTER SLOTS reply.
+// Nodes[0] is the master, the others are replicas.
+type ClusterSlotRange struct {
+	Start int
+	End   int
+	Nodes []string
+}
+
+func parseClusterSlots(rp *Reply) ([]*ClusterSlotRange, error) {
+	multi, err := rp.MultiValue()
+	if err != nil {
+		return nil, err
+	}
+	var ranges []*ClusterSlotRange
+	for _, item := range multi {
+		if item.Type != MultiReply || len(item.Multi) < 3 {
+			return nil, errors.New("cluster slots protocol error")
+		}
+		start, err := item.Multi[0].IntegerValue()
+		if err != nil {
+			return nil, err
+		}
+		end, err := item.Multi[1].IntegerValue()
+		if err != nil {
+			return nil, err
+		}
+		sr := &ClusterSlotRange{Start: int(start), End: int(end)}
+		for _, n := range item.Multi[2:] {
+			if n.Type != MultiReply || len(n.Multi) < 2 {
+				return nil, errors.New("cluster slots protocol error")
+			}
+			host, err := n.Multi[0].StringValue()
+			if err != nil {
+				return nil, err
+			}
+			port, err := n.Multi[1].IntegerValue()
+			if err != nil {
+				return nil, err
+			}
+			sr.Nodes = append(sr.Nodes, net.JoinHostPort(host, strconv.FormatInt(port, 10)))
+		}
+		ranges = append(ranges, sr)
+	}
+	return ranges, nil
+}
+
+func (c *redisCluster) node(addr string) (*Redis, error) {
+	c.mutex.RLock()
+	node, ok := c.nodes[addr]
+	c.mutex.RUnlock()
+	if ok {
+		return node, nil
+	}
+	cfg := c.dial
+	cfg.Address = addr
+	node, err := Dial(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	if exists, ok := c.nodes[addr]; ok {
+		c.mutex.Unlock()
+		node.ClosePool()
+		return exists, nil
+	}
+	c.nodes[addr] = node
+	c.mutex.Unlock()
+	return node, nil
+}
+
+// reload asks the known nodes, and then the seeds, for CLUSTER SLOTS
+// and replaces the slot map with the first answer.
+func (c *redisCluster) reload() error {
+	c.mutex.RLock()
+	addrs := make([]string, 0, len(c.nodes)+len(c.seeds))
+	for addr := range c.nodes {
+		addrs = append(addrs, addr)
+	}
+	c.mutex.RUnlock()
+	addrs = append(addrs, c.seeds...)
+
+	err := errors.New("no reachable cluster node")
+	for _, addr := range addrs {
+		var node *Redis
+		node, err = c.node(addr)
+		if err != nil {
+			continue
+		}
+		var ranges []*ClusterSlotRange
+		ranges, err = node.ClusterSlots()
+		if err != nil {
+			continue
+		}
+		var slots [HashSlots]string
+		for _, sr := range ranges {
+			if len(sr.Nodes) == 0 {
+				continue
+			}
+			for i := sr.Start; i <= sr.End && i < HashSlots; i++ {
+				slots[i] = sr.Nodes[0]
+			}
+		}
+		c.mutex.Lock()
+		c.slots = slots
+		c.mutex.Unlock()
+		return nil
+	}
+	return err
+}
+
+// reloadAsync reloads the slot map in background, at most one reload at a time.
+func (c *redisCluster) reloadAsync() {
+	c.mutex.Lock()
+	if c.reloading {
+		c.mutex.Unlock()
+		return
+	}
+	c.reloading = true
+	c.mutex.Unlock()
+	go func() {
+		c.reload()
+		c.mutex.Lock()
+		c.reloading = false
+		c.mutex.Unlock()
+	}()
+}
+
+func (c *redisCluster) slotNode(slot int) *Redis {
+	c.mutex.RLock()
+	addr := c.slots[slot]
+	c.mutex.RUnlock()
+	if addr == "" {
+		return nil
+	}
+	node, err := c.node(addr)
+	if err != nil {
+		return nil
+	}
+	return node
+}
+
+// masters returns the addresses of the masters serving any slot, in order.
+func (c *redisCluster) masters() []string {
+	c.mutex.RLock()
+	seen := make(map[string]bool)
+	var addrs []string
+	for _, addr := range c.slots {
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	c.mutex.RUnlock()
+	sort.Strings(addrs)
+	return addrs
+}
+
+func (c *redisCluster) poolStats() PoolStats {
+	var stats PoolStats
+	c.mutex.RLock()
+	for _, node := range c.nodes {
+		stats = stats.add(node.pool.Stats())
+	}
+	c.mutex.RUnlock()
+	return stats
+}
+
+func (c *redisCluster) close() {
+	c.mutex.Lock()
+	for _, node := range c.nodes {
+		node.ClosePool()
+	}
+	c.nodes = make(map[string]*Redis)
+	c.mutex.Unlock()
+}
+
+func (c *redisCluster) executeCommand(ctx context.Context, args ...interface{}) (*Reply, error) {
+	if len(args) > 0 {
+		switch name := strings.ToUpper(argString(args[0])); name {
+		case "KEYS", "DBSIZE", "FLUSHDB", "FLUSHALL", "RANDOMKEY", "SCAN":
+			return c.executeMasters(ctx, name, args)
+		case "SCRIPT":
+			if len(args) > 1 {
+				return c.executeMasters(ctx, name+" "+strings.ToUpper(argString(args[1])), args)
+			}
+		}
+	}
+	slot := 0
+	if key, ok := commandKey(args); ok {
+		slot = KeySlot(key)
+	}
+	var asking string
+	for i := 0; i <= c.maxRedirects; i++ {
+		var node *Redis
+		var err error
+		if asking != "" {
+			node, err = c.node(asking)
+		} else if node = c.slotNode(slot); node == nil {
+			err = fmt.Errorf("no cluster node serves slot %d", slot)
+		}
+		if err != nil {
+			c.reloadAsync()
+			return nil, err
+		}
+
+		var rp *Reply
+		if asking != "" {
+			rp, err = node.executeAsking(ctx, args...)
+		} else {
+			rp, err = execute(ctx, node.pool, args...)
+		}
+		asking = ""
+		if err != nil {
+			c.reloadAsync()
+			return nil, err
+		}
+		if rp.Type != ErrorReply {
+			return rp, nil
+		}
+
+		fields := strings.Fields(rp.Error)
+		switch {
+		case len(fields) == 3 && fields[0] == "MOVED":
+			c.moved(fields[1], fields[2])
+		case len(fields) == 3 && fields[0] == "ASK":
+			asking = fields[2]
+		case len(fields) > 0 && (fields[0] == "TRYAGAIN" || fields[0] == "CLUSTERDOWN"):
+			if err := sleepContext(ctx, 100*time.Millisecond); err != nil {
+				return nil, err
+			}
+		default:
+			return rp, nil
+		}
+	}
+	return nil, errors.New("too many cluster redirects")
+}
+
+// moved records addr as the master of the slot of a MOVED redirect, and reloads the slot map in background.
+func (c *redisCluster) moved(slot, addr string) {
+	c.mutex.Lock()
+	if s, err := strconv.Atoi(slot); err == nil && s >= 0 && s < HashSlots {
+		c.slots[s] = addr
+	}
+	c.mutex.Unlock()
+	c.reloadAsync()
+}
+
+// clusterScanShift is the bits of the master index in the cursor of SCAN of a cluster.
+const clusterScanShift = 10
+
+// executeMasters sends a command about the whole keyspace to every master and merges the replies:
+// KEYS, DBSIZE, FLUSHDB, FLUSHALL, RANDOMKEY, SCRIPT LOAD, SCRIPT EXISTS and SCRIPT FLUSH.
+// SCAN scans the masters one by one, the cursor has the index of the master in the low clusterScanShift bits.
+// The other SCRIPT subcommands are not supported.
+func (c *redisCluster) executeMasters(ctx context.Context, name string, args []interface{}) (*Reply, error) {
+	masters := c.masters()
+	if len(masters) == 0 {
+		c.reloadAsync()
+		return nil, errors.New("no cluster master known")
+	}
+	switch name {
+	case "SCAN":
+		return c.scan(ctx, masters, args)
+	case "RANDOMKEY":
+		for _, i := range rand.Perm(len(masters)) {
+			rp, err := c.executeNode(ctx, masters[i], args)
+			if err != nil || rp.Type == ErrorReply || rp.Bulk != nil {
+				return rp, err
+			}
+		}
+		return &Reply{Type: BulkReply}, nil
+	case "KEYS", "DBSIZE", "FLUSHDB", "FLUSHALL", "SCRIPT LOAD", "SCRIPT EXISTS", "SCRIPT FLUSH":
+	default:
+		return nil, fmt.Errorf("%s is not supported in cluster mode", name)
+	}
+
+	var merged *Reply
+	for _, addr := range masters {
+		rp, err := c.executeNode(ctx, addr, args)
+		if err != nil {
+			return nil, err
+		}
+		if rp.Type == ErrorReply {
+			return rp, nil
+		}
+		if merged == nil {
+			merged = rp
+			continue
+		}
+		switch name {
+		case "KEYS":
+			merged.Multi = append(merged.Multi, rp.Multi...)
+		case "DBSIZE":
+			merged.Integer += rp.Integer
+		case "SCRIPT EXISTS":
+			for i := range merged.Multi {
+				if i < len(rp.Multi) && rp.Multi[i].Integer == 0 {
+					merged.Multi[i] = rp.Multi[i]
+				}
+			}
+		}
+	}
+	return merged, nil
+}
+
+// scan runs SCAN on the master of the cursor, and moves the cursor to the next master
+// when that one is done, so SCAN of a cluster iterates the masters one by one.
+func (c *redisCluster) scan(ctx context.Context, masters []string, args []interface{}) (*Reply, error) {
+	if len(args) < 2 {
+		return nil, errors.New("scan cursor required")
+	}
+	cursor, err := strconv.ParseUint(argString(args[1]), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	index := int(cursor & (1<<clusterScanShift - 1))
+	if index >= len(masters) {
+		return nil, errors.New("invalid scan cursor, the cluster masters changed")
+	}
+	nodeArgs := append([]interface{}{args[0], cursor >> clusterScanShift}, args[2:]...)
+	rp, err := c.executeNode(ctx, masters[index], nodeArgs)
+	if err != nil || rp.Type != MultiReply || len(rp.Multi) != 2 {
+		return rp, err
+	}
+	next, err := rp.Multi[0].StringValue()
+	if err != nil {
+		return nil, err
+	}
+	nodeCursor, err := strconv.ParseUint(next, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if nodeCursor == 0 {
+		index++
+		if index == len(masters) {
+			index = 0
+		}
+	}
+	next = strconv.FormatUint(nodeCursor<<clusterScanShift|uint64(index), 10)
+	rp.Multi[0] = &Reply{Type: BulkReply, Bulk: []byte(next)}
+	return rp, nil
+}
+
+// executeNode sends a command to the node of addr.
+func (c *redisCluster) executeNode(ctx context.Context, addr string, args []interface{}) (*Reply, error) {
+	node, err := c.node(addr)
+	if err != nil {
+		c.reloadAsync()
+		return nil, err
+	}
+	return execute(ctx, node.pool, args...)
+}
+
+// executeAsking sends ASKING and then the command on the same connection,
+// used to follow an ASK redirect while a slot is migrating.
+func (r *Redis) executeAsking(ctx context.Context, args ...interface{}) (*Reply, error) {
+	c, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.execute(ctx, "ASKING"); err != nil {
+		r.pool.Discard(c)
+		return nil, err
+	}
+	rp, err := c.execute(ctx, args...)
+	if err != nil {
+		r.pool.Discard(c)
+		return nil, err
+	}
+	r.pool.Put(c)
+	return rp, nil
+}
+
+// sleepContext sleeps d, or returns ctx.Err() as soon as ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if ctx == nil {
+		time.Sleep(d)
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// KeySlot returns the hash slot of key in a redis cluster.
+// If the key contains a non-empty {hashtag}, only the hashtag is hashed.
+func KeySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16([]byte(key)) % HashSlots)
+}
+
+// crc16 is the CRC16-CCITT(XMODEM) checksum used by redis cluster.
+func crc16(buf []byte) uint16 {
+	var crc uint16
+	for _, b := range buf {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// commandKeyIndex is the position of the first key for the commands
+// which do not take it as the first argument, -1 means no key at all.
+var commandKeyIndex = map[string]int{
+	"BGREWRITEAOF": -1,
+	"BGSAVE":       -1,
+	"BITOP":        2,
+	"CLIENT":       -1,
+	"CLUSTER":      -1,
+	"CONFIG":       -1,
+	"DBSIZE":       -1,
+	"DEBUG":        2,
+	"ECHO":         -1,
+	"FLUSHALL":     -1,
+	"FLUSHDB":      -1,
+	"INFO":         -1,
+	"KEYS":         -1,
+	"LASTSAVE":     -1,
+	"MEMORY":       2,
+	"OBJECT":       2,
+	"PING":         -1,
+	"PUBLISH":      -1,
+	"RANDOMKEY":    -1,
+	"SAVE":         -1,
+	"SCAN":         -1,
+	"SCRIPT":       -1,
+	"SHUTDOWN":     -1,
+	"SLAVEOF":      -1,
+	"SLOWLOG":      -1,
+	"TIME":         -1,
+	"XGROUP":       2,
+	"XINFO":        2,
+}
+
+// commandKey returns the key which decides the slot of the command.
+func commandKey(args []interface{}) (string, bool) {
+	if len(args) < 2 {
+		return "", false
+	}
+	name := strings.ToUpper(argString(args[0]))
+	switch name {
+	case "EVAL", "EVALSHA":
+		if len(args) > 3 && argString(args[2]) != "0" {
+			return argString(args[3]), true
+		}
+		return "", false
+	case "XREAD", "XREADGROUP":
+		for i := 1; i < len(args)-1; i++ {
+			if strings.ToUpper(argString(args[i])) == "STREAMS" {
+				return argString(args[i+1]), true
+			}
+		}
+		return "", false
+	}
+	index, ok := commandKeyIndex[name]
+	if !ok {
+		index = 1
+	}
+	if index < 0 || index >= len(args) {
+		return "", false
+	}
+	return argString(args[index]), true
+}
+
+func argString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(arg)
+}
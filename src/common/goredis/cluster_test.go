@@ -0,0 +1,447 @@
+package goredis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCluster is an in-process redis cluster which only knows
+// CLUSTER SLOTS, ASKING, PING, GET, SET, DEL and the commands of the keys of a node:
+// KEYS *, SCAN without MATCH, DBSIZE, FLUSHDB, RANDOMKEY and SCRIPT LOAD.
+type fakeCluster struct {
+	mutex     sync.Mutex
+	addrs     []string
+	listeners []net.Listener
+	owner     [HashSlots]int
+	importing map[int]int
+	served    []int
+	data      map[string]string
+	scripts   []int
+	cursors   []string // the last key returned by SCAN of a cursor
+}
+
+func newFakeCluster(t *testing.T, n int) *fakeCluster {
+	fc := &fakeCluster{importing: make(map[int]int), served: make([]int, n), scripts: make([]int, n), data: make(map[string]string)}
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fc.listeners = append(fc.listeners, l)
+		fc.addrs = append(fc.addrs, l.Addr().String())
+		go fc.serve(i, l)
+	}
+	for slot := 0; slot < HashSlots; slot++ {
+		fc.owner[slot] = slot * n / HashSlots
+	}
+	return fc
+}
+
+func (fc *fakeCluster) Close() {
+	for _, l := range fc.listeners {
+		l.Close()
+	}
+}
+
+func (fc *fakeCluster) servedBy(node int) int {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	return fc.served[node]
+}
+
+func (fc *fakeCluster) serve(node int, l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go fc.handle(node, conn)
+	}
+}
+
+func (fc *fakeCluster) handle(node int, conn net.Conn) {
+	defer conn.Close()
+	c := &connection{Conn: conn, Reader: bufio.NewReader(conn)}
+	asking := false
+	for {
+		rp, err := c.RecvReply()
+		if err != nil {
+			return
+		}
+		args, err := rp.ListValue()
+		if err != nil || len(args) == 0 {
+			return
+		}
+		reply := fc.command(node, args, asking)
+		asking = strings.ToUpper(args[0]) == "ASKING"
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (fc *fakeCluster) command(node int, args []string, asking bool) string {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "ASKING":
+		return "+OK\r\n"
+	case "CLUSTER":
+		var ranges []string
+		for start := 0; start < HashSlots; {
+			end := start
+			for end+1 < HashSlots && fc.owner[end+1] == fc.owner[start] {
+				end++
+			}
+			host, port, _ := net.SplitHostPort(fc.addrs[fc.owner[start]])
+			ranges = append(ranges, fmt.Sprintf("*3\r\n:%d\r\n:%d\r\n*2\r\n$%d\r\n%s\r\n:%s\r\n",
+				start, end, len(host), host, port))
+			start = end + 1
+		}
+		return "*" + strconv.Itoa(len(ranges)) + "\r\n" + strings.Join(ranges, "")
+	case "KEYS", "SCAN", "DBSIZE", "FLUSHDB", "RANDOMKEY":
+		return fc.nodeKeys(node, args)
+	case "SCRIPT":
+		fc.scripts[node]++
+		return "$3\r\nsha\r\n"
+	}
+	if len(args) < 2 {
+		return "-ERR wrong number of arguments\r\n"
+	}
+	slot := KeySlot(args[1])
+	if target, ok := fc.importing[slot]; ok && fc.owner[slot] == node && target != node {
+		return fmt.Sprintf("-ASK %d %s\r\n", slot, fc.addrs[target])
+	}
+	if fc.owner[slot] != node && !(asking && fc.importing[slot] == node) {
+		return fmt.Sprintf("-MOVED %d %s\r\n", slot, fc.addrs[fc.owner[slot]])
+	}
+	fc.served[node]++
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		value, ok := fc.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		fc.data[args[1]] = args[2]
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, key := range args[1:] {
+			if KeySlot(key) != slot {
+				return "-CROSSSLOT Keys in request don't hash to the same slot\r\n"
+			}
+		}
+		for _, key := range args[1:] {
+			if _, ok := fc.data[key]; ok {
+				delete(fc.data, key)
+				n++
+			}
+		}
+		return ":" + strconv.Itoa(n) + "\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+// nodeKeys runs a command of the keys of node, SCAN returns the keys after the last key of the cursor.
+func (fc *fakeCluster) nodeKeys(node int, args []string) string {
+	var keys []string
+	for key := range fc.data {
+		if fc.owner[KeySlot(key)] == node {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	bulks := func(keys []string) string {
+		reply := "*" + strconv.Itoa(len(keys)) + "\r\n"
+		for _, key := range keys {
+			reply += fmt.Sprintf("$%d\r\n%s\r\n", len(key), key)
+		}
+		return reply
+	}
+	switch strings.ToUpper(args[0]) {
+	case "KEYS":
+		return bulks(keys)
+	case "SCAN":
+		start := 0
+		if cursor, _ := strconv.Atoi(args[1]); cursor > 0 {
+			start = sort.SearchStrings(keys, fc.cursors[cursor-1]+"\x00")
+		}
+		end := start + 3
+		next := "0"
+		if end < len(keys) {
+			fc.cursors = append(fc.cursors, keys[end-1])
+			next = strconv.Itoa(len(fc.cursors))
+		} else {
+			end = len(keys)
+		}
+		return fmt.Sprintf("*2\r\n$%d\r\n%s\r\n", len(next), next) + bulks(keys[start:end])
+	case "DBSIZE":
+		return ":" + strconv.Itoa(len(keys)) + "\r\n"
+	case "FLUSHDB":
+		for _, key := range keys {
+			delete(fc.data, key)
+		}
+		return "+OK\r\n"
+	}
+	if len(keys) == 0 {
+		return "$-1\r\n"
+	}
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(keys[0]), keys[0])
+}
+
+func TestKeySlot(t *testing.T) {
+	if crc16([]byte("123456789")) != 0x31C3 {
+		t.Fail()
+	}
+	if KeySlot("foo") != 12182 || KeySlot("bar") != 5061 {
+		t.Fail()
+	}
+	if KeySlot("{user1000}.following") != KeySlot("{user1000}.followers") {
+		t.Fail()
+	}
+	if KeySlot("foo{}{bar}") != int(crc16([]byte("foo{}{bar}"))%HashSlots) {
+		t.Fail()
+	}
+	if KeySlot("foo{{bar}}zap") != KeySlot("{bar") {
+		t.Fail()
+	}
+}
+
+func TestCommandKey(t *testing.T) {
+	if key, ok := commandKey([]interface{}{"GET", "key"}); !ok || key != "key" {
+		t.Fail()
+	}
+	if _, ok := commandKey([]interface{}{"PING"}); ok {
+		t.Fail()
+	}
+	if key, ok := commandKey([]interface{}{"BITOP", "AND", "dest", "src"}); !ok || key != "dest" {
+		t.Fail()
+	}
+	if key, ok := commandKey([]interface{}{"EVAL", "return 1", 1, "key"}); !ok || key != "key" {
+		t.Fail()
+	}
+	if _, ok := commandKey([]interface{}{"EVAL", "return 1", 0}); ok {
+		t.Fail()
+	}
+	if key, ok := commandKey([]interface{}{"XREAD", "COUNT", 1, "STREAMS", "stream", "0"}); !ok || key != "stream" {
+		t.Fail()
+	}
+}
+
+func TestClusterRouting(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	defer fc.Close()
+	client, err := DialCluster(&ClusterConfig{Addrs: fc.addrs[:1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		if err := client.SimpleSet(key, strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+		if b, err := client.Get(key); err != nil {
+			t.Error(err)
+		} else if string(b) != strconv.Itoa(i) {
+			t.Fail()
+		}
+	}
+	for node := range fc.addrs {
+		if fc.servedBy(node) == 0 {
+			t.Errorf("node %d served nothing", node)
+		}
+	}
+}
+
+func TestClusterMoved(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	defer fc.Close()
+	client, err := DialCluster(&ClusterConfig{Addrs: fc.addrs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	if err := client.SimpleSet("foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	slot := KeySlot("foo")
+	fc.mutex.Lock()
+	fc.owner[slot] = (fc.owner[slot] + 1) % 3
+	fc.mutex.Unlock()
+	if b, err := client.Get("foo"); err != nil {
+		t.Error(err)
+	} else if string(b) != "bar" {
+		t.Fail()
+	}
+	if n, err := client.Del("foo"); err != nil {
+		t.Error(err)
+	} else if n != 1 {
+		t.Fail()
+	}
+}
+
+func TestClusterAsk(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	defer fc.Close()
+	client, err := DialCluster(&ClusterConfig{Addrs: fc.addrs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	slot := KeySlot("{tag}key")
+	fc.mutex.Lock()
+	target := (fc.owner[slot] + 1) % 2
+	fc.importing[slot] = target
+	fc.mutex.Unlock()
+	if err := client.SimpleSet("{tag}key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := client.Get("{tag}key"); err != nil {
+		t.Error(err)
+	} else if string(b) != "value" {
+		t.Fail()
+	}
+	if fc.servedBy(target) != 2 {
+		t.Fail()
+	}
+}
+
+func TestClusterKeyspace(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	defer fc.Close()
+	client, err := DialCluster(&ClusterConfig{Addrs: fc.addrs[:1], MaxActive: 4, IdleTimeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	for i := 0; i < 20; i++ {
+		if err := client.SimpleSet("key"+strconv.Itoa(i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for node := range fc.addrs {
+		if fc.servedBy(node) == 0 {
+			t.Fatalf("node %d has no key", node)
+		}
+	}
+
+	if keys, err := client.Keys("*"); err != nil || len(keys) != 20 {
+		t.Error(keys, err)
+	}
+	if n, err := client.DBSize(); err != nil || n != 20 {
+		t.Error(n, err)
+	}
+	if key, err := client.RandomKey(); err != nil || key == nil {
+		t.Error(key, err)
+	}
+	seen := make(map[string]bool)
+	iter := client.ScanIter("", 0)
+	for iter.Next() {
+		seen[iter.Val()] = true
+	}
+	if err := iter.Err(); err != nil || len(seen) != 20 {
+		t.Error(len(seen), err)
+	}
+	if sha, err := client.ScriptLoad("return 1"); err != nil || sha != "sha" {
+		t.Error(sha, err)
+	}
+	for node := range fc.addrs {
+		if fc.scripts[node] != 1 {
+			t.Errorf("script is not loaded on node %d", node)
+		}
+	}
+
+	if n, err := client.DelPattern("*", 5); err != nil || n != 20 {
+		t.Error(n, err)
+	}
+	if err := client.SimpleSet("foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.FlushDB(); err != nil {
+		t.Error(err)
+	}
+	if n, err := client.DBSize(); err != nil || n != 0 {
+		t.Error(n, err)
+	}
+	if key, err := client.RandomKey(); err != nil || key != nil {
+		t.Error(key, err)
+	}
+	if _, err := client.ExecuteCommand("SCRIPT", "KILL"); err == nil {
+		t.Error("SCRIPT KILL is sent to one master")
+	}
+}
+
+func TestClusterDialConfig(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	defer fc.Close()
+	cfg := &ClusterConfig{Addrs: fc.addrs, Username: "user", Timeout: time.Second, MaxActive: 3, WaitTimeout: 2 * time.Second, TestOnBorrow: true}
+	client, err := DialCluster(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	dial := client.cluster.dial
+	if dial.Username != "user" || dial.Timeout != time.Second || dial.MaxActive != 3 || dial.WaitTimeout != 2*time.Second || !dial.TestOnBorrow {
+		t.Errorf("%+v", dial)
+	}
+}
+
+func TestClusterPipeline(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	defer fc.Close()
+	client, err := DialCluster(&ClusterConfig{Addrs: fc.addrs[:1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	p := client.Pipeline()
+	for i := 0; i < 30; i++ {
+		p.Set("key"+strconv.Itoa(i), strconv.Itoa(i), 0, 0, false, false)
+	}
+	if err := p.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	for node := range fc.addrs {
+		if fc.servedBy(node) == 0 {
+			t.Errorf("node %d served nothing", node)
+		}
+	}
+
+	// foo is moved, and {tag}key is migrating
+	moved, migrating := KeySlot("foo"), KeySlot("{tag}key")
+	fc.mutex.Lock()
+	fc.data["foo"] = "bar"
+	fc.data["{tag}key"] = "value"
+	fc.owner[moved] = (fc.owner[moved] + 1) % 3
+	target := (fc.owner[migrating] + 1) % 3
+	fc.importing[migrating] = target
+	fc.mutex.Unlock()
+	served := fc.servedBy(target)
+	var gets []*BytesCmd
+	for _, key := range []string{"foo", "{tag}key", "key0", "key29"} {
+		gets = append(gets, p.Get(key))
+	}
+	if err := p.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"bar", "value", "0", "29"} {
+		if b, err := gets[i].Result(); err != nil || string(b) != want {
+			t.Errorf("%d: %q, %v, want %q", i, b, err, want)
+		}
+	}
+	if fc.servedBy(target) == served {
+		t.Error("the ASK redirect is not followed")
+	}
+}
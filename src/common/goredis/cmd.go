@@ -0,0 +1,284 @@
+package goredis
+
+import (
+	"errors"
+)
+
+// ErrNotExecuted is the error of a queued command before its Pipeline is executed.
+var ErrNotExecuted = errors.New("command not executed")
+
+// Cmder is a command queued in a Pipeline, such as *IntCmd or *StringMapCmd.
+// The result of the command is available after Pipeline.Exec.
+type Cmder interface {
+	// Args returns the arguments of the command, the name of the command is the first one.
+	Args() []interface{}
+	// Err returns the error of the command: the error reply of redis,
+	// the reply of an unexpected type, or the connection error if the reply was not received.
+	Err() error
+	// Reply returns the raw reply, nil if it was not received.
+	Reply() *Reply
+
+	setReply(rp *Reply)
+	setErr(err error)
+}
+
+type baseCmd struct {
+	args []interface{}
+	rp   *Reply
+	err  error
+}
+
+func newBaseCmd(args []interface{}) baseCmd {
+	return baseCmd{args: args, err: ErrNotExecuted}
+}
+
+// Args returns the arguments of the command.
+func (c *baseCmd) Args() []interface{} {
+	return c.args
+}
+
+// Err returns the error of the command, ErrNotExecuted before the Pipeline is executed.
+func (c *baseCmd) Err() error {
+	return c.err
+}
+
+// Reply returns the raw reply of the command.
+func (c *baseCmd) Reply() *Reply {
+	return c.rp
+}
+
+func (c *baseCmd) setErr(err error) {
+	c.err = err
+}
+
+// Cmd is a command whose reply is kept as is, an error reply is returned by Err.
+type Cmd struct {
+	baseCmd
+}
+
+func (c *Cmd) setReply(rp *Reply) {
+	c.rp, c.err = rp, nil
+	if rp.Type == ErrorReply {
+		c.err = errors.New(rp.Error)
+	}
+}
+
+// Val returns the reply.
+func (c *Cmd) Val() *Reply {
+	return c.rp
+}
+
+// Result returns the reply and the error of the command.
+func (c *Cmd) Result() (*Reply, error) {
+	return c.rp, c.err
+}
+
+// StatusCmd is a command of status reply, such as SET or RENAME.
+type StatusCmd struct {
+	baseCmd
+	val string
+}
+
+func (c *StatusCmd) setReply(rp *Reply) {
+	c.rp = rp
+	c.val, c.err = rp.StatusValue()
+}
+
+// Val returns the status.
+func (c *StatusCmd) Val() string {
+	return c.val
+}
+
+// Result returns the status and the error of the command.
+func (c *StatusCmd) Result() (string, error) {
+	return c.val, c.err
+}
+
+// IntCmd is a command of integer reply, such as INCR or LPUSH.
+type IntCmd struct {
+	baseCmd
+	val int64
+}
+
+func (c *IntCmd) setReply(rp *Reply) {
+	c.rp = rp
+	c.val, c.err = rp.IntegerValue()
+}
+
+// Val returns the integer.
+func (c *IntCmd) Val() int64 {
+	return c.val
+}
+
+// Result returns the integer and the error of the command.
+func (c *IntCmd) Result() (int64, error) {
+	return c.val, c.err
+}
+
+// BoolCmd is a command of integer reply used as true or false, such as EXISTS or SISMEMBER.
+type BoolCmd struct {
+	baseCmd
+	val bool
+}
+
+func (c *BoolCmd) setReply(rp *Reply) {
+	c.rp = rp
+	c.val, c.err = rp.BoolValue()
+}
+
+// Val returns the bool.
+func (c *BoolCmd) Val() bool {
+	return c.val
+}
+
+// Result returns the bool and the error of the command.
+func (c *BoolCmd) Result() (bool, error) {
+	return c.val, c.err
+}
+
+// FloatCmd is a command of double reply, such as INCRBYFLOAT or ZINCRBY.
+type FloatCmd struct {
+	baseCmd
+	val float64
+}
+
+func (c *FloatCmd) setReply(rp *Reply) {
+	c.rp = rp
+	c.val, c.err = rp.FloatValue()
+}
+
+// Val returns the float.
+func (c *FloatCmd) Val() float64 {
+	return c.val
+}
+
+// Result returns the float and the error of the command.
+func (c *FloatCmd) Result() (float64, error) {
+	return c.val, c.err
+}
+
+// BytesCmd is a command of bulk reply which maybe nil, such as GET or HGET.
+type BytesCmd struct {
+	baseCmd
+	val []byte
+}
+
+func (c *BytesCmd) setReply(rp *Reply) {
+	c.rp = rp
+	c.val, c.err = rp.BytesValue()
+}
+
+// Val returns the bulk, nil for the nil bulk.
+func (c *BytesCmd) Val() []byte {
+	return c.val
+}
+
+// Result returns the bulk and the error of the command.
+func (c *BytesCmd) Result() ([]byte, error) {
+	return c.val, c.err
+}
+
+// StringCmd is a command of bulk reply which should not be nil, such as GETRANGE.
+type StringCmd struct {
+	baseCmd
+	val string
+}
+
+func (c *StringCmd) setReply(rp *Reply) {
+	c.rp = rp
+	c.val, c.err = rp.StringValue()
+}
+
+// Val returns the string.
+func (c *StringCmd) Val() string {
+	return c.val
+}
+
+// Result returns the string and the error of the command.
+func (c *StringCmd) Result() (string, error) {
+	return c.val, c.err
+}
+
+// BytesSliceCmd is a command of multi bulk reply whose elements maybe nil, such as MGET or HMGET.
+type BytesSliceCmd struct {
+	baseCmd
+	val [][]byte
+}
+
+func (c *BytesSliceCmd) setReply(rp *Reply) {
+	c.rp = rp
+	c.val, c.err = rp.BytesArrayValue()
+}
+
+// Val returns the bulks.
+func (c *BytesSliceCmd) Val() [][]byte {
+	return c.val
+}
+
+// Result returns the bulks and the error of the command.
+func (c *BytesSliceCmd) Result() ([][]byte, error) {
+	return c.val, c.err
+}
+
+// StringSliceCmd is a command of multi bulk reply, such as LRANGE or ZRANGEBYSCORE.
+type StringSliceCmd struct {
+	baseCmd
+	val []string
+}
+
+func (c *StringSliceCmd) setReply(rp *Reply) {
+	c.rp = rp
+	c.val, c.err = rp.ListValue()
+}
+
+// Val returns the list.
+func (c *StringSliceCmd) Val() []string {
+	return c.val
+}
+
+// Result returns the list and the error of the command.
+func (c *StringSliceCmd) Result() ([]string, error) {
+	return c.val, c.err
+}
+
+// StringMapCmd is a command of multi bulk reply of field value pairs, such as HGETALL.
+type StringMapCmd struct {
+	baseCmd
+	val map[string]string
+}
+
+func (c *StringMapCmd) setReply(rp *Reply) {
+	c.rp = rp
+	c.val, c.err = rp.HashValue()
+}
+
+// Val returns the map.
+func (c *StringMapCmd) Val() map[string]string {
+	return c.val
+}
+
+// Result returns the map and the error of the command.
+func (c *StringMapCmd) Result() (map[string]string, error) {
+	return c.val, c.err
+}
+
+// BoolSliceCmd is a command of multi bulk reply of integers used as true or false, such as SCRIPT EXISTS.
+type BoolSliceCmd struct {
+	baseCmd
+	val []bool
+}
+
+func (c *BoolSliceCmd) setReply(rp *Reply) {
+	c.rp = rp
+	c.val, c.err = rp.BoolArrayValue()
+}
+
+// Val returns the bools.
+func (c *BoolSliceCmd) Val() []bool {
+	return c.val
+}
+
+// Result returns the bools and the error of the command.
+func (c *BoolSliceCmd) Result() ([]bool, error) {
+	return c.val, c.err
+}
@@ -0,0 +1,31 @@
+package goredis
+
+import (
+	"testing"
+)
+
+func TestCmdReply(t *testing.T) {
+	hash := &StringMapCmd{baseCmd: newBaseCmd([]interface{}{"HGETALL", "key"})}
+	hash.setReply(&Reply{Type: MultiReply, Multi: []*Reply{
+		{Type: BulkReply, Bulk: []byte("field")},
+		{Type: BulkReply, Bulk: []byte("value")},
+	}})
+	if m, err := hash.Result(); err != nil || m["field"] != "value" {
+		t.Error(m, err)
+	}
+	n := &IntCmd{baseCmd: newBaseCmd([]interface{}{"INCR", "key"})}
+	n.setReply(&Reply{Type: BulkReply, Bulk: []byte("1")})
+	if n.Err() == nil {
+		t.Error("unexpected reply type accepted")
+	}
+	cmd := &Cmd{newBaseCmd([]interface{}{"GET", "key"})}
+	cmd.setReply(&Reply{Type: ErrorReply, Error: "WRONGTYPE"})
+	if cmd.Err() == nil || cmd.Err().Error() != "WRONGTYPE" || cmd.Val() == nil {
+		t.Error(cmd.Result())
+	}
+	f := &FloatCmd{baseCmd: newBaseCmd(nil)}
+	f.setReply(&Reply{Type: DoubleReply, Double: 1.5})
+	if f.Val() != 1.5 {
+		t.Error(f.Val())
+	}
+}
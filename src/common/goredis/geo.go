@@ -0,0 +1,259 @@
+package goredis
+
+import (
+	"errors"
+)
+
+// GeoLocation is a member of a geospatial index.
+// Dist and GeoHash are only filled by the queries asked for them.
+type GeoLocation struct {
+	Name      string
+	Longitude float64
+	Latitude  float64
+	Dist      float64
+	GeoHash   int64
+}
+
+// GeoQuery is the query of GeoRadius, GeoSearch and GeoSearchStore.
+// The center is Member if it is not empty, else Longitude and Latitude.
+// The area is a circle of Radius, or a box of Width and Height for GeoSearch if Radius is 0.
+// Unit is one of m, km, ft and mi, m if empty. Sort is ASC, DESC or empty for unsorted.
+// Count limits the number of the results if it is positive, Any returns as soon as Count matches are found.
+type GeoQuery struct {
+	Member    string
+	Longitude float64
+	Latitude  float64
+	Radius    float64
+	Width     float64
+	Height    float64
+	Unit      string
+	WithCoord bool
+	WithDist  bool
+	WithHash  bool
+	Count     int
+	Any       bool
+	Sort      string
+}
+
+func (q *GeoQuery) unit() string {
+	if q.Unit == "" {
+		return "m"
+	}
+	return q.Unit
+}
+
+// searchArgs returns the arguments of GEOSEARCH after the key.
+func (q *GeoQuery) searchArgs() []interface{} {
+	var args []interface{}
+	if q.Member != "" {
+		args = append(args, "FROMMEMBER", q.Member)
+	} else {
+		args = append(args, "FROMLONLAT", q.Longitude, q.Latitude)
+	}
+	if q.Radius > 0 {
+		args = append(args, "BYRADIUS", q.Radius, q.unit())
+	} else {
+		args = append(args, "BYBOX", q.Width, q.Height, q.unit())
+	}
+	return append(args, q.options()...)
+}
+
+// options returns the COUNT and the sort options.
+func (q *GeoQuery) options() []interface{} {
+	var args []interface{}
+	if q.Count > 0 {
+		args = append(args, "COUNT", q.Count)
+		if q.Any {
+			args = append(args, "ANY")
+		}
+	}
+	if q.Sort != "" {
+		args = append(args, q.Sort)
+	}
+	return args
+}
+
+// withArgs returns the WITHCOORD, WITHDIST and WITHHASH options.
+func (q *GeoQuery) withArgs() []interface{} {
+	var args []interface{}
+	if q.WithDist {
+		args = append(args, "WITHDIST")
+	}
+	if q.WithHash {
+		args = append(args, "WITHHASH")
+	}
+	if q.WithCoord {
+		args = append(args, "WITHCOORD")
+	}
+	return args
+}
+
+// parseLocations parses the reply of GEORADIUS and GEOSEARCH,
+// every item is the name, or an array of the name, dist, hash and coordinates if they are asked for.
+func (q *GeoQuery) parseLocations(rp *Reply) ([]*GeoLocation, error) {
+	items, err := rp.MultiValue()
+	if err != nil {
+		return nil, err
+	}
+	locations := make([]*GeoLocation, 0, len(items))
+	for _, item := range items {
+		location := new(GeoLocation)
+		if !item.isMulti() {
+			if location.Name, err = item.StringValue(); err != nil {
+				return nil, err
+			}
+			locations = append(locations, location)
+			continue
+		}
+		fields := item.Multi
+		if len(fields) == 0 {
+			return nil, errors.New("invalid geo location reply")
+		}
+		if location.Name, err = fields[0].StringValue(); err != nil {
+			return nil, err
+		}
+		fields = fields[1:]
+		if q.WithDist && len(fields) > 0 {
+			if location.Dist, err = fields[0].FloatValue(); err != nil {
+				return nil, err
+			}
+			fields = fields[1:]
+		}
+		if q.WithHash && len(fields) > 0 {
+			if location.GeoHash, err = fields[0].IntegerValue(); err != nil {
+				return nil, err
+			}
+			fields = fields[1:]
+		}
+		if q.WithCoord && len(fields) > 0 {
+			if err := parseCoordinates(fields[0], location); err != nil {
+				return nil, err
+			}
+		}
+		locations = append(locations, location)
+	}
+	return locations, nil
+}
+
+func parseCoordinates(rp *Reply, location *GeoLocation) error {
+	if !rp.isMulti() || len(rp.Multi) != 2 {
+		return errors.New("invalid geo coordinates reply")
+	}
+	var err error
+	if location.Longitude, err = rp.Multi[0].FloatValue(); err != nil {
+		return err
+	}
+	location.Latitude, err = rp.Multi[1].FloatValue()
+	return err
+}
+
+// GeoAdd adds the specified geospatial items (longitude, latitude, name) to the specified key.
+// Integer reply: the number of elements added to the sorted set,
+// not including elements already existing for which the score was updated.
+func (r *Redis) GeoAdd(key string, locations ...*GeoLocation) (int64, error) {
+	args := packArgs("GEOADD", key)
+	for _, location := range locations {
+		args = append(args, location.Longitude, location.Latitude, location.Name)
+	}
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return 0, err
+	}
+	return rp.IntegerValue()
+}
+
+// GeoDist returns the distance between two members in the geospatial index represented by the sorted set.
+// Unit is one of m, km, ft and mi, m if empty.
+// -1 is returned if one or both the members are missing.
+func (r *Redis) GeoDist(key, member1, member2, unit string) (float64, error) {
+	args := packArgs("GEODIST", key, member1, member2, unit)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return -1, err
+	}
+	if rp.Type == NilReply || rp.Type == BulkReply && rp.Bulk == nil {
+		return -1, nil
+	}
+	return rp.FloatValue()
+}
+
+// GeoHash returns valid Geohash strings representing the position of the members.
+// The string of a missing member is empty.
+func (r *Redis) GeoHash(key string, members ...string) ([]string, error) {
+	args := packArgs("GEOHASH", key, members)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	return rp.ListValue()
+}
+
+// GeoPos returns the positions (longitude, latitude) of the members.
+// The location of a missing member is nil.
+func (r *Redis) GeoPos(key string, members ...string) ([]*GeoLocation, error) {
+	args := packArgs("GEOPOS", key, members)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	items, err := rp.MultiValue()
+	if err != nil {
+		return nil, err
+	}
+	locations := make([]*GeoLocation, len(items))
+	for i, item := range items {
+		if item.isNilMulti() {
+			continue
+		}
+		location := &GeoLocation{Name: members[i]}
+		if err := parseCoordinates(item, location); err != nil {
+			return nil, err
+		}
+		locations[i] = location
+	}
+	return locations, nil
+}
+
+// GeoRadius returns the members of a geospatial index which are within the Radius of the query,
+// by GEORADIUSBYMEMBER if the query has a Member, else by GEORADIUS.
+func (r *Redis) GeoRadius(key string, query *GeoQuery) ([]*GeoLocation, error) {
+	var args []interface{}
+	if query.Member != "" {
+		args = packArgs("GEORADIUSBYMEMBER", key, query.Member, query.Radius, query.unit())
+	} else {
+		args = packArgs("GEORADIUS", key, query.Longitude, query.Latitude, query.Radius, query.unit())
+	}
+	args = append(args, query.withArgs()...)
+	args = append(args, query.options()...)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	return query.parseLocations(rp)
+}
+
+// GeoSearch returns the members of a geospatial index which are within the circle or the box of the query.
+func (r *Redis) GeoSearch(key string, query *GeoQuery) ([]*GeoLocation, error) {
+	args := packArgs("GEOSEARCH", key, query.searchArgs(), query.withArgs())
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	return query.parseLocations(rp)
+}
+
+// GeoSearchStore is like GeoSearch, but stores the result in destination,
+// with the distances from the center as the scores if storeDist is true.
+// The WITH options of the query are ignored.
+// Integer reply: the number of elements in the resulting set.
+func (r *Redis) GeoSearchStore(destination, source string, query *GeoQuery, storeDist bool) (int64, error) {
+	args := packArgs("GEOSEARCHSTORE", destination, source, query.searchArgs())
+	if storeDist {
+		args = append(args, "STOREDIST")
+	}
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return 0, err
+	}
+	return rp.IntegerValue()
+}
@@ -0,0 +1,112 @@
+package goredis
+
+import (
+	"math"
+	"testing"
+)
+
+func addSicily(t *testing.T) {
+	r.Del("key")
+	n, err := r.GeoAdd("key",
+		&GeoLocation{Name: "Palermo", Longitude: 13.361389, Latitude: 38.115556},
+		&GeoLocation{Name: "Catania", Longitude: 15.087269, Latitude: 37.502669})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatal(n)
+	}
+}
+
+func closeTo(a, b, delta float64) bool {
+	return math.Abs(a-b) <= delta
+}
+
+func TestGeoAdd(t *testing.T) {
+	addSicily(t)
+	if n, err := r.GeoAdd("key", &GeoLocation{Name: "Palermo", Longitude: 13.361389, Latitude: 38.115556}); err != nil || n != 0 {
+		t.Error(n, err)
+	}
+	if _, err := r.GeoAdd("key", &GeoLocation{Name: "invalid", Longitude: 200, Latitude: 38}); err == nil {
+		t.Error("invalid longitude accepted")
+	}
+}
+
+func TestGeoDist(t *testing.T) {
+	addSicily(t)
+	if dist, err := r.GeoDist("key", "Palermo", "Catania", ""); err != nil || !closeTo(dist, 166274.1516, 0.01) {
+		t.Error(dist, err)
+	}
+	if dist, err := r.GeoDist("key", "Palermo", "Catania", "km"); err != nil || !closeTo(dist, 166.2742, 0.001) {
+		t.Error(dist, err)
+	}
+	if dist, err := r.GeoDist("key", "Palermo", "Nowhere", "km"); err != nil || dist != -1 {
+		t.Error(dist, err)
+	}
+}
+
+func TestGeoHash(t *testing.T) {
+	addSicily(t)
+	hashes, err := r.GeoHash("key", "Palermo", "Catania", "Nowhere")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 3 || hashes[0] != "sqc8b49rny0" || hashes[1] != "sqdtr74hyu0" || hashes[2] != "" {
+		t.Error(hashes)
+	}
+}
+
+func TestGeoPos(t *testing.T) {
+	addSicily(t)
+	locations, err := r.GeoPos("key", "Palermo", "Nowhere")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 2 || locations[1] != nil {
+		t.Fatal(locations)
+	}
+	if l := locations[0]; l.Name != "Palermo" || !closeTo(l.Longitude, 13.361389, 1e-5) || !closeTo(l.Latitude, 38.115556, 1e-5) {
+		t.Error(l)
+	}
+}
+
+func TestGeoRadius(t *testing.T) {
+	addSicily(t)
+	locations, err := r.GeoRadius("key", &GeoQuery{Longitude: 15, Latitude: 37, Radius: 200, Unit: "km", WithDist: true, Sort: "ASC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 2 || locations[0].Name != "Catania" || !closeTo(locations[0].Dist, 56.4413, 0.001) ||
+		locations[1].Name != "Palermo" || !closeTo(locations[1].Dist, 190.4424, 0.001) {
+		t.Error(locations)
+	}
+	locations, err = r.GeoRadius("key", &GeoQuery{Member: "Palermo", Radius: 100, Unit: "km"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 || locations[0].Name != "Palermo" {
+		t.Error(locations)
+	}
+}
+
+func TestGeoSearch(t *testing.T) {
+	addSicily(t)
+	query := &GeoQuery{Longitude: 15, Latitude: 37, Width: 400, Height: 400, Unit: "km", WithCoord: true, WithHash: true, Sort: "DESC", Count: 1}
+	locations, err := r.GeoSearch("key", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 {
+		t.Fatal(locations)
+	}
+	if l := locations[0]; l.Name != "Palermo" || l.GeoHash != 3479099956230698 || !closeTo(l.Longitude, 13.361389, 1e-5) {
+		t.Error(l)
+	}
+	r.Del("key2")
+	if n, err := r.GeoSearchStore("key2", "key", &GeoQuery{Member: "Catania", Radius: 100, Unit: "km"}, true); err != nil || n != 1 {
+		t.Error(n, err)
+	}
+	if score, err := r.ZScore("key2", "Catania"); err != nil || string(score) != "0" {
+		t.Error(string(score), err)
+	}
+}
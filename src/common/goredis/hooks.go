@@ -0,0 +1,339 @@
+package goredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"common/logging"
+)
+
+// CommandInfo describes a command processed by Redis.ExecuteCommand or a command of Pipeline.Exec for the hooks.
+type CommandInfo struct {
+	// Name is the command name in upper case, such as GET.
+	Name string
+	// Args are all the arguments, Args[0] is the command name.
+	Args []interface{}
+	// Start is the time the command started.
+	Start time.Time
+	// Duration is the time the command took, for a pipeline the time of the whole Exec.
+	// It is set for AfterProcess and AfterProcessPipeline.
+	Duration time.Duration
+	// ReplyType is the type of the reply, such as BulkReply, or -1 if the reply was not received.
+	ReplyType int
+	// Err is the connection error, the error reply or the reply error of a pipelined command.
+	Err error
+}
+
+// Hook is called around the commands of a Redis, see Redis.AddHook.
+// BeforeProcess returns the context passed to AfterProcess, so a hook can keep a span in it for tracing.
+// The pipeline variants are called around Pipeline.Exec with the info of every queued command.
+type Hook interface {
+	BeforeProcess(ctx context.Context, cmd *CommandInfo) context.Context
+	AfterProcess(ctx context.Context, cmd *CommandInfo)
+	BeforeProcessPipeline(ctx context.Context, cmds []*CommandInfo) context.Context
+	AfterProcessPipeline(ctx context.Context, cmds []*CommandInfo)
+}
+
+// hookList is the hooks shared by a Redis and its views.
+type hookList struct {
+	mutex sync.Mutex
+	hooks atomic.Value
+}
+
+func (l *hookList) get() []Hook {
+	if l == nil {
+		return nil
+	}
+	hooks, _ := l.hooks.Load().([]Hook)
+	return hooks
+}
+
+func (l *hookList) add(h Hook) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	hooks := l.get()
+	l.hooks.Store(append(hooks[:len(hooks):len(hooks)], h))
+}
+
+// AddHook adds h to the client and its views, the hooks are called in the order they are added
+// before a command, and in the reverse order after it.
+// Only the commands of ExecuteCommand, which all the command methods use, and Pipeline.Exec are hooked,
+// Pipelining, Transaction, PubSub and Monitor are not.
+func (r *Redis) AddHook(h Hook) {
+	r.hooks.add(h)
+}
+
+func newCommandInfo(args []interface{}, start time.Time) *CommandInfo {
+	info := &CommandInfo{Args: args, Start: start, ReplyType: -1}
+	if len(args) > 0 {
+		info.Name = strings.ToUpper(argString(args[0]))
+	}
+	return info
+}
+
+// finish sets the result of the command.
+func (info *CommandInfo) finish(rp *Reply, err error) {
+	info.Duration = time.Since(info.Start)
+	if rp != nil {
+		info.ReplyType = rp.Type
+		if err == nil && rp.Type == ErrorReply {
+			err = errors.New(rp.Error)
+		}
+	}
+	info.Err = err
+}
+
+// processHooks runs f between the hooks of a command.
+func (r *Redis) processHooks(hooks []Hook, args []interface{}, f func() (*Reply, error)) (*Reply, error) {
+	ctx := r.Context()
+	info := newCommandInfo(args, time.Now())
+	for _, h := range hooks {
+		ctx = h.BeforeProcess(ctx, info)
+	}
+	rp, err := f()
+	info.finish(rp, err)
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i].AfterProcess(ctx, info)
+	}
+	return rp, err
+}
+
+// processPipelineHooks runs f between the pipeline hooks of cmds.
+func (r *Redis) processPipelineHooks(hooks []Hook, cmds []Cmder, f func() error) error {
+	ctx := r.Context()
+	start := time.Now()
+	infos := make([]*CommandInfo, len(cmds))
+	for i, cmd := range cmds {
+		infos[i] = newCommandInfo(cmd.Args(), start)
+	}
+	for _, h := range hooks {
+		ctx = h.BeforeProcessPipeline(ctx, infos)
+	}
+	err := f()
+	for i, cmd := range cmds {
+		infos[i].finish(cmd.Reply(), cmd.Err())
+	}
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i].AfterProcessPipeline(ctx, infos)
+	}
+	return err
+}
+
+// SlowLogHook logs the commands slower than Threshold as warnings.
+type SlowLogHook struct {
+	Threshold time.Duration
+	Logger    *logging.Logger
+	// MaxArgLen truncates the logged arguments, the default is 64 bytes.
+	MaxArgLen int
+}
+
+// NewSlowLogHook returns a SlowLogHook of threshold, logging to logger or logging.DefaultLogger if it is nil.
+func NewSlowLogHook(threshold time.Duration, logger *logging.Logger) *SlowLogHook {
+	if logger == nil {
+		logger = logging.DefaultLogger
+	}
+	return &SlowLogHook{Threshold: threshold, Logger: logger, MaxArgLen: 64}
+}
+
+// BeforeProcess implements Hook.
+func (h *SlowLogHook) BeforeProcess(ctx context.Context, cmd *CommandInfo) context.Context {
+	return ctx
+}
+
+// AfterProcess implements Hook.
+func (h *SlowLogHook) AfterProcess(ctx context.Context, cmd *CommandInfo) {
+	if cmd.Duration < h.Threshold {
+		return
+	}
+	if cmd.Err != nil {
+		h.Logger.Warning("redis slow command %s took %s, error: %s", h.format(cmd.Args), cmd.Duration, cmd.Err)
+	} else {
+		h.Logger.Warning("redis slow command %s took %s", h.format(cmd.Args), cmd.Duration)
+	}
+}
+
+// BeforeProcessPipeline implements Hook.
+func (h *SlowLogHook) BeforeProcessPipeline(ctx context.Context, cmds []*CommandInfo) context.Context {
+	return ctx
+}
+
+// AfterProcessPipeline implements Hook.
+func (h *SlowLogHook) AfterProcessPipeline(ctx context.Context, cmds []*CommandInfo) {
+	if len(cmds) == 0 || cmds[0].Duration < h.Threshold {
+		return
+	}
+	names := make([]string, 0, len(cmds))
+	for i, cmd := range cmds {
+		if i == 10 {
+			names = append(names, "...")
+			break
+		}
+		names = append(names, cmd.Name)
+	}
+	h.Logger.Warning("redis slow pipeline of %d commands [%s] took %s", len(cmds), strings.Join(names, " "), cmds[0].Duration)
+}
+
+// format returns the arguments joined by spaces, the long arguments are truncated.
+func (h *SlowLogHook) format(args []interface{}) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		s := argString(arg)
+		if h.MaxArgLen > 0 && len(s) > h.MaxArgLen {
+			s = fmt.Sprintf("%s...(%d bytes)", s[:h.MaxArgLen], len(s))
+		}
+		parts[i] = s
+	}
+	return strings.Join(parts, " ")
+}
+
+// DefaultLatencyBuckets are the upper bounds of the buckets of LatencyHook.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// LatencyStats is the latency histogram of a command.
+// Counts[i] is the number of calls not slower than Buckets[i],
+// the last count, one more than the buckets, is the number of the slower calls.
+type LatencyStats struct {
+	Count   int64
+	Errors  int64
+	Total   time.Duration
+	Max     time.Duration
+	Buckets []time.Duration
+	Counts  []int64
+}
+
+// Mean returns the average latency.
+func (s *LatencyStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// Percentile returns the upper bound of the bucket of the percentile p (0-100),
+// Max if it falls in the last bucket.
+func (s *LatencyStats) Percentile(p float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := int64(float64(s.Count)*p/100 + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var n int64
+	for i, bound := range s.Buckets {
+		if n += s.Counts[i]; n >= rank {
+			return bound
+		}
+	}
+	return s.Max
+}
+
+func (s *LatencyStats) add(d time.Duration, err error) {
+	s.Count++
+	if err != nil {
+		s.Errors++
+	}
+	s.Total += d
+	if d > s.Max {
+		s.Max = d
+	}
+	i := sort.Search(len(s.Buckets), func(i int) bool { return d <= s.Buckets[i] })
+	s.Counts[i]++
+}
+
+// LatencyHook aggregates the latency histograms of the commands by name,
+// the pipelines are aggregated as PIPELINE.
+type LatencyHook struct {
+	mutex   sync.Mutex
+	buckets []time.Duration
+	stats   map[string]*LatencyStats
+}
+
+// NewLatencyHook returns a LatencyHook of the ascending bucket bounds, DefaultLatencyBuckets if none is given.
+func NewLatencyHook(buckets ...time.Duration) *LatencyHook {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	return &LatencyHook{
+		buckets: append([]time.Duration(nil), buckets...),
+		stats:   make(map[string]*LatencyStats),
+	}
+}
+
+func (h *LatencyHook) record(name string, d time.Duration, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	s, ok := h.stats[name]
+	if !ok {
+		s = &LatencyStats{Buckets: h.buckets, Counts: make([]int64, len(h.buckets)+1)}
+		h.stats[name] = s
+	}
+	s.add(d, err)
+}
+
+// Stats returns a copy of the histograms by command name.
+func (h *LatencyHook) Stats() map[string]LatencyStats {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	stats := make(map[string]LatencyStats, len(h.stats))
+	for name, s := range h.stats {
+		c := *s
+		c.Counts = append([]int64(nil), s.Counts...)
+		stats[name] = c
+	}
+	return stats
+}
+
+// Reset clears the histograms.
+func (h *LatencyHook) Reset() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.stats = make(map[string]*LatencyStats)
+}
+
+// BeforeProcess implements Hook.
+func (h *LatencyHook) BeforeProcess(ctx context.Context, cmd *CommandInfo) context.Context {
+	return ctx
+}
+
+// AfterProcess implements Hook.
+func (h *LatencyHook) AfterProcess(ctx context.Context, cmd *CommandInfo) {
+	h.record(cmd.Name, cmd.Duration, cmd.Err)
+}
+
+// BeforeProcessPipeline implements Hook.
+func (h *LatencyHook) BeforeProcessPipeline(ctx context.Context, cmds []*CommandInfo) context.Context {
+	return ctx
+}
+
+// AfterProcessPipeline implements Hook.
+func (h *LatencyHook) AfterProcessPipeline(ctx context.Context, cmds []*CommandInfo) {
+	if len(cmds) == 0 {
+		return
+	}
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err != nil {
+			err = cmd.Err
+			break
+		}
+	}
+	h.record("PIPELINE", cmds[0].Duration, err)
+}
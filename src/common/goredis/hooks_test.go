@@ -0,0 +1,161 @@
+package goredis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"common/logging"
+)
+
+type recordHook struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+type hookKey struct{}
+
+func (h *recordHook) record(event string) {
+	h.mutex.Lock()
+	h.events = append(h.events, event)
+	h.mutex.Unlock()
+}
+
+func (h *recordHook) BeforeProcess(ctx context.Context, cmd *CommandInfo) context.Context {
+	h.record("before " + cmd.Name)
+	return context.WithValue(ctx, hookKey{}, cmd.Name)
+}
+
+func (h *recordHook) AfterProcess(ctx context.Context, cmd *CommandInfo) {
+	if ctx.Value(hookKey{}) != cmd.Name {
+		h.record("context lost")
+	}
+	if cmd.Err != nil {
+		h.record("after " + cmd.Name + " " + cmd.Err.Error())
+	} else {
+		h.record("after " + cmd.Name)
+	}
+}
+
+func (h *recordHook) BeforeProcessPipeline(ctx context.Context, cmds []*CommandInfo) context.Context {
+	h.record("before pipeline")
+	return ctx
+}
+
+func (h *recordHook) AfterProcessPipeline(ctx context.Context, cmds []*CommandInfo) {
+	for _, cmd := range cmds {
+		h.record("pipelined " + cmd.Name)
+	}
+}
+
+func newHookClient(t *testing.T) *Redis {
+	client, err := Dial(&DialConfig{Network: network, Address: address, Database: db, Password: password, Timeout: timeout, MaxIdle: maxidle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestHooks(t *testing.T) {
+	client := newHookClient(t)
+	defer client.ClosePool()
+	view := client.WithContext(context.Background())
+	hook := &recordHook{}
+	client.AddHook(hook)
+	view.Set("key", "value", 0, 0, false, false)
+	client.LPush("key", "value")
+	p := client.Pipeline()
+	p.Get("key")
+	p.Incr("key")
+	p.Exec()
+	expected := []string{
+		"before SET", "after SET",
+		"before LPUSH", "after LPUSH WRONGTYPE Operation against a key holding the wrong kind of value",
+		"before pipeline", "pipelined GET", "pipelined INCR",
+	}
+	if strings.Join(hook.events, ",") != strings.Join(expected, ",") {
+		t.Error(hook.events)
+	}
+}
+
+type recordEmitter struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (e *recordEmitter) Emit(name string, rd *logging.Record) {
+	e.mutex.Lock()
+	e.messages = append(e.messages, rd.Message)
+	e.mutex.Unlock()
+}
+
+func TestSlowLogHook(t *testing.T) {
+	client := newHookClient(t)
+	defer client.ClosePool()
+	emitter := &recordEmitter{}
+	logger := logging.NewLogger()
+	logger.AddHandler("record", emitter)
+	hook := NewSlowLogHook(0, logger)
+	hook.MaxArgLen = 4
+	client.AddHook(hook)
+	client.Set("key", "long value", 0, 0, false, false)
+	p := client.Pipeline()
+	p.Get("key")
+	p.Exec()
+	if len(emitter.messages) != 2 {
+		t.Fatal(emitter.messages)
+	}
+	if !strings.HasPrefix(emitter.messages[0], "redis slow command SET key long...(10 bytes) took") {
+		t.Error(emitter.messages[0])
+	}
+	if !strings.HasPrefix(emitter.messages[1], "redis slow pipeline of 1 commands [GET] took") {
+		t.Error(emitter.messages[1])
+	}
+	hook.Threshold = time.Hour
+	client.Get("key")
+	if len(emitter.messages) != 2 {
+		t.Error(emitter.messages)
+	}
+}
+
+func TestLatencyHook(t *testing.T) {
+	client := newHookClient(t)
+	defer client.ClosePool()
+	hook := NewLatencyHook()
+	client.AddHook(hook)
+	for i := 0; i < 10; i++ {
+		client.Incr("counter")
+	}
+	client.HGet("counter", "field")
+	p := client.Pipeline()
+	p.Get("key")
+	p.Exec()
+	stats := hook.Stats()
+	incr := stats["INCR"]
+	if incr.Count != 10 || incr.Errors != 0 || incr.Max <= 0 || incr.Mean() <= 0 {
+		t.Error(incr)
+	}
+	if p := incr.Percentile(99); p < incr.Max && p != DefaultLatencyBuckets[0] {
+		t.Error(p, incr.Max)
+	}
+	if hget := stats["HGET"]; hget.Count != 1 || hget.Errors != 1 {
+		t.Error(hget)
+	}
+	if stats["PIPELINE"].Count != 1 {
+		t.Error(stats["PIPELINE"])
+	}
+	hook.Reset()
+	if len(hook.Stats()) != 0 {
+		t.Fail()
+	}
+
+	s := &LatencyStats{Buckets: []time.Duration{time.Millisecond, 10 * time.Millisecond}, Counts: make([]int64, 3)}
+	for _, d := range []time.Duration{time.Microsecond, 5 * time.Millisecond, 5 * time.Millisecond, time.Second} {
+		s.add(d, nil)
+	}
+	if s.Percentile(25) != time.Millisecond || s.Percentile(50) != 10*time.Millisecond || s.Percentile(100) != time.Second {
+		t.Error(s.Percentile(25), s.Percentile(50), s.Percentile(100))
+	}
+}
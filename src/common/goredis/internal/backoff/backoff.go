@@ -0,0 +1,26 @@
+// Package backoff computes the retry delays shared by goredis and its subpackages.
+package backoff
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Exponential returns the exponential backoff of the attempt (from 0) with jitter, between min and max.
+func Exponential(min, max time.Duration, attempt int) time.Duration {
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	// up to a quarter of random jitter so that the clients do not retry at the same time
+	if jitter := int64(d / 4); jitter > 0 {
+		d = d - time.Duration(jitter) + time.Duration(rand.Int63n(2*jitter))
+	}
+	if d < min {
+		d = min
+	}
+	return d
+}
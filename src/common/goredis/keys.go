@@ -5,6 +5,25 @@ import (
 	"strconv"
 )
 
+// Copy copies the value stored at source to destination,
+// in the database db, or the current database if db is negative.
+// The destination is overwritten if replace is true, else nothing is done if it exists.
+// True if source was copied.
+func (r *Redis) Copy(source, destination string, db int, replace bool) (bool, error) {
+	args := packArgs("COPY", source, destination)
+	if db >= 0 {
+		args = append(args, "DB", db)
+	}
+	if replace {
+		args = append(args, "REPLACE")
+	}
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return false, err
+	}
+	return rp.BoolValue()
+}
+
 // Del removes the specified keys.
 // A key is ignored if it does not exist.
 // Integer reply: The number of keys that were removed.
@@ -121,6 +140,44 @@ func (r *Redis) Object(subcommand string, arguments ...string) (*Reply, error) {
 	return r.ExecuteCommand(args...)
 }
 
+// ObjectEncoding returns the internal encoding of the value stored at key,
+// such as listpack, quicklist, intset, hashtable or embstr, empty if key does not exist.
+func (r *Redis) ObjectEncoding(key string) (string, error) {
+	rp, err := r.ExecuteCommand("OBJECT", "ENCODING", key)
+	if err != nil {
+		return "", err
+	}
+	return rp.StringValue()
+}
+
+// ObjectFreq returns the logarithmic access frequency counter of the value stored at key,
+// it is only available with a LFU maxmemory policy.
+func (r *Redis) ObjectFreq(key string) (int64, error) {
+	rp, err := r.ExecuteCommand("OBJECT", "FREQ", key)
+	if err != nil {
+		return 0, err
+	}
+	return rp.IntegerValue()
+}
+
+// ObjectIdleTime returns the number of seconds since the value stored at key was last accessed.
+func (r *Redis) ObjectIdleTime(key string) (int64, error) {
+	rp, err := r.ExecuteCommand("OBJECT", "IDLETIME", key)
+	if err != nil {
+		return 0, err
+	}
+	return rp.IntegerValue()
+}
+
+// ObjectRefCount returns the number of references of the value stored at key.
+func (r *Redis) ObjectRefCount(key string) (int64, error) {
+	rp, err := r.ExecuteCommand("OBJECT", "REFCOUNT", key)
+	if err != nil {
+		return 0, err
+	}
+	return rp.IntegerValue()
+}
+
 // Persist removes the existing timeout on key,
 // turning the key from volatile (a key with an expire set) to persistent
 // (a key that will never expire as no timeout is associated).
@@ -231,6 +288,17 @@ func (r *Redis) Type(key string) (string, error) {
 	return rp.StatusValue()
 }
 
+// Unlink is like Del, but the memory of the values is reclaimed in the background.
+// Integer reply: The number of keys that were unlinked.
+func (r *Redis) Unlink(keys ...string) (int64, error) {
+	args := packArgs("UNLINK", keys)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return 0, err
+	}
+	return rp.IntegerValue()
+}
+
 // Scan command:
 // SCAN cursor [MATCH pattern] [COUNT count]
 func (r *Redis) Scan(cursor uint64, pattern string, count int) (uint64, []string, error) {
@@ -248,7 +316,7 @@ func (r *Redis) Scan(cursor uint64, pattern string, count int) (uint64, []string
 	if rp.Type == ErrorReply {
 		return 0, nil, errors.New(rp.Error)
 	}
-	if rp.Type != MultiReply {
+	if rp.Type != MultiReply || len(rp.Multi) != 2 {
 		return 0, nil, errors.New("scan protocol error")
 	}
 	first, err := rp.Multi[0].StringValue()
@@ -5,6 +5,30 @@ import (
 	"time"
 )
 
+func TestCopy(t *testing.T) {
+	r.Del("key", "key2")
+	r.RPush("key", "a", "b")
+	if ok, err := r.Copy("key", "key2", -1, false); err != nil || !ok {
+		t.Error(ok, err)
+	}
+	if list, _ := r.LRange("key2", 0, -1); len(list) != 2 || list[1] != "b" {
+		t.Error(list)
+	}
+	r.RPush("key", "c")
+	if ok, _ := r.Copy("key", "key2", -1, false); ok {
+		t.Error("copied to an existing key")
+	}
+	if ok, _ := r.Copy("key", "key2", -1, true); !ok {
+		t.Error("not replaced")
+	}
+	if n, _ := r.LLen("key2"); n != 3 {
+		t.Error(n)
+	}
+	if _, err := r.Copy("key", "key", -1, true); err == nil {
+		t.Error("copied to itself")
+	}
+}
+
 func TestDel(t *testing.T) {
 	r.Set("key", "value", 0, 0, false, false)
 	if n, err := r.Del("key"); err != nil {
@@ -110,6 +134,19 @@ func TestObject(t *testing.T) {
 	}
 }
 
+func TestObjectEncoding(t *testing.T) {
+	r.Set("key", "12345", 0, 0, false, false)
+	if encoding, err := r.ObjectEncoding("key"); err != nil || encoding != "int" {
+		t.Error(encoding, err)
+	}
+	if n, err := r.ObjectRefCount("key"); err != nil || n < 1 {
+		t.Error(n, err)
+	}
+	if _, err := r.ObjectIdleTime("key"); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestPersist(t *testing.T) {
 	r.Set("key", "value", 0, 0, false, false)
 	r.Expire("key", 500)
@@ -232,6 +269,13 @@ func TestType(t *testing.T) {
 	}
 }
 
+func TestUnlink(t *testing.T) {
+	r.MSet(map[string]string{"key": "value", "key2": "value"})
+	if n, err := r.Unlink("key", "key2", "key3"); err != nil || n != 2 {
+		t.Error(n, err)
+	}
+}
+
 func TestScan(t *testing.T) {
 	r.FlushDB()
 	cursor, list, err := r.Scan(0, "", 0)
@@ -46,7 +46,7 @@ func (r *Redis) BRPopLPush(source, destination string, timeout int) ([]byte, err
 	if err != nil {
 		return nil, err
 	}
-	if rp.Type == MultiReply {
+	if rp.Type == MultiReply || rp.Type == NilReply {
 		return nil, nil
 	}
 	return rp.BytesValue()
@@ -100,6 +100,42 @@ func (r *Redis) LPop(key string) ([]byte, error) {
 	return rp.BytesValue()
 }
 
+// LPos returns the index of the first element equal to element in the list stored at key, -1 if not found.
+// Rank 1 or 0 means the first match, 2 the second, -1 the first from the tail and so on.
+// Only maxlen elements are compared if maxlen is positive.
+func (r *Redis) LPos(key, element string, rank, maxlen int) (int64, error) {
+	args := packArgs("LPOS", key, element, lposArgs(rank, maxlen))
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return -1, err
+	}
+	if rp.Type == NilReply || rp.Type == BulkReply && rp.Bulk == nil {
+		return -1, nil
+	}
+	return rp.IntegerValue()
+}
+
+// LPosCount is like LPos, but returns the indexes of count matches, or all the matches if count is 0.
+func (r *Redis) LPosCount(key, element string, count, rank, maxlen int) ([]int64, error) {
+	args := packArgs("LPOS", key, element, lposArgs(rank, maxlen), "COUNT", count)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	return rp.IntegerArrayValue()
+}
+
+func lposArgs(rank, maxlen int) []interface{} {
+	var args []interface{}
+	if rank != 0 {
+		args = append(args, "RANK", rank)
+	}
+	if maxlen > 0 {
+		args = append(args, "MAXLEN", maxlen)
+	}
+	return args
+}
+
 // LPush insert all the specified values at the head of the list stored at key.
 // If key does not exist, it is created as empty list before performing the push operations.
 // When key holds a value that is not a list, an error is returned.
@@ -114,6 +114,32 @@ func TestLPop(t *testing.T) {
 	}
 }
 
+func TestLPos(t *testing.T) {
+	r.Del("key")
+	r.RPush("key", "a", "b", "c", "1", "2", "3", "c", "c")
+	if n, err := r.LPos("key", "c", 0, 0); err != nil || n != 2 {
+		t.Error(n, err)
+	}
+	if n, _ := r.LPos("key", "c", -1, 0); n != 7 {
+		t.Error(n)
+	}
+	if n, _ := r.LPos("key", "c", 2, 0); n != 6 {
+		t.Error(n)
+	}
+	if n, _ := r.LPos("key", "3", 0, 3); n != -1 {
+		t.Error(n)
+	}
+	if positions, err := r.LPosCount("key", "c", 0, 0, 0); err != nil || len(positions) != 3 || positions[2] != 7 {
+		t.Error(positions, err)
+	}
+	if positions, _ := r.LPosCount("key", "c", 2, -1, 0); len(positions) != 2 || positions[0] != 7 || positions[1] != 6 {
+		t.Error(positions)
+	}
+	if positions, err := r.LPosCount("key", "x", 1, 0, 0); err != nil || len(positions) != 0 {
+		t.Error(positions, err)
+	}
+}
+
 func TestLPush(t *testing.T) {
 	r.Del("key")
 	if n, err := r.LPush("key", "value"); err != nil {
@@ -0,0 +1,156 @@
+package lock
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"common/goredis"
+)
+
+// Result is the decision of a rate limiter.
+// Remaining is the number of events still allowed now,
+// RetryAfter is the time to wait before the event may be allowed if it is not.
+type Result struct {
+	Allowed    bool
+	Remaining  int64
+	RetryAfter time.Duration
+}
+
+var slidingWindowScript = goredis.NewScript(1, `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+if count + n > limit then
+	local retry = window
+	local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+	if oldest[2] then
+		retry = tonumber(oldest[2]) + window - now
+	end
+	return {0, limit - count, retry}
+end
+for i = 1, n do
+	redis.call("ZADD", KEYS[1], now, ARGV[5] .. ":" .. i)
+end
+redis.call("PEXPIRE", KEYS[1], window)
+return {1, limit - count - n, 0}`)
+
+// SlidingWindow allows at most Limit events of a key in any Window,
+// the time of every event is kept in a sorted set.
+type SlidingWindow struct {
+	Limit  int64
+	Window time.Duration
+
+	redis *goredis.Redis
+}
+
+// NewSlidingWindow new a SlidingWindow limiter allowing limit events per window.
+func NewSlidingWindow(r *goredis.Redis, limit int64, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{Limit: limit, Window: window, redis: r}
+}
+
+// Allow reports whether one event of key is allowed now.
+func (l *SlidingWindow) Allow(key string) (*Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN reports whether n events of key are allowed now, the events are recorded only if allowed.
+func (l *SlidingWindow) AllowN(key string, n int64) (*Result, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	rp, err := slidingWindowScript.Run(l.redis, key, now, milliseconds(l.Window), l.Limit, n, token)
+	if err != nil {
+		return nil, err
+	}
+	return parseResult(rp)
+}
+
+var tokenBucketScript = goredis.NewScript(1, `
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+end
+local allowed = 0
+local retry = 0
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+else
+	retry = math.ceil((n - tokens) * 1000 / rate)
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", math.max(now, ts))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, math.floor(tokens), retry}`)
+
+// TokenBucket allows the events of a key at Rate per second on average, with bursts of at most Burst events.
+// The tokens and the last refill time are kept in a hash.
+type TokenBucket struct {
+	Rate  float64
+	Burst int64
+
+	redis *goredis.Redis
+}
+
+// NewTokenBucket new a TokenBucket limiter refilled at rate tokens per second and holding at most burst tokens.
+func NewTokenBucket(r *goredis.Redis, rate float64, burst int64) *TokenBucket {
+	return &TokenBucket{Rate: rate, Burst: burst, redis: r}
+}
+
+// Allow reports whether one event of key is allowed now.
+func (l *TokenBucket) Allow(key string) (*Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN reports whether n events of key are allowed now, the tokens are taken only if allowed.
+func (l *TokenBucket) AllowN(key string, n int64) (*Result, error) {
+	if l.Rate <= 0 {
+		return nil, errors.New("token bucket rate must be positive")
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	rate := strconv.FormatFloat(l.Rate, 'f', -1, 64)
+	rp, err := tokenBucketScript.Run(l.redis, key, now, rate, l.Burst, n)
+	if err != nil {
+		return nil, err
+	}
+	return parseResult(rp)
+}
+
+func parseResult(rp *goredis.Reply) (*Result, error) {
+	multi, err := rp.MultiValue()
+	if err != nil {
+		return nil, err
+	}
+	if len(multi) != 3 {
+		return nil, errors.New("rate limiter script protocol error")
+	}
+	var values [3]int64
+	for i, item := range multi {
+		if values[i], err = item.IntegerValue(); err != nil {
+			return nil, err
+		}
+	}
+	if values[1] < 0 {
+		values[1] = 0
+	}
+	return &Result{
+		Allowed:    values[0] == 1,
+		Remaining:  values[1],
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
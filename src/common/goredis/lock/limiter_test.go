@@ -0,0 +1,164 @@
+package lock
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"common/goredis/redistest"
+)
+
+// registerLimiterScripts implements the Lua scripts of the limiters in Go for the in-process server.
+func registerLimiterScripts(server *redistest.Server) {
+	server.RegisterScript(slidingWindowScript.Source(), func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+		now, _ := strconv.ParseInt(args[0], 10, 64)
+		window, _ := strconv.ParseInt(args[1], 10, 64)
+		limit, _ := strconv.ParseInt(args[2], 10, 64)
+		n, _ := strconv.ParseInt(args[3], 10, 64)
+		call("ZREMRANGEBYSCORE", keys[0], "-inf", now-window)
+		count := call("ZCARD", keys[0]).(int64)
+		if count+n > limit {
+			retry := window
+			if oldest, _ := call("ZRANGE", keys[0], 0, 0, "WITHSCORES").([]interface{}); len(oldest) == 2 {
+				score, _ := strconv.ParseFloat(oldest[1].(string), 64)
+				retry = int64(score) + window - now
+			}
+			return []interface{}{0, limit - count, retry}
+		}
+		for i := int64(1); i <= n; i++ {
+			call("ZADD", keys[0], now, args[4]+":"+strconv.FormatInt(i, 10))
+		}
+		call("PEXPIRE", keys[0], window)
+		return []interface{}{1, limit - count - n, 0}
+	})
+	server.RegisterScript(tokenBucketScript.Source(), func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+		var values [4]float64
+		for i := range values {
+			values[i], _ = strconv.ParseFloat(args[i], 64)
+		}
+		now, rate, burst, n := values[0], values[1], values[2], values[3]
+		state, _ := call("HMGET", keys[0], "tokens", "ts").([]interface{})
+		tokens, ts := burst, now
+		if len(state) == 2 && state[0] != nil && state[1] != nil {
+			tokens, _ = strconv.ParseFloat(state[0].(string), 64)
+			ts, _ = strconv.ParseFloat(state[1].(string), 64)
+		}
+		if now > ts {
+			tokens = math.Min(burst, tokens+(now-ts)*rate/1000)
+		}
+		allowed, retry := 0, 0.0
+		if tokens >= n {
+			tokens -= n
+			allowed = 1
+		} else {
+			retry = math.Ceil((n - tokens) * 1000 / rate)
+		}
+		call("HMSET", keys[0], "tokens", strconv.FormatFloat(tokens, 'f', -1, 64), "ts", strconv.FormatFloat(math.Max(now, ts), 'f', -1, 64))
+		call("PEXPIRE", keys[0], int64(math.Ceil(burst*1000/rate))+1000)
+		return []interface{}{allowed, int64(math.Floor(tokens)), int64(retry)}
+	})
+}
+
+func TestSlidingWindow(t *testing.T) {
+	r.Del("rate")
+	l := NewSlidingWindow(r, 3, 100*time.Millisecond)
+	for i := int64(0); i < 3; i++ {
+		if result, err := l.Allow("rate"); err != nil {
+			t.Fatal(err)
+		} else if !result.Allowed || result.Remaining != 2-i {
+			t.Error(result)
+		}
+	}
+	result, err := l.Allow("rate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed || result.Remaining != 0 || result.RetryAfter <= 0 || result.RetryAfter > 100*time.Millisecond {
+		t.Error(result)
+	}
+	if result, _ := l.AllowN("rate", 5); result.Allowed {
+		t.Fail()
+	}
+	time.Sleep(result.RetryAfter + 10*time.Millisecond)
+	if result, err := l.Allow("rate"); err != nil || !result.Allowed {
+		t.Error(result, err)
+	}
+	if n, _ := r.ZCard("rate"); n > 3 {
+		t.Error(n)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	r.Del("rate")
+	l := NewTokenBucket(r, 20, 2)
+	for i := int64(0); i < 2; i++ {
+		if result, err := l.Allow("rate"); err != nil {
+			t.Fatal(err)
+		} else if !result.Allowed || result.Remaining != 1-i {
+			t.Error(result)
+		}
+	}
+	result, err := l.Allow("rate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > 50*time.Millisecond {
+		t.Error(result)
+	}
+	if result, _ := l.AllowN("rate", 3); result.Allowed {
+		t.Fail()
+	}
+	time.Sleep(result.RetryAfter + 10*time.Millisecond)
+	if result, err := l.Allow("rate"); err != nil || !result.Allowed {
+		t.Error(result, err)
+	}
+	if _, err := NewTokenBucket(r, 0, 1).Allow("rate"); err == nil {
+		t.Fail()
+	}
+}
+
+// TestLimiterScripts runs the scripts at fixed times, the Lua scripts run on a real redis when REDIS_TEST_ADDR is set,
+// and the Go copies of registerLimiterScripts must give the same results.
+func TestLimiterScripts(t *testing.T) {
+	r.Del("rate")
+	for _, c := range []struct {
+		now, n int64
+		want   [3]int64
+	}{
+		{1000, 1, [3]int64{1, 1, 0}},
+		{1010, 1, [3]int64{1, 0, 0}},
+		// the oldest event leaves the window at 1100
+		{1020, 1, [3]int64{0, 0, 80}},
+		{1101, 1, [3]int64{1, 0, 0}},
+	} {
+		rp, err := slidingWindowScript.Run(r, "rate", c.now, 100, 2, c.n, "token"+strconv.FormatInt(c.now, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if values, _ := rp.IntegerArrayValue(); len(values) != 3 || [3]int64{values[0], values[1], values[2]} != c.want {
+			t.Errorf("sliding window at %d: %v, want %v", c.now, values, c.want)
+		}
+	}
+
+	r.Del("rate")
+	for _, c := range []struct {
+		now, n int64
+		want   [3]int64
+	}{
+		{1000, 1, [3]int64{1, 1, 0}},
+		{1000, 2, [3]int64{0, 1, 100}},
+		// 0.5 token is refilled in 50ms
+		{1050, 1, [3]int64{1, 0, 0}},
+		{1100, 1, [3]int64{1, 0, 0}},
+		{1100, 1, [3]int64{0, 0, 100}},
+	} {
+		rp, err := tokenBucketScript.Run(r, "rate", c.now, 10, 2, c.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if values, _ := rp.IntegerArrayValue(); len(values) != 3 || [3]int64{values[0], values[1], values[2]} != c.want {
+			t.Errorf("token bucket at %d: %v, want %v", c.now, values, c.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Package lock provides distributed locks and rate limiters on top of goredis.
+//
+// A Mutex is owned by a random token, so that only the owner can release or extend it:
+//
+//	m := lock.NewMutex(client, "lock:order:1", 10*time.Second)
+//	if err := m.Lock(ctx); err != nil {
+//		return err
+//	}
+//	defer m.Unlock()
+//
+// SlidingWindow and TokenBucket limit the rate of the events of a key:
+//
+//	limiter := lock.NewSlidingWindow(client, 100, time.Minute)
+//	result, err := limiter.Allow("rate:user:1")
+//	if result.Allowed {}
+//
+// The state is kept in redis and updated by Lua scripts, so the primitives are shared by all the processes.
+// The lock is for a single redis master, it is not the Redlock algorithm.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"common/goredis"
+	"common/goredis/internal/backoff"
+)
+
+var (
+	// ErrNotObtained is returned by Lock when the lock is held by another owner until the context is done.
+	ErrNotObtained = errors.New("lock not obtained")
+	// ErrNotHeld is returned by Unlock and Extend when the lock is not held by the mutex any more,
+	// it expired and maybe was obtained by another owner.
+	ErrNotHeld = errors.New("lock not held")
+)
+
+var (
+	releaseScript = goredis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+	extendScript = goredis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// Mutex is a lock of key which expires after TTL unless extended.
+// Lock retries with an exponential backoff between RetryMin and RetryMax.
+// A Mutex should not be used by several goroutines at the same time.
+type Mutex struct {
+	TTL      time.Duration
+	RetryMin time.Duration
+	RetryMax time.Duration
+
+	redis *goredis.Redis
+	key   string
+	token string
+}
+
+// NewMutex new a Mutex of key with the lease ttl, the backoff is 10ms to 500ms.
+func NewMutex(r *goredis.Redis, key string, ttl time.Duration) *Mutex {
+	return &Mutex{
+		TTL:      ttl,
+		RetryMin: 10 * time.Millisecond,
+		RetryMax: 500 * time.Millisecond,
+		redis:    r,
+		key:      key,
+	}
+}
+
+// Key returns the key of the lock.
+func (m *Mutex) Key() string {
+	return m.key
+}
+
+// Token returns the token of the current owner, empty if the lock is not obtained.
+func (m *Mutex) Token() string {
+	return m.token
+}
+
+// TryLock tries to obtain the lock once by SET NX PX.
+func (m *Mutex) TryLock() (bool, error) {
+	return m.tryLock(m.redis)
+}
+
+func (m *Mutex) tryLock(r *goredis.Redis) (bool, error) {
+	token, err := newToken()
+	if err != nil {
+		return false, err
+	}
+	rp, err := r.ExecuteCommand("SET", m.key, token, "PX", milliseconds(m.TTL), "NX")
+	if err != nil {
+		return false, err
+	}
+	if rp.Type == goredis.BulkReply || rp.Type == goredis.NilReply {
+		// null reply, the key exists
+		return false, nil
+	}
+	if err := rp.OKValue(); err != nil {
+		return false, err
+	}
+	m.token = token
+	return true, nil
+}
+
+// Lock obtains the lock, retrying until ctx is done.
+// ErrNotObtained is returned if ctx is done while the lock is held by another owner.
+func (m *Mutex) Lock(ctx context.Context) error {
+	r := m.redis.WithContext(ctx)
+	for attempt := 0; ; attempt++ {
+		ok, err := m.tryLock(r)
+		if ok {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ErrNotObtained
+		}
+		if err != nil {
+			return err
+		}
+		timer := time.NewTimer(backoff.Exponential(m.RetryMin, m.RetryMax, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ErrNotObtained
+		case <-timer.C:
+		}
+	}
+}
+
+// Unlock releases the lock if it is still held by the mutex.
+func (m *Mutex) Unlock() error {
+	if m.token == "" {
+		return ErrNotHeld
+	}
+	rp, err := releaseScript.Run(m.redis, m.key, m.token)
+	if err != nil {
+		return err
+	}
+	n, err := rp.IntegerValue()
+	if err != nil {
+		return err
+	}
+	m.token = ""
+	if n == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// Extend resets the lease of the lock to ttl if it is still held by the mutex.
+func (m *Mutex) Extend(ttl time.Duration) error {
+	if m.token == "" {
+		return ErrNotHeld
+	}
+	rp, err := extendScript.Run(m.redis, m.key, m.token, milliseconds(ttl))
+	if err != nil {
+		return err
+	}
+	n, err := rp.IntegerValue()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		m.token = ""
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// PTTL returns the remaining lease of the lock, a negative value if the key does not exist.
+func (m *Mutex) PTTL() (time.Duration, error) {
+	ms, err := m.redis.PTTL(m.key)
+	if err != nil {
+		return 0, err
+	}
+	if ms < 0 {
+		return time.Duration(ms), nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func milliseconds(d time.Duration) int64 {
+	ms := int64(d / time.Millisecond)
+	if ms <= 0 {
+		ms = 1
+	}
+	return ms
+}
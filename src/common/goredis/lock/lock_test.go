@@ -0,0 +1,197 @@
+package lock
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"common/goredis"
+	"common/goredis/redistest"
+)
+
+var (
+	r *goredis.Redis
+	// testServer is the in-process server the tests run against, unless REDIS_TEST_ADDR is set.
+	testServer *redistest.Server
+)
+
+func init() {
+	address := os.Getenv("REDIS_TEST_ADDR")
+	if address == "" {
+		server, err := redistest.NewServer()
+		if err != nil {
+			panic(err)
+		}
+		// the Lua scripts of Mutex in Go
+		ownerCall := func(command string) redistest.ScriptFunc {
+			return func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+				if call("GET", keys[0]) != args[0] {
+					return 0
+				}
+				return call(append([]interface{}{command, keys[0]}, toInterfaces(args[1:])...)...)
+			}
+		}
+		server.RegisterScript(releaseScript.Source(), ownerCall("DEL"))
+		server.RegisterScript(extendScript.Source(), ownerCall("PEXPIRE"))
+		registerLimiterScripts(server)
+		testServer = server
+		address = server.Addr()
+	}
+	client, err := goredis.Dial(&goredis.DialConfig{Address: address, Database: 1, MaxIdle: 4})
+	if err != nil {
+		panic(err)
+	}
+	r = client
+}
+
+func toInterfaces(strs []string) []interface{} {
+	values := make([]interface{}, len(strs))
+	for i, s := range strs {
+		values[i] = s
+	}
+	return values
+}
+
+func TestMutex(t *testing.T) {
+	r.Del("lock")
+	a, b := NewMutex(r, "lock", time.Second), NewMutex(r, "lock", time.Second)
+	if ok, err := a.TryLock(); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if ok, err := b.TryLock(); err != nil || ok {
+		t.Fatal(ok, err)
+	}
+	if err := b.Unlock(); err != ErrNotHeld {
+		t.Error(err)
+	}
+	if ttl, err := a.PTTL(); err != nil || ttl <= 0 || ttl > time.Second {
+		t.Error(ttl, err)
+	}
+	if err := a.Extend(time.Minute); err != nil {
+		t.Error(err)
+	}
+	if ttl, _ := a.PTTL(); ttl <= time.Second {
+		t.Error(ttl)
+	}
+	if err := a.Unlock(); err != nil {
+		t.Error(err)
+	}
+	if err := a.Unlock(); err != ErrNotHeld {
+		t.Error(err)
+	}
+	if ok, err := b.TryLock(); err != nil || !ok {
+		t.Error(ok, err)
+	}
+	// the lock of a is taken over by b, a must not release it
+	a.token = "stale"
+	if err := a.Unlock(); err != ErrNotHeld {
+		t.Error(err)
+	}
+	if err := a.Extend(time.Minute); err != ErrNotHeld {
+		t.Error(err)
+	}
+	if b.Unlock() != nil {
+		t.Fail()
+	}
+}
+
+// TestMutexScripts checks the replies of the scripts, and that the Lua scripts really ran on a real redis.
+func TestMutexScripts(t *testing.T) {
+	r.Del("lock")
+	r.ExecuteCommand("SET", "lock", "owner")
+	for _, c := range []struct {
+		script *goredis.Script
+		args   []interface{}
+		want   int64
+	}{
+		{extendScript, []interface{}{"lock", "other", 60000}, 0},
+		{extendScript, []interface{}{"lock", "owner", 60000}, 1},
+		{releaseScript, []interface{}{"lock", "other"}, 0},
+		{releaseScript, []interface{}{"lock", "owner"}, 1},
+		{releaseScript, []interface{}{"lock", "owner"}, 0},
+	} {
+		rp, err := c.script.Run(r, c.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := rp.IntegerValue(); err != nil || n != c.want {
+			t.Errorf("%v: %d, %v, want %d", c.args, n, err, c.want)
+		}
+	}
+	if testServer != nil {
+		// the Go copies of the scripts ran, the Lua scripts run only on a real redis
+		return
+	}
+	for _, s := range []*goredis.Script{releaseScript, extendScript} {
+		rp, err := r.ExecuteCommand("SCRIPT", "EXISTS", s.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists, _ := rp.BoolArrayValue(); len(exists) != 1 || !exists[0] {
+			t.Errorf("script %s is not loaded", s.Hash())
+		}
+	}
+}
+
+func TestMutexLock(t *testing.T) {
+	r.Del("lock")
+	holder := NewMutex(r, "lock", 100*time.Millisecond)
+	if ok, _ := holder.TryLock(); !ok {
+		t.Fatal()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	waiter := NewMutex(r, "lock", time.Second)
+	if err := waiter.Lock(ctx); err != ErrNotObtained {
+		t.Error(err)
+	}
+	// the lease of holder expires
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel2()
+	if err := waiter.Lock(ctx2); err != nil {
+		t.Fatal(err)
+	}
+	waiter.Unlock()
+}
+
+func TestMutexExclusive(t *testing.T) {
+	r.Del("lock")
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	holders, maxHolders := 0, 0
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := NewMutex(r, "lock", time.Second)
+			m.RetryMin, m.RetryMax = time.Millisecond, 5*time.Millisecond
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			for j := 0; j < 5; j++ {
+				if err := m.Lock(ctx); err != nil {
+					t.Error(err)
+					return
+				}
+				mutex.Lock()
+				holders++
+				if holders > maxHolders {
+					maxHolders = holders
+				}
+				mutex.Unlock()
+				time.Sleep(time.Millisecond)
+				mutex.Lock()
+				holders--
+				mutex.Unlock()
+				if err := m.Unlock(); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if maxHolders != 1 {
+		t.Error(maxHolders)
+	}
+}
@@ -0,0 +1,784 @@
+package goredis
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Default chunk limits of a Pipeline.
+const (
+	DefaultPipelineChunkSize  = 1000
+	DefaultPipelineChunkBytes = 1 << 20
+)
+
+// Pipeline queues typed commands and sends them together by Exec,
+// every queued command returns a future whose result is available after Exec:
+//
+//	p := client.Pipeline()
+//	incr := p.Incr("counter")
+//	hash := p.HGetAll("user:1")
+//	err := p.Exec()
+//	n, err := incr.Result()
+//	fields, err := hash.Result()
+//
+// The error of Exec is the connection error, the error reply of a command is kept by the command.
+// A Pipeline is not safe for concurrent use, it takes a connection from the pool only during Exec.
+type Pipeline struct {
+	redis *Redis
+	multi bool
+	cmds  []Cmder
+
+	// ChunkSize is the max number of commands sent in one write,
+	// larger batches are sent in chunks, the replies of a chunk are read before the next chunk is sent.
+	ChunkSize int
+	// ChunkBytes is the max size of the commands sent in one write, a single larger command is sent alone.
+	ChunkBytes int
+}
+
+// Pipeline returns a new Pipeline on r.
+// If r is a WithContext view, the Exec of the pipeline is bounded by the context.
+func (r *Redis) Pipeline() *Pipeline {
+	return &Pipeline{
+		redis:      r,
+		ChunkSize:  DefaultPipelineChunkSize,
+		ChunkBytes: DefaultPipelineChunkBytes,
+	}
+}
+
+// TxPipeline returns a new Pipeline whose commands are wrapped in MULTI and EXEC,
+// so they are executed as a transaction.
+// If a command is rejected when queued, EXEC fails with EXECABORT and no command is executed,
+// Exec returns the error of EXEC then.
+func (r *Redis) TxPipeline() *Pipeline {
+	p := r.Pipeline()
+	p.multi = true
+	return p
+}
+
+// Len returns the number of queued commands.
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Discard drops the queued commands.
+func (p *Pipeline) Discard() {
+	p.cmds = nil
+}
+
+// Queue queues cmd, it is used to queue the commands created outside of the Pipeline.
+func (p *Pipeline) Queue(cmd Cmder) {
+	p.cmds = append(p.cmds, cmd)
+}
+
+// Exec sends the queued commands and receives their replies, the queue is emptied.
+// A batch is sent in a single write unless it is larger than ChunkSize or ChunkBytes.
+// The error is not nil only if the connection failed or the transaction failed,
+// the commands which did not get their replies have the error too.
+// ErrTxAborted is returned if EXEC of a TxPipeline is aborted because a watched key was changed.
+// On a cluster client the commands are sent to the masters of their slots, see DialCluster.
+func (p *Pipeline) Exec() error {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return nil
+	}
+	if hooks := p.redis.hooks.get(); len(hooks) > 0 {
+		return p.redis.processPipelineHooks(hooks, cmds, func() error {
+			return p.execCmds(cmds)
+		})
+	}
+	return p.execCmds(cmds)
+}
+
+// execCmds sends cmds on the connection of the Tx, the nodes of a cluster, or a connection of the pool.
+func (p *Pipeline) execCmds(cmds []Cmder) error {
+	ctx := p.redis.ctx
+	if tx := p.redis.tx; tx != nil {
+		var txErr error
+		err := tx.conn.do(ctx, func() (err error) {
+			_, txErr, err = p.exec(tx.conn, cmds)
+			return err
+		})
+		if err != nil {
+			tx.broken = true
+			setCmdsErr(cmds, err)
+			return err
+		}
+		return txErr
+	}
+	if cluster := p.redis.cluster; cluster != nil {
+		return p.execCluster(cluster, cmds)
+	}
+	return p.execPool(p.redis.pool, cmds)
+}
+
+// execPool sends cmds on a connection of pool.
+func (p *Pipeline) execPool(pool *connPool, cmds []Cmder) error {
+	ctx := p.redis.ctx
+	c, err := pool.GetContext(ctx)
+	if err != nil {
+		setCmdsErr(cmds, err)
+		return err
+	}
+	var n int
+	var txErr error
+	err = c.do(ctx, func() (err error) {
+		n, txErr, err = p.exec(c, cmds)
+		return err
+	})
+	if err == io.EOF && n == 0 {
+		// the idle connection was closed by server, try once more with another one
+		pool.Discard(c)
+		if c, err = pool.GetContext(ctx); err != nil {
+			setCmdsErr(cmds, err)
+			return err
+		}
+		err = c.do(ctx, func() (err error) {
+			n, txErr, err = p.exec(c, cmds)
+			return err
+		})
+	}
+	if err != nil {
+		pool.Discard(c)
+		setCmdsErr(cmds, err)
+		return err
+	}
+	pool.Put(c)
+	return txErr
+}
+
+// execCluster sends the commands of a cluster client to the masters of their slots, one pipeline per node,
+// the commands redirected by MOVED or ASK are sent again to the nodes of the redirects.
+// A TxPipeline runs on the master of the slot of its first key, so all its keys must be in that slot.
+func (p *Pipeline) execCluster(c *redisCluster, cmds []Cmder) error {
+	if p.multi {
+		slot := 0
+		for _, cmd := range cmds {
+			if key, ok := commandKey(cmd.Args()); ok {
+				slot = KeySlot(key)
+				break
+			}
+		}
+		node := c.slotNode(slot)
+		if node == nil {
+			c.reloadAsync()
+			err := fmt.Errorf("no cluster node serves slot %d", slot)
+			setCmdsErr(cmds, err)
+			return err
+		}
+		return p.execPool(node.pool, cmds)
+	}
+
+	var firstErr error
+	asking := make(map[Cmder]string)
+	for i := 0; len(cmds) > 0; i++ {
+		if i > c.maxRedirects {
+			err := errors.New("too many cluster redirects")
+			setCmdsErr(cmds, err)
+			return err
+		}
+		groups := make(map[*Redis][]Cmder)
+		for _, cmd := range cmds {
+			var node *Redis
+			var err error
+			if addr := asking[cmd]; addr != "" {
+				if node, err = c.node(addr); err == nil {
+					groups[node] = append(groups[node], &Cmd{newBaseCmd([]interface{}{"ASKING"})}, cmd)
+				}
+			} else {
+				slot := 0
+				if key, ok := commandKey(cmd.Args()); ok {
+					slot = KeySlot(key)
+				}
+				if node = c.slotNode(slot); node == nil {
+					err = fmt.Errorf("no cluster node serves slot %d", slot)
+				} else {
+					groups[node] = append(groups[node], cmd)
+				}
+			}
+			if err != nil {
+				c.reloadAsync()
+				cmd.setErr(err)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+
+		asking = make(map[Cmder]string)
+		var redirected []Cmder
+		for node, group := range groups {
+			if err := p.execPool(node.pool, group); err != nil {
+				c.reloadAsync()
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			for _, cmd := range group {
+				rp := cmd.Reply()
+				if rp == nil || rp.Type != ErrorReply {
+					continue
+				}
+				fields := strings.Fields(rp.Error)
+				if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+					continue
+				}
+				if fields[0] == "MOVED" {
+					c.moved(fields[1], fields[2])
+				} else {
+					asking[cmd] = fields[2]
+				}
+				cmd.setErr(ErrNotExecuted)
+				redirected = append(redirected, cmd)
+			}
+		}
+		cmds = redirected
+	}
+	return firstErr
+}
+
+// setCmdsErr sets err to the commands which are not executed.
+func setCmdsErr(cmds []Cmder, err error) {
+	for _, cmd := range cmds {
+		if cmd.Err() == ErrNotExecuted {
+			cmd.setErr(err)
+		}
+	}
+}
+
+// exec writes the commands in chunks and reads the replies of every chunk,
+// n is the number of replies read, txErr is the error of EXEC and err is the connection error.
+func (p *Pipeline) exec(c *connection, cmds []Cmder) (n int, txErr, err error) {
+	var buf []byte
+	var chunk, queued []Cmder
+	multi := p.multi
+	if multi {
+		buf, _ = packCommand("MULTI")
+	}
+	flush := func(last bool) error {
+		if last && p.multi {
+			request, _ := packCommand("EXEC")
+			buf = append(buf, request...)
+		}
+		if len(buf) == 0 {
+			return nil
+		}
+		if _, err := c.Conn.Write(buf); err != nil {
+			return err
+		}
+		buf = buf[:0]
+		if multi {
+			rp, err := c.RecvReply()
+			if err != nil {
+				return err
+			}
+			n++
+			if err := rp.OKValue(); err != nil {
+				return err
+			}
+			multi = false
+		}
+		for _, cmd := range chunk {
+			rp, err := c.RecvReply()
+			if err != nil {
+				return err
+			}
+			n++
+			if p.multi && rp.Type != ErrorReply {
+				queued = append(queued, cmd)
+			} else {
+				cmd.setReply(rp)
+			}
+		}
+		chunk = chunk[:0]
+		if last && p.multi {
+			rp, err := c.RecvReply()
+			if err != nil {
+				return err
+			}
+			n++
+			txErr = setExecReply(queued, rp)
+		}
+		return nil
+	}
+	for _, cmd := range cmds {
+		request, err := packCommand(cmd.Args()...)
+		if err != nil {
+			cmd.setErr(err)
+			continue
+		}
+		if len(chunk) > 0 && len(buf)+len(request) > p.ChunkBytes {
+			if err := flush(false); err != nil {
+				return n, nil, err
+			}
+		}
+		buf = append(buf, request...)
+		chunk = append(chunk, cmd)
+		if len(chunk) >= p.ChunkSize {
+			if err := flush(false); err != nil {
+				return n, nil, err
+			}
+		}
+	}
+	err = flush(true)
+	return n, txErr, err
+}
+
+// setExecReply sets the replies of EXEC to the queued commands.
+func setExecReply(queued []Cmder, rp *Reply) error {
+	if rp.Type == ErrorReply {
+		err := errors.New(rp.Error)
+		setCmdsErr(queued, err)
+		return err
+	}
+	if rp.isNilMulti() {
+		setCmdsErr(queued, ErrTxAborted)
+		return ErrTxAborted
+	}
+	if len(rp.Multi) != len(queued) {
+		err := errors.New("EXEC reply protocol error")
+		setCmdsErr(queued, err)
+		return err
+	}
+	for i, cmd := range queued {
+		cmd.setReply(rp.Multi[i])
+	}
+	return nil
+}
+
+func (p *Pipeline) cmd(args ...interface{}) *Cmd {
+	cmd := &Cmd{newBaseCmd(args)}
+	p.Queue(cmd)
+	return cmd
+}
+
+func (p *Pipeline) status(args ...interface{}) *StatusCmd {
+	cmd := &StatusCmd{baseCmd: newBaseCmd(args)}
+	p.Queue(cmd)
+	return cmd
+}
+
+func (p *Pipeline) integer(args ...interface{}) *IntCmd {
+	cmd := &IntCmd{baseCmd: newBaseCmd(args)}
+	p.Queue(cmd)
+	return cmd
+}
+
+func (p *Pipeline) boolean(args ...interface{}) *BoolCmd {
+	cmd := &BoolCmd{baseCmd: newBaseCmd(args)}
+	p.Queue(cmd)
+	return cmd
+}
+
+func (p *Pipeline) float(args ...interface{}) *FloatCmd {
+	cmd := &FloatCmd{baseCmd: newBaseCmd(args)}
+	p.Queue(cmd)
+	return cmd
+}
+
+func (p *Pipeline) bytes(args ...interface{}) *BytesCmd {
+	cmd := &BytesCmd{baseCmd: newBaseCmd(args)}
+	p.Queue(cmd)
+	return cmd
+}
+
+func (p *Pipeline) str(args ...interface{}) *StringCmd {
+	cmd := &StringCmd{baseCmd: newBaseCmd(args)}
+	p.Queue(cmd)
+	return cmd
+}
+
+func (p *Pipeline) bytesSlice(args ...interface{}) *BytesSliceCmd {
+	cmd := &BytesSliceCmd{baseCmd: newBaseCmd(args)}
+	p.Queue(cmd)
+	return cmd
+}
+
+func (p *Pipeline) stringSlice(args ...interface{}) *StringSliceCmd {
+	cmd := &StringSliceCmd{baseCmd: newBaseCmd(args)}
+	p.Queue(cmd)
+	return cmd
+}
+
+func (p *Pipeline) stringMap(args ...interface{}) *StringMapCmd {
+	cmd := &StringMapCmd{baseCmd: newBaseCmd(args)}
+	p.Queue(cmd)
+	return cmd
+}
+
+func (p *Pipeline) boolSlice(args ...interface{}) *BoolSliceCmd {
+	cmd := &BoolSliceCmd{baseCmd: newBaseCmd(args)}
+	p.Queue(cmd)
+	return cmd
+}
+
+// Command queues a raw redis command, its reply is kept as is.
+func (p *Pipeline) Command(args ...interface{}) *Cmd {
+	return p.cmd(packArgs(args...)...)
+}
+
+// Append queues APPEND, see Redis.Append.
+func (p *Pipeline) Append(key, value string) *IntCmd {
+	return p.integer("APPEND", key, value)
+}
+
+// Decr queues DECR, see Redis.Decr.
+func (p *Pipeline) Decr(key string) *IntCmd {
+	return p.integer("DECR", key)
+}
+
+// DecrBy queues DECRBY, see Redis.DecrBy.
+func (p *Pipeline) DecrBy(key string, decrement int) *IntCmd {
+	return p.integer("DECRBY", key, decrement)
+}
+
+// Get queues GET, see Redis.Get.
+func (p *Pipeline) Get(key string) *BytesCmd {
+	return p.bytes("GET", key)
+}
+
+// GetRange queues GETRANGE, see Redis.GetRange.
+func (p *Pipeline) GetRange(key string, start, end int) *StringCmd {
+	return p.str("GETRANGE", key, start, end)
+}
+
+// GetSet queues GETSET, see Redis.GetSet.
+func (p *Pipeline) GetSet(key, value string) *BytesCmd {
+	return p.bytes("GETSET", key, value)
+}
+
+// Incr queues INCR, see Redis.Incr.
+func (p *Pipeline) Incr(key string) *IntCmd {
+	return p.integer("INCR", key)
+}
+
+// IncrBy queues INCRBY, see Redis.IncrBy.
+func (p *Pipeline) IncrBy(key string, increment int) *IntCmd {
+	return p.integer("INCRBY", key, increment)
+}
+
+// IncrByFloat queues INCRBYFLOAT, see Redis.IncrByFloat.
+func (p *Pipeline) IncrByFloat(key string, increment float64) *FloatCmd {
+	return p.float("INCRBYFLOAT", key, increment)
+}
+
+// MGet queues MGET, see Redis.MGet.
+func (p *Pipeline) MGet(keys ...string) *BytesSliceCmd {
+	return p.bytesSlice(packArgs("MGET", keys)...)
+}
+
+// MSet queues MSET, see Redis.MSet.
+func (p *Pipeline) MSet(pairs map[string]string) *StatusCmd {
+	return p.status(packArgs("MSET", pairs)...)
+}
+
+// Set queues SET, see Redis.Set.
+func (p *Pipeline) Set(key, value string, seconds, milliseconds int, mustExists, mustNotExists bool) *StatusCmd {
+	args := packArgs("SET", key, value)
+	if seconds > 0 {
+		args = append(args, "EX", seconds)
+	}
+	if milliseconds > 0 {
+		args = append(args, "PX", milliseconds)
+	}
+	if mustExists {
+		args = append(args, "XX")
+	} else if mustNotExists {
+		args = append(args, "NX")
+	}
+	return p.status(args...)
+}
+
+// Setex queues SETEX, see Redis.Setex.
+func (p *Pipeline) Setex(key string, seconds int, value string) *StatusCmd {
+	return p.status("SETEX", key, seconds, value)
+}
+
+// Setnx queues SETNX, see Redis.Setnx.
+func (p *Pipeline) Setnx(key, value string) *BoolCmd {
+	return p.boolean("SETNX", key, value)
+}
+
+// StrLen queues STRLEN, see Redis.StrLen.
+func (p *Pipeline) StrLen(key string) *IntCmd {
+	return p.integer("STRLEN", key)
+}
+
+// Del queues DEL, see Redis.Del.
+func (p *Pipeline) Del(keys ...string) *IntCmd {
+	return p.integer(packArgs("DEL", keys)...)
+}
+
+// Exists queues EXISTS, see Redis.Exists.
+func (p *Pipeline) Exists(key string) *BoolCmd {
+	return p.boolean("EXISTS", key)
+}
+
+// Expire queues EXPIRE, see Redis.Expire.
+func (p *Pipeline) Expire(key string, seconds int) *BoolCmd {
+	return p.boolean("EXPIRE", key, seconds)
+}
+
+// ExpireAt queues EXPIREAT, see Redis.ExpireAt.
+func (p *Pipeline) ExpireAt(key string, timestamp int64) *BoolCmd {
+	return p.boolean("EXPIREAT", key, timestamp)
+}
+
+// Persist queues PERSIST, see Redis.Persist.
+func (p *Pipeline) Persist(key string) *BoolCmd {
+	return p.boolean("PERSIST", key)
+}
+
+// PExpire queues PEXPIRE, see Redis.PExpire.
+func (p *Pipeline) PExpire(key string, milliseconds int) *BoolCmd {
+	return p.boolean("PEXPIRE", key, milliseconds)
+}
+
+// PTTL queues PTTL, see Redis.PTTL.
+func (p *Pipeline) PTTL(key string) *IntCmd {
+	return p.integer("PTTL", key)
+}
+
+// Rename queues RENAME, see Redis.Rename.
+func (p *Pipeline) Rename(key, newkey string) *StatusCmd {
+	return p.status("RENAME", key, newkey)
+}
+
+// TTL queues TTL, see Redis.TTL.
+func (p *Pipeline) TTL(key string) *IntCmd {
+	return p.integer("TTL", key)
+}
+
+// Type queues TYPE, see Redis.Type.
+func (p *Pipeline) Type(key string) *StatusCmd {
+	return p.status("TYPE", key)
+}
+
+// HDel queues HDEL, see Redis.HDel.
+func (p *Pipeline) HDel(key string, fields ...string) *IntCmd {
+	return p.integer(packArgs("HDEL", key, fields)...)
+}
+
+// HExists queues HEXISTS, see Redis.HExists.
+func (p *Pipeline) HExists(key, field string) *BoolCmd {
+	return p.boolean("HEXISTS", key, field)
+}
+
+// HGet queues HGET, see Redis.HGet.
+func (p *Pipeline) HGet(key, field string) *BytesCmd {
+	return p.bytes("HGET", key, field)
+}
+
+// HGetAll queues HGETALL, see Redis.HGetAll.
+func (p *Pipeline) HGetAll(key string) *StringMapCmd {
+	return p.stringMap("HGETALL", key)
+}
+
+// HIncrBy queues HINCRBY, see Redis.HIncrBy.
+func (p *Pipeline) HIncrBy(key, field string, increment int) *IntCmd {
+	return p.integer("HINCRBY", key, field, increment)
+}
+
+// HIncrByFloat queues HINCRBYFLOAT, see Redis.HIncrByFloat.
+func (p *Pipeline) HIncrByFloat(key, field string, increment float64) *FloatCmd {
+	return p.float("HINCRBYFLOAT", key, field, increment)
+}
+
+// HKeys queues HKEYS, see Redis.HKeys.
+func (p *Pipeline) HKeys(key string) *StringSliceCmd {
+	return p.stringSlice("HKEYS", key)
+}
+
+// HLen queues HLEN, see Redis.HLen.
+func (p *Pipeline) HLen(key string) *IntCmd {
+	return p.integer("HLEN", key)
+}
+
+// HMGet queues HMGET, see Redis.HMGet.
+func (p *Pipeline) HMGet(key string, fields ...string) *BytesSliceCmd {
+	return p.bytesSlice(packArgs("HMGET", key, fields)...)
+}
+
+// HMSet queues HMSET, see Redis.HMSet.
+func (p *Pipeline) HMSet(key string, pairs map[string]string) *StatusCmd {
+	return p.status(packArgs("HMSET", key, pairs)...)
+}
+
+// HSet queues HSET, see Redis.HSet.
+func (p *Pipeline) HSet(key, field, value string) *BoolCmd {
+	return p.boolean("HSET", key, field, value)
+}
+
+// HVals queues HVALS, see Redis.HVals.
+func (p *Pipeline) HVals(key string) *StringSliceCmd {
+	return p.stringSlice("HVALS", key)
+}
+
+// LIndex queues LINDEX, see Redis.LIndex.
+func (p *Pipeline) LIndex(key string, index int) *BytesCmd {
+	return p.bytes("LINDEX", key, index)
+}
+
+// LLen queues LLEN, see Redis.LLen.
+func (p *Pipeline) LLen(key string) *IntCmd {
+	return p.integer("LLEN", key)
+}
+
+// LPop queues LPOP, see Redis.LPop.
+func (p *Pipeline) LPop(key string) *BytesCmd {
+	return p.bytes("LPOP", key)
+}
+
+// LPush queues LPUSH, see Redis.LPush.
+func (p *Pipeline) LPush(key string, values ...string) *IntCmd {
+	return p.integer(packArgs("LPUSH", key, values)...)
+}
+
+// LRange queues LRANGE, see Redis.LRange.
+func (p *Pipeline) LRange(key string, start, end int) *StringSliceCmd {
+	return p.stringSlice("LRANGE", key, start, end)
+}
+
+// LRem queues LREM, see Redis.LRem.
+func (p *Pipeline) LRem(key string, count int, value string) *IntCmd {
+	return p.integer("LREM", key, count, value)
+}
+
+// LTrim queues LTRIM, see Redis.LTrim.
+func (p *Pipeline) LTrim(key string, start, stop int) *StatusCmd {
+	return p.status("LTRIM", key, start, stop)
+}
+
+// RPop queues RPOP, see Redis.RPop.
+func (p *Pipeline) RPop(key string) *BytesCmd {
+	return p.bytes("RPOP", key)
+}
+
+// RPush queues RPUSH, see Redis.RPush.
+func (p *Pipeline) RPush(key string, values ...string) *IntCmd {
+	return p.integer(packArgs("RPUSH", key, values)...)
+}
+
+// SAdd queues SADD, see Redis.SAdd.
+func (p *Pipeline) SAdd(key string, members ...string) *IntCmd {
+	return p.integer(packArgs("SADD", key, members)...)
+}
+
+// SCard queues SCARD, see Redis.SCard.
+func (p *Pipeline) SCard(key string) *IntCmd {
+	return p.integer("SCARD", key)
+}
+
+// SIsMember queues SISMEMBER, see Redis.SIsMember.
+func (p *Pipeline) SIsMember(key, member string) *BoolCmd {
+	return p.boolean("SISMEMBER", key, member)
+}
+
+// SMembers queues SMEMBERS, see Redis.SMembers.
+func (p *Pipeline) SMembers(key string) *StringSliceCmd {
+	return p.stringSlice("SMEMBERS", key)
+}
+
+// SRem queues SREM, see Redis.SRem.
+func (p *Pipeline) SRem(key string, members ...string) *IntCmd {
+	return p.integer(packArgs("SREM", key, members)...)
+}
+
+// ZAdd queues ZADD, see Redis.ZAdd.
+func (p *Pipeline) ZAdd(key string, pairs map[string]float64) *IntCmd {
+	args := packArgs("ZADD", key)
+	for member, score := range pairs {
+		args = append(args, score, member)
+	}
+	return p.integer(args...)
+}
+
+// ZCard queues ZCARD, see Redis.ZCard.
+func (p *Pipeline) ZCard(key string) *IntCmd {
+	return p.integer("ZCARD", key)
+}
+
+// ZCount queues ZCOUNT, see Redis.ZCount.
+func (p *Pipeline) ZCount(key, min, max string) *IntCmd {
+	return p.integer("ZCOUNT", key, min, max)
+}
+
+// ZIncrBy queues ZINCRBY, see Redis.ZIncrBy.
+func (p *Pipeline) ZIncrBy(key string, increment float64, member string) *FloatCmd {
+	return p.float("ZINCRBY", key, increment, member)
+}
+
+// ZRange queues ZRANGE, see Redis.ZRange.
+func (p *Pipeline) ZRange(key string, start, stop int, withscores bool) *StringSliceCmd {
+	args := []interface{}{"ZRANGE", key, start, stop}
+	if withscores {
+		args = append(args, "WITHSCORES")
+	}
+	return p.stringSlice(args...)
+}
+
+// ZRangeByScore queues ZRANGEBYSCORE, see Redis.ZRangeByScore.
+func (p *Pipeline) ZRangeByScore(key, min, max string, withscores, limit bool, offset, count int) *StringSliceCmd {
+	args := packArgs("ZRANGEBYSCORE", key, min, max)
+	if withscores {
+		args = append(args, "WITHSCORES")
+	}
+	if limit {
+		args = append(args, "LIMIT", offset, count)
+	}
+	return p.stringSlice(args...)
+}
+
+// ZRem queues ZREM, see Redis.ZRem.
+func (p *Pipeline) ZRem(key string, members ...string) *IntCmd {
+	return p.integer(packArgs("ZREM", key, members)...)
+}
+
+// ZRevRange queues ZREVRANGE, see Redis.ZRevRange.
+func (p *Pipeline) ZRevRange(key string, start, stop int, withscores bool) *StringSliceCmd {
+	args := []interface{}{"ZREVRANGE", key, start, stop}
+	if withscores {
+		args = append(args, "WITHSCORES")
+	}
+	return p.stringSlice(args...)
+}
+
+// ZRevRangeByScore queues ZREVRANGEBYSCORE, see Redis.ZRevRangeByScore.
+func (p *Pipeline) ZRevRangeByScore(key, max, min string, withscores, limit bool, offset, count int) *StringSliceCmd {
+	args := packArgs("ZREVRANGEBYSCORE", key, max, min)
+	if withscores {
+		args = append(args, "WITHSCORES")
+	}
+	if limit {
+		args = append(args, "LIMIT", offset, count)
+	}
+	return p.stringSlice(args...)
+}
+
+// ZScore queues ZSCORE, see Redis.ZScore.
+func (p *Pipeline) ZScore(key, member string) *BytesCmd {
+	return p.bytes("ZSCORE", key, member)
+}
+
+// Publish queues PUBLISH, see Redis.Publish.
+func (p *Pipeline) Publish(channel, message string) *IntCmd {
+	return p.integer("PUBLISH", channel, message)
+}
+
+// Eval queues EVAL, see Redis.Eval.
+func (p *Pipeline) Eval(script string, keys []string, args []string) *Cmd {
+	return p.cmd(packArgs("EVAL", script, len(keys), keys, args)...)
+}
+
+// EvalSha queues EVALSHA, see Redis.EvalSha.
+func (p *Pipeline) EvalSha(sha1 string, keys []string, args []string) *Cmd {
+	return p.cmd(packArgs("EVALSHA", sha1, len(keys), keys, args)...)
+}
+
+// ScriptExists queues SCRIPT EXISTS, see Redis.ScriptExists.
+func (p *Pipeline) ScriptExists(scripts ...string) *BoolSliceCmd {
+	return p.boolSlice(packArgs("SCRIPT", "EXISTS", scripts)...)
+}
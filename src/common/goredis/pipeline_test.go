@@ -0,0 +1,108 @@
+package goredis
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	r.Del("key", "hash")
+	p := r.Pipeline()
+	set := p.Set("key", "1", 0, 0, false, false)
+	incr := p.Incr("key")
+	hmset := p.HMSet("hash", map[string]string{"field": "value"})
+	hgetall := p.HGetAll("hash")
+	wrong := p.Incr("hash")
+	get := p.Get("key")
+	if p.Len() != 6 || incr.Err() != ErrNotExecuted {
+		t.Fail()
+	}
+	if err := p.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Len() != 0 {
+		t.Fail()
+	}
+	if s, err := set.Result(); err != nil || s != "OK" {
+		t.Error(s, err)
+	}
+	if n, err := incr.Result(); err != nil || n != 2 {
+		t.Error(n, err)
+	}
+	if err := hmset.Err(); err != nil {
+		t.Error(err)
+	}
+	if hash, err := hgetall.Result(); err != nil || hash["field"] != "value" {
+		t.Error(hash, err)
+	}
+	if wrong.Err() == nil || wrong.Reply().Type != ErrorReply {
+		t.Error("error reply not kept by the command")
+	}
+	if string(get.Val()) != "2" {
+		t.Error(get.Val())
+	}
+}
+
+func TestPipelineChunk(t *testing.T) {
+	r.Del("list")
+	p := r.Pipeline()
+	p.ChunkSize = 3
+	var pushes []*IntCmd
+	for i := 0; i < 10; i++ {
+		pushes = append(pushes, p.RPush("list", strconv.Itoa(i)))
+	}
+	p.ChunkBytes = 64
+	p.Command("SET", "key", string(make([]byte, 100)))
+	lrange := p.LRange("list", 0, -1)
+	if err := p.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	for i, push := range pushes {
+		if n, err := push.Result(); err != nil || n != int64(i+1) {
+			t.Error(i, n, err)
+		}
+	}
+	if list := lrange.Val(); len(list) != 10 || list[9] != "9" {
+		t.Error(list)
+	}
+}
+
+func TestTxPipeline(t *testing.T) {
+	r.Del("key")
+	p := r.TxPipeline()
+	p.ChunkSize = 2
+	incr := p.Incr("key")
+	incrBy := p.IncrBy("key", 10)
+	get := p.Get("key")
+	if err := p.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if incr.Val() != 1 || incrBy.Val() != 11 || string(get.Val()) != "11" {
+		t.Error(incr.Val(), incrBy.Val(), string(get.Val()))
+	}
+	incr = p.Incr("key")
+	unknown := p.Command("NOCOMMAND")
+	if err := p.Exec(); err == nil {
+		t.Error("EXECABORT expected")
+	}
+	if incr.Err() == nil || unknown.Err() == nil {
+		t.Error(incr.Err(), unknown.Err())
+	}
+	if n, _ := r.Incr("key"); n != 12 {
+		t.Error("aborted transaction executed", n)
+	}
+}
+
+func TestPipelineContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := r.WithContext(ctx).Pipeline()
+	ping := p.Command("PING")
+	if err := p.Exec(); err != context.Canceled {
+		t.Error(err)
+	}
+	if ping.Err() != context.Canceled {
+		t.Error(ping.Err())
+	}
+}
@@ -6,40 +6,58 @@ package goredis
 // This way it is possible to send multiple commands to the server without waiting for the replies at all,
 // and finally read the replies in a single step.
 type Pipelined struct {
-	redis *Redis
-	conn  *connection
-	times int
+	redis  *Redis
+	conn   *connection
+	times  int
+	broken bool
 }
 
 // Pipelining new a Pipelined from *redis.
+// If *redis is a WithContext view, every Command and Receive is bounded by the context.
 func (r *Redis) Pipelining() (*Pipelined, error) {
-	c, err := r.pool.Get()
+	c, err := r.pool.GetContext(r.ctx)
 	if err != nil {
 		return nil, err
 	}
-	return &Pipelined{r, c, 0}, nil
+	return &Pipelined{redis: r, conn: c}, nil
 }
 
 // Close closes current pipeline mode.
+// If some replies are not received or a network error happened,
+// the connection is closed instead of put back to the pool.
 func (p *Pipelined) Close() {
-	p.redis.pool.Put(p.conn)
+	if p.times == 0 && !p.broken {
+		p.redis.pool.Put(p.conn)
+	} else {
+		p.redis.pool.Discard(p.conn)
+	}
 	p.times = 0
 }
 
 // Command send raw redis command and do not wait for response.
 func (p *Pipelined) Command(args ...interface{}) error {
-	err := p.conn.SendCommand(args...)
+	err := p.conn.do(p.redis.ctx, func() error {
+		return p.conn.SendCommand(args...)
+	})
 	if err == nil {
 		p.times++
+	} else {
+		p.broken = true
 	}
 	return err
 }
 
 // Receive wait for one the response.
 func (p *Pipelined) Receive() (*Reply, error) {
-	rp, err := p.conn.RecvReply()
+	var rp *Reply
+	err := p.conn.do(p.redis.ctx, func() (err error) {
+		rp, err = p.conn.RecvReply()
+		return err
+	})
 	if err == nil {
 		p.times--
+	} else {
+		p.broken = true
 	}
 	return rp, err
 }
@@ -31,6 +31,8 @@ func (r *Redis) PubSub() (*PubSub, error) {
 	if err != nil {
 		return nil, err
 	}
+	// with RESP3 the messages are push replies, which are read by Receive
+	c.push = nil
 	return &PubSub{
 		redis:    r,
 		conn:     c,
@@ -40,8 +42,10 @@ func (r *Redis) PubSub() (*PubSub, error) {
 }
 
 // Close closes current pubsub command.
+// The connection is in subscribed state, so it is closed instead of put back to the pool.
 func (p *PubSub) Close() error {
-	return p.conn.Conn.Close()
+	p.redis.pool.Discard(p.conn)
+	return nil
 }
 
 // Receive returns the reply of pubsub command.
@@ -56,69 +60,112 @@ func (p *PubSub) Close() error {
 // 3) message: it is a message received as result of a PUBLISH command issued by another client.
 // The second element is the name of the originating channel, and the third argument is the actual message payload.
 func (p *PubSub) Receive() ([]string, error) {
+	m, err := p.ReceiveMessage()
+	if err != nil {
+		return nil, err
+	}
+	switch m.Kind {
+	case "psubscribe", "punsubscribe":
+		return []string{m.Kind, m.Pattern, strconv.FormatInt(m.Count, 10)}, nil
+	case "subscribe", "unsubscribe":
+		return []string{m.Kind, m.Channel, strconv.FormatInt(m.Count, 10)}, nil
+	case "pmessage":
+		return []string{m.Kind, m.Pattern, m.Channel, m.Payload}, nil
+	case "message":
+		return []string{m.Kind, m.Channel, m.Payload}, nil
+	}
+	return []string{m.Kind, m.Payload}, nil
+}
+
+// Message is a typed reply of pubsub command.
+// Kind is one of subscribe, unsubscribe, psubscribe, punsubscribe, message, pmessage and pong.
+// Count is the number of channels and patterns subscribed for the subscribe kinds.
+type Message struct {
+	Kind    string
+	Channel string
+	Pattern string
+	Payload string
+	Count   int64
+}
+
+// ReceiveMessage is like Receive but returns a typed Message.
+func (p *PubSub) ReceiveMessage() (*Message, error) {
 	rp, err := p.conn.RecvReply()
 	if err != nil {
 		return nil, err
 	}
+	if rp.Type == ErrorReply {
+		return nil, errors.New(rp.Error)
+	}
+	if rp.Type == StatusReply && strings.ToLower(rp.Status) == "pong" {
+		// RESP3 replies PING with a status instead of a push
+		return &Message{Kind: "pong"}, nil
+	}
+	if !rp.isMulti() || len(rp.Multi) < 2 {
+		return nil, errors.New("pubsub protocol error")
+	}
 	command, err := rp.Multi[0].StringValue()
 	if err != nil {
 		return nil, err
 	}
-	switch strings.ToLower(command) {
-	case "psubscribe", "punsubscribe":
-		pattern, err := rp.Multi[1].StringValue()
-		if err != nil {
-			return nil, err
+	m := &Message{Kind: strings.ToLower(command)}
+	switch m.Kind {
+	case "psubscribe", "punsubscribe", "subscribe", "unsubscribe":
+		if len(rp.Multi) < 3 {
+			return nil, errors.New("pubsub protocol error")
 		}
-		if command == "psubscribe" {
-			p.Patterns[pattern] = true
-		} else {
-			delete(p.Patterns, pattern)
-		}
-		number, err := rp.Multi[2].IntegerValue()
+		name, err := rp.Multi[1].StringValue()
 		if err != nil {
 			return nil, err
 		}
-		return []string{command, pattern, strconv.FormatInt(number, 10)}, nil
-	case "subscribe", "unsubscribe":
-		channel, err := rp.Multi[1].StringValue()
-		if err != nil {
+		if m.Count, err = rp.Multi[2].IntegerValue(); err != nil {
 			return nil, err
 		}
-		if command == "subscribe" {
-			p.Channels[channel] = true
-		} else {
-			delete(p.Channels, channel)
+		switch m.Kind {
+		case "psubscribe":
+			m.Pattern = name
+			p.Patterns[name] = true
+		case "punsubscribe":
+			m.Pattern = name
+			delete(p.Patterns, name)
+		case "subscribe":
+			m.Channel = name
+			p.Channels[name] = true
+		case "unsubscribe":
+			m.Channel = name
+			delete(p.Channels, name)
 		}
-		number, err := rp.Multi[2].IntegerValue()
-		if err != nil {
-			return nil, err
-		}
-		return []string{command, channel, strconv.FormatInt(number, 10)}, nil
+		return m, nil
 	case "pmessage":
-		pattern, err := rp.Multi[1].StringValue()
-		if err != nil {
+		if len(rp.Multi) < 4 {
+			return nil, errors.New("pubsub protocol error")
+		}
+		if m.Pattern, err = rp.Multi[1].StringValue(); err != nil {
 			return nil, err
 		}
-		channel, err := rp.Multi[2].StringValue()
-		if err != nil {
+		if m.Channel, err = rp.Multi[2].StringValue(); err != nil {
 			return nil, err
 		}
-		message, err := rp.Multi[3].StringValue()
-		if err != nil {
+		if m.Payload, err = rp.Multi[3].StringValue(); err != nil {
 			return nil, err
 		}
-		return []string{command, pattern, channel, message}, nil
+		return m, nil
 	case "message":
-		channel, err := rp.Multi[1].StringValue()
-		if err != nil {
+		if len(rp.Multi) < 3 {
+			return nil, errors.New("pubsub protocol error")
+		}
+		if m.Channel, err = rp.Multi[1].StringValue(); err != nil {
 			return nil, err
 		}
-		message, err := rp.Multi[2].StringValue()
-		if err != nil {
+		if m.Payload, err = rp.Multi[2].StringValue(); err != nil {
 			return nil, err
 		}
-		return []string{command, channel, message}, nil
+		return m, nil
+	case "pong":
+		if m.Payload, err = rp.Multi[1].StringValue(); err != nil {
+			return nil, err
+		}
+		return m, nil
 	}
 	return nil, errors.New("pubsub protocol error")
 }
@@ -146,3 +193,9 @@ func (p *PubSub) PUnSubscribe(patterns ...string) error {
 	args := packArgs("PUNSUBSCRIBE", patterns)
 	return p.conn.SendCommand(args...)
 }
+
+// Ping sends a PING in subscribed state, the reply is a pong kind message.
+func (p *PubSub) Ping(payload string) error {
+	args := packArgs("PING", payload)
+	return p.conn.SendCommand(args...)
+}
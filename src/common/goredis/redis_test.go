@@ -1,9 +1,24 @@
 package goredis
 
 import (
+	"container/list"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"common/goredis/redistest"
 )
 
 var (
@@ -16,10 +31,24 @@ var (
 	r        *Redis
 
 	format = "tcp://auth:%s@%s/%d?timeout=%s&maxidle=%d"
+
+	// testServer is the in-process server the tests run against, unless REDIS_TEST_ADDR is set.
+	testServer *redistest.Server
 )
 
 func init() {
-	client, err := Dial(&DialConfig{network, address, db, password, timeout, maxidle})
+	if addr := os.Getenv("REDIS_TEST_ADDR"); addr != "" {
+		address = addr
+	} else {
+		server, err := redistest.NewServer()
+		if err != nil {
+			panic(err)
+		}
+		registerTestScripts(server)
+		testServer = server
+		address = server.Addr()
+	}
+	client, err := Dial(&DialConfig{Network: network, Address: address, Database: db, Password: password, Timeout: timeout, MaxIdle: maxidle})
 	if err != nil {
 		panic(err)
 	}
@@ -27,7 +56,7 @@ func init() {
 }
 
 func TestDial(t *testing.T) {
-	redis, err := Dial(&DialConfig{network, address, db, password, timeout, maxidle})
+	redis, err := Dial(&DialConfig{Network: network, Address: address, Database: db, Password: password, Timeout: timeout, MaxIdle: maxidle})
 	if err != nil {
 		t.Error(err)
 	} else if err := redis.Ping(); err != nil {
@@ -37,7 +66,7 @@ func TestDial(t *testing.T) {
 }
 
 func TestDialTimeout(t *testing.T) {
-	redis, err := Dial(&DialConfig{network, address, db, password, timeout, maxidle})
+	redis, err := Dial(&DialConfig{Network: network, Address: address, Database: db, Password: password, Timeout: timeout, MaxIdle: maxidle})
 	if err != nil {
 		t.Error(err)
 	} else if err := redis.Ping(); err != nil {
@@ -55,3 +84,509 @@ func TestDiaURL(t *testing.T) {
 	}
 	redis.pool.Close()
 }
+
+// newTestCert generates a self-signed certificate of 127.0.0.1 and localhost,
+// and the pool to verify it.
+func newTestCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "goredis test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, pool
+}
+
+func TestDialTLS(t *testing.T) {
+	cert, pool := newTestCert(t)
+	server, err := redistest.NewTLSServer(&tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	redis, err := Dial(&DialConfig{Address: server.Addr(), TLSConfig: &tls.Config{RootCAs: pool}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	if err := redis.Ping(); err != nil {
+		t.Error(err)
+	}
+	if _, err := Dial(&DialConfig{Address: server.Addr(), TLSConfig: &tls.Config{}}); err == nil {
+		t.Error("unknown certificate accepted")
+	}
+	redis, err = DialURL("rediss://" + server.Addr() + "/2?skipverify=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	redis.Set("key", "value", 0, 0, false, false)
+	if keys := server.Keys(2); len(keys) != 1 || keys[0] != "key" {
+		t.Error(keys)
+	}
+}
+
+func TestDialACL(t *testing.T) {
+	server, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.RequireAuth("admin")
+	server.AddUser("app", "secret")
+	redis, err := Dial(&DialConfig{Address: server.Addr(), Username: "app", Password: "secret", ClientName: "worker"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	if rp, err := redis.ExecuteCommand("CLIENT", "GETNAME"); err != nil {
+		t.Error(err)
+	} else if name, _ := rp.StringValue(); name != "worker" {
+		t.Error(name)
+	}
+	if _, err := Dial(&DialConfig{Address: server.Addr(), Username: "app", Password: "admin"}); err == nil {
+		t.Error("wrong password accepted")
+	}
+	redis, err = DialURL("redis://app:secret@" + server.Addr() + "/0?clientname=url")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	if rp, err := redis.ExecuteCommand("CLIENT", "INFO"); err != nil {
+		t.Error(err)
+	} else if info, _ := rp.StringValue(); !strings.Contains(info, "name=url") || !strings.Contains(info, "user=app") {
+		t.Error(info)
+	}
+	// the user of a tcp URL is a placeholder
+	redis, err = DialURL("tcp://auth:admin@" + server.Addr() + "/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redis.ClosePool()
+}
+
+func TestDialUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redis.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip(err)
+	}
+	server := redistest.NewServerListener(l)
+	defer server.Close()
+	redis, err := Dial(&DialConfig{Network: "unix", Address: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	if err := redis.Ping(); err != nil {
+		t.Error(err)
+	}
+	redis, err = DialURL("unix://" + path + "?db=3&timeout=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	redis.Set("key", "value", 0, 0, false, false)
+	if keys := server.Keys(3); len(keys) != 1 || keys[0] != "key" {
+		t.Error(keys)
+	}
+}
+
+func TestPoolMaxActive(t *testing.T) {
+	server := newFakeRedis(t)
+	redis, err := Dial(&DialConfig{Address: server.Addr(), MaxActive: 2, WaitTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	c1, err := redis.pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := redis.pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := redis.pool.Get(); err != ErrPoolExhausted {
+		t.Error(err)
+	}
+	stats := redis.PoolStats()
+	if stats.InUse != 2 || stats.Idle != 0 || stats.Waits != 1 || stats.Timeouts != 1 {
+		t.Error(stats)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		redis.pool.Put(c1)
+	}()
+	if err := redis.Ping(); err != nil {
+		t.Error(err)
+	}
+	redis.pool.Discard(c2)
+	stats = redis.PoolStats()
+	if stats.InUse != 0 || stats.Idle != 1 || stats.Waits != 2 || stats.Discards != 1 {
+		t.Error(stats)
+	}
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	server := newFakeRedis(t)
+	redis, err := Dial(&DialConfig{Address: server.Addr(), IdleTimeout: 10 * time.Millisecond, TestOnBorrow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	c, err := redis.pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redis.pool.Put(c)
+	time.Sleep(20 * time.Millisecond)
+	if c2, err := redis.pool.Get(); err != nil {
+		t.Error(err)
+	} else if c2 == c {
+		t.Fail()
+	} else {
+		redis.pool.Put(c2)
+	}
+	if stats := redis.PoolStats(); stats.Discards != 1 || stats.Idle != 1 {
+		t.Error(stats)
+	}
+}
+
+func TestPoolDialErrors(t *testing.T) {
+	server := newFakeRedis(t)
+	redis, err := Dial(&DialConfig{Address: server.Addr(), Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	server.listener.Close()
+	redis.pool.Drain()
+	if err := redis.Ping(); err == nil {
+		t.Fail()
+	}
+	if stats := redis.PoolStats(); stats.DialErrors != 1 || stats.InUse != 0 {
+		t.Error(stats)
+	}
+}
+
+// hangingServer accepts connections but never replies.
+func hangingServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				buf := make([]byte, 1024)
+				for {
+					if _, err := conn.Read(buf); err != nil {
+						conn.Close()
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func TestPoolWaitDeadline(t *testing.T) {
+	p := &connPool{
+		MaxIdle:     1,
+		MaxActive:   1,
+		WaitTimeout: 100 * time.Millisecond,
+		Dial: func() (*connection, error) {
+			return &connection{}, nil
+		},
+		idle:    list.New(),
+		waiters: list.New(),
+	}
+	if _, err := p.Get(); err != nil {
+		t.Fatal(err)
+	}
+	// the waiter is woken up again and again, but no connection is put back
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(20 * time.Millisecond):
+				p.mutex.Lock()
+				p.wakeup()
+				p.mutex.Unlock()
+			}
+		}
+	}()
+	start := time.Now()
+	if _, err := p.Get(); err != ErrPoolExhausted {
+		t.Error(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Error("waited", d)
+	}
+	if stats := p.Stats(); stats.Waits != 1 || stats.Timeouts != 1 {
+		t.Error(stats)
+	}
+}
+
+func TestPoolTestOnBorrowTimeout(t *testing.T) {
+	l := hangingServer(t)
+	defer l.Close()
+	redis, err := Dial(&DialConfig{Address: l.Addr().String(), Timeout: 100 * time.Millisecond, TestOnBorrow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	c, err := redis.pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redis.pool.Put(c)
+	start := time.Now()
+	c2, err := redis.pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.pool.Put(c2)
+	if c2 == c {
+		t.Error("the connection which does not answer PING is borrowed")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Error("borrowed in", d)
+	}
+	// the idle connection of Dial is discarded by the first Get
+	if stats := redis.PoolStats(); stats.Discards != 2 {
+		t.Error(stats)
+	}
+}
+
+func TestWithContextTestOnBorrow(t *testing.T) {
+	l := hangingServer(t)
+	defer l.Close()
+	redis, err := Dial(&DialConfig{Address: l.Addr().String(), Timeout: 10 * time.Second, TestOnBorrow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// the PING of the idle connection of Dial is bounded by ctx
+	if _, err := redis.WithContext(ctx).Get("key"); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Error("returned in", d)
+	}
+}
+
+func TestWithContextDeadline(t *testing.T) {
+	l := hangingServer(t)
+	defer l.Close()
+	redis, err := Dial(&DialConfig{Address: l.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := redis.WithContext(ctx).Get("key"); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fail()
+	}
+	if stats := redis.PoolStats(); stats.InUse != 0 || stats.Idle != 0 || stats.Discards != 1 {
+		t.Error(stats)
+	}
+}
+
+func TestWithContextCancel(t *testing.T) {
+	l := hangingServer(t)
+	defer l.Close()
+	redis, err := Dial(&DialConfig{Address: l.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := redis.WithContext(ctx).Get("key"); err != context.Canceled {
+		t.Error(err)
+	}
+	if _, err := redis.WithContext(ctx).Get("key"); err != context.Canceled {
+		t.Error(err)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	server := newFakeRedis(t)
+	redis, err := Dial(&DialConfig{Address: server.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := redis.WithContext(ctx).Ping(); err != nil {
+		t.Error(err)
+	}
+	if redis.Context() != context.Background() || redis.WithContext(ctx).Context() != ctx {
+		t.Fail()
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := redis.Ping(); err != nil {
+		t.Error(err)
+	}
+	if stats := redis.PoolStats(); stats.Idle != 1 || stats.Discards != 0 {
+		t.Error(stats)
+	}
+}
+
+// resp3Server is an in-process redis server which speaks RESP3 after HELLO 3.
+func resp3Server(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serveFake(l, func(conn net.Conn, args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "HELLO":
+			if len(args) != 5 || args[1] != "3" || args[3] != "default" || args[4] != "secret" {
+				return "-NOPROTO unsupported protocol version\r\n"
+			}
+			return "%2\r\n" + bulkString("server") + bulkString("redis") + bulkString("proto") + ":3\r\n"
+		case "SELECT":
+			return "+OK\r\n"
+		case "GET":
+			if args[1] == "nil" {
+				return "_\r\n"
+			}
+			// a push message before the reply
+			return ">2\r\n" + bulkString("invalidate") + "*1\r\n" + bulkString(args[1]) + fmt.Sprintf("=%d\r\ntxt:%s\r\n", len(args[1])+4, args[1])
+		case "HGETALL":
+			return "|1\r\n+ttl\r\n:3600\r\n%2\r\n" + bulkString("a") + bulkString("1") + bulkString("b") + ",2.5\r\n"
+		case "SMEMBERS":
+			return "~2\r\n" + bulkString("x") + bulkString("y")
+		case "EXISTS":
+			return "#t\r\n"
+		case "ZRANGE":
+			return "*2\r\n*2\r\n" + bulkString("m1") + ",1\r\n*2\r\n" + bulkString("m2") + ",2\r\n"
+		case "ZRANK":
+			return "_\r\n"
+		case "BIG":
+			return "(3492890328409238509324850943850943825024385\r\n"
+		}
+		return "!21\r\nSYNTAX invalid syntax\r\n"
+	})
+	return l
+}
+
+func TestRESP3(t *testing.T) {
+	l := resp3Server(t)
+	defer l.Close()
+	redis, err := Dial(&DialConfig{Address: l.Addr().String(), Database: 1, Password: "secret", Protocol: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	if b, err := redis.Get("key"); err != nil {
+		t.Error(err)
+	} else if string(b) != "key" {
+		t.Fail()
+	}
+	select {
+	case rp := <-redis.PushMessages():
+		if items, err := rp.ListValue(); err != nil || len(items) != 2 || items[0] != "invalidate" || items[1] != "key" {
+			t.Error(items, err)
+		}
+	default:
+		t.Error("push message not received")
+	}
+	if b, err := redis.Get("nil"); err != nil || b != nil {
+		t.Error(b, err)
+	}
+	rp, err := redis.ExecuteCommand("HGETALL", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := rp.HashValue(); err != nil || hash["a"] != "1" || hash["b"] != "2.5" {
+		t.Error(hash, err)
+	}
+	if rp.Type != MapReply || rp.Attribute == nil || rp.Attribute.Multi[1].Integer != 3600 || rp.Multi[3].Double != 2.5 {
+		t.Fail()
+	}
+	if members, err := redis.SMembers("set"); err != nil || len(members) != 2 {
+		t.Error(members, err)
+	}
+	if ok, err := redis.Exists("key"); err != nil || !ok {
+		t.Error(ok, err)
+	}
+	if items, err := redis.ZRange("zset", 0, -1, true); err != nil || len(items) != 4 || items[3] != "2" {
+		t.Error(items, err)
+	}
+	if rank, err := redis.ZRank("zset", "m"); err != nil || rank != -1 {
+		t.Error(rank, err)
+	}
+	rp, err = redis.ExecuteCommand("BIG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := rp.BigIntValue(); err != nil || n.String() != "3492890328409238509324850943850943825024385" {
+		t.Error(n, err)
+	}
+	if _, err := redis.Del("key"); err == nil || err.Error() != "SYNTAX invalid syntax" {
+		t.Error(err)
+	}
+}
+
+func TestRESP3HelloError(t *testing.T) {
+	l := resp3Server(t)
+	defer l.Close()
+	if _, err := Dial(&DialConfig{Address: l.Addr().String(), Protocol: 3}); err == nil {
+		t.Fail()
+	}
+	if _, err := Dial(&DialConfig{Address: l.Addr().String(), Protocol: 4}); err == nil {
+		t.Fail()
+	}
+	redis, err := DialURL("tcp://auth:secret@" + l.Addr().String() + "/0?timeout=1s&maxidle=1&protocol=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	if redis.PushMessages() == nil {
+		t.Fail()
+	}
+}
@@ -0,0 +1,345 @@
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status is a status reply, such as OK.
+type Status string
+
+// nilArray is the null multi bulk reply.
+type nilArray struct{}
+
+// noReply is returned by the commands which write their replies themselves, such as SUBSCRIBE.
+type noReply struct{}
+
+// wait is returned by a blocking command which has nothing to serve yet,
+// the command is retried after a write until timeout, then reply is sent.
+type wait struct {
+	timeout time.Duration
+	reply   interface{}
+}
+
+var (
+	statusOK     = Status("OK")
+	statusQueued = Status("QUEUED")
+
+	errWrongType   = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errSyntax      = errors.New("ERR syntax error")
+	errNotInteger  = errors.New("ERR value is not an integer or out of range")
+	errNotFloat    = errors.New("ERR value is not a valid float")
+	errNoSuchKey   = errors.New("ERR no such key")
+	errOutOfRange  = errors.New("ERR index out of range")
+	errNoAuth      = errors.New("NOAUTH Authentication required.")
+	errInvalidDB   = errors.New("ERR DB index is out of range")
+	errNegTimeout  = errors.New("ERR timeout is negative")
+	errInvalidTime = errors.New("ERR invalid expire time")
+)
+
+type command struct {
+	arity   int // the number of the arguments with the name, -n means at least n
+	handler func(c *client, args []string) interface{}
+}
+
+var commands = make(map[string]*command)
+
+func addCommands(table map[string]*command) {
+	for name, cmd := range table {
+		commands[name] = cmd
+	}
+}
+
+type client struct {
+	server  *Server
+	conn    net.Conn
+	id      int64
+	name    string
+	index   int
+	user    string
+	authed  bool
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	created time.Time
+	last    string
+	closing bool
+
+	multi   bool
+	aborted bool
+	queue   [][]string
+	watched map[*db]map[string]uint64
+
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	monitor  bool
+
+	tracking bool
+	redirect int64
+}
+
+func (c *client) db() *db {
+	return c.server.dbs[c.index]
+}
+
+func (c *client) serve() {
+	defer c.conn.Close()
+	for {
+		args, err := readCommand(c.reader)
+		if err != nil {
+			if err != io.EOF {
+				c.server.mutex.Lock()
+				c.write(fmt.Errorf("ERR Protocol error: %v", err))
+				c.server.mutex.Unlock()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		c.server.mutex.Lock()
+		c.execute(args)
+		closing := c.closing
+		c.server.mutex.Unlock()
+		if closing {
+			return
+		}
+	}
+}
+
+// execute runs a command from the connection and writes the reply, the server mutex is held.
+func (c *client) execute(args []string) {
+	name := strings.ToUpper(args[0])
+	c.last = strings.ToLower(name)
+	c.server.monitorCommand(c, args)
+	cmd, err := lookupCommand(args)
+	if err != nil {
+		if c.multi {
+			c.aborted = true
+		}
+		c.write(err)
+		return
+	}
+	if !c.authed && name != "AUTH" && name != "HELLO" && name != "QUIT" {
+		c.write(errNoAuth)
+		return
+	}
+	if c.subscribed() && !pubsubCommands[name] {
+		c.write(fmt.Errorf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", strings.ToLower(name)))
+		return
+	}
+	if c.multi && !transactionCommands[name] {
+		c.queue = append(c.queue, args)
+		c.write(statusQueued)
+		return
+	}
+	c.server.current = c
+	reply := cmd.handler(c, args)
+	if w, ok := reply.(wait); ok {
+		reply = c.block(cmd, args, w)
+	}
+	c.server.current = nil
+	c.write(reply)
+	if c.server.dirty {
+		c.server.wakeup()
+	}
+}
+
+// block waits for the writes of the other clients and retries the command until it is served or timeout.
+func (c *client) block(cmd *command, args []string, w wait) interface{} {
+	s := c.server
+	var timeout <-chan time.Time
+	if w.timeout > 0 {
+		timer := time.NewTimer(w.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		changed := s.changed
+		if s.dirty {
+			s.wakeup()
+		}
+		s.mutex.Unlock()
+		select {
+		case <-changed:
+		case <-timeout:
+			s.mutex.Lock()
+			return w.reply
+		case <-s.done:
+			s.mutex.Lock()
+			return w.reply
+		}
+		s.mutex.Lock()
+		s.current = c
+		reply := cmd.handler(c, args)
+		if _, ok := reply.(wait); !ok {
+			return reply
+		}
+	}
+}
+
+// call runs a command inside EXEC or a script, the blocking commands do not block.
+func (c *client) call(args []string) interface{} {
+	cmd, err := lookupCommand(args)
+	if err != nil {
+		return err
+	}
+	reply := cmd.handler(c, args)
+	if w, ok := reply.(wait); ok {
+		return w.reply
+	}
+	return reply
+}
+
+func lookupCommand(args []string) (*command, error) {
+	cmd, ok := commands[strings.ToUpper(args[0])]
+	if !ok {
+		return nil, fmt.Errorf("ERR unknown command '%s'", args[0])
+	}
+	if cmd.arity > 0 && len(args) != cmd.arity || cmd.arity < 0 && len(args) < -cmd.arity {
+		return nil, fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(args[0]))
+	}
+	return cmd, nil
+}
+
+// write writes a reply to the connection.
+func (c *client) write(reply interface{}) {
+	if _, ok := reply.(noReply); ok {
+		return
+	}
+	writeReply(c.writer, reply)
+	c.writer.Flush()
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case nilArray:
+		w.WriteString("*-1\r\n")
+	case noReply:
+	case Status:
+		w.WriteString("+" + string(v) + "\r\n")
+	case error:
+		w.WriteString("-" + strings.Replace(v.Error(), "\r\n", " ", -1) + "\r\n")
+	case int:
+		w.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case bool:
+		if v {
+			w.WriteString(":1\r\n")
+		} else {
+			w.WriteString(":0\r\n")
+		}
+	case float64:
+		writeBulk(w, formatFloat(v))
+	case string:
+		writeBulk(w, v)
+	case []string:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, s := range v {
+			writeBulk(w, s)
+		}
+	case []interface{}:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	default:
+		panic(fmt.Sprintf("redistest: invalid reply type %T", reply))
+	}
+}
+
+func writeBulk(w *bufio.Writer, s string) {
+	w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n")
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+// readCommand reads a command as a multi bulk, or as an inline command.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > 1024*1024 {
+		return nil, errors.New("invalid multibulk length")
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("expected '$', got '%s'", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > 512*1024*1024 {
+			return nil, errors.New("invalid bulk length")
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func parseInt(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errNotInteger
+	}
+	return n, nil
+}
+
+func parseFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, errNotFloat
+	}
+	return f, nil
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// parseTimeout parses the timeout in seconds of a blocking command, 0 means forever.
+func parseTimeout(s string) (time.Duration, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.New("ERR timeout is not a float or out of range")
+	}
+	if f < 0 {
+		return 0, errNegTimeout
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
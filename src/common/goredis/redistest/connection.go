@@ -0,0 +1,167 @@
+package redistest
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	addCommands(map[string]*command{
+		"PING":   {-1, cmdPing},
+		"ECHO":   {2, cmdEcho},
+		"SELECT": {2, cmdSelect},
+		"SWAPDB": {3, cmdSwapDB},
+		"AUTH":   {-2, cmdAuth},
+		"HELLO":  {-1, cmdHello},
+		"QUIT":   {1, cmdQuit},
+	})
+}
+
+func cmdPing(c *client, args []string) interface{} {
+	if len(args) > 2 {
+		return errors.New("ERR wrong number of arguments for 'ping' command")
+	}
+	if c.subscribed() {
+		payload := ""
+		if len(args) == 2 {
+			payload = args[1]
+		}
+		return []string{"pong", payload}
+	}
+	if len(args) == 2 {
+		return args[1]
+	}
+	return Status("PONG")
+}
+
+func cmdEcho(c *client, args []string) interface{} {
+	return args[1]
+}
+
+func parseDB(s string) (int, error) {
+	index, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errNotInteger
+	}
+	if index < 0 || index >= Databases {
+		return 0, errInvalidDB
+	}
+	return index, nil
+}
+
+func cmdSelect(c *client, args []string) interface{} {
+	index, err := parseDB(args[1])
+	if err != nil {
+		return err
+	}
+	c.index = index
+	return statusOK
+}
+
+func cmdSwapDB(c *client, args []string) interface{} {
+	i, err := parseDB(args[1])
+	if err != nil {
+		return errors.New("ERR invalid first DB index")
+	}
+	j, err := parseDB(args[2])
+	if err != nil {
+		return errors.New("ERR invalid second DB index")
+	}
+	s := c.server
+	for _, d := range []*db{s.dbs[i], s.dbs[j]} {
+		for key := range d.keys {
+			d.touch(key)
+		}
+	}
+	s.dbs[i].keys, s.dbs[j].keys = s.dbs[j].keys, s.dbs[i].keys
+	for _, d := range []*db{s.dbs[i], s.dbs[j]} {
+		for key := range d.keys {
+			d.touch(key)
+		}
+	}
+	return statusOK
+}
+
+// auth checks the username and the password of the default user or the users of AddUser.
+func (c *client) auth(username, password string) error {
+	s := c.server
+	if username == "default" && s.password == "" && len(s.users) == 0 {
+		return errors.New("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+	expected, ok := s.users[username]
+	if username == "default" {
+		expected, ok = s.password, s.password != ""
+	}
+	if !ok || password != expected {
+		return errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	c.user = username
+	c.authed = true
+	return nil
+}
+
+func cmdAuth(c *client, args []string) interface{} {
+	var err error
+	switch len(args) {
+	case 2:
+		err = c.auth("default", args[1])
+	case 3:
+		err = c.auth(args[1], args[2])
+	default:
+		return errSyntax
+	}
+	if err != nil {
+		return err
+	}
+	return statusOK
+}
+
+func cmdHello(c *client, args []string) interface{} {
+	if len(args) > 1 {
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return errors.New("ERR Protocol version is not an integer or out of range")
+		}
+		if version != 2 {
+			return errors.New("NOPROTO unsupported protocol version")
+		}
+	}
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				return errSyntax
+			}
+			if err := c.auth(args[i+1], args[i+2]); err != nil {
+				return err
+			}
+			i += 2
+		case "SETNAME":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			c.name = args[i+1]
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	if !c.authed {
+		return errNoAuth
+	}
+	return []interface{}{
+		"server", "redis",
+		"version", Version,
+		"proto", 2,
+		"id", c.id,
+		"mode", "standalone",
+		"role", "master",
+		"modules", []interface{}{},
+	}
+}
+
+func cmdQuit(c *client, args []string) interface{} {
+	c.closing = true
+	return statusOK
+}
@@ -0,0 +1,474 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	addCommands(map[string]*command{
+		"GEOADD":            {-5, cmdGeoAdd},
+		"GEOPOS":            {-2, cmdGeoPos},
+		"GEODIST":           {-4, cmdGeoDist},
+		"GEOHASH":           {-2, cmdGeoHash},
+		"GEORADIUS":         {-6, cmdGeoRadius},
+		"GEORADIUSBYMEMBER": {-5, cmdGeoRadius},
+		"GEOSEARCH":         {-7, cmdGeoSearch},
+		"GEOSEARCHSTORE":    {-8, cmdGeoSearch},
+	})
+}
+
+// The geohash of redis has 26 steps for each coordinate, the latitude is limited to the range of EPSG:3857.
+const (
+	geoStep        = 26
+	geoLatMax      = 85.05112878
+	geoEarthRadius = 6372797.560856
+)
+
+// geoEncode interleaves the cell numbers of the coordinates, longitude first, to a 52 bits geohash.
+func geoEncode(longitude, latitude, latMax float64) uint64 {
+	const max = 1<<geoStep - 1
+	lon := uint64(math.Min(max, (longitude+180)/360*(1<<geoStep)))
+	lat := uint64(math.Min(max, (latitude+latMax)/(2*latMax)*(1<<geoStep)))
+	var hash uint64
+	for i := geoStep - 1; i >= 0; i-- {
+		hash = hash<<2 | (lon>>uint(i)&1)<<1 | lat>>uint(i)&1
+	}
+	return hash
+}
+
+// geoDecode returns the center of the cell of a geohash.
+func geoDecode(hash uint64) (longitude, latitude float64) {
+	var lon, lat uint64
+	for i := geoStep - 1; i >= 0; i-- {
+		lon = lon<<1 | hash>>uint(2*i+1)&1
+		lat = lat<<1 | hash>>uint(2*i)&1
+	}
+	longitude = -180 + (float64(lon)+0.5)*360/(1<<geoStep)
+	latitude = -geoLatMax + (float64(lat)+0.5)*2*geoLatMax/(1<<geoStep)
+	return math.Max(-180, math.Min(180, longitude)), math.Max(-geoLatMax, math.Min(geoLatMax, latitude))
+}
+
+// geoHashString returns the standard 11 characters geohash of GEOHASH, whose latitude range is -90 to 90.
+func geoHashString(score float64) string {
+	const alphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+	longitude, latitude := geoDecode(uint64(score))
+	hash := geoEncode(longitude, latitude, 90)
+	b := make([]byte, 11)
+	for i := range b {
+		var idx uint64
+		if i < 10 {
+			idx = hash >> uint(52-(i+1)*5) & 0x1f
+		}
+		b[i] = alphabet[idx]
+	}
+	return string(b)
+}
+
+// geoDistance returns the distance in meters of two points by the haversine formula.
+func geoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lon1r := lat1*math.Pi/180, lon1*math.Pi/180
+	lat2r, lon2r := lat2*math.Pi/180, lon2*math.Pi/180
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((lon2r - lon1r) / 2)
+	return 2 * geoEarthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+func parseGeoUnit(s string) (float64, error) {
+	switch strings.ToLower(s) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, errors.New("ERR unsupported unit provided. please use M, KM, FT, MI")
+}
+
+func parseCoordinates(lonArg, latArg string) (float64, float64, error) {
+	lon, err := parseFloat(lonArg)
+	if err != nil {
+		return 0, 0, err
+	}
+	lat, err := parseFloat(latArg)
+	if err != nil {
+		return 0, 0, err
+	}
+	if lon < -180 || lon > 180 || lat < -geoLatMax || lat > geoLatMax {
+		return 0, 0, fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", lon, lat)
+	}
+	return lon, lat, nil
+}
+
+func formatDistance(meters, unit float64) string {
+	return strconv.FormatFloat(meters/unit, 'f', 4, 64)
+}
+
+func cmdGeoAdd(c *client, args []string) interface{} {
+	zadd := []string{"ZADD", args[1]}
+	i := 2
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		if opt != "NX" && opt != "XX" && opt != "CH" {
+			break
+		}
+		zadd = append(zadd, opt)
+	}
+	if len(args[i:]) == 0 || len(args[i:])%3 != 0 {
+		return errSyntax
+	}
+	for ; i < len(args); i += 3 {
+		lon, lat, err := parseCoordinates(args[i], args[i+1])
+		if err != nil {
+			return err
+		}
+		zadd = append(zadd, strconv.FormatUint(geoEncode(lon, lat, geoLatMax), 10), args[i+2])
+	}
+	return cmdZAdd(c, zadd)
+}
+
+func cmdGeoPos(c *client, args []string) interface{} {
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	result := make([]interface{}, 0, len(args)-2)
+	for _, member := range args[2:] {
+		score, ok := z[member]
+		if !ok {
+			result = append(result, nilArray{})
+			continue
+		}
+		lon, lat := geoDecode(uint64(score))
+		result = append(result, []string{formatFloat(lon), formatFloat(lat)})
+	}
+	return result
+}
+
+func cmdGeoDist(c *client, args []string) interface{} {
+	unit := 1.0
+	switch len(args) {
+	case 4:
+	case 5:
+		var err error
+		if unit, err = parseGeoUnit(args[4]); err != nil {
+			return err
+		}
+	default:
+		return errSyntax
+	}
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	score1, ok1 := z[args[2]]
+	score2, ok2 := z[args[3]]
+	if !ok1 || !ok2 {
+		return nil
+	}
+	lon1, lat1 := geoDecode(uint64(score1))
+	lon2, lat2 := geoDecode(uint64(score2))
+	return formatDistance(geoDistance(lon1, lat1, lon2, lat2), unit)
+}
+
+func cmdGeoHash(c *client, args []string) interface{} {
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	result := make([]interface{}, 0, len(args)-2)
+	for _, member := range args[2:] {
+		if score, ok := z[member]; ok {
+			result = append(result, geoHashString(score))
+		} else {
+			result = append(result, nil)
+		}
+	}
+	return result
+}
+
+// geoQuery is a search of GEORADIUS, GEORADIUSBYMEMBER, GEOSEARCH or GEOSEARCHSTORE.
+type geoQuery struct {
+	member        string
+	fromMember    bool
+	lon, lat      float64
+	fromLonLat    bool
+	radius        float64
+	byRadius      bool
+	width, height float64
+	byBox         bool
+	unit          float64
+	withCoord     bool
+	withDist      bool
+	withHash      bool
+	count         int
+	any           bool
+	desc          bool
+	store         string
+	storeDist     bool
+}
+
+type geoPoint struct {
+	member   string
+	score    float64
+	lon, lat float64
+	dist     float64
+}
+
+// parseShape parses the radius or the box and the unit at args[i:].
+func (q *geoQuery) parseShape(args []string, i int, box bool) (int, error) {
+	n := 2
+	if box {
+		n = 3
+	}
+	if i+n > len(args) {
+		return i, errSyntax
+	}
+	unit, err := parseGeoUnit(args[i+n-1])
+	if err != nil {
+		return i, err
+	}
+	q.unit = unit
+	if box {
+		q.byBox = true
+		if q.width, err = parseFloat(args[i]); err == nil {
+			q.height, err = parseFloat(args[i+1])
+		}
+		if err == nil && (q.width < 0 || q.height < 0) {
+			err = errors.New("ERR height or width cannot be negative")
+		}
+		q.width *= unit
+		q.height *= unit
+	} else {
+		q.byRadius = true
+		if q.radius, err = parseFloat(args[i]); err == nil && q.radius < 0 {
+			err = errors.New("ERR radius cannot be negative")
+		}
+		q.radius *= unit
+	}
+	return i + n, err
+}
+
+// parseOptions parses the options after the shape, search is true for GEOSEARCH and GEOSEARCHSTORE.
+func (q *geoQuery) parseOptions(args []string, search bool) error {
+	for i := 0; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "WITHCOORD":
+			q.withCoord = true
+		case "WITHDIST":
+			q.withDist = true
+		case "WITHHASH":
+			q.withHash = true
+		case "ASC":
+			q.desc = false
+		case "DESC":
+			q.desc = true
+		case "ANY":
+			q.any = true
+		case "COUNT":
+			if i+1 == len(args) {
+				return errSyntax
+			}
+			i++
+			n, err := parseInt(args[i])
+			if err != nil {
+				return err
+			}
+			if n <= 0 {
+				return errors.New("ERR COUNT must be > 0")
+			}
+			q.count = int(n)
+		case "STORE", "STOREDIST":
+			if search || i+1 == len(args) {
+				return errSyntax
+			}
+			i++
+			q.store, q.storeDist = args[i], opt == "STOREDIST"
+		case "FROMMEMBER", "FROMLONLAT", "BYRADIUS", "BYBOX":
+			if !search {
+				return errSyntax
+			}
+			var err error
+			if i, err = q.parseSearchArg(args, i); err != nil {
+				return err
+			}
+			i--
+		default:
+			return errSyntax
+		}
+	}
+	if q.any && q.count == 0 {
+		return errors.New("ERR the ANY argument requires COUNT argument")
+	}
+	if q.store != "" && (q.withCoord || q.withDist || q.withHash) {
+		return errors.New("ERR STORE option in GEORADIUS is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	}
+	return nil
+}
+
+// parseSearchArg parses FROMMEMBER, FROMLONLAT, BYRADIUS or BYBOX at args[i], and returns the index after it.
+func (q *geoQuery) parseSearchArg(args []string, i int) (int, error) {
+	switch strings.ToUpper(args[i]) {
+	case "FROMMEMBER":
+		if i+1 == len(args) || q.fromMember || q.fromLonLat {
+			return i, errSyntax
+		}
+		q.member, q.fromMember = args[i+1], true
+		return i + 2, nil
+	case "FROMLONLAT":
+		if i+2 >= len(args) || q.fromMember || q.fromLonLat {
+			return i, errSyntax
+		}
+		lon, lat, err := parseCoordinates(args[i+1], args[i+2])
+		q.lon, q.lat, q.fromLonLat = lon, lat, true
+		return i + 3, err
+	case "BYRADIUS", "BYBOX":
+		if q.byRadius || q.byBox {
+			return i, errSyntax
+		}
+		return q.parseShape(args, i+1, strings.EqualFold(args[i], "BYBOX"))
+	}
+	return i, errSyntax
+}
+
+// search returns the points of z in the shape ordered by distance.
+func (q *geoQuery) search(z zset) []geoPoint {
+	var points []geoPoint
+	for member, score := range z {
+		lon, lat := geoDecode(uint64(score))
+		p := geoPoint{member: member, score: score, lon: lon, lat: lat, dist: geoDistance(q.lon, q.lat, lon, lat)}
+		if q.byBox {
+			if geoDistance(lon, lat, q.lon, lat) > q.width/2 || geoDistance(lon, lat, lon, q.lat) > q.height/2 {
+				continue
+			}
+		} else if p.dist > q.radius {
+			continue
+		}
+		points = append(points, p)
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].dist != points[j].dist {
+			return points[i].dist < points[j].dist != q.desc
+		}
+		return points[i].member < points[j].member
+	})
+	if q.count > 0 && len(points) > q.count {
+		points = points[:q.count]
+	}
+	return points
+}
+
+// run searches the sorted set of key, and replies or stores the result.
+func (q *geoQuery) run(c *client, key string) interface{} {
+	d := c.db()
+	z, err := d.getZSet(key, false)
+	if err != nil {
+		return err
+	}
+	if q.fromMember {
+		score, ok := z[q.member]
+		if !ok {
+			return errors.New("ERR could not decode requested zset member")
+		}
+		q.lon, q.lat = geoDecode(uint64(score))
+	}
+	points := q.search(z)
+	if q.store != "" {
+		if len(points) == 0 {
+			d.remove(q.store)
+			return 0
+		}
+		stored := make(zset, len(points))
+		for _, p := range points {
+			stored[p.member] = p.score
+			if q.storeDist {
+				stored[p.member] = p.dist / q.unit
+			}
+		}
+		d.put(q.store, stored)
+		return len(points)
+	}
+	result := make([]interface{}, 0, len(points))
+	for _, p := range points {
+		if !q.withCoord && !q.withDist && !q.withHash {
+			result = append(result, p.member)
+			continue
+		}
+		item := []interface{}{p.member}
+		if q.withDist {
+			item = append(item, formatDistance(p.dist, q.unit))
+		}
+		if q.withHash {
+			item = append(item, int64(p.score))
+		}
+		if q.withCoord {
+			item = append(item, []string{formatFloat(p.lon), formatFloat(p.lat)})
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+func cmdGeoRadius(c *client, args []string) interface{} {
+	q := &geoQuery{}
+	i := 2
+	if strings.ToUpper(args[0]) == "GEORADIUSBYMEMBER" {
+		q.member, q.fromMember = args[2], true
+		i = 3
+	} else {
+		lon, lat, err := parseCoordinates(args[2], args[3])
+		if err != nil {
+			return err
+		}
+		q.lon, q.lat = lon, lat
+		i = 4
+	}
+	i, err := q.parseShape(args, i, false)
+	if err != nil {
+		return err
+	}
+	if err := q.parseOptions(args[i:], false); err != nil {
+		return err
+	}
+	return q.run(c, args[1])
+}
+
+func cmdGeoSearch(c *client, args []string) interface{} {
+	q := &geoQuery{}
+	key, options := args[1], args[2:]
+	if strings.ToUpper(args[0]) == "GEOSEARCHSTORE" {
+		key, options = args[2], args[3:]
+		q.store = args[1]
+		for i, opt := range options {
+			if strings.EqualFold(opt, "STOREDIST") {
+				q.storeDist = true
+				options = append(options[:i:i], options[i+1:]...)
+				break
+			}
+		}
+	}
+	var err error
+	store := q.store
+	q.store = ""
+	if err = q.parseOptions(options, true); err != nil {
+		return err
+	}
+	if !q.fromMember && !q.fromLonLat {
+		return errors.New("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+	}
+	if !q.byRadius && !q.byBox {
+		return errors.New("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+	}
+	if store != "" && (q.withCoord || q.withDist || q.withHash) {
+		return errSyntax
+	}
+	q.store = store
+	return q.run(c, key)
+}
@@ -0,0 +1,260 @@
+package redistest
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	addCommands(map[string]*command{
+		"HDEL":         {-3, cmdHDel},
+		"HEXISTS":      {3, cmdHExists},
+		"HGET":         {3, cmdHGet},
+		"HGETALL":      {2, cmdHGetAll},
+		"HINCRBY":      {4, cmdHIncrBy},
+		"HINCRBYFLOAT": {4, cmdHIncrByFloat},
+		"HKEYS":        {2, cmdHKeys},
+		"HVALS":        {2, cmdHVals},
+		"HLEN":         {2, cmdHLen},
+		"HMGET":        {-3, cmdHMGet},
+		"HMSET":        {-4, cmdHSet},
+		"HSET":         {-4, cmdHSet},
+		"HSETNX":       {4, cmdHSetnx},
+		"HSTRLEN":      {3, cmdHStrLen},
+		"HSCAN":        {-3, cmdHScan},
+	})
+}
+
+// getHash returns the hash of key, a new hash is stored if create is true and key does not exist.
+func (d *db) getHash(key string, create bool) (map[string]string, error) {
+	it := d.get(key)
+	if it == nil {
+		if !create {
+			return nil, nil
+		}
+		hash := make(map[string]string)
+		d.put(key, hash)
+		return hash, nil
+	}
+	hash, ok := it.value.(map[string]string)
+	if !ok {
+		return nil, errWrongType
+	}
+	return hash, nil
+}
+
+func sortedFields(hash map[string]string) []string {
+	fields := make([]string, 0, len(hash))
+	for field := range hash {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func cmdHDel(c *client, args []string) interface{} {
+	d := c.db()
+	hash, err := d.getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, field := range args[2:] {
+		if _, ok := hash[field]; ok {
+			delete(hash, field)
+			n++
+		}
+	}
+	if n > 0 {
+		d.modified(args[1])
+	}
+	return n
+}
+
+func cmdHExists(c *client, args []string) interface{} {
+	hash, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	_, ok := hash[args[2]]
+	return ok
+}
+
+func cmdHGet(c *client, args []string) interface{} {
+	hash, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	if value, ok := hash[args[2]]; ok {
+		return value
+	}
+	return nil
+}
+
+func cmdHGetAll(c *client, args []string) interface{} {
+	hash, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	result := make([]string, 0, 2*len(hash))
+	for _, field := range sortedFields(hash) {
+		result = append(result, field, hash[field])
+	}
+	return result
+}
+
+func cmdHIncrBy(c *client, args []string) interface{} {
+	by, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	hash, err := d.getHash(args[1], true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if s, ok := hash[args[2]]; ok {
+		if n, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return errors.New("ERR hash value is not an integer")
+		}
+	}
+	if by > 0 && n > math.MaxInt64-by || by < 0 && n < math.MinInt64-by {
+		return errors.New("ERR increment or decrement would overflow")
+	}
+	n += by
+	hash[args[2]] = strconv.FormatInt(n, 10)
+	d.modified(args[1])
+	return n
+}
+
+func cmdHIncrByFloat(c *client, args []string) interface{} {
+	by, err := parseFloat(args[3])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	hash, err := d.getHash(args[1], true)
+	if err != nil {
+		return err
+	}
+	var f float64
+	if s, ok := hash[args[2]]; ok {
+		if f, err = strconv.ParseFloat(s, 64); err != nil {
+			return errors.New("ERR hash value is not a float")
+		}
+	}
+	f += by
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return errors.New("ERR increment would produce NaN or Infinity")
+	}
+	hash[args[2]] = formatFloat(f)
+	d.modified(args[1])
+	return hash[args[2]]
+}
+
+func cmdHKeys(c *client, args []string) interface{} {
+	hash, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	return sortedFields(hash)
+}
+
+func cmdHVals(c *client, args []string) interface{} {
+	hash, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	values := make([]string, 0, len(hash))
+	for _, field := range sortedFields(hash) {
+		values = append(values, hash[field])
+	}
+	return values
+}
+
+func cmdHLen(c *client, args []string) interface{} {
+	hash, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	return len(hash)
+}
+
+func cmdHMGet(c *client, args []string) interface{} {
+	hash, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(args)-2)
+	for i, field := range args[2:] {
+		if value, ok := hash[field]; ok {
+			values[i] = value
+		}
+	}
+	return values
+}
+
+func cmdHSet(c *client, args []string) interface{} {
+	if len(args)%2 != 0 {
+		return errors.New("ERR wrong number of arguments for '" + strings.ToLower(args[0]) + "' command")
+	}
+	d := c.db()
+	hash, err := d.getHash(args[1], true)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for i := 2; i < len(args); i += 2 {
+		if _, ok := hash[args[i]]; !ok {
+			n++
+		}
+		hash[args[i]] = args[i+1]
+	}
+	d.modified(args[1])
+	if strings.EqualFold(args[0], "HMSET") {
+		return statusOK
+	}
+	return n
+}
+
+func cmdHSetnx(c *client, args []string) interface{} {
+	d := c.db()
+	hash, err := d.getHash(args[1], true)
+	if err != nil {
+		return err
+	}
+	if _, ok := hash[args[2]]; ok {
+		return 0
+	}
+	hash[args[2]] = args[3]
+	d.modified(args[1])
+	return 1
+}
+
+func cmdHStrLen(c *client, args []string) interface{} {
+	hash, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	return len(hash[args[2]])
+}
+
+func cmdHScan(c *client, args []string) interface{} {
+	s, err := parseScanArgs(args[2:], false)
+	if err != nil {
+		return err
+	}
+	hash, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	elements := make([]string, 0, 2*len(hash))
+	for _, field := range sortedFields(hash) {
+		elements = append(elements, field, hash[field])
+	}
+	return s.scan(c.server, elements, 2, nil)
+}
@@ -0,0 +1,94 @@
+package redistest
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// A hyperloglog is a string value of the HYLL header and the JSON of the sorted elements,
+// so the counts are exact, which makes the tests predictable.
+const hllHeader = "HYLL"
+
+var errNotHLL = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+
+func init() {
+	addCommands(map[string]*command{
+		"PFADD":   {-2, cmdPFAdd},
+		"PFCOUNT": {-2, cmdPFCount},
+		"PFMERGE": {-2, cmdPFMerge},
+	})
+}
+
+// getHLL returns the elements of the hyperloglog of key.
+func (d *db) getHLL(key string) (map[string]struct{}, bool, error) {
+	s, ok, err := d.getString(key)
+	if err != nil || !ok {
+		return make(map[string]struct{}), false, err
+	}
+	var elements []string
+	if !strings.HasPrefix(s, hllHeader) || json.Unmarshal([]byte(s[len(hllHeader):]), &elements) != nil {
+		return nil, false, errNotHLL
+	}
+	set := make(map[string]struct{}, len(elements))
+	for _, e := range elements {
+		set[e] = struct{}{}
+	}
+	return set, true, nil
+}
+
+func (d *db) setHLL(key string, set map[string]struct{}) {
+	b, _ := json.Marshal(sortedMembers(set))
+	d.setString(key, hllHeader+string(b))
+}
+
+func cmdPFAdd(c *client, args []string) interface{} {
+	d := c.db()
+	set, exists, err := d.getHLL(args[1])
+	if err != nil {
+		return err
+	}
+	changed := !exists
+	for _, e := range args[2:] {
+		if _, ok := set[e]; !ok {
+			set[e] = struct{}{}
+			changed = true
+		}
+	}
+	if !changed {
+		return 0
+	}
+	d.setHLL(args[1], set)
+	return 1
+}
+
+func cmdPFCount(c *client, args []string) interface{} {
+	d := c.db()
+	union := make(map[string]struct{})
+	for _, key := range args[1:] {
+		set, _, err := d.getHLL(key)
+		if err != nil {
+			return err
+		}
+		for e := range set {
+			union[e] = struct{}{}
+		}
+	}
+	return len(union)
+}
+
+func cmdPFMerge(c *client, args []string) interface{} {
+	d := c.db()
+	union := make(map[string]struct{})
+	for _, key := range args[1:] {
+		set, _, err := d.getHLL(key)
+		if err != nil {
+			return err
+		}
+		for e := range set {
+			union[e] = struct{}{}
+		}
+	}
+	d.setHLL(args[1], union)
+	return statusOK
+}
@@ -0,0 +1,552 @@
+package redistest
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	addCommands(map[string]*command{
+		"DEL":       {-2, cmdDel},
+		"UNLINK":    {-2, cmdDel},
+		"COPY":      {-3, cmdCopy},
+		"EXISTS":    {-2, cmdExists},
+		"EXPIRE":    {-3, cmdExpire},
+		"PEXPIRE":   {-3, cmdExpire},
+		"EXPIREAT":  {-3, cmdExpire},
+		"PEXPIREAT": {-3, cmdExpire},
+		"TTL":       {2, cmdTTL},
+		"PTTL":      {2, cmdTTL},
+		"PERSIST":   {2, cmdPersist},
+		"KEYS":      {2, cmdKeys},
+		"RANDOMKEY": {1, cmdRandomKey},
+		"RENAME":    {3, cmdRename},
+		"RENAMENX":  {3, cmdRename},
+		"TYPE":      {2, cmdType},
+		"MOVE":      {3, cmdMove},
+		"DUMP":      {2, cmdDump},
+		"RESTORE":   {-4, cmdRestore},
+		"OBJECT":    {-2, cmdObject},
+		"SCAN":      {-2, cmdScan},
+	})
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case []string:
+		return "list"
+	case map[string]string:
+		return "hash"
+	case map[string]struct{}:
+		return "set"
+	case zset:
+		return "zset"
+	case *stream:
+		return "stream"
+	}
+	return "none"
+}
+
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case []string:
+		return len(v) == 0
+	case map[string]string:
+		return len(v) == 0
+	case map[string]struct{}:
+		return len(v) == 0
+	case zset:
+		return len(v) == 0
+	}
+	return false
+}
+
+func cmdDel(c *client, args []string) interface{} {
+	d := c.db()
+	n := 0
+	for _, key := range args[1:] {
+		if d.remove(key) {
+			n++
+		}
+	}
+	return n
+}
+
+// copyValue returns a deep copy of the value of a key.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []string:
+		return append([]string{}, v...)
+	case map[string]string:
+		hash := make(map[string]string, len(v))
+		for field, s := range v {
+			hash[field] = s
+		}
+		return hash
+	case map[string]struct{}:
+		set := make(map[string]struct{}, len(v))
+		for member := range v {
+			set[member] = struct{}{}
+		}
+		return set
+	case zset:
+		z := make(zset, len(v))
+		for member, score := range v {
+			z[member] = score
+		}
+		return z
+	case *stream:
+		return v.copy()
+	}
+	return v
+}
+
+func cmdCopy(c *client, args []string) interface{} {
+	dst := c.db()
+	var replace bool
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "DB":
+			if i+1 == len(args) {
+				return errSyntax
+			}
+			i++
+			index, err := strconv.Atoi(args[i])
+			if err != nil || index < 0 || index >= Databases {
+				return errInvalidDB
+			}
+			dst = c.server.dbs[index]
+		case "REPLACE":
+			replace = true
+		default:
+			return errSyntax
+		}
+	}
+	src := c.db()
+	if src == dst && args[1] == args[2] {
+		return errors.New("ERR source and destination objects are the same")
+	}
+	it := src.peek(args[1])
+	if it == nil || !replace && dst.peek(args[2]) != nil {
+		return 0
+	}
+	dst.put(args[2], copyValue(it.value)).expire = it.expire
+	return 1
+}
+
+func cmdExists(c *client, args []string) interface{} {
+	d := c.db()
+	n := 0
+	for _, key := range args[1:] {
+		if d.peek(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExpire(c *client, args []string) interface{} {
+	n, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	now := c.server.now()
+	var at time.Time
+	switch strings.ToUpper(args[0]) {
+	case "EXPIRE":
+		at = now.Add(time.Duration(n) * time.Second)
+	case "PEXPIRE":
+		at = now.Add(time.Duration(n) * time.Millisecond)
+	case "EXPIREAT":
+		at = time.Unix(n, 0)
+	case "PEXPIREAT":
+		at = time.Unix(0, n*int64(time.Millisecond))
+	}
+	var nx, xx, gt, lt bool
+	for _, opt := range args[3:] {
+		switch strings.ToUpper(opt) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			return errors.New("ERR Unsupported option " + opt)
+		}
+	}
+	if nx && (xx || gt || lt) || gt && lt {
+		return errors.New("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	d := c.db()
+	it := d.peek(args[1])
+	if it == nil {
+		return 0
+	}
+	persistent := it.expire.IsZero()
+	if nx && !persistent || xx && persistent ||
+		gt && (persistent || !at.After(it.expire)) || lt && !persistent && !at.Before(it.expire) {
+		return 0
+	}
+	if !at.After(now) {
+		d.remove(args[1])
+		return 1
+	}
+	it.expire = at
+	d.touch(args[1])
+	return 1
+}
+
+func cmdTTL(c *client, args []string) interface{} {
+	it := c.db().peek(args[1])
+	if it == nil {
+		return -2
+	}
+	if it.expire.IsZero() {
+		return -1
+	}
+	ms := int64(it.expire.Sub(c.server.now()) / time.Millisecond)
+	if strings.ToUpper(args[0]) == "PTTL" {
+		return ms
+	}
+	return (ms + 500) / 1000
+}
+
+func cmdPersist(c *client, args []string) interface{} {
+	d := c.db()
+	it := d.peek(args[1])
+	if it == nil || it.expire.IsZero() {
+		return 0
+	}
+	it.expire = time.Time{}
+	d.touch(args[1])
+	return 1
+}
+
+func cmdKeys(c *client, args []string) interface{} {
+	keys := []string{}
+	for _, key := range c.db().sortedKeys() {
+		if match(args[1], key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func cmdRandomKey(c *client, args []string) interface{} {
+	keys := c.db().sortedKeys()
+	if len(keys) == 0 {
+		return nil
+	}
+	return keys[rand.Intn(len(keys))]
+}
+
+func cmdRename(c *client, args []string) interface{} {
+	d := c.db()
+	it := d.peek(args[1])
+	if it == nil {
+		return errNoSuchKey
+	}
+	nx := strings.ToUpper(args[0]) == "RENAMENX"
+	if args[1] == args[2] {
+		if nx {
+			return 0
+		}
+		return statusOK
+	}
+	if nx && d.peek(args[2]) != nil {
+		return 0
+	}
+	d.remove(args[1])
+	d.keys[args[2]] = it
+	d.touch(args[2])
+	if nx {
+		return 1
+	}
+	return statusOK
+}
+
+func cmdType(c *client, args []string) interface{} {
+	it := c.db().peek(args[1])
+	if it == nil {
+		return Status("none")
+	}
+	return Status(typeName(it.value))
+}
+
+func cmdMove(c *client, args []string) interface{} {
+	index, err := strconv.Atoi(args[2])
+	if err != nil || index < 0 || index >= Databases {
+		return errInvalidDB
+	}
+	if index == c.index {
+		return errors.New("ERR source and destination objects are the same")
+	}
+	src, dst := c.db(), c.server.dbs[index]
+	it := src.peek(args[1])
+	if it == nil || dst.peek(args[1]) != nil {
+		return 0
+	}
+	src.remove(args[1])
+	dst.keys[args[1]] = it
+	dst.touch(args[1])
+	return 1
+}
+
+// dumpPrefix marks the payload of DUMP, the payload is not compatible with redis.
+const dumpPrefix = "redistest:"
+
+type dumpValue struct {
+	Type   string            `json:"type"`
+	String string            `json:"string,omitempty"`
+	List   []string          `json:"list,omitempty"`
+	Hash   map[string]string `json:"hash,omitempty"`
+	ZSet   map[string]string `json:"zset,omitempty"`
+}
+
+func cmdDump(c *client, args []string) interface{} {
+	it := c.db().peek(args[1])
+	if it == nil {
+		return nil
+	}
+	v := dumpValue{Type: typeName(it.value)}
+	switch value := it.value.(type) {
+	case string:
+		v.String = value
+	case []string:
+		v.List = value
+	case map[string]string:
+		v.Hash = value
+	case map[string]struct{}:
+		v.List = setMembers(value)
+	case zset:
+		v.ZSet = make(map[string]string, len(value))
+		for member, score := range value {
+			v.ZSet[member] = formatFloat(score)
+		}
+	}
+	b, _ := json.Marshal(v)
+	return dumpPrefix + string(b)
+}
+
+func cmdRestore(c *client, args []string) interface{} {
+	ttl, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	if ttl < 0 {
+		return errors.New("ERR Invalid TTL value, must be >= 0")
+	}
+	var replace, absttl bool
+	for _, opt := range args[4:] {
+		switch strings.ToUpper(opt) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absttl = true
+		default:
+			return errSyntax
+		}
+	}
+	var v dumpValue
+	if !strings.HasPrefix(args[3], dumpPrefix) || json.Unmarshal([]byte(args[3][len(dumpPrefix):]), &v) != nil {
+		return errors.New("ERR DUMP payload version or checksum are wrong")
+	}
+	var value interface{}
+	switch v.Type {
+	case "string":
+		value = v.String
+	case "list":
+		value = append([]string{}, v.List...)
+	case "hash":
+		hash := make(map[string]string, len(v.Hash))
+		for field, s := range v.Hash {
+			hash[field] = s
+		}
+		value = hash
+	case "set":
+		set := make(map[string]struct{}, len(v.List))
+		for _, member := range v.List {
+			set[member] = struct{}{}
+		}
+		value = set
+	case "zset":
+		z := make(zset, len(v.ZSet))
+		for member, s := range v.ZSet {
+			if z[member], err = parseFloat(s); err != nil {
+				return errors.New("ERR Bad data format")
+			}
+		}
+		value = z
+	default:
+		return errors.New("ERR Bad data format")
+	}
+	d := c.db()
+	if !replace && d.peek(args[1]) != nil {
+		return errors.New("BUSYKEY Target key name already exists.")
+	}
+	it := d.put(args[1], value)
+	if ttl > 0 {
+		if absttl {
+			it.expire = time.Unix(0, ttl*int64(time.Millisecond))
+		} else {
+			it.expire = c.server.now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+	}
+	return statusOK
+}
+
+func cmdObject(c *client, args []string) interface{} {
+	sub := strings.ToUpper(args[1])
+	if sub == "HELP" {
+		return []string{"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:", "ENCODING <key>", "FREQ <key>", "IDLETIME <key>", "REFCOUNT <key>"}
+	}
+	if len(args) != 3 {
+		return errors.New("ERR wrong number of arguments for 'object|" + strings.ToLower(args[1]) + "' command")
+	}
+	it := c.db().peek(args[2])
+	if it == nil {
+		return nil
+	}
+	switch sub {
+	case "REFCOUNT":
+		return 1
+	case "ENCODING":
+		return encoding(it.value)
+	case "IDLETIME":
+		return int64(c.server.now().Sub(it.access) / time.Second)
+	case "FREQ":
+		return errors.New("ERR An LFU maxmemory policy is not selected, access frequency not tracked.")
+	}
+	return errors.New("ERR unknown subcommand '" + args[1] + "'. Try OBJECT HELP.")
+}
+
+// encoding returns the encoding which redis would use for the value.
+func encoding(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		if _, err := strconv.ParseInt(v, 10, 64); err == nil && len(v) <= 20 {
+			return "int"
+		}
+		if len(v) <= 44 {
+			return "embstr"
+		}
+		return "raw"
+	case []string:
+		if len(v) <= 128 {
+			return "listpack"
+		}
+		return "quicklist"
+	case map[string]string:
+		if len(v) <= 128 {
+			return "listpack"
+		}
+		return "hashtable"
+	case map[string]struct{}:
+		for member := range v {
+			if _, err := strconv.ParseInt(member, 10, 64); err != nil {
+				if len(v) <= 128 {
+					return "listpack"
+				}
+				return "hashtable"
+			}
+		}
+		return "intset"
+	case zset:
+		if len(v) <= 128 {
+			return "listpack"
+		}
+		return "skiplist"
+	case *stream:
+		return "stream"
+	}
+	return "raw"
+}
+
+// scanArgs are the options of SCAN, HSCAN, SSCAN and ZSCAN.
+type scanArgs struct {
+	cursor  int
+	match   string
+	count   int
+	keyType string
+}
+
+func parseScanArgs(args []string, withType bool) (*scanArgs, error) {
+	cursor, err := strconv.Atoi(args[0])
+	if err != nil || cursor < 0 {
+		return nil, errors.New("ERR invalid cursor")
+	}
+	s := &scanArgs{cursor: cursor, count: 10}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return nil, errSyntax
+		}
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "MATCH":
+			s.match = args[i+1]
+		case opt == "COUNT":
+			if s.count, err = strconv.Atoi(args[i+1]); err != nil {
+				return nil, errNotInteger
+			}
+			if s.count < 1 {
+				return nil, errSyntax
+			}
+		case opt == "TYPE" && withType:
+			s.keyType = strings.ToLower(args[i+1])
+		default:
+			return nil, errSyntax
+		}
+	}
+	return s, nil
+}
+
+// scan returns a page of the elements in lexicographical order,
+// every element is a group of size items, such as a field and its value.
+// A cursor keeps the last element visited, so the next page starts after it
+// and the elements existing during the whole iteration are returned even if others are removed meanwhile.
+func (s *scanArgs) scan(server *Server, elements []string, size int, filter func(i int) bool) []interface{} {
+	var page []string
+	i := 0
+	if after, ok := server.cursors[s.cursor]; ok {
+		i = size * sort.Search(len(elements)/size, func(j int) bool {
+			return elements[j*size] > after
+		})
+	}
+	for n := 0; i < len(elements) && n < s.count; i, n = i+size, n+1 {
+		if s.match != "" && !match(s.match, elements[i]) || filter != nil && !filter(i) {
+			continue
+		}
+		page = append(page, elements[i:i+size]...)
+	}
+	next := 0
+	if i < len(elements) {
+		server.cursorID++
+		next = server.cursorID
+		server.cursors[next] = elements[i-size]
+	}
+	if page == nil {
+		page = []string{}
+	}
+	return []interface{}{strconv.Itoa(next), page}
+}
+
+func cmdScan(c *client, args []string) interface{} {
+	s, err := parseScanArgs(args[1:], true)
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	keys := d.sortedKeys()
+	return s.scan(c.server, keys, 1, func(i int) bool {
+		return s.keyType == "" || typeName(d.keys[keys[i]].value) == s.keyType
+	})
+}
@@ -0,0 +1,474 @@
+package redistest
+
+import (
+	"errors"
+	"strings"
+)
+
+func init() {
+	addCommands(map[string]*command{
+		"LPUSH":      {-3, cmdPush},
+		"RPUSH":      {-3, cmdPush},
+		"LPUSHX":     {-3, cmdPush},
+		"RPUSHX":     {-3, cmdPush},
+		"LPOP":       {-2, cmdPop},
+		"RPOP":       {-2, cmdPop},
+		"LLEN":       {2, cmdLLen},
+		"LINDEX":     {3, cmdLIndex},
+		"LPOS":       {-3, cmdLPos},
+		"LINSERT":    {5, cmdLInsert},
+		"LRANGE":     {4, cmdLRange},
+		"LREM":       {4, cmdLRem},
+		"LSET":       {4, cmdLSet},
+		"LTRIM":      {4, cmdLTrim},
+		"RPOPLPUSH":  {3, cmdRPopLPush},
+		"LMOVE":      {5, cmdLMove},
+		"BLPOP":      {-3, cmdBPop},
+		"BRPOP":      {-3, cmdBPop},
+		"BRPOPLPUSH": {4, cmdBRPopLPush},
+		"BLMOVE":     {6, cmdBLMove},
+	})
+}
+
+// getList returns the list of key.
+func (d *db) getList(key string) ([]string, error) {
+	it := d.get(key)
+	if it == nil {
+		return nil, nil
+	}
+	list, ok := it.value.([]string)
+	if !ok {
+		return nil, errWrongType
+	}
+	return list, nil
+}
+
+// setList stores list as the value of key, keeping its TTL, an empty list removes key.
+func (d *db) setList(key string, list []string) {
+	if it := d.peek(key); it != nil {
+		it.value = list
+		d.modified(key)
+		return
+	}
+	if len(list) > 0 {
+		d.put(key, list)
+	}
+}
+
+// listIndex converts a redis index, which may be negative, to a slice index.
+func listIndex(index int64, n int) int64 {
+	if index < 0 {
+		index += int64(n)
+	}
+	return index
+}
+
+func cmdPush(c *client, args []string) interface{} {
+	d := c.db()
+	list, err := d.getList(args[1])
+	if err != nil {
+		return err
+	}
+	name := strings.ToUpper(args[0])
+	if strings.HasSuffix(name, "X") && list == nil {
+		return 0
+	}
+	for _, value := range args[2:] {
+		if name[0] == 'L' {
+			list = append([]string{value}, list...)
+		} else {
+			list = append(list, value)
+		}
+	}
+	d.setList(args[1], list)
+	return len(list)
+}
+
+func cmdPop(c *client, args []string) interface{} {
+	if len(args) > 3 {
+		return errSyntax
+	}
+	count := int64(-1)
+	if len(args) == 3 {
+		n, err := parseInt(args[2])
+		if err != nil || n < 0 {
+			return errors.New("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	d := c.db()
+	list, err := d.getList(args[1])
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		if count >= 0 {
+			return nilArray{}
+		}
+		return nil
+	}
+	n := int(count)
+	if count < 0 {
+		n = 1
+	}
+	if n > len(list) {
+		n = len(list)
+	}
+	var values []string
+	if strings.ToUpper(args[0]) == "LPOP" {
+		values = append(values, list[:n]...)
+		list = list[n:]
+	} else {
+		for i := 0; i < n; i++ {
+			values = append(values, list[len(list)-1-i])
+		}
+		list = list[:len(list)-n]
+	}
+	d.setList(args[1], list)
+	if count < 0 {
+		return values[0]
+	}
+	return values
+}
+
+func cmdLLen(c *client, args []string) interface{} {
+	list, err := c.db().getList(args[1])
+	if err != nil {
+		return err
+	}
+	return len(list)
+}
+
+func cmdLIndex(c *client, args []string) interface{} {
+	index, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	list, err := c.db().getList(args[1])
+	if err != nil {
+		return err
+	}
+	index = listIndex(index, len(list))
+	if index < 0 || index >= int64(len(list)) {
+		return nil
+	}
+	return list[index]
+}
+
+func cmdLInsert(c *client, args []string) interface{} {
+	where := strings.ToUpper(args[2])
+	if where != "BEFORE" && where != "AFTER" {
+		return errSyntax
+	}
+	d := c.db()
+	list, err := d.getList(args[1])
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		return 0
+	}
+	for i, value := range list {
+		if value != args[3] {
+			continue
+		}
+		if where == "AFTER" {
+			i++
+		}
+		list = append(list[:i], append([]string{args[4]}, list[i:]...)...)
+		d.setList(args[1], list)
+		return len(list)
+	}
+	return -1
+}
+
+func cmdLRange(c *client, args []string) interface{} {
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	end, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	list, err := c.db().getList(args[1])
+	if err != nil {
+		return err
+	}
+	i, j := stringRange(start, end, len(list))
+	return append([]string{}, list[i:j]...)
+}
+
+func cmdLRem(c *client, args []string) interface{} {
+	count, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	list, err := d.getList(args[1])
+	if err != nil {
+		return err
+	}
+	removed := int64(0)
+	result := make([]string, 0, len(list))
+	if count >= 0 {
+		for _, value := range list {
+			if value == args[3] && (count == 0 || removed < count) {
+				removed++
+				continue
+			}
+			result = append(result, value)
+		}
+	} else {
+		for i := len(list) - 1; i >= 0; i-- {
+			if list[i] == args[3] && removed < -count {
+				removed++
+				continue
+			}
+			result = append([]string{list[i]}, result...)
+		}
+	}
+	if removed > 0 {
+		d.setList(args[1], result)
+	}
+	return removed
+}
+
+func cmdLSet(c *client, args []string) interface{} {
+	index, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	list, err := d.getList(args[1])
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		return errNoSuchKey
+	}
+	index = listIndex(index, len(list))
+	if index < 0 || index >= int64(len(list)) {
+		return errOutOfRange
+	}
+	list[index] = args[3]
+	d.setList(args[1], list)
+	return statusOK
+}
+
+func cmdLTrim(c *client, args []string) interface{} {
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	end, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	list, err := d.getList(args[1])
+	if err != nil {
+		return err
+	}
+	if list != nil {
+		i, j := stringRange(start, end, len(list))
+		d.setList(args[1], append([]string{}, list[i:j]...))
+	}
+	return statusOK
+}
+
+// move pops an element from the left or right of source and pushes it to the left or right of destination.
+func (d *db) move(source, destination string, fromLeft, toLeft bool) (interface{}, error) {
+	list, err := d.getList(source)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.getList(destination); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	var value string
+	if fromLeft {
+		value, list = list[0], list[1:]
+	} else {
+		value, list = list[len(list)-1], list[:len(list)-1]
+	}
+	d.setList(source, list)
+	dst, _ := d.getList(destination)
+	if toLeft {
+		dst = append([]string{value}, dst...)
+	} else {
+		dst = append(dst, value)
+	}
+	d.setList(destination, dst)
+	return value, nil
+}
+
+func parseWhere(s string) (bool, error) {
+	switch strings.ToUpper(s) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	}
+	return false, errSyntax
+}
+
+func cmdRPopLPush(c *client, args []string) interface{} {
+	value, err := c.db().move(args[1], args[2], false, true)
+	if err != nil {
+		return err
+	}
+	return value
+}
+
+func cmdLMove(c *client, args []string) interface{} {
+	fromLeft, err := parseWhere(args[3])
+	if err != nil {
+		return err
+	}
+	toLeft, err := parseWhere(args[4])
+	if err != nil {
+		return err
+	}
+	value, err := c.db().move(args[1], args[2], fromLeft, toLeft)
+	if err != nil {
+		return err
+	}
+	return value
+}
+
+func cmdBPop(c *client, args []string) interface{} {
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	for _, key := range args[1 : len(args)-1] {
+		list, err := d.getList(key)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			continue
+		}
+		var value string
+		if strings.ToUpper(args[0]) == "BLPOP" {
+			value, list = list[0], list[1:]
+		} else {
+			value, list = list[len(list)-1], list[:len(list)-1]
+		}
+		d.setList(key, list)
+		return []string{key, value}
+	}
+	return wait{timeout: timeout, reply: nilArray{}}
+}
+
+func cmdBRPopLPush(c *client, args []string) interface{} {
+	timeout, err := parseTimeout(args[3])
+	if err != nil {
+		return err
+	}
+	value, err := c.db().move(args[1], args[2], false, true)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		return wait{timeout: timeout, reply: nilArray{}}
+	}
+	return value
+}
+
+func cmdBLMove(c *client, args []string) interface{} {
+	fromLeft, err := parseWhere(args[3])
+	if err != nil {
+		return err
+	}
+	toLeft, err := parseWhere(args[4])
+	if err != nil {
+		return err
+	}
+	timeout, err := parseTimeout(args[5])
+	if err != nil {
+		return err
+	}
+	value, err := c.db().move(args[1], args[2], fromLeft, toLeft)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		return wait{timeout: timeout, reply: nilArray{}}
+	}
+	return value
+}
+
+func cmdLPos(c *client, args []string) interface{} {
+	rank, count, maxlen := int64(1), int64(-1), int64(0)
+	for i := 3; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return errSyntax
+		}
+		n, err := parseInt(args[i+1])
+		if err != nil {
+			return err
+		}
+		switch strings.ToUpper(args[i]) {
+		case "RANK":
+			if n == 0 {
+				return errors.New("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return errors.New("ERR COUNT can't be negative")
+			}
+			count = n
+		case "MAXLEN":
+			if n < 0 {
+				return errors.New("ERR MAXLEN can't be negative")
+			}
+			maxlen = n
+		default:
+			return errSyntax
+		}
+	}
+	list, err := c.db().getList(args[1])
+	if err != nil {
+		return err
+	}
+	positions := []int64{}
+	skip := rank - 1
+	if rank < 0 {
+		skip = -rank - 1
+	}
+	for i := int64(0); i < int64(len(list)) && (maxlen == 0 || i < maxlen); i++ {
+		index := i
+		if rank < 0 {
+			index = int64(len(list)) - 1 - i
+		}
+		if list[index] != args[2] {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		positions = append(positions, index)
+		if count < 0 || count > 0 && int64(len(positions)) == count {
+			break
+		}
+	}
+	if count >= 0 {
+		result := make([]interface{}, len(positions))
+		for i, index := range positions {
+			result[i] = index
+		}
+		return result
+	}
+	if len(positions) == 0 {
+		return nil
+	}
+	return positions[0]
+}
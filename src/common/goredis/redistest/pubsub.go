@@ -0,0 +1,179 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pubsubCommands are allowed when the client subscribes channels or patterns.
+var pubsubCommands = map[string]bool{
+	"SUBSCRIBE":    true,
+	"UNSUBSCRIBE":  true,
+	"PSUBSCRIBE":   true,
+	"PUNSUBSCRIBE": true,
+	"PING":         true,
+	"QUIT":         true,
+}
+
+func init() {
+	addCommands(map[string]*command{
+		"SUBSCRIBE":    {-2, cmdSubscribe},
+		"PSUBSCRIBE":   {-2, cmdSubscribe},
+		"UNSUBSCRIBE":  {-1, cmdUnSubscribe},
+		"PUNSUBSCRIBE": {-1, cmdUnSubscribe},
+		"PUBLISH":      {3, cmdPublish},
+		"PUBSUB":       {-2, cmdPubSub},
+		"MONITOR":      {1, cmdMonitor},
+	})
+}
+
+func (c *client) subscribed() bool {
+	return len(c.channels)+len(c.patterns) > 0
+}
+
+// subscriptions returns the channels or the patterns of the client.
+func (c *client) subscriptions(pattern bool) map[string]struct{} {
+	if pattern {
+		if c.patterns == nil {
+			c.patterns = make(map[string]struct{})
+		}
+		return c.patterns
+	}
+	if c.channels == nil {
+		c.channels = make(map[string]struct{})
+	}
+	return c.channels
+}
+
+func cmdSubscribe(c *client, args []string) interface{} {
+	kind := strings.ToLower(args[0])
+	subs := c.subscriptions(kind == "psubscribe")
+	for _, name := range args[1:] {
+		subs[name] = struct{}{}
+		c.write([]interface{}{kind, name, len(c.channels) + len(c.patterns)})
+	}
+	return noReply{}
+}
+
+func cmdUnSubscribe(c *client, args []string) interface{} {
+	kind := strings.ToLower(args[0])
+	subs := c.subscriptions(kind == "punsubscribe")
+	names := args[1:]
+	if len(names) == 0 {
+		names = sortedMembers(subs)
+		if len(names) == 0 {
+			c.write([]interface{}{kind, nil, len(c.channels) + len(c.patterns)})
+		}
+	}
+	for _, name := range names {
+		delete(subs, name)
+		c.write([]interface{}{kind, name, len(c.channels) + len(c.patterns)})
+	}
+	return noReply{}
+}
+
+func cmdPublish(c *client, args []string) interface{} {
+	n := 0
+	for _, sub := range c.server.sortedClients() {
+		if _, ok := sub.channels[args[1]]; ok {
+			sub.write([]interface{}{"message", args[1], args[2]})
+			n++
+		}
+		for _, pattern := range sortedMembers(sub.patterns) {
+			if match(pattern, args[1]) {
+				sub.write([]interface{}{"pmessage", pattern, args[1], args[2]})
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func cmdPubSub(c *client, args []string) interface{} {
+	clients := c.server.sortedClients()
+	switch strings.ToUpper(args[1]) {
+	case "CHANNELS":
+		if len(args) > 3 {
+			return errSyntax
+		}
+		channels := make(map[string]struct{})
+		for _, sub := range clients {
+			for channel := range sub.channels {
+				if len(args) == 2 || match(args[2], channel) {
+					channels[channel] = struct{}{}
+				}
+			}
+		}
+		return sortedMembers(channels)
+	case "NUMSUB":
+		result := make([]interface{}, 0, 2*(len(args)-2))
+		for _, channel := range args[2:] {
+			n := 0
+			for _, sub := range clients {
+				if _, ok := sub.channels[channel]; ok {
+					n++
+				}
+			}
+			result = append(result, channel, n)
+		}
+		return result
+	case "NUMPAT":
+		n := 0
+		for _, sub := range clients {
+			n += len(sub.patterns)
+		}
+		return n
+	}
+	return fmt.Errorf("ERR unknown subcommand '%s'. Try PUBSUB HELP.", args[1])
+}
+
+func cmdMonitor(c *client, args []string) interface{} {
+	if c.multi {
+		return errors.New("ERR MONITOR inside MULTI is not allowed")
+	}
+	c.monitor = true
+	return statusOK
+}
+
+// monitorCommand sends the command of c to the monitors.
+func (s *Server) monitorCommand(c *client, args []string) {
+	var line string
+	for _, m := range s.sortedClients() {
+		if !m.monitor || m == c {
+			continue
+		}
+		if line == "" {
+			now := time.Now()
+			quoted := make([]string, len(args))
+			for i, arg := range args {
+				quoted[i] = strconv.Quote(arg)
+			}
+			line = fmt.Sprintf("%d.%06d [%d %s] %s", now.Unix(), now.Nanosecond()/1000, c.index, c.conn.RemoteAddr(), strings.Join(quoted, " "))
+		}
+		m.write(Status(line))
+	}
+}
+
+// sortedClients returns the connected clients in the order of connection.
+func (s *Server) sortedClients() []*client {
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].id < clients[j].id
+	})
+	return clients
+}
+
+// reset drops the subscriptions and the transaction of the client.
+func (c *client) reset() {
+	c.channels = nil
+	c.patterns = nil
+	c.monitor = false
+	c.discard()
+}
@@ -0,0 +1,419 @@
+// Package redistest provides an in-process redis server for tests.
+//
+// The server speaks RESP2 on a random local port, so any client, goredis or not, can use it:
+//
+//	server, err := redistest.NewServer()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer server.Close()
+//	client, err := goredis.Dial(&goredis.DialConfig{Address: server.Addr()})
+//
+// NewTLSServer serves TLS, and NewServerListener serves any listener, such as a unix socket.
+// RequireAuth sets the password of the default user and AddUser adds the ACL users of AUTH username password.
+//
+// Strings with BITFIELD, hashes, lists, sets, sorted sets, geospatial indexes, hyperloglogs (kept exactly),
+// streams with consumer groups, keys with TTL, SORT, the SCAN family, MULTI/EXEC/WATCH, pub/sub, MONITOR
+// and the common server commands are implemented. Cluster commands are not, nor DUMP of streams.
+//
+// CLIENT TRACKING supports REDIRECT only, the invalidation messages are sent to the redirect client
+// subscribing __redis__:invalidate as RESP2 does. Every key looked up by a command of a tracking client
+// is tracked, including the keys of the writes, so a client may receive more invalidations than from redis.
+//
+// The clock of the server is the real time by default, SetTime freezes it and FastForward moves it,
+// so the expiration of keys can be tested without sleeping.
+// The timeouts of the blocking commands, such as BLPOP, always use the real time.
+//
+// There is no Lua interpreter. SCRIPT LOAD, EXISTS and FLUSH keep the scripts by SHA1,
+// and a script can be implemented in Go by RegisterScript, EVAL and EVALSHA of other scripts fail.
+package redistest
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Databases is the number of databases of a server.
+const Databases = 16
+
+// Server is an in-process redis server listening on 127.0.0.1.
+type Server struct {
+	mutex    sync.Mutex
+	listener net.Listener
+	dbs      [Databases]*db
+	clients  map[*client]struct{}
+	scripts  map[string]string
+	funcs    map[string]ScriptFunc
+	config   map[string]string
+	password string
+	users    map[string]string
+	started  time.Time
+	lastSave time.Time
+	clientID int64
+	cursorID int
+	cursors  map[int]string
+	version  uint64
+
+	// tracked is the tracking table of CLIENT TRACKING, the ids of the clients to invalidate by key.
+	tracked map[string]map[int64]struct{}
+	// current is the client running a command, whose keys are tracked.
+	current *client
+
+	// changed is closed and renewed after every write, the blocked commands wait on it.
+	changed chan struct{}
+	dirty   bool
+
+	frozen bool
+	base   time.Time
+	offset time.Duration
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewServer starts a server on a random port of 127.0.0.1.
+func NewServer() (*Server, error) {
+	return NewServerAddr("127.0.0.1:0")
+}
+
+// NewServerAddr starts a server on the tcp address addr.
+func NewServerAddr(addr string) (*Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewServerListener(l), nil
+}
+
+// NewTLSServer starts a server serving TLS by cfg on a random port of 127.0.0.1.
+func NewTLSServer(cfg *tls.Config) (*Server, error) {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewServerListener(l), nil
+}
+
+// NewServerListener starts a server accepting the connections of l, l is closed by Close.
+func NewServerListener(l net.Listener) *Server {
+	s := &Server{
+		listener: l,
+		clients:  make(map[*client]struct{}),
+		scripts:  make(map[string]string),
+		funcs:    make(map[string]ScriptFunc),
+		users:    make(map[string]string),
+		cursors:  make(map[int]string),
+		tracked:  make(map[string]map[int64]struct{}),
+		config:   defaultConfig(),
+		started:  time.Now(),
+		lastSave: time.Now(),
+		changed:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for i := range s.dbs {
+		s.dbs[i] = newDB(s)
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Addr returns the address the server listens on, such as 127.0.0.1:53212, or the path of a unix socket.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and closes all the client connections.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.mutex.Lock()
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// RequireAuth makes the clients authenticate by AUTH password before other commands,
+// an empty password disables the authentication.
+func (s *Server) RequireAuth(password string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.password = password
+}
+
+// AddUser adds the ACL user username, which authenticates by AUTH username password.
+// The connections still start as the default user, unless RequireAuth is set.
+func (s *Server) AddUser(username, password string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.users[username] = password
+}
+
+// Now returns the current time of the server clock.
+func (s *Server) Now() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.now()
+}
+
+// SetTime freezes the server clock at t, FastForward is the only way to move it after.
+func (s *Server) SetTime(t time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.frozen = true
+	s.base = t
+	s.wakeup()
+}
+
+// FastForward moves the server clock forward by d, the keys whose TTL is passed expire.
+func (s *Server) FastForward(d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.frozen {
+		s.base = s.base.Add(d)
+	} else {
+		s.offset += d
+	}
+	s.wakeup()
+}
+
+// FlushAll removes all the keys of all the databases.
+func (s *Server) FlushAll() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.invalidateAll()
+	for _, d := range s.dbs {
+		d.flush()
+	}
+	s.wakeup()
+}
+
+// Keys returns the names of the keys of the database index, in order.
+func (s *Server) Keys(index int) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.dbs[index].sortedKeys()
+}
+
+func (s *Server) now() time.Time {
+	if s.frozen {
+		return s.base
+	}
+	return time.Now().Add(s.offset)
+}
+
+func (s *Server) nextVersion() uint64 {
+	s.version++
+	return s.version
+}
+
+// wakeup wakes up the blocked commands.
+func (s *Server) wakeup() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.dirty = false
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.clientID++
+		c := &client{
+			server:  s,
+			conn:    conn,
+			id:      s.clientID,
+			reader:  bufio.NewReader(conn),
+			writer:  bufio.NewWriter(conn),
+			created: time.Now(),
+			user:    "default",
+			authed:  s.password == "",
+		}
+		s.clients[c] = struct{}{}
+		s.mutex.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+			s.mutex.Lock()
+			c.reset()
+			delete(s.clients, c)
+			s.mutex.Unlock()
+		}()
+	}
+}
+
+type db struct {
+	server   *Server
+	keys     map[string]*item
+	versions map[string]uint64
+}
+
+type item struct {
+	value  interface{}
+	expire time.Time
+	access time.Time
+}
+
+func newDB(s *Server) *db {
+	return &db{server: s, keys: make(map[string]*item), versions: make(map[string]uint64)}
+}
+
+// get returns the item of key, nil if it does not exist or expired.
+func (d *db) get(key string) *item {
+	it := d.peek(key)
+	if it != nil {
+		it.access = d.server.now()
+	}
+	return it
+}
+
+// peek is get without changing the access time of the key.
+func (d *db) peek(key string) *item {
+	it, ok := d.keys[key]
+	if ok && !it.expire.IsZero() && !d.server.now().Before(it.expire) {
+		delete(d.keys, key)
+		d.touch(key)
+		it = nil
+	}
+	d.server.track(key)
+	return it
+}
+
+// put sets the value of key without a TTL.
+func (d *db) put(key string, value interface{}) *item {
+	it := &item{value: value, access: d.server.now()}
+	d.keys[key] = it
+	d.touch(key)
+	return it
+}
+
+// remove deletes key and reports whether it existed.
+func (d *db) remove(key string) bool {
+	if d.peek(key) == nil {
+		return false
+	}
+	delete(d.keys, key)
+	d.touch(key)
+	return true
+}
+
+// modified marks key changed in place, an empty hash, list, set or sorted set is removed.
+func (d *db) modified(key string) {
+	if it, ok := d.keys[key]; ok && isEmpty(it.value) {
+		delete(d.keys, key)
+	}
+	d.touch(key)
+}
+
+func (d *db) touch(key string) {
+	d.versions[key] = d.server.nextVersion()
+	d.server.dirty = true
+	d.server.invalidate(key)
+}
+
+func (d *db) flush() {
+	for key := range d.keys {
+		d.touch(key)
+	}
+	d.keys = make(map[string]*item)
+}
+
+func (d *db) sortedKeys() []string {
+	keys := make([]string, 0, len(d.keys))
+	for key := range d.keys {
+		if d.peek(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// match reports whether s matches the glob-style pattern of redis.
+func match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if match(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			matched := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				switch {
+				case pattern[0] == '\\' && len(pattern) > 1:
+					matched = matched || pattern[1] == s[0]
+					pattern = pattern[2:]
+				case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+					lo, hi := pattern[0], pattern[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					matched = matched || (s[0] >= lo && s[0] <= hi)
+					pattern = pattern[3:]
+				default:
+					matched = matched || pattern[0] == s[0]
+					pattern = pattern[1:]
+				}
+			}
+			if len(pattern) > 0 {
+				pattern = pattern[1:]
+			}
+			if matched == not {
+				return false
+			}
+			s = s[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,357 @@
+package redistest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"common/goredis"
+)
+
+func newClient(t *testing.T) (*Server, *goredis.Redis) {
+	server, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := goredis.Dial(&goredis.DialConfig{Address: server.Addr(), Timeout: 2 * time.Second, MaxIdle: 2})
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		matched    bool
+	}{
+		{"*", "", true},
+		{"h?llo", "hello", true},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"news.*", "news.china", true},
+		{"news.*", "new", false},
+	}
+	for _, test := range tests {
+		if match(test.pattern, test.s) != test.matched {
+			t.Error(test)
+		}
+	}
+}
+
+func TestClock(t *testing.T) {
+	server, client := newClient(t)
+	defer server.Close()
+	defer client.ClosePool()
+	server.SetTime(time.Unix(1000, 0))
+	client.Setex("key", 10, "value")
+	if ttl, err := client.TTL("key"); err != nil || ttl != 10 {
+		t.Error(ttl, err)
+	}
+	server.FastForward(9 * time.Second)
+	if ttl, _ := client.PTTL("key"); ttl != 1000 {
+		t.Error(ttl)
+	}
+	server.FastForward(time.Second)
+	if ok, _ := client.Exists("key"); ok {
+		t.Error("key not expired")
+	}
+	if tt, err := client.Time(); err != nil || tt[0] != "1010" {
+		t.Error(tt, err)
+	}
+	if client.ExpireAt("key", 2000); len(server.Keys(0)) != 0 {
+		t.Fail()
+	}
+}
+
+func TestWrongType(t *testing.T) {
+	server, client := newClient(t)
+	defer server.Close()
+	defer client.ClosePool()
+	client.LPush("list", "a")
+	if _, err := client.Get("list"); err == nil || !strings.HasPrefix(err.Error(), "WRONGTYPE") {
+		t.Error(err)
+	}
+	if _, err := client.ExecuteCommand("NOCOMMAND"); err != nil {
+		t.Error(err)
+	} else if rp, _ := client.ExecuteCommand("NOCOMMAND"); rp.Type != goredis.ErrorReply {
+		t.Fail()
+	}
+	if _, err := client.LPop("list"); err != nil {
+		t.Error(err)
+	}
+	if ty, _ := client.Type("list"); ty != "none" {
+		t.Error("empty list not removed")
+	}
+}
+
+func TestTransactionWatch(t *testing.T) {
+	server, client := newClient(t)
+	defer server.Close()
+	defer client.ClosePool()
+	watch := func(modify bool) *goredis.Reply {
+		p, err := client.Pipelining()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Close()
+		p.Command("WATCH", "key")
+		if _, err := p.Receive(); err != nil {
+			t.Fatal(err)
+		}
+		if modify {
+			client.Incr("key")
+		}
+		p.Command("MULTI")
+		p.Command("INCR", "key")
+		p.Command("EXEC")
+		rps, err := p.ReceiveAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rps[2]
+	}
+	if rp := watch(false); len(rp.Multi) != 1 || rp.Multi[0].Integer != 1 {
+		t.Error(rp)
+	}
+	if rp := watch(true); rp.Type != goredis.MultiReply || rp.Multi != nil {
+		t.Error("transaction not aborted", rp)
+	}
+	if n, _ := client.Incr("key"); n != 3 {
+		t.Error(n)
+	}
+}
+
+func TestBlockingPop(t *testing.T) {
+	server, client := newClient(t)
+	defer server.Close()
+	defer client.ClosePool()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		client.RPush("list", "value")
+	}()
+	start := time.Now()
+	result, err := client.BLPop([]string{"list"}, 2)
+	if err != nil || len(result) != 2 || result[1] != "value" {
+		t.Error(result, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("not woken up by RPUSH")
+	}
+	if result, err := client.BRPop([]string{"list"}, 1); err != nil || result != nil {
+		t.Error(result, err)
+	}
+}
+
+func TestBlockingXRead(t *testing.T) {
+	server, client := newClient(t)
+	defer server.Close()
+	defer client.ClosePool()
+	client.XAdd("stream", "1-1", 0, false, map[string]string{"name": "old"})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		// a write of another key retries the blocked XREAD, "$" still means the entries after 1-1
+		client.RPush("list", "value")
+		client.XAdd("stream", "2-1", 0, false, map[string]string{"name": "new"})
+	}()
+	start := time.Now()
+	streams, err := client.XRead(map[string]string{"stream": "$"}, 0, 2*time.Second)
+	if err != nil || len(streams) != 1 || len(streams[0].Messages) != 1 || streams[0].Messages[0].ID != "2-1" {
+		t.Fatal(streams, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("not woken up by XADD")
+	}
+	if typ, _ := client.Type("stream"); typ != "stream" {
+		t.Error(typ)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	server, client := newClient(t)
+	defer server.Close()
+	defer client.ClosePool()
+	sub, err := client.PubSub()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	sub.PSubscribe("news.*")
+	if list, err := sub.Receive(); err != nil || list[0] != "psubscribe" {
+		t.Fatal(list, err)
+	}
+	if n, err := client.Publish("news.china", "message"); err != nil || n != 1 {
+		t.Error(n, err)
+	}
+	if list, err := sub.Receive(); err != nil || len(list) != 4 || list[2] != "news.china" || list[3] != "message" {
+		t.Error(list, err)
+	}
+}
+
+func TestRegisterScript(t *testing.T) {
+	server, client := newClient(t)
+	defer server.Close()
+	defer client.ClosePool()
+	src := "return redis.call('INCRBY', KEYS[1], ARGV[1])"
+	server.RegisterScript(src, func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+		return call("INCRBY", keys[0], args[0])
+	})
+	script := goredis.NewScript(1, src)
+	for i := int64(1); i <= 2; i++ {
+		rp, err := script.Run(client, "key", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := rp.IntegerValue(); err != nil || n != 2*i {
+			t.Error(n, err)
+		}
+	}
+	if rp, err := client.Eval("return 1", nil, nil); err != nil || rp.Type != goredis.ErrorReply {
+		t.Error("script not registered", err)
+	}
+	server.RegisterScript("return redis.error_reply('failed')", func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+		return errors.New("failed")
+	})
+	if rp, err := client.Eval("return redis.error_reply('failed')", nil, nil); err != nil || rp.Error != "failed" {
+		t.Error(rp, err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	server, client := newClient(t)
+	defer server.Close()
+	defer client.ClosePool()
+	for _, key := range []string{"a1", "a2", "a3", "b1", "b2"} {
+		client.Set(key, "value", 0, 0, false, false)
+	}
+	client.SAdd("set", "a1")
+	var keys []string
+	var cursor uint64
+	for {
+		next, list, err := client.Scan(cursor, "a*", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, list...)
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	if strings.Join(keys, ",") != "a1,a2,a3" {
+		t.Error(keys)
+	}
+	rp, err := client.ExecuteCommand("SCAN", 0, "COUNT", 100, "TYPE", "set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list, err := rp.Multi[1].ListValue(); err != nil || len(list) != 1 || list[0] != "set" {
+		t.Error(list, err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	server, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.RequireAuth("secret")
+	if _, err := goredis.Dial(&goredis.DialConfig{Address: server.Addr(), Password: "wrong"}); err == nil {
+		t.Error("wrong password accepted")
+	}
+	client, err := goredis.Dial(&goredis.DialConfig{Address: server.Addr(), Password: "secret", Database: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	client.Set("key", "value", 0, 0, false, false)
+	if keys := server.Keys(3); len(keys) != 1 || keys[0] != "key" {
+		t.Error(keys)
+	}
+}
+
+func TestAddUser(t *testing.T) {
+	server, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.AddUser("app", "secret")
+	client, err := goredis.Dial(&goredis.DialConfig{Address: server.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	if rp, _ := client.ExecuteCommand("AUTH", "app", "wrong"); rp.Type != goredis.ErrorReply {
+		t.Error("wrong password accepted")
+	}
+	if rp, _ := client.ExecuteCommand("AUTH", "app", "secret"); rp.Type != goredis.StatusReply {
+		t.Error(rp.Error)
+	}
+}
+
+func TestClientTracking(t *testing.T) {
+	server, client := newClient(t)
+	defer server.Close()
+	defer client.ClosePool()
+	sub, err := client.Pipelining()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	sub.Command("CLIENT", "ID")
+	sub.Command("SUBSCRIBE", "__redis__:invalidate")
+	rps, err := sub.ReceiveAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := client.Pipelining()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	do := func(args ...interface{}) *goredis.Reply {
+		p.Command(args...)
+		rp, err := p.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rp
+	}
+	if rp := do("CLIENT", "TRACKING", "ON", "REDIRECT", 12345); rp.Type != goredis.ErrorReply {
+		t.Error("redirect to a missing client accepted")
+	}
+	if rp := do("CLIENT", "TRACKING", "ON", "REDIRECT", rps[0].Integer); rp.Type != goredis.StatusReply {
+		t.Fatal(rp.Error)
+	}
+	invalidated := func(key string) {
+		rp, err := sub.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if list, err := rp.Multi[2].ListValue(); err != nil || len(list) != 1 || list[0] != key {
+			t.Error(list, err)
+		}
+	}
+	do("GET", "key")
+	client.Set("key", "value", 0, 0, false, false)
+	invalidated("key")
+	// a key is tracked again only after it is read again
+	client.Set("key", "value", 0, 0, false, false)
+	do("HGETALL", "other")
+	do("GET", "key")
+	client.Del("key")
+	invalidated("key")
+	server.FlushAll()
+	if rp, err := sub.Receive(); err != nil || rp.Multi[2].Type != goredis.MultiReply || rp.Multi[2].Multi != nil {
+		t.Error("flush not invalidated", err)
+	}
+}
@@ -0,0 +1,144 @@
+package redistest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ScriptFunc implements a Lua script in Go.
+// call runs a redis command like redis.pcall, its reply is nil, int64, string, Status, error or []interface{}.
+// The return value is sent as the reply of EVAL, in the same types, false is sent as nil like Lua.
+type ScriptFunc func(call func(args ...interface{}) interface{}, keys, args []string) interface{}
+
+func init() {
+	addCommands(map[string]*command{
+		"EVAL":    {-3, cmdEval},
+		"EVALSHA": {-3, cmdEval},
+		"SCRIPT":  {-2, cmdScript},
+	})
+}
+
+func scriptHash(src string) string {
+	h := sha1.Sum([]byte(src))
+	return hex.EncodeToString(h[:])
+}
+
+// RegisterScript implements the script src by fn, which runs on EVAL or EVALSHA of src.
+// The scripts are not loaded by RegisterScript, SCRIPT LOAD or EVAL loads them as in redis.
+func (s *Server) RegisterScript(src string, fn ScriptFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.funcs[scriptHash(src)] = fn
+}
+
+func cmdEval(c *client, args []string) interface{} {
+	s := c.server
+	var sha string
+	if strings.ToUpper(args[0]) == "EVAL" {
+		sha = scriptHash(args[1])
+		s.scripts[sha] = args[1]
+	} else {
+		sha = strings.ToLower(args[1])
+		if _, ok := s.scripts[sha]; !ok {
+			return errors.New("NOSCRIPT No matching script. Please use EVAL.")
+		}
+	}
+	n, err := strconv.Atoi(args[2])
+	if err != nil {
+		return errNotInteger
+	}
+	if n < 0 {
+		return errors.New("ERR Number of keys can't be negative")
+	}
+	if n > len(args)-3 {
+		return errors.New("ERR Number of keys can't be greater than number of args")
+	}
+	fn, ok := s.funcs[sha]
+	if !ok {
+		return fmt.Errorf("ERR script %s is not registered by redistest.Server.RegisterScript", sha)
+	}
+	call := func(args ...interface{}) interface{} {
+		strs := make([]string, len(args))
+		for i, arg := range args {
+			switch v := arg.(type) {
+			case string:
+				strs[i] = v
+			case float64:
+				strs[i] = formatFloat(v)
+			default:
+				strs[i] = fmt.Sprint(v)
+			}
+		}
+		if len(strs) == 0 {
+			return errors.New("ERR Please specify at least one argument for this redis lib call")
+		}
+		return scriptValue(c.call(strs))
+	}
+	reply := scriptValue(fn(call, args[3:3+n], args[3+n:]))
+	if b, ok := reply.(bool); ok && !b {
+		return nil
+	}
+	return reply
+}
+
+// scriptValue converts a reply to the types of ScriptFunc.
+func scriptValue(reply interface{}) interface{} {
+	switch v := reply.(type) {
+	case int:
+		return int64(v)
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return false
+	case float64:
+		return formatFloat(v)
+	case nilArray:
+		return nil
+	case []string:
+		values := make([]interface{}, len(v))
+		for i, s := range v {
+			values[i] = s
+		}
+		return values
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			if values[i] = scriptValue(item); values[i] == false {
+				values[i] = nil
+			}
+		}
+		return values
+	}
+	return reply
+}
+
+func cmdScript(c *client, args []string) interface{} {
+	s := c.server
+	switch strings.ToUpper(args[1]) {
+	case "LOAD":
+		if len(args) != 3 {
+			return errors.New("ERR wrong number of arguments for 'script|load' command")
+		}
+		sha := scriptHash(args[2])
+		s.scripts[sha] = args[2]
+		return sha
+	case "EXISTS":
+		result := make([]interface{}, len(args)-2)
+		for i, sha := range args[2:] {
+			_, ok := s.scripts[strings.ToLower(sha)]
+			result[i] = ok
+		}
+		return result
+	case "FLUSH":
+		s.scripts = make(map[string]string)
+		return statusOK
+	case "KILL":
+		return errors.New("NOTBUSY No scripts in execution right now.")
+	}
+	return fmt.Errorf("ERR unknown subcommand '%s'. Try SCRIPT HELP.", args[1])
+}
@@ -0,0 +1,370 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the redis version reported by the server.
+const Version = "7.0.0"
+
+func init() {
+	addCommands(map[string]*command{
+		"CONFIG":       {-2, cmdConfig},
+		"INFO":         {-1, cmdInfo},
+		"SLOWLOG":      {-2, cmdSlowLog},
+		"CLIENT":       {-2, cmdClient},
+		"DEBUG":        {-2, cmdDebug},
+		"MEMORY":       {-2, cmdMemory},
+		"SAVE":         {1, cmdSave},
+		"BGSAVE":       {-1, cmdSave},
+		"BGREWRITEAOF": {1, cmdBgRewriteAof},
+		"LASTSAVE":     {1, cmdLastSave},
+		"TIME":         {1, cmdTime},
+		"DBSIZE":       {1, cmdDBSize},
+		"FLUSHDB":      {-1, cmdFlush},
+		"FLUSHALL":     {-1, cmdFlush},
+	})
+}
+
+func defaultConfig() map[string]string {
+	return map[string]string{
+		"appendonly":              "no",
+		"bind":                    "127.0.0.1",
+		"daemonize":               "no",
+		"databases":               strconv.Itoa(Databases),
+		"maxclients":              "10000",
+		"maxmemory":               "0",
+		"maxmemory-policy":        "noeviction",
+		"port":                    "0",
+		"save":                    "",
+		"slowlog-log-slower-than": "10000",
+		"slowlog-max-len":         "128",
+		"timeout":                 "0",
+	}
+}
+
+func cmdConfig(c *client, args []string) interface{} {
+	s := c.server
+	switch strings.ToUpper(args[1]) {
+	case "GET":
+		if len(args) < 3 {
+			return errors.New("ERR wrong number of arguments for 'config|get' command")
+		}
+		names := make([]string, 0, len(s.config))
+		for name := range s.config {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		result := []string{}
+		for _, name := range names {
+			for _, pattern := range args[2:] {
+				if match(strings.ToLower(pattern), name) {
+					result = append(result, name, s.config[name])
+					break
+				}
+			}
+		}
+		return result
+	case "SET":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return errors.New("ERR wrong number of arguments for 'config|set' command")
+		}
+		for i := 2; i < len(args); i += 2 {
+			name := strings.ToLower(args[i])
+			if _, ok := s.config[name]; !ok {
+				return fmt.Errorf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", args[i])
+			}
+			s.config[name] = args[i+1]
+		}
+		return statusOK
+	case "RESETSTAT", "REWRITE":
+		return statusOK
+	}
+	return fmt.Errorf("ERR unknown subcommand '%s'. Try CONFIG HELP.", args[1])
+}
+
+func cmdInfo(c *client, args []string) interface{} {
+	s := c.server
+	hostname, _ := os.Hostname()
+	_, port, _ := net.SplitHostPort(s.Addr())
+	sections := map[string][]string{
+		"server": {
+			"redis_version:" + Version,
+			"redis_mode:standalone",
+			"os:" + hostname,
+			"tcp_port:" + port,
+			fmt.Sprintf("uptime_in_seconds:%d", int64(time.Since(s.started)/time.Second)),
+		},
+		"clients": {
+			fmt.Sprintf("connected_clients:%d", len(s.clients)),
+		},
+		"persistence": {
+			"loading:0",
+			fmt.Sprintf("rdb_last_save_time:%d", s.lastSave.Unix()),
+		},
+		"replication": {
+			"role:master",
+			"connected_slaves:0",
+		},
+	}
+	var keyspace []string
+	for i, d := range s.dbs {
+		keys, expires := 0, 0
+		for _, key := range d.sortedKeys() {
+			keys++
+			if !d.keys[key].expire.IsZero() {
+				expires++
+			}
+		}
+		if keys > 0 {
+			keyspace = append(keyspace, fmt.Sprintf("db%d:keys=%d,expires=%d,avg_ttl=0", i, keys, expires))
+		}
+	}
+	sections["keyspace"] = keyspace
+	titles := []string{"Server", "Clients", "Persistence", "Replication", "Keyspace"}
+	var b strings.Builder
+	for _, title := range titles {
+		name := strings.ToLower(title)
+		if len(args) > 1 && !strings.EqualFold(args[1], name) && !strings.EqualFold(args[1], "all") &&
+			!strings.EqualFold(args[1], "default") && !strings.EqualFold(args[1], "everything") {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# " + title + "\r\n")
+		for _, line := range sections[name] {
+			b.WriteString(line + "\r\n")
+		}
+	}
+	return b.String()
+}
+
+func cmdSlowLog(c *client, args []string) interface{} {
+	switch strings.ToUpper(args[1]) {
+	case "GET":
+		return []interface{}{}
+	case "LEN":
+		return 0
+	case "RESET":
+		return statusOK
+	}
+	return fmt.Errorf("ERR unknown subcommand '%s'. Try SLOWLOG HELP.", args[1])
+}
+
+// info returns the description of the client as in CLIENT LIST.
+func (c *client) info() string {
+	flags := "N"
+	switch {
+	case c.multi:
+		flags = "x"
+	case c.subscribed():
+		flags = "P"
+	case c.monitor:
+		flags = "O"
+	}
+	return fmt.Sprintf("id=%d addr=%s laddr=%s fd=8 name=%s age=%d idle=0 flags=%s db=%d sub=%d psub=%d multi=%d cmd=%s user=%s",
+		c.id, c.conn.RemoteAddr(), c.conn.LocalAddr(), c.name, int64(time.Since(c.created)/time.Second),
+		flags, c.index, len(c.channels), len(c.patterns), len(c.queue), c.last, c.user)
+}
+
+func cmdClient(c *client, args []string) interface{} {
+	s := c.server
+	switch strings.ToUpper(args[1]) {
+	case "LIST":
+		var b strings.Builder
+		for _, other := range s.sortedClients() {
+			b.WriteString(other.info() + "\n")
+		}
+		return b.String()
+	case "INFO":
+		return c.info() + "\n"
+	case "ID":
+		return c.id
+	case "GETNAME":
+		if c.name == "" {
+			return nil
+		}
+		return c.name
+	case "SETNAME":
+		if len(args) != 3 {
+			return errors.New("ERR wrong number of arguments for 'client|setname' command")
+		}
+		if strings.ContainsAny(args[2], " \n") {
+			return errors.New("ERR Client names cannot contain spaces, newlines or special characters.")
+		}
+		c.name = args[2]
+		return statusOK
+	case "KILL":
+		return c.kill(args[2:])
+	case "TRACKING":
+		return c.setTracking(args[2:])
+	case "PAUSE", "UNPAUSE":
+		return statusOK
+	}
+	return fmt.Errorf("ERR unknown subcommand '%s'. Try CLIENT HELP.", args[1])
+}
+
+// kill closes the clients of CLIENT KILL addr or CLIENT KILL ID id | ADDR addr.
+func (c *client) kill(args []string) interface{} {
+	if len(args) == 1 {
+		for _, other := range c.server.sortedClients() {
+			if other.conn.RemoteAddr().String() == args[0] {
+				other.close()
+				return statusOK
+			}
+		}
+		return errors.New("ERR No such client")
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		return errSyntax
+	}
+	n := 0
+	for _, other := range c.server.sortedClients() {
+		killed := true
+		for i := 0; i < len(args); i += 2 {
+			switch strings.ToUpper(args[i]) {
+			case "ID":
+				killed = killed && strconv.FormatInt(other.id, 10) == args[i+1]
+			case "ADDR":
+				killed = killed && other.conn.RemoteAddr().String() == args[i+1]
+			case "SKIPME":
+				killed = killed && !(other == c && strings.EqualFold(args[i+1], "yes"))
+			default:
+				return errSyntax
+			}
+		}
+		if killed {
+			other.close()
+			n++
+		}
+	}
+	return n
+}
+
+// close closes the connection of the client, which ends its goroutine.
+func (c *client) close() {
+	c.closing = true
+	c.conn.Close()
+}
+
+func cmdDebug(c *client, args []string) interface{} {
+	switch strings.ToUpper(args[1]) {
+	case "OBJECT":
+		if len(args) != 3 {
+			return errSyntax
+		}
+		it := c.db().peek(args[2])
+		if it == nil {
+			return errNoSuchKey
+		}
+		return Status(fmt.Sprintf("Value at:0x0 refcount:1 encoding:%s serializedlength:0 lru:0 lru_seconds_idle:%d",
+			encoding(it.value), int64(c.server.now().Sub(it.access)/time.Second)))
+	case "SLEEP":
+		return statusOK
+	}
+	return fmt.Errorf("ERR unknown subcommand '%s'. Try DEBUG HELP.", args[1])
+}
+
+// memoryUsage approximates the bytes taken by a key and its value, the overhead of every element is a guess.
+func memoryUsage(key string, v interface{}) int {
+	const overhead = 16
+	n := 56 + len(key)
+	switch v := v.(type) {
+	case string:
+		n += len(v)
+	case []string:
+		for _, s := range v {
+			n += overhead + len(s)
+		}
+	case map[string]string:
+		for field, s := range v {
+			n += overhead + len(field) + len(s)
+		}
+	case map[string]struct{}:
+		for member := range v {
+			n += overhead + len(member)
+		}
+	case zset:
+		for member := range v {
+			n += 2*overhead + len(member)
+		}
+	case *stream:
+		for _, e := range v.entries {
+			n += overhead
+			for _, s := range e.values {
+				n += len(s)
+			}
+		}
+	}
+	return n
+}
+
+func cmdMemory(c *client, args []string) interface{} {
+	switch strings.ToUpper(args[1]) {
+	case "USAGE":
+		if len(args) != 3 && (len(args) != 5 || !strings.EqualFold(args[3], "SAMPLES")) {
+			return errSyntax
+		}
+		if len(args) == 5 {
+			if _, err := parseInt(args[4]); err != nil {
+				return err
+			}
+		}
+		it := c.db().peek(args[2])
+		if it == nil {
+			return nil
+		}
+		return memoryUsage(args[2], it.value)
+	case "DOCTOR":
+		return "Hi Sam, I can't find any memory issue in your instance. I can only account for what occurs on this base."
+	}
+	return fmt.Errorf("ERR unknown subcommand '%s'. Try MEMORY HELP.", args[1])
+}
+
+func cmdSave(c *client, args []string) interface{} {
+	c.server.lastSave = time.Now()
+	if strings.ToUpper(args[0]) == "BGSAVE" {
+		return Status("Background saving started")
+	}
+	return statusOK
+}
+
+func cmdBgRewriteAof(c *client, args []string) interface{} {
+	return Status("Background append only file rewriting started")
+}
+
+func cmdLastSave(c *client, args []string) interface{} {
+	return c.server.lastSave.Unix()
+}
+
+func cmdTime(c *client, args []string) interface{} {
+	now := c.server.now()
+	return []string{strconv.FormatInt(now.Unix(), 10), strconv.Itoa(now.Nanosecond() / 1000)}
+}
+
+func cmdDBSize(c *client, args []string) interface{} {
+	return len(c.db().sortedKeys())
+}
+
+func cmdFlush(c *client, args []string) interface{} {
+	if len(args) > 2 || len(args) == 2 && !strings.EqualFold(args[1], "ASYNC") && !strings.EqualFold(args[1], "SYNC") {
+		return errSyntax
+	}
+	c.server.invalidateAll()
+	if strings.ToUpper(args[0]) == "FLUSHALL" {
+		for _, d := range c.server.dbs {
+			d.flush()
+		}
+	} else {
+		c.db().flush()
+	}
+	return statusOK
+}
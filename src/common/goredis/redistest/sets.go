@@ -0,0 +1,313 @@
+package redistest
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+func init() {
+	addCommands(map[string]*command{
+		"SADD":        {-3, cmdSAdd},
+		"SCARD":       {2, cmdSCard},
+		"SDIFF":       {-2, cmdSetOp},
+		"SDIFFSTORE":  {-3, cmdSetOpStore},
+		"SINTER":      {-2, cmdSetOp},
+		"SINTERSTORE": {-3, cmdSetOpStore},
+		"SUNION":      {-2, cmdSetOp},
+		"SUNIONSTORE": {-3, cmdSetOpStore},
+		"SISMEMBER":   {3, cmdSIsMember},
+		"SMISMEMBER":  {-3, cmdSMIsMember},
+		"SMEMBERS":    {2, cmdSMembers},
+		"SMOVE":       {4, cmdSMove},
+		"SPOP":        {-2, cmdSPop},
+		"SRANDMEMBER": {-2, cmdSRandMember},
+		"SREM":        {-3, cmdSRem},
+		"SSCAN":       {-3, cmdSScan},
+	})
+}
+
+// getSet returns the set of key, a new set is stored if create is true and key does not exist.
+func (d *db) getSet(key string, create bool) (map[string]struct{}, error) {
+	it := d.get(key)
+	if it == nil {
+		if !create {
+			return nil, nil
+		}
+		set := make(map[string]struct{})
+		d.put(key, set)
+		return set, nil
+	}
+	set, ok := it.value.(map[string]struct{})
+	if !ok {
+		return nil, errWrongType
+	}
+	return set, nil
+}
+
+func setMembers(set map[string]struct{}) []string {
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	return members
+}
+
+func sortedMembers(set map[string]struct{}) []string {
+	members := setMembers(set)
+	sort.Strings(members)
+	return members
+}
+
+func cmdSAdd(c *client, args []string) interface{} {
+	d := c.db()
+	set, err := d.getSet(args[1], true)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, member := range args[2:] {
+		if _, ok := set[member]; !ok {
+			set[member] = struct{}{}
+			n++
+		}
+	}
+	d.modified(args[1])
+	return n
+}
+
+func cmdSCard(c *client, args []string) interface{} {
+	set, err := c.db().getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	return len(set)
+}
+
+// setOp returns the difference, intersection or union of the sets of keys.
+func (d *db) setOp(op string, keys []string) (map[string]struct{}, error) {
+	sets := make([]map[string]struct{}, len(keys))
+	for i, key := range keys {
+		set, err := d.getSet(key, false)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	result := make(map[string]struct{})
+	switch op {
+	case "SDIFF":
+		for member := range sets[0] {
+			result[member] = struct{}{}
+		}
+		for _, set := range sets[1:] {
+			for member := range set {
+				delete(result, member)
+			}
+		}
+	case "SINTER":
+	next:
+		for member := range sets[0] {
+			for _, set := range sets[1:] {
+				if _, ok := set[member]; !ok {
+					continue next
+				}
+			}
+			result[member] = struct{}{}
+		}
+	case "SUNION":
+		for _, set := range sets {
+			for member := range set {
+				result[member] = struct{}{}
+			}
+		}
+	}
+	return result, nil
+}
+
+func cmdSetOp(c *client, args []string) interface{} {
+	set, err := c.db().setOp(strings.ToUpper(args[0]), args[1:])
+	if err != nil {
+		return err
+	}
+	return sortedMembers(set)
+}
+
+func cmdSetOpStore(c *client, args []string) interface{} {
+	op := strings.TrimSuffix(strings.ToUpper(args[0]), "STORE")
+	d := c.db()
+	set, err := d.setOp(op, args[2:])
+	if err != nil {
+		return err
+	}
+	if len(set) == 0 {
+		d.remove(args[1])
+	} else {
+		d.put(args[1], set)
+	}
+	return len(set)
+}
+
+func cmdSIsMember(c *client, args []string) interface{} {
+	set, err := c.db().getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	_, ok := set[args[2]]
+	return ok
+}
+
+func cmdSMIsMember(c *client, args []string) interface{} {
+	set, err := c.db().getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	result := make([]interface{}, len(args)-2)
+	for i, member := range args[2:] {
+		_, ok := set[member]
+		result[i] = ok
+	}
+	return result
+}
+
+func cmdSMembers(c *client, args []string) interface{} {
+	set, err := c.db().getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	return sortedMembers(set)
+}
+
+func cmdSMove(c *client, args []string) interface{} {
+	d := c.db()
+	src, err := d.getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	if _, err := d.getSet(args[2], false); err != nil {
+		return err
+	}
+	if _, ok := src[args[3]]; !ok {
+		return 0
+	}
+	delete(src, args[3])
+	d.modified(args[1])
+	dst, _ := d.getSet(args[2], true)
+	dst[args[3]] = struct{}{}
+	d.modified(args[2])
+	return 1
+}
+
+func cmdSPop(c *client, args []string) interface{} {
+	count := int64(-1)
+	if len(args) > 3 {
+		return errSyntax
+	}
+	if len(args) == 3 {
+		n, err := parseInt(args[2])
+		if err != nil || n < 0 {
+			return errNotInteger
+		}
+		count = n
+	}
+	d := c.db()
+	set, err := d.getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	members := setMembers(set)
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	n := int(count)
+	if count < 0 {
+		n = 1
+	}
+	if n > len(members) {
+		n = len(members)
+	}
+	members = members[:n]
+	for _, member := range members {
+		delete(set, member)
+	}
+	if n > 0 {
+		d.modified(args[1])
+	}
+	if count >= 0 {
+		return members
+	}
+	if n == 0 {
+		return nil
+	}
+	return members[0]
+}
+
+func cmdSRandMember(c *client, args []string) interface{} {
+	if len(args) > 3 {
+		return errSyntax
+	}
+	set, err := c.db().getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	members := setMembers(set)
+	if len(args) == 2 {
+		if len(members) == 0 {
+			return nil
+		}
+		return members[rand.Intn(len(members))]
+	}
+	count, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	result := []string{}
+	if len(members) == 0 {
+		return result
+	}
+	if count < 0 {
+		// the members may repeat
+		for i := int64(0); i < -count; i++ {
+			result = append(result, members[rand.Intn(len(members))])
+		}
+		return result
+	}
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	if count < int64(len(members)) {
+		members = members[:count]
+	}
+	return members
+}
+
+func cmdSRem(c *client, args []string) interface{} {
+	d := c.db()
+	set, err := d.getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, member := range args[2:] {
+		if _, ok := set[member]; ok {
+			delete(set, member)
+			n++
+		}
+	}
+	if n > 0 {
+		d.modified(args[1])
+	}
+	return n
+}
+
+func cmdSScan(c *client, args []string) interface{} {
+	s, err := parseScanArgs(args[2:], false)
+	if err != nil {
+		return err
+	}
+	set, err := c.db().getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	return s.scan(c.server, sortedMembers(set), 1, nil)
+}
@@ -0,0 +1,182 @@
+package redistest
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	addCommands(map[string]*command{
+		"SORT": {-2, cmdSort},
+	})
+}
+
+// lookupPattern returns the value of the key of pattern, in which the first * is replaced by element,
+// a key->field pattern returns the field of a hash.
+func (d *db) lookupPattern(pattern, element string) (string, bool) {
+	if pattern == "#" {
+		return element, true
+	}
+	i := strings.Index(pattern, "*")
+	if i < 0 {
+		return "", false
+	}
+	key := pattern[:i] + element + pattern[i+1:]
+	field := ""
+	if j := strings.Index(key, "->"); j > 0 && j+2 < len(key) {
+		key, field = key[:j], key[j+2:]
+	}
+	it := d.peek(key)
+	if it == nil {
+		return "", false
+	}
+	if field == "" {
+		s, ok := it.value.(string)
+		return s, ok
+	}
+	hash, ok := it.value.(map[string]string)
+	if !ok {
+		return "", false
+	}
+	s, ok := hash[field]
+	return s, ok
+}
+
+func cmdSort(c *client, args []string) interface{} {
+	var by, store string
+	var gets []string
+	var desc, alpha, limit bool
+	offset, count := 0, -1
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "ASC":
+			desc = false
+		case "DESC":
+			desc = true
+		case "ALPHA":
+			alpha = true
+		case "BY", "STORE", "GET":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			switch strings.ToUpper(args[i]) {
+			case "BY":
+				by = args[i+1]
+			case "STORE":
+				store = args[i+1]
+			case "GET":
+				gets = append(gets, args[i+1])
+			}
+			i++
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return errSyntax
+			}
+			var err error
+			if offset, err = strconv.Atoi(args[i+1]); err != nil {
+				return errNotInteger
+			}
+			if count, err = strconv.Atoi(args[i+2]); err != nil {
+				return errNotInteger
+			}
+			limit = true
+			i += 2
+		default:
+			return errSyntax
+		}
+	}
+	d := c.db()
+	var elements []string
+	if it := d.get(args[1]); it != nil {
+		switch v := it.value.(type) {
+		case []string:
+			elements = append(elements, v...)
+		case map[string]struct{}:
+			elements = setMembers(v)
+		case zset:
+			for _, m := range v.sorted() {
+				elements = append(elements, m.member)
+			}
+		default:
+			return errWrongType
+		}
+	}
+	if by == "" || strings.Contains(by, "*") {
+		weights := make(map[string]string, len(elements))
+		for _, e := range elements {
+			weights[e] = e
+			if by != "" {
+				weights[e], _ = d.lookupPattern(by, e)
+			}
+		}
+		scores := make(map[string]float64, len(elements))
+		if !alpha {
+			for _, e := range elements {
+				if weights[e] == "" && by != "" {
+					continue
+				}
+				f, err := strconv.ParseFloat(weights[e], 64)
+				if err != nil {
+					return errors.New("ERR One or more scores can't be converted into double")
+				}
+				scores[e] = f
+			}
+		}
+		sort.SliceStable(elements, func(i, j int) bool {
+			a, b := elements[i], elements[j]
+			if desc {
+				a, b = b, a
+			}
+			if alpha {
+				return weights[a] < weights[b]
+			}
+			if scores[a] != scores[b] {
+				return scores[a] < scores[b]
+			}
+			return a < b
+		})
+	}
+	if limit {
+		if offset < 0 {
+			offset = 0
+		}
+		if offset > len(elements) {
+			offset = len(elements)
+		}
+		elements = elements[offset:]
+		if count >= 0 && count < len(elements) {
+			elements = elements[:count]
+		}
+	}
+	result := make([]interface{}, 0, len(elements)*(len(gets)+1))
+	for _, e := range elements {
+		if len(gets) == 0 {
+			result = append(result, e)
+			continue
+		}
+		for _, pattern := range gets {
+			if s, ok := d.lookupPattern(pattern, e); ok {
+				result = append(result, s)
+			} else {
+				result = append(result, nil)
+			}
+		}
+	}
+	if store == "" {
+		return result
+	}
+	list := make([]string, len(result))
+	for i, v := range result {
+		if s, ok := v.(string); ok {
+			list[i] = s
+		}
+	}
+	if len(list) == 0 {
+		d.remove(store)
+	} else {
+		d.put(store, list)
+	}
+	return len(list)
+}
@@ -0,0 +1,773 @@
+package redistest
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	addCommands(map[string]*command{
+		"ZADD":             {-4, cmdZAdd},
+		"ZCARD":            {2, cmdZCard},
+		"ZCOUNT":           {4, cmdZCount},
+		"ZINCRBY":          {4, cmdZIncrBy},
+		"ZRANGE":           {-4, cmdZRange},
+		"ZREVRANGE":        {-4, cmdZRange},
+		"ZRANGEBYSCORE":    {-4, cmdZRangeByScore},
+		"ZREVRANGEBYSCORE": {-4, cmdZRangeByScore},
+		"ZRANGEBYLEX":      {-4, cmdZRangeByLex},
+		"ZREVRANGEBYLEX":   {-4, cmdZRangeByLex},
+		"ZLEXCOUNT":        {4, cmdZLexCount},
+		"ZRANK":            {3, cmdZRank},
+		"ZREVRANK":         {3, cmdZRank},
+		"ZREM":             {-3, cmdZRem},
+		"ZREMRANGEBYRANK":  {4, cmdZRemRangeByRank},
+		"ZREMRANGEBYSCORE": {4, cmdZRemRangeByScore},
+		"ZREMRANGEBYLEX":   {4, cmdZRemRangeByLex},
+		"ZSCORE":           {3, cmdZScore},
+		"ZMSCORE":          {-3, cmdZMScore},
+		"ZSCAN":            {-3, cmdZScan},
+		"ZINTERSTORE":      {-4, cmdZStore},
+		"ZUNIONSTORE":      {-4, cmdZStore},
+		"ZPOPMIN":          {-2, cmdZPop},
+		"ZPOPMAX":          {-2, cmdZPop},
+		"BZPOPMIN":         {-3, cmdBZPop},
+		"BZPOPMAX":         {-3, cmdBZPop},
+	})
+}
+
+// zset is the value of a sorted set, the score of every member.
+type zset map[string]float64
+
+type zmember struct {
+	member string
+	score  float64
+}
+
+// sorted returns the members ordered by score, then by member.
+func (z zset) sorted() []zmember {
+	members := make([]zmember, 0, len(z))
+	for member, score := range z {
+		members = append(members, zmember{member, score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].score != members[j].score {
+			return members[i].score < members[j].score
+		}
+		return members[i].member < members[j].member
+	})
+	return members
+}
+
+// getZSet returns the sorted set of key, a new one is stored if create is true and key does not exist.
+func (d *db) getZSet(key string, create bool) (zset, error) {
+	it := d.get(key)
+	if it == nil {
+		if !create {
+			return nil, nil
+		}
+		z := make(zset)
+		d.put(key, z)
+		return z, nil
+	}
+	z, ok := it.value.(zset)
+	if !ok {
+		return nil, errWrongType
+	}
+	return z, nil
+}
+
+// scoreBound is a bound of a score range, such as (1 or +inf.
+type scoreBound struct {
+	score     float64
+	exclusive bool
+}
+
+func parseScoreBound(s string) (scoreBound, error) {
+	var b scoreBound
+	if strings.HasPrefix(s, "(") {
+		b.exclusive = true
+		s = s[1:]
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return b, errors.New("ERR min or max is not a float")
+	}
+	b.score = f
+	return b, nil
+}
+
+func (b scoreBound) above(score float64) bool {
+	return score > b.score || !b.exclusive && score == b.score
+}
+
+func (b scoreBound) below(score float64) bool {
+	return score < b.score || !b.exclusive && score == b.score
+}
+
+// lexBound is a bound of a lexicographical range, such as [a, (a, - or +.
+type lexBound struct {
+	value     string
+	exclusive bool
+	infinite  int
+}
+
+func parseLexBound(s string) (lexBound, error) {
+	switch {
+	case s == "-":
+		return lexBound{infinite: -1}, nil
+	case s == "+":
+		return lexBound{infinite: 1}, nil
+	case strings.HasPrefix(s, "["):
+		return lexBound{value: s[1:]}, nil
+	case strings.HasPrefix(s, "("):
+		return lexBound{value: s[1:], exclusive: true}, nil
+	}
+	return lexBound{}, errors.New("ERR min or max not valid string range item")
+}
+
+func (b lexBound) above(s string) bool {
+	if b.infinite != 0 {
+		return b.infinite < 0
+	}
+	return s > b.value || !b.exclusive && s == b.value
+}
+
+func (b lexBound) below(s string) bool {
+	if b.infinite != 0 {
+		return b.infinite > 0
+	}
+	return s < b.value || !b.exclusive && s == b.value
+}
+
+// limitArgs parses the optional WITHSCORES and LIMIT offset count.
+func limitArgs(args []string, withScores bool) (scores bool, offset, count int, err error) {
+	count = -1
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			if !withScores {
+				return false, 0, 0, errSyntax
+			}
+			scores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return false, 0, 0, errSyntax
+			}
+			if offset, err = strconv.Atoi(args[i+1]); err != nil {
+				return false, 0, 0, errNotInteger
+			}
+			if count, err = strconv.Atoi(args[i+2]); err != nil {
+				return false, 0, 0, errNotInteger
+			}
+			i += 2
+		default:
+			return false, 0, 0, errSyntax
+		}
+	}
+	return scores, offset, count, nil
+}
+
+func limitMembers(members []zmember, offset, count int) []zmember {
+	if offset < 0 || offset >= len(members) {
+		return nil
+	}
+	members = members[offset:]
+	if count >= 0 && count < len(members) {
+		members = members[:count]
+	}
+	return members
+}
+
+func zmemberReply(members []zmember, withScores bool) []string {
+	result := make([]string, 0, len(members))
+	for _, m := range members {
+		result = append(result, m.member)
+		if withScores {
+			result = append(result, formatFloat(m.score))
+		}
+	}
+	return result
+}
+
+func reverse(members []zmember) {
+	for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+		members[i], members[j] = members[j], members[i]
+	}
+}
+
+func cmdZAdd(c *client, args []string) interface{} {
+	var nx, xx, gt, lt, ch, incr bool
+	i := 2
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break options
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return errSyntax
+	}
+	if nx && xx {
+		return errors.New("ERR XX and NX options at the same time are not compatible")
+	}
+	if gt && lt || nx && (gt || lt) {
+		return errors.New("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && len(pairs) != 2 {
+		return errors.New("ERR INCR option supports a single increment-element pair")
+	}
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		f, err := parseFloat(pairs[2*j])
+		if err != nil {
+			return err
+		}
+		scores[j] = f
+	}
+	d := c.db()
+	z, err := d.getZSet(args[1], true)
+	if err != nil {
+		return err
+	}
+	added, changed := 0, 0
+	var result interface{}
+	for j, score := range scores {
+		member := pairs[2*j+1]
+		old, exists := z[member]
+		if nx && exists || xx && !exists {
+			continue
+		}
+		if incr {
+			score += old
+			if math.IsNaN(score) {
+				d.modified(args[1])
+				return errors.New("ERR resulting score is not a number (NaN)")
+			}
+		}
+		if exists && (gt && score <= old || lt && score >= old) {
+			continue
+		}
+		z[member] = score
+		result = score
+		if !exists {
+			added++
+		} else if score != old {
+			changed++
+		}
+	}
+	d.modified(args[1])
+	if incr {
+		return result
+	}
+	if ch {
+		return added + changed
+	}
+	return added
+}
+
+func cmdZCard(c *client, args []string) interface{} {
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	return len(z)
+}
+
+func cmdZCount(c *client, args []string) interface{} {
+	min, err := parseScoreBound(args[2])
+	if err != nil {
+		return err
+	}
+	max, err := parseScoreBound(args[3])
+	if err != nil {
+		return err
+	}
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, score := range z {
+		if min.above(score) && max.below(score) {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdZIncrBy(c *client, args []string) interface{} {
+	by, err := parseFloat(args[2])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	z, err := d.getZSet(args[1], true)
+	if err != nil {
+		return err
+	}
+	score := z[args[3]] + by
+	if math.IsNaN(score) {
+		d.modified(args[1])
+		return errors.New("ERR resulting score is not a number (NaN)")
+	}
+	z[args[3]] = score
+	d.modified(args[1])
+	return score
+}
+
+func cmdZRange(c *client, args []string) interface{} {
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	end, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	withScores := false
+	switch {
+	case len(args) == 5 && strings.ToUpper(args[4]) == "WITHSCORES":
+		withScores = true
+	case len(args) > 4:
+		return errSyntax
+	}
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	members := z.sorted()
+	if strings.ToUpper(args[0]) == "ZREVRANGE" {
+		reverse(members)
+	}
+	i, j := stringRange(start, end, len(members))
+	return zmemberReply(members[i:j], withScores)
+}
+
+func cmdZRangeByScore(c *client, args []string) interface{} {
+	rev := strings.ToUpper(args[0]) == "ZREVRANGEBYSCORE"
+	minArg, maxArg := args[2], args[3]
+	if rev {
+		minArg, maxArg = maxArg, minArg
+	}
+	min, err := parseScoreBound(minArg)
+	if err != nil {
+		return err
+	}
+	max, err := parseScoreBound(maxArg)
+	if err != nil {
+		return err
+	}
+	withScores, offset, count, err := limitArgs(args[4:], true)
+	if err != nil {
+		return err
+	}
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	var members []zmember
+	for _, m := range z.sorted() {
+		if min.above(m.score) && max.below(m.score) {
+			members = append(members, m)
+		}
+	}
+	if rev {
+		reverse(members)
+	}
+	return zmemberReply(limitMembers(members, offset, count), withScores)
+}
+
+// lexRange returns the members in the lexicographical range, the members should have the same score.
+func (z zset) lexRange(min, max lexBound) []zmember {
+	var members []zmember
+	for _, m := range z.sorted() {
+		if min.above(m.member) && max.below(m.member) {
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+func cmdZRangeByLex(c *client, args []string) interface{} {
+	rev := strings.ToUpper(args[0]) == "ZREVRANGEBYLEX"
+	minArg, maxArg := args[2], args[3]
+	if rev {
+		minArg, maxArg = maxArg, minArg
+	}
+	min, err := parseLexBound(minArg)
+	if err != nil {
+		return err
+	}
+	max, err := parseLexBound(maxArg)
+	if err != nil {
+		return err
+	}
+	_, offset, count, err := limitArgs(args[4:], false)
+	if err != nil {
+		return err
+	}
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	members := z.lexRange(min, max)
+	if rev {
+		reverse(members)
+	}
+	return zmemberReply(limitMembers(members, offset, count), false)
+}
+
+func cmdZLexCount(c *client, args []string) interface{} {
+	min, err := parseLexBound(args[2])
+	if err != nil {
+		return err
+	}
+	max, err := parseLexBound(args[3])
+	if err != nil {
+		return err
+	}
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	return len(z.lexRange(min, max))
+}
+
+func cmdZRank(c *client, args []string) interface{} {
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	if _, ok := z[args[2]]; !ok {
+		return nil
+	}
+	members := z.sorted()
+	if strings.ToUpper(args[0]) == "ZREVRANK" {
+		reverse(members)
+	}
+	for i, m := range members {
+		if m.member == args[2] {
+			return i
+		}
+	}
+	return nil
+}
+
+func cmdZRem(c *client, args []string) interface{} {
+	d := c.db()
+	z, err := d.getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, member := range args[2:] {
+		if _, ok := z[member]; ok {
+			delete(z, member)
+			n++
+		}
+	}
+	if n > 0 {
+		d.modified(args[1])
+	}
+	return n
+}
+
+// removeMembers removes the members from the sorted set of key and returns the number of them.
+func (d *db) removeMembers(key string, z zset, members []zmember) int {
+	for _, m := range members {
+		delete(z, m.member)
+	}
+	if len(members) > 0 {
+		d.modified(key)
+	}
+	return len(members)
+}
+
+func cmdZRemRangeByRank(c *client, args []string) interface{} {
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	end, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	z, err := d.getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	members := z.sorted()
+	i, j := stringRange(start, end, len(members))
+	return d.removeMembers(args[1], z, members[i:j])
+}
+
+func cmdZRemRangeByScore(c *client, args []string) interface{} {
+	min, err := parseScoreBound(args[2])
+	if err != nil {
+		return err
+	}
+	max, err := parseScoreBound(args[3])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	z, err := d.getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	var members []zmember
+	for _, m := range z.sorted() {
+		if min.above(m.score) && max.below(m.score) {
+			members = append(members, m)
+		}
+	}
+	return d.removeMembers(args[1], z, members)
+}
+
+func cmdZRemRangeByLex(c *client, args []string) interface{} {
+	min, err := parseLexBound(args[2])
+	if err != nil {
+		return err
+	}
+	max, err := parseLexBound(args[3])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	z, err := d.getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	return d.removeMembers(args[1], z, z.lexRange(min, max))
+}
+
+func cmdZScore(c *client, args []string) interface{} {
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	if score, ok := z[args[2]]; ok {
+		return score
+	}
+	return nil
+}
+
+func cmdZMScore(c *client, args []string) interface{} {
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	result := make([]interface{}, len(args)-2)
+	for i, member := range args[2:] {
+		if score, ok := z[member]; ok {
+			result[i] = score
+		}
+	}
+	return result
+}
+
+func cmdZScan(c *client, args []string) interface{} {
+	s, err := parseScanArgs(args[2:], false)
+	if err != nil {
+		return err
+	}
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	members := make([]string, 0, len(z))
+	for member := range z {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	elements := make([]string, 0, 2*len(z))
+	for _, member := range members {
+		elements = append(elements, member, formatFloat(z[member]))
+	}
+	return s.scan(c.server, elements, 2, nil)
+}
+
+func cmdZStore(c *client, args []string) interface{} {
+	n, err := strconv.Atoi(args[2])
+	if err != nil {
+		return errNotInteger
+	}
+	if n < 1 {
+		return errors.New("ERR at least 1 input key is needed for '" + strings.ToLower(args[0]) + "' command")
+	}
+	if n > len(args)-3 {
+		return errSyntax
+	}
+	keys := args[3 : 3+n]
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	aggregate := "SUM"
+	for i := 3 + n; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WEIGHTS":
+			if i+n >= len(args) {
+				return errSyntax
+			}
+			for j := range weights {
+				if weights[j], err = strconv.ParseFloat(args[i+1+j], 64); err != nil {
+					return errors.New("ERR weight value is not a float")
+				}
+			}
+			i += n
+		case "AGGREGATE":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			aggregate = strings.ToUpper(args[i+1])
+			if aggregate != "SUM" && aggregate != "MIN" && aggregate != "MAX" {
+				return errSyntax
+			}
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	d := c.db()
+	var result zset
+	for i, key := range keys {
+		it := d.get(key)
+		var z zset
+		if it != nil {
+			// a set is a sorted set with scores of 1
+			switch v := it.value.(type) {
+			case zset:
+				z = v
+			case map[string]struct{}:
+				z = make(zset, len(v))
+				for member := range v {
+					z[member] = 1
+				}
+			default:
+				return errWrongType
+			}
+		}
+		weighted := make(zset, len(z))
+		for member, score := range z {
+			weighted[member] = score * weights[i]
+			if math.IsNaN(weighted[member]) {
+				weighted[member] = 0
+			}
+		}
+		switch {
+		case i == 0:
+			result = weighted
+		case strings.ToUpper(args[0]) == "ZUNIONSTORE":
+			for member, score := range weighted {
+				if old, ok := result[member]; ok {
+					score = aggregateScore(aggregate, old, score)
+				}
+				result[member] = score
+			}
+		default:
+			for member, old := range result {
+				if score, ok := weighted[member]; ok {
+					result[member] = aggregateScore(aggregate, old, score)
+				} else {
+					delete(result, member)
+				}
+			}
+		}
+	}
+	if len(result) == 0 {
+		d.remove(args[1])
+		return 0
+	}
+	d.put(args[1], result)
+	return len(result)
+}
+
+func aggregateScore(aggregate string, a, b float64) float64 {
+	switch aggregate {
+	case "MIN":
+		return math.Min(a, b)
+	case "MAX":
+		return math.Max(a, b)
+	}
+	if s := a + b; !math.IsNaN(s) {
+		return s
+	}
+	return 0
+}
+
+// popMembers removes and returns count members with the lowest scores, or the highest if max is true.
+func (d *db) popMembers(key string, z zset, count int, max bool) []zmember {
+	members := z.sorted()
+	if max {
+		reverse(members)
+	}
+	if count < len(members) {
+		members = members[:count]
+	}
+	d.removeMembers(key, z, members)
+	return members
+}
+
+func cmdZPop(c *client, args []string) interface{} {
+	if len(args) > 3 {
+		return errSyntax
+	}
+	count := int64(1)
+	if len(args) == 3 {
+		n, err := parseInt(args[2])
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return errors.New("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	d := c.db()
+	z, err := d.getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	members := d.popMembers(args[1], z, int(count), strings.ToUpper(args[0]) == "ZPOPMAX")
+	return zmemberReply(members, true)
+}
+
+func cmdBZPop(c *client, args []string) interface{} {
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	for _, key := range args[1 : len(args)-1] {
+		z, err := d.getZSet(key, false)
+		if err != nil {
+			return err
+		}
+		if len(z) == 0 {
+			continue
+		}
+		members := d.popMembers(key, z, 1, strings.ToUpper(args[0]) == "BZPOPMAX")
+		return append([]string{key}, zmemberReply(members, true)...)
+	}
+	return wait{timeout: timeout, reply: nilArray{}}
+}
@@ -0,0 +1,1163 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	addCommands(map[string]*command{
+		"XADD":       {-5, cmdXAdd},
+		"XLEN":       {2, cmdXLen},
+		"XDEL":       {-3, cmdXDel},
+		"XRANGE":     {-4, cmdXRange},
+		"XREVRANGE":  {-4, cmdXRange},
+		"XTRIM":      {-4, cmdXTrim},
+		"XREAD":      {-4, cmdXRead},
+		"XREADGROUP": {-7, cmdXRead},
+		"XGROUP":     {-2, cmdXGroup},
+		"XACK":       {-4, cmdXAck},
+		"XPENDING":   {-3, cmdXPending},
+		"XCLAIM":     {-6, cmdXClaim},
+		"XAUTOCLAIM": {-6, cmdXAutoClaim},
+		"XINFO":      {-2, cmdXInfo},
+	})
+}
+
+var (
+	errInvalidStreamID = errors.New("ERR Invalid stream ID specified as stream command argument")
+	errStreamSmallerID = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	errStreamNoKey     = errors.New("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+)
+
+// streamID is the ID of a stream entry, the milliseconds time and the sequence number.
+type streamID struct {
+	ms, seq uint64
+}
+
+var maxStreamID = streamID{math.MaxUint64, math.MaxUint64}
+
+func (id streamID) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+func (id streamID) less(other streamID) bool {
+	return id.ms < other.ms || id.ms == other.ms && id.seq < other.seq
+}
+
+// next returns the smallest ID greater than id, false if id is the maximum.
+func (id streamID) next() (streamID, bool) {
+	switch {
+	case id.seq < math.MaxUint64:
+		return streamID{id.ms, id.seq + 1}, true
+	case id.ms < math.MaxUint64:
+		return streamID{id.ms + 1, 0}, true
+	}
+	return id, false
+}
+
+// prev returns the greatest ID less than id, false if id is 0-0.
+func (id streamID) prev() (streamID, bool) {
+	switch {
+	case id.seq > 0:
+		return streamID{id.ms, id.seq - 1}, true
+	case id.ms > 0:
+		return streamID{id.ms - 1, math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// parseStreamID parses an ID of ms-seq, or ms with the sequence number seq.
+func parseStreamID(s string, seq uint64) (streamID, error) {
+	ms := s
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		n, err := strconv.ParseUint(s[i+1:], 10, 64)
+		if err != nil {
+			return streamID{}, errInvalidStreamID
+		}
+		ms, seq = s[:i], n
+	}
+	n, err := strconv.ParseUint(ms, 10, 64)
+	if err != nil {
+		return streamID{}, errInvalidStreamID
+	}
+	return streamID{n, seq}, nil
+}
+
+// parseRangeID parses the start or the end of a range: "-", "+", an ID, or an exclusive ID prefixed by "(".
+// A start without the sequence number starts at sequence 0, an end ends at the maximum sequence.
+func parseRangeID(s string, end bool) (streamID, error) {
+	switch s {
+	case "-":
+		return streamID{}, nil
+	case "+":
+		return maxStreamID, nil
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+	var seq uint64
+	if end {
+		seq = math.MaxUint64
+	}
+	id, err := parseStreamID(s, seq)
+	if err != nil || !exclusive {
+		return id, err
+	}
+	ok := false
+	if end {
+		if id, ok = id.prev(); !ok {
+			return id, errors.New("ERR invalid end ID for the interval")
+		}
+	} else if id, ok = id.next(); !ok {
+		return id, errors.New("ERR invalid start ID for the interval")
+	}
+	return id, nil
+}
+
+type streamEntry struct {
+	id     streamID
+	values []string // the field value pairs
+}
+
+// pendingEntry is an entry delivered to a consumer of a group but not acknowledged.
+type pendingEntry struct {
+	id         streamID
+	consumer   string
+	delivered  time.Time
+	deliveries int64
+}
+
+type streamGroup struct {
+	last      streamID
+	pending   []*pendingEntry      // ordered by ID
+	consumers map[string]time.Time // the last time every consumer was seen
+}
+
+// stream is the value of a stream, the entries are ordered by ID.
+type stream struct {
+	entries    []streamEntry
+	last       streamID
+	added      int64
+	maxDeleted streamID
+	groups     map[string]*streamGroup
+}
+
+func newStream() *stream {
+	return &stream{groups: make(map[string]*streamGroup)}
+}
+
+func newStreamGroup(last streamID) *streamGroup {
+	return &streamGroup{last: last, consumers: make(map[string]time.Time)}
+}
+
+// copy returns a deep copy of the stream, the values of the entries are shared as they never change.
+func (st *stream) copy() *stream {
+	c := &stream{
+		entries:    append([]streamEntry{}, st.entries...),
+		last:       st.last,
+		added:      st.added,
+		maxDeleted: st.maxDeleted,
+		groups:     make(map[string]*streamGroup, len(st.groups)),
+	}
+	for name, g := range st.groups {
+		group := newStreamGroup(g.last)
+		for _, p := range g.pending {
+			entry := *p
+			group.pending = append(group.pending, &entry)
+		}
+		for consumer, seen := range g.consumers {
+			group.consumers[consumer] = seen
+		}
+		c.groups[name] = group
+	}
+	return c
+}
+
+// search returns the index of the first entry whose ID is not less than id.
+func (st *stream) search(id streamID) int {
+	return sort.Search(len(st.entries), func(i int) bool {
+		return !st.entries[i].id.less(id)
+	})
+}
+
+func (st *stream) find(id streamID) (streamEntry, bool) {
+	if i := st.search(id); i < len(st.entries) && st.entries[i].id == id {
+		return st.entries[i], true
+	}
+	return streamEntry{}, false
+}
+
+// between returns at most count entries with IDs between start and end, all if count is negative.
+func (st *stream) between(start, end streamID, count int, rev bool) []streamEntry {
+	lo := st.search(start)
+	hi := sort.Search(len(st.entries), func(i int) bool {
+		return end.less(st.entries[i].id)
+	})
+	var entries []streamEntry
+	for i := lo; i < hi && len(entries) != count; i++ {
+		j := i
+		if rev {
+			j = hi - 1 - (i - lo)
+		}
+		entries = append(entries, st.entries[j])
+	}
+	return entries
+}
+
+// after returns at most count entries with IDs greater than id, all if count is negative.
+func (st *stream) after(id streamID, count int) []streamEntry {
+	start, ok := id.next()
+	if !ok {
+		return nil
+	}
+	return st.between(start, maxStreamID, count, false)
+}
+
+// nextID returns the ID of a new entry by the ID argument of XADD: *, ms-* or an explicit ID.
+func (st *stream) nextID(s string, now time.Time) (streamID, error) {
+	var id streamID
+	switch {
+	case s == "*":
+		if ms := uint64(now.UnixNano() / int64(time.Millisecond)); st.last.ms < ms {
+			return streamID{ms, 0}, nil
+		}
+		next, ok := st.last.next()
+		if !ok {
+			return id, errors.New("ERR The stream has exhausted the last possible ID, unable to add more items")
+		}
+		return next, nil
+	case strings.HasSuffix(s, "-*"):
+		ms, err := strconv.ParseUint(s[:len(s)-2], 10, 64)
+		if err != nil {
+			return id, errInvalidStreamID
+		}
+		id.ms = ms
+		if ms == st.last.ms {
+			if st.last.seq == math.MaxUint64 {
+				return id, errStreamSmallerID
+			}
+			id.seq = st.last.seq + 1
+		}
+	default:
+		var err error
+		if id, err = parseStreamID(s, 0); err != nil {
+			return id, err
+		}
+		if id == (streamID{}) {
+			return id, errors.New("ERR The ID specified in XADD must be greater than 0-0")
+		}
+	}
+	if !st.last.less(id) {
+		return id, errStreamSmallerID
+	}
+	return id, nil
+}
+
+// delete removes the entry of id and reports whether it existed, the pending entries of the groups are kept.
+func (st *stream) delete(id streamID) bool {
+	i := st.search(id)
+	if i == len(st.entries) || st.entries[i].id != id {
+		return false
+	}
+	st.entries = append(st.entries[:i:i], st.entries[i+1:]...)
+	if st.maxDeleted.less(id) {
+		st.maxDeleted = id
+	}
+	return true
+}
+
+// streamTrim is the MAXLEN or MINID option of XADD and XTRIM, the approximate trimming of "~" is exact.
+type streamTrim struct {
+	byID   bool
+	maxlen int
+	minid  streamID
+}
+
+// parseStreamTrim parses the trim option starting at args[0], which is MAXLEN or MINID,
+// and returns the number of the arguments of the option.
+func parseStreamTrim(args []string) (*streamTrim, int, error) {
+	t := &streamTrim{byID: strings.EqualFold(args[0], "MINID")}
+	n := 1
+	if n < len(args) && (args[n] == "=" || args[n] == "~") {
+		n++
+	}
+	if n == len(args) {
+		return nil, 0, errSyntax
+	}
+	if t.byID {
+		id, err := parseStreamID(args[n], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		t.minid = id
+	} else {
+		maxlen, err := parseInt(args[n])
+		if err != nil || maxlen < 0 {
+			return nil, 0, errors.New("ERR The MAXLEN argument must be >= 0.")
+		}
+		t.maxlen = int(maxlen)
+	}
+	n++
+	if n+1 < len(args) && strings.EqualFold(args[n], "LIMIT") {
+		if _, err := parseInt(args[n+1]); err != nil {
+			return nil, 0, err
+		}
+		n += 2
+	}
+	return t, n, nil
+}
+
+// trim removes the entries out of t and returns the number of them.
+func (st *stream) trim(t *streamTrim) int {
+	n := 0
+	if t.byID {
+		n = st.search(t.minid)
+	} else if len(st.entries) > t.maxlen {
+		n = len(st.entries) - t.maxlen
+	}
+	st.entries = st.entries[n:]
+	return n
+}
+
+// pendingIndex returns the index of the pending entry of id, or where it would be inserted, and whether it exists.
+func (g *streamGroup) pendingIndex(id streamID) (int, bool) {
+	i := sort.Search(len(g.pending), func(i int) bool {
+		return !g.pending[i].id.less(id)
+	})
+	return i, i < len(g.pending) && g.pending[i].id == id
+}
+
+func (g *streamGroup) insertPending(i int, p *pendingEntry) {
+	g.pending = append(g.pending, nil)
+	copy(g.pending[i+1:], g.pending[i:])
+	g.pending[i] = p
+}
+
+func (g *streamGroup) removePending(i int) {
+	g.pending = append(g.pending[:i:i], g.pending[i+1:]...)
+}
+
+// pendingCount returns the number of the pending entries of consumer.
+func (g *streamGroup) pendingCount(consumer string) int {
+	n := 0
+	for _, p := range g.pending {
+		if p.consumer == consumer {
+			n++
+		}
+	}
+	return n
+}
+
+func (g *streamGroup) sortedConsumers() []string {
+	names := make([]string, 0, len(g.consumers))
+	for name := range g.consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getStream returns the stream of key, nil if it does not exist.
+func (d *db) getStream(key string) (*stream, error) {
+	it := d.get(key)
+	if it == nil {
+		return nil, nil
+	}
+	st, ok := it.value.(*stream)
+	if !ok {
+		return nil, errWrongType
+	}
+	return st, nil
+}
+
+// getGroup returns the stream of key and its consumer group, NOGROUP if either does not exist.
+func (d *db) getGroup(key, group string) (*stream, *streamGroup, error) {
+	st, err := d.getStream(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if st == nil || st.groups[group] == nil {
+		return nil, nil, fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s'", key, group)
+	}
+	return st, st.groups[group], nil
+}
+
+func entryReply(e streamEntry) []interface{} {
+	return []interface{}{e.id.String(), e.values}
+}
+
+func entriesReply(entries []streamEntry) []interface{} {
+	result := make([]interface{}, len(entries))
+	for i, e := range entries {
+		result[i] = entryReply(e)
+	}
+	return result
+}
+
+func idleMilliseconds(since, now time.Time) int64 {
+	return int64(now.Sub(since) / time.Millisecond)
+}
+
+func cmdXAdd(c *client, args []string) interface{} {
+	var nomkstream bool
+	var trim *streamTrim
+	i := 2
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			nomkstream = true
+		case "MAXLEN", "MINID":
+			t, n, err := parseStreamTrim(args[i:])
+			if err != nil {
+				return err
+			}
+			trim = t
+			i += n - 1
+		default:
+			break options
+		}
+	}
+	if n := len(args) - i - 1; n <= 0 || n%2 != 0 {
+		return errors.New("ERR wrong number of arguments for 'xadd' command")
+	}
+	d := c.db()
+	st, err := d.getStream(args[1])
+	if err != nil {
+		return err
+	}
+	exists := st != nil
+	if !exists {
+		if nomkstream {
+			return nil
+		}
+		st = newStream()
+	}
+	id, err := st.nextID(args[i], c.server.now())
+	if err != nil {
+		return err
+	}
+	st.entries = append(st.entries, streamEntry{id: id, values: append([]string{}, args[i+1:]...)})
+	st.last = id
+	st.added++
+	if trim != nil {
+		st.trim(trim)
+	}
+	if exists {
+		d.modified(args[1])
+	} else {
+		d.put(args[1], st)
+	}
+	return id.String()
+}
+
+func cmdXLen(c *client, args []string) interface{} {
+	st, err := c.db().getStream(args[1])
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return 0
+	}
+	return len(st.entries)
+}
+
+func cmdXDel(c *client, args []string) interface{} {
+	ids := make([]streamID, 0, len(args)-2)
+	for _, s := range args[2:] {
+		id, err := parseStreamID(s, 0)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	d := c.db()
+	st, err := d.getStream(args[1])
+	if err != nil || st == nil {
+		return orZero(err)
+	}
+	n := 0
+	for _, id := range ids {
+		if st.delete(id) {
+			n++
+		}
+	}
+	if n > 0 {
+		d.modified(args[1])
+	}
+	return n
+}
+
+// orZero returns err if it is not nil, otherwise the integer reply 0.
+func orZero(err error) interface{} {
+	if err != nil {
+		return err
+	}
+	return 0
+}
+
+func cmdXRange(c *client, args []string) interface{} {
+	rev := strings.ToUpper(args[0]) == "XREVRANGE"
+	startArg, endArg := args[2], args[3]
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	start, err := parseRangeID(startArg, false)
+	if err != nil {
+		return err
+	}
+	end, err := parseRangeID(endArg, true)
+	if err != nil {
+		return err
+	}
+	count := -1
+	if len(args) > 4 {
+		if len(args) != 6 || !strings.EqualFold(args[4], "COUNT") {
+			return errSyntax
+		}
+		n, err := parseInt(args[5])
+		if err != nil {
+			return err
+		}
+		if count = int(n); count < 0 {
+			count = 0
+		}
+	}
+	st, err := c.db().getStream(args[1])
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return []interface{}{}
+	}
+	return entriesReply(st.between(start, end, count, rev))
+}
+
+func cmdXTrim(c *client, args []string) interface{} {
+	if !strings.EqualFold(args[2], "MAXLEN") && !strings.EqualFold(args[2], "MINID") {
+		return errSyntax
+	}
+	t, n, err := parseStreamTrim(args[2:])
+	if err != nil {
+		return err
+	}
+	if 2+n != len(args) {
+		return errSyntax
+	}
+	d := c.db()
+	st, err := d.getStream(args[1])
+	if err != nil || st == nil {
+		return orZero(err)
+	}
+	removed := st.trim(t)
+	if removed > 0 {
+		d.modified(args[1])
+	}
+	return removed
+}
+
+// cmdXRead serves XREAD and XREADGROUP.
+func cmdXRead(c *client, args []string) interface{} {
+	name := strings.ToLower(args[0])
+	group := name == "xreadgroup"
+	var groupName, consumer string
+	i := 1
+	if group {
+		if !strings.EqualFold(args[1], "GROUP") {
+			return errSyntax
+		}
+		groupName, consumer = args[2], args[3]
+		i = 4
+	}
+	count, block, noack, streams := -1, time.Duration(-1), false, 0
+	for ; i < len(args) && streams == 0; i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COUNT", "BLOCK":
+			if i+1 == len(args) {
+				return errSyntax
+			}
+			n, err := parseInt(args[i+1])
+			if err != nil {
+				return err
+			}
+			if strings.EqualFold(args[i], "COUNT") {
+				if n > 0 {
+					count = int(n)
+				}
+			} else if n < 0 {
+				return errNegTimeout
+			} else {
+				block = time.Duration(n) * time.Millisecond
+			}
+			i++
+		case "NOACK":
+			if !group {
+				return errSyntax
+			}
+			noack = true
+		case "STREAMS":
+			streams = i + 1
+		default:
+			return errSyntax
+		}
+	}
+	if streams == 0 {
+		return errSyntax
+	}
+	if n := len(args) - streams; n == 0 || n%2 != 0 {
+		return fmt.Errorf("ERR Unbalanced '%s' list of streams: for each stream key an ID or '$' must be specified.", name)
+	}
+	keys := args[streams : streams+(len(args)-streams)/2]
+	idArgs := args[streams+len(keys):]
+
+	d := c.db()
+	now := c.server.now()
+	ids := make([]streamID, len(keys))
+	for i, key := range keys {
+		st, err := d.getStream(key)
+		if err != nil {
+			return err
+		}
+		if group && (st == nil || st.groups[groupName] == nil) {
+			return fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, groupName)
+		}
+		switch {
+		case idArgs[i] == ">" && group:
+		case idArgs[i] == "$" && !group:
+			if st != nil {
+				ids[i] = st.last
+			}
+			// a blocked command is retried by the same arguments, it reads the entries added after the first try
+			idArgs[i] = ids[i].String()
+		default:
+			if ids[i], err = parseStreamID(idArgs[i], 0); err != nil {
+				return err
+			}
+		}
+	}
+
+	result := []interface{}{}
+	for i, key := range keys {
+		st, _ := d.getStream(key)
+		if !group {
+			if st == nil {
+				continue
+			}
+			if entries := st.after(ids[i], count); len(entries) > 0 {
+				result = append(result, []interface{}{key, entriesReply(entries)})
+			}
+			continue
+		}
+		g := st.groups[groupName]
+		g.consumers[consumer] = now
+		if idArgs[i] != ">" {
+			// the history of the consumer is replied even if empty, the entries deleted from the stream have no values
+			history := []interface{}{}
+			for _, p := range g.pending {
+				if p.consumer != consumer || !ids[i].less(p.id) {
+					continue
+				}
+				if len(history) == count {
+					break
+				}
+				if e, ok := st.find(p.id); ok {
+					history = append(history, entryReply(e))
+				} else {
+					history = append(history, []interface{}{p.id.String(), nil})
+				}
+			}
+			result = append(result, []interface{}{key, history})
+			continue
+		}
+		entries := st.after(g.last, count)
+		if len(entries) == 0 {
+			continue
+		}
+		for _, e := range entries {
+			g.last = e.id
+			if noack {
+				continue
+			}
+			if j, ok := g.pendingIndex(e.id); ok {
+				g.pending[j] = &pendingEntry{id: e.id, consumer: consumer, delivered: now, deliveries: 1}
+			} else {
+				g.insertPending(j, &pendingEntry{id: e.id, consumer: consumer, delivered: now, deliveries: 1})
+			}
+		}
+		d.modified(key)
+		result = append(result, []interface{}{key, entriesReply(entries)})
+	}
+	if len(result) == 0 {
+		if block >= 0 {
+			return wait{timeout: block, reply: nilArray{}}
+		}
+		return nilArray{}
+	}
+	return result
+}
+
+func cmdXGroup(c *client, args []string) interface{} {
+	sub := strings.ToUpper(args[1])
+	arities := map[string]int{"CREATE": -5, "SETID": -5, "DESTROY": 4, "CREATECONSUMER": 5, "DELCONSUMER": 5}
+	arity, ok := arities[sub]
+	if !ok {
+		return fmt.Errorf("ERR unknown subcommand '%s'. Try XGROUP HELP.", args[1])
+	}
+	if arity > 0 && len(args) != arity || arity < 0 && len(args) < -arity {
+		return fmt.Errorf("ERR wrong number of arguments for 'xgroup|%s' command", strings.ToLower(sub))
+	}
+	d := c.db()
+	key := args[2]
+	switch sub {
+	case "CREATE":
+		var mkstream bool
+		for i := 5; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "MKSTREAM":
+				mkstream = true
+			case "ENTRIESREAD":
+				if i++; i == len(args) {
+					return errSyntax
+				}
+			default:
+				return errSyntax
+			}
+		}
+		var id streamID
+		if args[4] != "$" {
+			var err error
+			if id, err = parseStreamID(args[4], 0); err != nil {
+				return err
+			}
+		}
+		st, err := d.getStream(key)
+		if err != nil {
+			return err
+		}
+		exists := st != nil
+		if !exists {
+			if !mkstream {
+				return errStreamNoKey
+			}
+			st = newStream()
+		}
+		if st.groups[args[3]] != nil {
+			return errors.New("BUSYGROUP Consumer Group name already exists")
+		}
+		if args[4] == "$" {
+			id = st.last
+		}
+		st.groups[args[3]] = newStreamGroup(id)
+		if exists {
+			d.modified(key)
+		} else {
+			d.put(key, st)
+		}
+		return statusOK
+	case "DESTROY":
+		st, err := d.getStream(key)
+		if err != nil {
+			return err
+		}
+		if st == nil {
+			return errStreamNoKey
+		}
+		if st.groups[args[3]] == nil {
+			return 0
+		}
+		delete(st.groups, args[3])
+		d.modified(key)
+		return 1
+	}
+
+	st, g, err := d.getGroup(key, args[3])
+	if err != nil {
+		return err
+	}
+	switch sub {
+	case "SETID":
+		if args[4] == "$" {
+			g.last = st.last
+		} else if g.last, err = parseStreamID(args[4], 0); err != nil {
+			return err
+		}
+		d.modified(key)
+		return statusOK
+	case "CREATECONSUMER":
+		if _, ok := g.consumers[args[4]]; ok {
+			return 0
+		}
+		g.consumers[args[4]] = c.server.now()
+		d.modified(key)
+		return 1
+	}
+	// DELCONSUMER
+	if _, ok := g.consumers[args[4]]; !ok {
+		return 0
+	}
+	n := 0
+	for i := 0; i < len(g.pending); {
+		if g.pending[i].consumer == args[4] {
+			g.removePending(i)
+			n++
+		} else {
+			i++
+		}
+	}
+	delete(g.consumers, args[4])
+	d.modified(key)
+	return n
+}
+
+func cmdXAck(c *client, args []string) interface{} {
+	ids := make([]streamID, 0, len(args)-3)
+	for _, s := range args[3:] {
+		id, err := parseStreamID(s, 0)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	d := c.db()
+	st, err := d.getStream(args[1])
+	if err != nil || st == nil || st.groups[args[2]] == nil {
+		return orZero(err)
+	}
+	g := st.groups[args[2]]
+	n := 0
+	for _, id := range ids {
+		if i, ok := g.pendingIndex(id); ok {
+			g.removePending(i)
+			n++
+		}
+	}
+	if n > 0 {
+		d.modified(args[1])
+	}
+	return n
+}
+
+func cmdXPending(c *client, args []string) interface{} {
+	if len(args) > 3 && len(args) < 6 {
+		return errSyntax
+	}
+	_, g, err := c.db().getGroup(args[1], args[2])
+	if err != nil {
+		return err
+	}
+	if len(args) == 3 {
+		if len(g.pending) == 0 {
+			return []interface{}{0, nil, nil, nilArray{}}
+		}
+		counts := make(map[string]int)
+		for _, p := range g.pending {
+			counts[p.consumer]++
+		}
+		names := make([]string, 0, len(counts))
+		for name := range counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		consumers := make([]interface{}, len(names))
+		for i, name := range names {
+			consumers[i] = []string{name, strconv.Itoa(counts[name])}
+		}
+		return []interface{}{len(g.pending), g.pending[0].id.String(), g.pending[len(g.pending)-1].id.String(), consumers}
+	}
+
+	i := 3
+	var minIdle time.Duration
+	if strings.EqualFold(args[i], "IDLE") {
+		n, err := parseInt(args[i+1])
+		if err != nil {
+			return err
+		}
+		minIdle = time.Duration(n) * time.Millisecond
+		i += 2
+	}
+	if n := len(args) - i; n != 3 && n != 4 {
+		return errSyntax
+	}
+	start, err := parseRangeID(args[i], false)
+	if err != nil {
+		return err
+	}
+	end, err := parseRangeID(args[i+1], true)
+	if err != nil {
+		return err
+	}
+	count, err := parseInt(args[i+2])
+	if err != nil {
+		return err
+	}
+	var consumer string
+	if i+3 < len(args) {
+		consumer = args[i+3]
+	}
+	now := c.server.now()
+	result := []interface{}{}
+	for _, p := range g.pending {
+		if int64(len(result)) >= count {
+			break
+		}
+		if p.id.less(start) || end.less(p.id) || consumer != "" && p.consumer != consumer || now.Sub(p.delivered) < minIdle {
+			continue
+		}
+		result = append(result, []interface{}{p.id.String(), p.consumer, idleMilliseconds(p.delivered, now), p.deliveries})
+	}
+	return result
+}
+
+// claim gives the pending entry p to consumer, delivered at the time delivered.
+func (g *streamGroup) claim(p *pendingEntry, consumer string, delivered time.Time, justid bool) {
+	p.consumer = consumer
+	p.delivered = delivered
+	if !justid {
+		p.deliveries++
+	}
+}
+
+func cmdXClaim(c *client, args []string) interface{} {
+	minIdle, err := parseInt(args[4])
+	if err != nil {
+		return err
+	}
+	var ids []streamID
+	i := 5
+	for ; i < len(args); i++ {
+		id, err := parseStreamID(args[i], 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return errInvalidStreamID
+	}
+	now := c.server.now()
+	delivered, retries := now, int64(-1)
+	var force, justid bool
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		switch option {
+		case "FORCE":
+			force = true
+		case "JUSTID":
+			justid = true
+		case "IDLE", "TIME", "RETRYCOUNT", "LASTID":
+			if i+1 == len(args) {
+				return errSyntax
+			}
+			i++
+			if option == "LASTID" {
+				if _, err := parseStreamID(args[i], 0); err != nil {
+					return err
+				}
+				continue
+			}
+			n, err := parseInt(args[i])
+			if err != nil {
+				return err
+			}
+			switch option {
+			case "IDLE":
+				delivered = now.Add(-time.Duration(n) * time.Millisecond)
+			case "TIME":
+				delivered = time.Unix(0, n*int64(time.Millisecond))
+			default:
+				retries = n
+			}
+		default:
+			return fmt.Errorf("ERR Unrecognized XCLAIM option '%s'", args[i])
+		}
+	}
+	d := c.db()
+	st, g, err := d.getGroup(args[1], args[2])
+	if err != nil {
+		return err
+	}
+	consumer := args[3]
+	g.consumers[consumer] = now
+	result := []interface{}{}
+	for _, id := range ids {
+		e, exists := st.find(id)
+		j, ok := g.pendingIndex(id)
+		if !ok {
+			if !force || !exists {
+				continue
+			}
+			g.insertPending(j, &pendingEntry{id: id})
+		}
+		p := g.pending[j]
+		if !exists {
+			g.removePending(j)
+			continue
+		}
+		if now.Sub(p.delivered) < time.Duration(minIdle)*time.Millisecond {
+			continue
+		}
+		g.claim(p, consumer, delivered, justid)
+		if retries >= 0 {
+			p.deliveries = retries
+		}
+		if justid {
+			result = append(result, id.String())
+		} else {
+			result = append(result, entryReply(e))
+		}
+	}
+	d.modified(args[1])
+	return result
+}
+
+func cmdXAutoClaim(c *client, args []string) interface{} {
+	minIdle, err := parseInt(args[4])
+	if err != nil {
+		return err
+	}
+	start, err := parseRangeID(args[5], false)
+	if err != nil {
+		return err
+	}
+	count := 100
+	var justid bool
+	for i := 6; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COUNT":
+			if i+1 == len(args) {
+				return errSyntax
+			}
+			i++
+			n, err := parseInt(args[i])
+			if err != nil {
+				return err
+			}
+			if n < 1 {
+				return errors.New("ERR COUNT must be > 0")
+			}
+			count = int(n)
+		case "JUSTID":
+			justid = true
+		default:
+			return errSyntax
+		}
+	}
+	d := c.db()
+	st, g, err := d.getGroup(args[1], args[2])
+	if err != nil {
+		return err
+	}
+	now := c.server.now()
+	consumer := args[3]
+	g.consumers[consumer] = now
+	claimed, deleted := []interface{}{}, []interface{}{}
+	j, _ := g.pendingIndex(start)
+	for j < len(g.pending) && len(claimed) < count {
+		p := g.pending[j]
+		e, ok := st.find(p.id)
+		if !ok {
+			deleted = append(deleted, p.id.String())
+			g.removePending(j)
+			continue
+		}
+		j++
+		if now.Sub(p.delivered) < time.Duration(minIdle)*time.Millisecond {
+			continue
+		}
+		g.claim(p, consumer, now, justid)
+		if justid {
+			claimed = append(claimed, p.id.String())
+		} else {
+			claimed = append(claimed, entryReply(e))
+		}
+	}
+	next := "0-0"
+	if j < len(g.pending) {
+		next = g.pending[j].id.String()
+	}
+	d.modified(args[1])
+	return []interface{}{next, claimed, deleted}
+}
+
+func cmdXInfo(c *client, args []string) interface{} {
+	d := c.db()
+	now := c.server.now()
+	sub := strings.ToUpper(args[1])
+	switch sub {
+	case "STREAM", "GROUPS":
+		if len(args) != 3 {
+			return errSyntax
+		}
+		st, err := d.getStream(args[2])
+		if err != nil {
+			return err
+		}
+		if st == nil {
+			return errNoSuchKey
+		}
+		names := make([]string, 0, len(st.groups))
+		for name := range st.groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if sub == "GROUPS" {
+			groups := make([]interface{}, len(names))
+			for i, name := range names {
+				g := st.groups[name]
+				groups[i] = []interface{}{
+					"name", name,
+					"consumers", len(g.consumers),
+					"pending", len(g.pending),
+					"last-delivered-id", g.last.String(),
+				}
+			}
+			return groups
+		}
+		var first, last interface{}
+		firstID := streamID{}
+		if n := len(st.entries); n > 0 {
+			first, last = entryReply(st.entries[0]), entryReply(st.entries[n-1])
+			firstID = st.entries[0].id
+		}
+		// as if every node of the radix tree holds 100 entries, stream-node-max-entries of redis
+		nodes := (len(st.entries) + 99) / 100
+		return []interface{}{
+			"length", len(st.entries),
+			"radix-tree-keys", nodes,
+			"radix-tree-nodes", nodes + 1,
+			"last-generated-id", st.last.String(),
+			"max-deleted-entry-id", st.maxDeleted.String(),
+			"entries-added", st.added,
+			"recorded-first-entry-id", firstID.String(),
+			"groups", len(st.groups),
+			"first-entry", first,
+			"last-entry", last,
+		}
+	case "CONSUMERS":
+		if len(args) != 4 {
+			return errSyntax
+		}
+		_, g, err := d.getGroup(args[2], args[3])
+		if err != nil {
+			return err
+		}
+		names := g.sortedConsumers()
+		consumers := make([]interface{}, len(names))
+		for i, name := range names {
+			consumers[i] = []interface{}{
+				"name", name,
+				"pending", g.pendingCount(name),
+				"idle", idleMilliseconds(g.consumers[name], now),
+			}
+		}
+		return consumers
+	}
+	return fmt.Errorf("ERR unknown subcommand '%s'. Try XINFO HELP.", args[1])
+}
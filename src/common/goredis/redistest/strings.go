@@ -0,0 +1,789 @@
+package redistest
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	addCommands(map[string]*command{
+		"GET":         {2, cmdGet},
+		"SET":         {-3, cmdSet},
+		"SETEX":       {4, cmdSetex},
+		"PSETEX":      {4, cmdSetex},
+		"SETNX":       {3, cmdSetnx},
+		"GETSET":      {3, cmdGetSet},
+		"GETEX":       {-2, cmdGetEx},
+		"GETDEL":      {2, cmdGetDel},
+		"MGET":        {-2, cmdMGet},
+		"MSET":        {-3, cmdMSet},
+		"MSETNX":      {-3, cmdMSet},
+		"APPEND":      {3, cmdAppend},
+		"STRLEN":      {2, cmdStrLen},
+		"INCR":        {2, cmdIncr},
+		"DECR":        {2, cmdIncr},
+		"INCRBY":      {3, cmdIncr},
+		"DECRBY":      {3, cmdIncr},
+		"INCRBYFLOAT": {3, cmdIncrByFloat},
+		"GETRANGE":    {4, cmdGetRange},
+		"SETRANGE":    {4, cmdSetRange},
+		"GETBIT":      {3, cmdGetBit},
+		"SETBIT":      {4, cmdSetBit},
+		"BITCOUNT":    {-2, cmdBitCount},
+		"BITOP":       {-4, cmdBitOp},
+		"BITPOS":      {-3, cmdBitPos},
+		"BITFIELD":    {-2, cmdBitField},
+	})
+}
+
+// getString returns the string value of key.
+func (d *db) getString(key string) (string, bool, error) {
+	it := d.get(key)
+	if it == nil {
+		return "", false, nil
+	}
+	s, ok := it.value.(string)
+	if !ok {
+		return "", false, errWrongType
+	}
+	return s, true, nil
+}
+
+// setString sets the string value of key and keeps its TTL.
+func (d *db) setString(key, value string) {
+	if it := d.get(key); it != nil {
+		it.value = value
+		d.touch(key)
+		return
+	}
+	d.put(key, value)
+}
+
+func cmdGet(c *client, args []string) interface{} {
+	s, ok, err := c.db().getString(args[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	return s
+}
+
+// parseExpire parses the expiration option opt of SET or GETEX at args[i+1], and returns the expire time.
+func (c *client) parseExpire(opt, arg, command string) (time.Time, error) {
+	n, err := parseInt(arg)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if n <= 0 {
+		return time.Time{}, errors.New("ERR invalid expire time in '" + command + "' command")
+	}
+	now := c.server.now()
+	switch opt {
+	case "EX":
+		return now.Add(time.Duration(n) * time.Second), nil
+	case "PX":
+		return now.Add(time.Duration(n) * time.Millisecond), nil
+	case "EXAT":
+		return time.Unix(n, 0), nil
+	}
+	return time.Unix(0, n*int64(time.Millisecond)), nil
+}
+
+func cmdSet(c *client, args []string) interface{} {
+	var expire time.Time
+	var nx, xx, keepTTL, get, expiring bool
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GET":
+			get = true
+		case "KEEPTTL":
+			if expiring {
+				return errSyntax
+			}
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 == len(args) || expiring || keepTTL {
+				return errSyntax
+			}
+			i++
+			var err error
+			if expire, err = c.parseExpire(opt, args[i], "set"); err != nil {
+				return err
+			}
+			expiring = true
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx {
+		return errSyntax
+	}
+	d := c.db()
+	it := d.get(args[1])
+	var reply interface{} = statusOK
+	if get {
+		old, ok, err := d.getString(args[1])
+		if err != nil {
+			return err
+		}
+		reply = nil
+		if ok {
+			reply = old
+		}
+	}
+	if nx && it != nil || xx && it == nil {
+		if get {
+			return reply
+		}
+		return nil
+	}
+	var ttl time.Time
+	if keepTTL && it != nil {
+		ttl = it.expire
+	}
+	if expiring {
+		ttl = expire
+	}
+	d.put(args[1], args[2]).expire = ttl
+	return reply
+}
+
+func cmdGetEx(c *client, args []string) interface{} {
+	var expire time.Time
+	var persist, expiring bool
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "PERSIST":
+			if expiring {
+				return errSyntax
+			}
+			persist = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 == len(args) || expiring || persist {
+				return errSyntax
+			}
+			i++
+			var err error
+			if expire, err = c.parseExpire(opt, args[i], "getex"); err != nil {
+				return err
+			}
+			expiring = true
+		default:
+			return errSyntax
+		}
+	}
+	d := c.db()
+	s, ok, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	if expiring || persist {
+		d.get(args[1]).expire = expire
+		d.touch(args[1])
+	}
+	return s
+}
+
+func cmdGetDel(c *client, args []string) interface{} {
+	d := c.db()
+	s, ok, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	d.remove(args[1])
+	return s
+}
+
+func cmdSetex(c *client, args []string) interface{} {
+	n, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	if n <= 0 {
+		return errors.New("ERR invalid expire time in '" + strings.ToLower(args[0]) + "' command")
+	}
+	ttl := time.Duration(n) * time.Second
+	if strings.ToUpper(args[0]) == "PSETEX" {
+		ttl = time.Duration(n) * time.Millisecond
+	}
+	c.db().put(args[1], args[3]).expire = c.server.now().Add(ttl)
+	return statusOK
+}
+
+func cmdSetnx(c *client, args []string) interface{} {
+	d := c.db()
+	if d.get(args[1]) != nil {
+		return 0
+	}
+	d.put(args[1], args[2])
+	return 1
+}
+
+func cmdGetSet(c *client, args []string) interface{} {
+	d := c.db()
+	old, ok, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	d.put(args[1], args[2])
+	if !ok {
+		return nil
+	}
+	return old
+}
+
+func cmdMGet(c *client, args []string) interface{} {
+	d := c.db()
+	values := make([]interface{}, len(args)-1)
+	for i, key := range args[1:] {
+		if s, ok, err := d.getString(key); err == nil && ok {
+			values[i] = s
+		}
+	}
+	return values
+}
+
+func cmdMSet(c *client, args []string) interface{} {
+	if len(args)%2 != 1 {
+		return errors.New("ERR wrong number of arguments for '" + strings.ToLower(args[0]) + "' command")
+	}
+	d := c.db()
+	nx := strings.ToUpper(args[0]) == "MSETNX"
+	if nx {
+		for i := 1; i < len(args); i += 2 {
+			if d.get(args[i]) != nil {
+				return 0
+			}
+		}
+	}
+	for i := 1; i < len(args); i += 2 {
+		d.put(args[i], args[i+1])
+	}
+	if nx {
+		return 1
+	}
+	return statusOK
+}
+
+func cmdAppend(c *client, args []string) interface{} {
+	d := c.db()
+	s, _, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	s += args[2]
+	d.setString(args[1], s)
+	return len(s)
+}
+
+func cmdStrLen(c *client, args []string) interface{} {
+	s, _, err := c.db().getString(args[1])
+	if err != nil {
+		return err
+	}
+	return len(s)
+}
+
+func cmdIncr(c *client, args []string) interface{} {
+	by := int64(1)
+	if len(args) == 3 {
+		n, err := parseInt(args[2])
+		if err != nil {
+			return err
+		}
+		by = n
+	}
+	if strings.HasPrefix(strings.ToUpper(args[0]), "DECR") {
+		if by == math.MinInt64 {
+			return errors.New("ERR decrement would overflow")
+		}
+		by = -by
+	}
+	d := c.db()
+	s, ok, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	var n int64
+	if ok {
+		if n, err = parseInt(s); err != nil {
+			return err
+		}
+	}
+	if by > 0 && n > math.MaxInt64-by || by < 0 && n < math.MinInt64-by {
+		return errors.New("ERR increment or decrement would overflow")
+	}
+	n += by
+	d.setString(args[1], strconv.FormatInt(n, 10))
+	return n
+}
+
+func cmdIncrByFloat(c *client, args []string) interface{} {
+	by, err := parseFloat(args[2])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	s, ok, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	var f float64
+	if ok {
+		if f, err = parseFloat(s); err != nil {
+			return err
+		}
+	}
+	f += by
+	if math.IsInf(f, 0) {
+		return errors.New("ERR increment would produce NaN or Infinity")
+	}
+	s = formatFloat(f)
+	d.setString(args[1], s)
+	return s
+}
+
+// stringRange converts the inclusive range of redis with negative indexes to a slice range of a length n value.
+func stringRange(start, end int64, n int) (int, int) {
+	if start < 0 {
+		start += int64(n)
+	}
+	if end < 0 {
+		end += int64(n)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= int64(n) {
+		end = int64(n) - 1
+	}
+	if start > end || n == 0 {
+		return 0, 0
+	}
+	return int(start), int(end) + 1
+}
+
+func cmdGetRange(c *client, args []string) interface{} {
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	end, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	s, _, err := c.db().getString(args[1])
+	if err != nil {
+		return err
+	}
+	i, j := stringRange(start, end, len(s))
+	return s[i:j]
+}
+
+func cmdSetRange(c *client, args []string) interface{} {
+	offset, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	if offset < 0 || offset > 512*1024*1024 {
+		return errors.New("ERR offset is out of range")
+	}
+	d := c.db()
+	s, ok, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	if !ok && args[3] == "" {
+		return 0
+	}
+	b := []byte(s)
+	if end := int(offset) + len(args[3]); end > len(b) {
+		b = append(b, make([]byte, end-len(b))...)
+	}
+	copy(b[offset:], args[3])
+	d.setString(args[1], string(b))
+	return len(b)
+}
+
+func parseBitOffset(s string) (int64, error) {
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || offset < 0 || offset >= 4*1024*1024*1024 {
+		return 0, errors.New("ERR bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+func cmdGetBit(c *client, args []string) interface{} {
+	offset, err := parseBitOffset(args[2])
+	if err != nil {
+		return err
+	}
+	s, _, err := c.db().getString(args[1])
+	if err != nil {
+		return err
+	}
+	if offset/8 >= int64(len(s)) {
+		return 0
+	}
+	return int(s[offset/8]>>(7-uint(offset%8))) & 1
+}
+
+func cmdSetBit(c *client, args []string) interface{} {
+	offset, err := parseBitOffset(args[2])
+	if err != nil {
+		return err
+	}
+	if args[3] != "0" && args[3] != "1" {
+		return errors.New("ERR bit is not an integer or out of range")
+	}
+	d := c.db()
+	s, _, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	b := []byte(s)
+	if n := int(offset/8) + 1; n > len(b) {
+		b = append(b, make([]byte, n-len(b))...)
+	}
+	mask := byte(1) << (7 - uint(offset%8))
+	old := 0
+	if b[offset/8]&mask != 0 {
+		old = 1
+	}
+	if args[3] == "1" {
+		b[offset/8] |= mask
+	} else {
+		b[offset/8] &^= mask
+	}
+	d.setString(args[1], string(b))
+	return old
+}
+
+func cmdBitCount(c *client, args []string) interface{} {
+	s, _, err := c.db().getString(args[1])
+	if err != nil {
+		return err
+	}
+	switch len(args) {
+	case 2:
+	case 4:
+		start, err := parseInt(args[2])
+		if err != nil {
+			return err
+		}
+		end, err := parseInt(args[3])
+		if err != nil {
+			return err
+		}
+		i, j := stringRange(start, end, len(s))
+		s = s[i:j]
+	default:
+		return errSyntax
+	}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		n += bits.OnesCount8(s[i])
+	}
+	return n
+}
+
+func cmdBitOp(c *client, args []string) interface{} {
+	op := strings.ToUpper(args[1])
+	if op == "NOT" && len(args) != 4 {
+		return errors.New("ERR BITOP NOT must be called with a single source key.")
+	}
+	if op != "AND" && op != "OR" && op != "XOR" && op != "NOT" {
+		return errSyntax
+	}
+	d := c.db()
+	var result []byte
+	for i, key := range args[3:] {
+		s, _, err := d.getString(key)
+		if err != nil {
+			return err
+		}
+		if len(s) > len(result) {
+			result = append(result, make([]byte, len(s)-len(result))...)
+		}
+		for j := range result {
+			var b byte
+			if j < len(s) {
+				b = s[j]
+			}
+			switch {
+			case op == "NOT":
+				result[j] = ^b
+			case i == 0:
+				result[j] = b
+			case op == "AND":
+				result[j] &= b
+			case op == "OR":
+				result[j] |= b
+			case op == "XOR":
+				result[j] ^= b
+			}
+		}
+	}
+	if len(result) == 0 {
+		d.remove(args[2])
+		return 0
+	}
+	d.put(args[2], string(result))
+	return len(result)
+}
+
+func cmdBitPos(c *client, args []string) interface{} {
+	if args[2] != "0" && args[2] != "1" {
+		return errors.New("ERR The bit argument must be 1 or 0.")
+	}
+	bit := args[2][0] - '0'
+	s, ok, err := c.db().getString(args[1])
+	if err != nil {
+		return err
+	}
+	if len(args) > 6 {
+		return errSyntax
+	}
+	unit := int64(8)
+	if len(args) == 6 {
+		switch strings.ToUpper(args[5]) {
+		case "BYTE":
+		case "BIT":
+			unit = 1
+		default:
+			return errSyntax
+		}
+	}
+	size := int64(len(s)) * 8 / unit
+	start, end := int64(0), size-1
+	if len(args) > 3 {
+		if start, err = parseInt(args[3]); err != nil {
+			return err
+		}
+	}
+	if len(args) > 4 {
+		if end, err = parseInt(args[4]); err != nil {
+			return err
+		}
+	}
+	if !ok {
+		if bit == 1 {
+			return -1
+		}
+		return 0
+	}
+	i, j := stringRange(start, end, int(size))
+	if i == j {
+		return -1
+	}
+	from, to := int64(i)*unit, int64(j)*unit
+	for pos := from; pos < to; pos++ {
+		if s[pos/8]>>(7-uint(pos%8))&1 == bit {
+			return pos
+		}
+	}
+	if bit == 0 && len(args) <= 4 {
+		// the string is padded with zero bits on the right when the end is not given
+		return to
+	}
+	return -1
+}
+
+// bitfieldType is the type of a BITFIELD subcommand, such as i8 or u16.
+type bitfieldType struct {
+	signed bool
+	width  uint
+}
+
+func parseBitfieldType(s string) (bitfieldType, error) {
+	err := errors.New("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	if len(s) < 2 || s[0] != 'i' && s[0] != 'u' {
+		return bitfieldType{}, err
+	}
+	t := bitfieldType{signed: s[0] == 'i'}
+	width, e := strconv.Atoi(s[1:])
+	if e != nil || width < 1 || t.signed && width > 64 || !t.signed && width > 63 {
+		return bitfieldType{}, err
+	}
+	t.width = uint(width)
+	return t, nil
+}
+
+// parseBitfieldOffset parses an offset of BITFIELD, #n means n times the width.
+func parseBitfieldOffset(s string, t bitfieldType) (int64, error) {
+	multiply := strings.HasPrefix(s, "#")
+	if multiply {
+		s = s[1:]
+	}
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if multiply {
+		offset *= int64(t.width)
+	}
+	if err != nil || offset < 0 || offset >= 4*1024*1024*1024 {
+		return 0, errors.New("ERR bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+func (t bitfieldType) get(b []byte, offset int64) int64 {
+	var v uint64
+	for i := int64(0); i < int64(t.width); i++ {
+		pos := offset + i
+		var bit uint64
+		if pos/8 < int64(len(b)) {
+			bit = uint64(b[pos/8]>>(7-uint(pos%8))) & 1
+		}
+		v = v<<1 | bit
+	}
+	if t.signed && t.width < 64 && v>>(t.width-1) == 1 {
+		v |= ^uint64(0) << t.width
+	}
+	return int64(v)
+}
+
+func (t bitfieldType) set(b []byte, offset int64, value int64) {
+	for i := int64(0); i < int64(t.width); i++ {
+		pos := offset + i
+		mask := byte(1) << (7 - uint(pos%8))
+		if uint64(value)>>(t.width-1-uint(i))&1 == 1 {
+			b[pos/8] |= mask
+		} else {
+			b[pos/8] &^= mask
+		}
+	}
+}
+
+// overflow fits v into the type by the OVERFLOW behavior, ok is false for FAIL.
+func (t bitfieldType) overflow(v *big.Int, behavior string) (int64, bool) {
+	min, max := big.NewInt(0), new(big.Int).Lsh(big.NewInt(1), t.width)
+	if t.signed {
+		min.Neg(new(big.Int).Lsh(big.NewInt(1), t.width-1))
+		max.Lsh(big.NewInt(1), t.width-1)
+	}
+	max.Sub(max, big.NewInt(1))
+	if v.Cmp(min) >= 0 && v.Cmp(max) <= 0 {
+		return v.Int64(), true
+	}
+	switch behavior {
+	case "SAT":
+		if v.Cmp(min) < 0 {
+			return min.Int64(), true
+		}
+		return max.Int64(), true
+	case "FAIL":
+		return 0, false
+	}
+	modulus := new(big.Int).Lsh(big.NewInt(1), t.width)
+	wrapped := new(big.Int).Mod(v, modulus)
+	if t.signed && wrapped.Cmp(max) > 0 {
+		wrapped.Sub(wrapped, modulus)
+	}
+	return wrapped.Int64(), true
+}
+
+func cmdBitField(c *client, args []string) interface{} {
+	type op struct {
+		name     string
+		t        bitfieldType
+		offset   int64
+		value    int64
+		overflow string
+	}
+	var ops []op
+	overflow := "WRAP"
+	write := false
+	for i := 2; i < len(args); i++ {
+		name := strings.ToUpper(args[i])
+		if name == "OVERFLOW" {
+			if i+1 == len(args) {
+				return errSyntax
+			}
+			i++
+			overflow = strings.ToUpper(args[i])
+			if overflow != "WRAP" && overflow != "SAT" && overflow != "FAIL" {
+				return errors.New("ERR Invalid OVERFLOW type specified")
+			}
+			continue
+		}
+		n := 3
+		if name == "GET" {
+			n = 2
+		} else if name != "SET" && name != "INCRBY" {
+			return errSyntax
+		}
+		if i+n >= len(args) {
+			return errSyntax
+		}
+		t, err := parseBitfieldType(args[i+1])
+		if err != nil {
+			return err
+		}
+		offset, err := parseBitfieldOffset(args[i+2], t)
+		if err != nil {
+			return err
+		}
+		o := op{name: name, t: t, offset: offset, overflow: overflow}
+		if n == 3 {
+			if o.value, err = parseInt(args[i+3]); err != nil {
+				return err
+			}
+			write = true
+		}
+		ops = append(ops, o)
+		i += n
+	}
+	d := c.db()
+	s, ok, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	b := []byte(s)
+	result := make([]interface{}, 0, len(ops))
+	for _, o := range ops {
+		if end := (o.offset + int64(o.t.width) + 7) / 8; o.name != "GET" && end > int64(len(b)) {
+			b = append(b, make([]byte, end-int64(len(b)))...)
+		}
+		old := o.t.get(b, o.offset)
+		switch o.name {
+		case "GET":
+			result = append(result, old)
+		case "SET":
+			v, ok := o.t.overflow(big.NewInt(o.value), o.overflow)
+			if !ok {
+				result = append(result, nil)
+				continue
+			}
+			o.t.set(b, o.offset, v)
+			result = append(result, old)
+		case "INCRBY":
+			v, ok := o.t.overflow(new(big.Int).Add(big.NewInt(old), big.NewInt(o.value)), o.overflow)
+			if !ok {
+				result = append(result, nil)
+				continue
+			}
+			o.t.set(b, o.offset, v)
+			result = append(result, v)
+		}
+	}
+	if write && (ok || len(b) > 0) {
+		d.setString(args[1], string(b))
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+package redistest
+
+import (
+	"errors"
+	"strings"
+)
+
+// invalidateChannel is the channel of the invalidation messages of RESP2.
+const invalidateChannel = "__redis__:invalidate"
+
+// setTracking runs CLIENT TRACKING ON|OFF [REDIRECT id].
+func (c *client) setTracking(args []string) interface{} {
+	if len(args) == 0 {
+		return errors.New("ERR wrong number of arguments for 'client|tracking' command")
+	}
+	var redirect int64
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "REDIRECT":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			id, err := parseInt(args[i+1])
+			if err != nil {
+				return err
+			}
+			if c.server.clientByID(id) == nil {
+				return errors.New("ERR The client ID you want redirect to does not exist")
+			}
+			redirect = id
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	switch strings.ToUpper(args[0]) {
+	case "ON":
+		c.tracking, c.redirect = true, redirect
+	case "OFF":
+		c.tracking, c.redirect = false, 0
+	default:
+		return errSyntax
+	}
+	return statusOK
+}
+
+func (s *Server) clientByID(id int64) *client {
+	for c := range s.clients {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// track adds key to the tracking table if the current client is tracking.
+func (s *Server) track(key string) {
+	c := s.current
+	if c == nil || !c.tracking {
+		return
+	}
+	ids, ok := s.tracked[key]
+	if !ok {
+		ids = make(map[int64]struct{})
+		s.tracked[key] = ids
+	}
+	ids[c.id] = struct{}{}
+}
+
+// invalidate sends the invalidation message of key to the clients tracking it, key is not tracked after.
+func (s *Server) invalidate(key string) {
+	ids, ok := s.tracked[key]
+	if !ok {
+		return
+	}
+	delete(s.tracked, key)
+	for _, c := range s.sortedClients() {
+		if _, ok := ids[c.id]; ok {
+			c.sendInvalidation([]string{key})
+		}
+	}
+}
+
+// invalidateAll sends the invalidation message of null, as redis does for a flush, to all the tracking clients.
+func (s *Server) invalidateAll() {
+	s.tracked = make(map[string]map[int64]struct{})
+	for _, c := range s.sortedClients() {
+		c.sendInvalidation(nil)
+	}
+}
+
+// sendInvalidation writes the invalidation message of keys to the redirect client of a tracking client.
+func (c *client) sendInvalidation(keys []string) {
+	if !c.tracking {
+		return
+	}
+	target := c
+	if c.redirect != 0 {
+		target = c.server.clientByID(c.redirect)
+	}
+	if target == nil {
+		return
+	}
+	if _, ok := target.channels[invalidateChannel]; !ok {
+		return
+	}
+	var payload interface{} = nilArray{}
+	if keys != nil {
+		payload = keys
+	}
+	target.write([]interface{}{"message", invalidateChannel, payload})
+}
@@ -0,0 +1,103 @@
+package redistest
+
+import "errors"
+
+// transactionCommands are executed at once inside MULTI.
+var transactionCommands = map[string]bool{
+	"MULTI":   true,
+	"EXEC":    true,
+	"DISCARD": true,
+	"WATCH":   true,
+	"QUIT":    true,
+}
+
+func init() {
+	addCommands(map[string]*command{
+		"MULTI":   {1, cmdMulti},
+		"EXEC":    {1, cmdExec},
+		"DISCARD": {1, cmdDiscard},
+		"WATCH":   {-2, cmdWatch},
+		"UNWATCH": {1, cmdUnWatch},
+	})
+}
+
+func cmdMulti(c *client, args []string) interface{} {
+	if c.multi {
+		return errors.New("ERR MULTI calls can not be nested")
+	}
+	c.multi = true
+	return statusOK
+}
+
+func cmdExec(c *client, args []string) interface{} {
+	if !c.multi {
+		return errors.New("ERR EXEC without MULTI")
+	}
+	queue, aborted, dirty := c.queue, c.aborted, c.watchedChanged()
+	c.discard()
+	if aborted {
+		return errors.New("EXECABORT Transaction discarded because of previous errors.")
+	}
+	if dirty {
+		return nilArray{}
+	}
+	replies := make([]interface{}, len(queue))
+	for i, args := range queue {
+		replies[i] = c.call(args)
+	}
+	return replies
+}
+
+func cmdDiscard(c *client, args []string) interface{} {
+	if !c.multi {
+		return errors.New("ERR DISCARD without MULTI")
+	}
+	c.discard()
+	return statusOK
+}
+
+func cmdWatch(c *client, args []string) interface{} {
+	if c.multi {
+		return errors.New("ERR WATCH inside MULTI is not allowed")
+	}
+	d := c.db()
+	if c.watched == nil {
+		c.watched = make(map[*db]map[string]uint64)
+	}
+	if c.watched[d] == nil {
+		c.watched[d] = make(map[string]uint64)
+	}
+	for _, key := range args[1:] {
+		if _, ok := c.watched[d][key]; !ok {
+			d.peek(key)
+			c.watched[d][key] = d.versions[key]
+		}
+	}
+	return statusOK
+}
+
+func cmdUnWatch(c *client, args []string) interface{} {
+	c.watched = nil
+	return statusOK
+}
+
+// watchedChanged reports whether a watched key is changed or expired since WATCH.
+func (c *client) watchedChanged() bool {
+	for d, keys := range c.watched {
+		for key, version := range keys {
+			d.peek(key)
+			if d.versions[key] != version {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// discard ends the transaction and unwatches all the keys.
+func (c *client) discard() {
+	c.multi = false
+	c.aborted = false
+	c.queue = nil
+	c.watched = nil
+}
@@ -0,0 +1,214 @@
+package goredis
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ScanIterator walks the elements of SCAN, HSCAN, SSCAN or ZSCAN page by page until the cursor is 0:
+//
+//	iter := client.ScanIter("user:*", 100)
+//	for iter.Next() {
+//		key := iter.Val()
+//	}
+//	if err := iter.Err(); err != nil {
+//	}
+//
+// SCAN may return an element more than once, the repeated elements are skipped if Dedup is true,
+// which keeps every element in memory until the iteration ends.
+type ScanIterator struct {
+	redis   *Redis
+	args    []interface{}
+	pattern string
+	count   int
+	pairs   bool
+
+	// Type filters the keys of SCAN by the TYPE option, such as string or hash, Redis 6 is required.
+	Type string
+	// Dedup skips the elements returned already, it is true by default.
+	Dedup bool
+
+	cursor  uint64
+	started bool
+	page    []string
+	pos     int
+	seen    map[string]struct{}
+	val     string
+	value   string
+	err     error
+}
+
+func newScanIterator(r *Redis, args []interface{}, pattern string, count int, pairs bool) *ScanIterator {
+	return &ScanIterator{
+		redis:   r,
+		args:    args,
+		pattern: pattern,
+		count:   count,
+		pairs:   pairs,
+		Dedup:   true,
+	}
+}
+
+// ScanIter returns an iterator of the keys matching pattern by SCAN, count is the COUNT hint of a page.
+// An empty pattern matches all the keys, a count of 0 uses the default of redis.
+func (r *Redis) ScanIter(pattern string, count int) *ScanIterator {
+	return newScanIterator(r, []interface{}{"SCAN"}, pattern, count, false)
+}
+
+// HScanIter returns an iterator of the fields of the hash at key by HSCAN, Value returns the value of the field.
+func (r *Redis) HScanIter(key, pattern string, count int) *ScanIterator {
+	return newScanIterator(r, []interface{}{"HSCAN", key}, pattern, count, true)
+}
+
+// SScanIter returns an iterator of the members of the set at key by SSCAN.
+func (r *Redis) SScanIter(key, pattern string, count int) *ScanIterator {
+	return newScanIterator(r, []interface{}{"SSCAN", key}, pattern, count, false)
+}
+
+// ZScanIter returns an iterator of the members of the sorted set at key by ZSCAN, Value returns the score.
+func (r *Redis) ZScanIter(key, pattern string, count int) *ScanIterator {
+	return newScanIterator(r, []interface{}{"ZSCAN", key}, pattern, count, true)
+}
+
+// Next advances to the next element, fetching the next page when needed.
+// It returns false when the iteration ends or fails, see Err.
+func (it *ScanIterator) Next() bool {
+	for it.err == nil {
+		for it.pos < len(it.page) {
+			it.val, it.value = it.page[it.pos], ""
+			if it.pairs {
+				it.value = it.page[it.pos+1]
+				it.pos += 2
+			} else {
+				it.pos++
+			}
+			if it.Dedup {
+				if it.seen == nil {
+					it.seen = make(map[string]struct{})
+				}
+				if _, ok := it.seen[it.val]; ok {
+					continue
+				}
+				it.seen[it.val] = struct{}{}
+			}
+			return true
+		}
+		if it.started && it.cursor == 0 {
+			it.seen = nil
+			return false
+		}
+		it.fetch()
+	}
+	return false
+}
+
+// fetch reads the page of the cursor.
+func (it *ScanIterator) fetch() {
+	args := append(append([]interface{}{}, it.args...), it.cursor)
+	if it.pattern != "" {
+		args = append(args, "MATCH", it.pattern)
+	}
+	if it.count > 0 {
+		args = append(args, "COUNT", it.count)
+	}
+	if it.Type != "" {
+		args = append(args, "TYPE", it.Type)
+	}
+	rp, err := it.redis.ExecuteCommand(args...)
+	if err != nil {
+		it.err = err
+		return
+	}
+	it.cursor, it.page, it.err = parseScan(rp)
+	it.pos, it.started = 0, true
+	if it.err == nil && it.pairs && len(it.page)%2 != 0 {
+		it.err = errors.New("scan protocol error")
+	}
+}
+
+// parseScan parses the reply of the SCAN family to the next cursor and the elements.
+func parseScan(rp *Reply) (uint64, []string, error) {
+	if rp.Type == ErrorReply {
+		return 0, nil, errors.New(rp.Error)
+	}
+	if rp.Type != MultiReply || len(rp.Multi) != 2 {
+		return 0, nil, errors.New("scan protocol error")
+	}
+	first, err := rp.Multi[0].StringValue()
+	if err != nil {
+		return 0, nil, err
+	}
+	next, err := strconv.ParseUint(first, 10, 64)
+	if err != nil {
+		return 0, nil, err
+	}
+	list, err := rp.Multi[1].ListValue()
+	return next, list, err
+}
+
+// Val returns the current element: the key, the field of a hash or the member of a set or sorted set.
+func (it *ScanIterator) Val() string {
+	return it.val
+}
+
+// Value returns the value of the current field of HScanIter or the score of the current member of ZScanIter.
+func (it *ScanIterator) Value() string {
+	return it.value
+}
+
+// Err returns the error which ended the iteration.
+func (it *ScanIterator) Err() error {
+	return it.err
+}
+
+// DelPattern deletes the keys matching pattern found by SCAN, count is the COUNT hint of SCAN
+// and the number of keys deleted by a DEL, 100 if count is not positive.
+// The keys are deleted while scanning, so the keys matching pattern which are added meanwhile may be left.
+// For a cluster client the keys of every master are deleted, by a DEL per slot.
+// Integer reply: the number of keys deleted.
+func (r *Redis) DelPattern(pattern string, count int) (int64, error) {
+	if count <= 0 {
+		count = 100
+	}
+	iter := r.ScanIter(pattern, count)
+	iter.Dedup = false
+	var deleted int64
+	keys := make([]string, 0, count)
+	del := func() error {
+		defer func() { keys = keys[:0] }()
+		if r.cluster == nil {
+			n, err := r.Del(keys...)
+			deleted += n
+			return err
+		}
+		// a DEL of a cluster takes the keys of one slot
+		slots := make(map[int][]string)
+		for _, key := range keys {
+			slots[KeySlot(key)] = append(slots[KeySlot(key)], key)
+		}
+		for _, group := range slots {
+			n, err := r.Del(group...)
+			deleted += n
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for iter.Next() {
+		if keys = append(keys, iter.Val()); len(keys) >= count {
+			if err := del(); err != nil {
+				return deleted, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, err
+	}
+	if len(keys) > 0 {
+		if err := del(); err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
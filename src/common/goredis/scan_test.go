@@ -0,0 +1,96 @@
+package goredis
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestScanIter(t *testing.T) {
+	r.FlushDB()
+	for i := 0; i < 25; i++ {
+		r.Set("scan:"+strconv.Itoa(i), "value", 0, 0, false, false)
+	}
+	r.Set("other", "value", 0, 0, false, false)
+	r.SAdd("scan:set", "member")
+	iter := r.ScanIter("scan:*", 3)
+	var keys []string
+	for iter.Next() {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 26 {
+		t.Error(len(keys), keys)
+	}
+	iter = r.ScanIter("", 5)
+	iter.Type = "set"
+	keys = nil
+	for iter.Next() {
+		keys = append(keys, iter.Val())
+	}
+	if iter.Err() != nil || len(keys) != 1 || keys[0] != "scan:set" {
+		t.Error(keys, iter.Err())
+	}
+}
+
+func TestScanIterDedup(t *testing.T) {
+	iter := r.ScanIter("", 0)
+	iter.started = true
+	iter.page = []string{"a", "b", "a", "c", "b"}
+	var keys []string
+	for iter.Next() {
+		keys = append(keys, iter.Val())
+	}
+	if len(keys) != 3 {
+		t.Error(keys)
+	}
+}
+
+func TestHScanIter(t *testing.T) {
+	r.Del("hash", "zset", "set")
+	r.HMSet("hash", map[string]string{"a": "1", "b": "2", "c": "3"})
+	iter := r.HScanIter("hash", "", 1)
+	hash := make(map[string]string)
+	for iter.Next() {
+		hash[iter.Val()] = iter.Value()
+	}
+	if iter.Err() != nil || len(hash) != 3 || hash["b"] != "2" {
+		t.Error(hash, iter.Err())
+	}
+	r.ZAdd("zset", map[string]float64{"a": 1, "b": 2.5})
+	iter = r.ZScanIter("zset", "b*", 0)
+	if !iter.Next() || iter.Val() != "b" || iter.Value() != "2.5" || iter.Next() {
+		t.Error(iter.Val(), iter.Value(), iter.Err())
+	}
+	r.SAdd("set", "a", "b", "c")
+	iter = r.SScanIter("set", "", 0)
+	var members []string
+	for iter.Next() {
+		members = append(members, iter.Val())
+	}
+	sort.Strings(members)
+	if len(members) != 3 || members[0] != "a" {
+		t.Error(members)
+	}
+	r.Set("string", "value", 0, 0, false, false)
+	if iter = r.SScanIter("string", "", 0); iter.Next() || iter.Err() == nil {
+		t.Error("WRONGTYPE expected")
+	}
+}
+
+func TestDelPattern(t *testing.T) {
+	r.FlushDB()
+	for i := 0; i < 25; i++ {
+		r.Set("cache:"+strconv.Itoa(i), "value", 0, 0, false, false)
+	}
+	r.Set("keep", "value", 0, 0, false, false)
+	n, err := r.DelPattern("cache:*", 10)
+	if err != nil || n != 25 {
+		t.Error(n, err)
+	}
+	if keys, _ := r.Keys("*"); len(keys) != 1 || keys[0] != "keep" {
+		t.Error(keys)
+	}
+}
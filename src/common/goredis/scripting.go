@@ -1,5 +1,12 @@
 package goredis
 
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
 // ScriptExists returns information about the existence of the scripts in the script cache.
 // Multi-bulk reply The command returns an array of integers
 // that correspond to the specified SHA1 digest arguments.
@@ -64,3 +71,118 @@ func (r *Redis) EvalSha(sha1 string, keys []string, args []string) (*Reply, erro
 	cmds := packArgs("EVALSHA", sha1, len(keys), keys, args)
 	return r.ExecuteCommand(cmds...)
 }
+
+// Script is a Lua script which runs by EVALSHA with its SHA1 digest computed locally,
+// EVAL is used instead when the server replies NOSCRIPT, for example after a restart.
+// Scripts can be loaded on every new connection by DialConfig.Scripts.
+type Script struct {
+	keyCount int
+	src      string
+	hash     string
+}
+
+// NewScript new a Script of src, the first keyCount arguments of Run are the keys.
+// If keyCount is negative, the first argument of Run is the number of keys.
+func NewScript(keyCount int, src string) *Script {
+	h := sha1.Sum([]byte(src))
+	return &Script{keyCount: keyCount, src: src, hash: hex.EncodeToString(h[:])}
+}
+
+// Hash returns the SHA1 digest of the script.
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+// Source returns the Lua source of the script.
+func (s *Script) Source() string {
+	return s.src
+}
+
+func (s *Script) args(command, script string, keysAndArgs []interface{}) ([]interface{}, error) {
+	args := []interface{}{command, script}
+	if s.keyCount < 0 {
+		if len(keysAndArgs) == 0 {
+			return nil, errors.New("script: number of keys required")
+		}
+		return append(args, keysAndArgs...), nil
+	}
+	if len(keysAndArgs) < s.keyCount {
+		return nil, errors.New("script: not enough keys")
+	}
+	args = append(args, s.keyCount)
+	return append(args, keysAndArgs...), nil
+}
+
+// Run evaluates the script by EVALSHA, and by EVAL if the script is not cached by the server.
+// The error of the script is an ErrorReply like Eval.
+func (s *Script) Run(r *Redis, keysAndArgs ...interface{}) (*Reply, error) {
+	args, err := s.args("EVALSHA", s.hash, keysAndArgs)
+	if err != nil {
+		return nil, err
+	}
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	if rp.Type == ErrorReply && strings.HasPrefix(rp.Error, "NOSCRIPT") {
+		args[0], args[1] = "EVAL", s.src
+		return r.ExecuteCommand(args...)
+	}
+	return rp, nil
+}
+
+// Load loads the script into the scripts cache by SCRIPT LOAD.
+func (s *Script) Load(r *Redis) error {
+	_, err := r.ScriptLoad(s.src)
+	return err
+}
+
+// LoadScripts loads the scripts into the scripts cache.
+func (r *Redis) LoadScripts(scripts ...*Script) error {
+	for _, s := range scripts {
+		if err := s.Load(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunScript sends the script in the pipeline.
+// EVAL is sent since a NOSCRIPT reply can not be retried inside a pipeline,
+// use RunScriptSha if the script is known to be loaded, for example by DialConfig.Scripts.
+func (p *Pipelined) RunScript(s *Script, keysAndArgs ...interface{}) error {
+	args, err := s.args("EVAL", s.src, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	return p.Command(args...)
+}
+
+// RunScriptSha sends the script by EVALSHA in the pipeline.
+func (p *Pipelined) RunScriptSha(s *Script, keysAndArgs ...interface{}) error {
+	args, err := s.args("EVALSHA", s.hash, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	return p.Command(args...)
+}
+
+// RunScript queues the script in the transaction.
+// EVAL is queued since a NOSCRIPT reply can not be retried inside a transaction,
+// use RunScriptSha if the script is known to be loaded, for example by DialConfig.Scripts.
+func (t *Transaction) RunScript(s *Script, keysAndArgs ...interface{}) error {
+	args, err := s.args("EVAL", s.src, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	return t.queue(args...)
+}
+
+// RunScriptSha queues the script by EVALSHA in the transaction.
+func (t *Transaction) RunScriptSha(s *Script, keysAndArgs ...interface{}) error {
+	args, err := s.args("EVALSHA", s.hash, keysAndArgs)
+	if err != nil {
+		return err
+	}
+	return t.queue(args...)
+}
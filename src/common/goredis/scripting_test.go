@@ -1,9 +1,52 @@
 package goredis
 
 import (
+	"errors"
+	"strings"
 	"testing"
+
+	"common/goredis/redistest"
 )
 
+// registerTestScripts implements the Lua scripts of the tests in Go for the in-process server.
+func registerTestScripts(server *redistest.Server) {
+	scripts := map[string]redistest.ScriptFunc{
+		"return {KEYS[1], KEYS[2], ARGV[1], ARGV[2]}": func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+			return []interface{}{keys[0], keys[1], args[0], args[1]}
+		},
+		"return redis.call('set','foo','bar')": func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+			return call("set", "foo", "bar")
+		},
+		"return {1,2,{3,'Hello World!'}}": func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+			return []interface{}{1, 2, []interface{}{3, "Hello World!"}}
+		},
+		"return {KEYS[1], ARGV[1]}": func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+			return []interface{}{keys[0], args[0]}
+		},
+		"return #KEYS": func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+			return len(keys)
+		},
+		"return redis.error_reply('failed')": func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+			return errors.New("failed")
+		},
+		"return KEYS[1]": func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+			return keys[0]
+		},
+		"return 'preloaded'": func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+			return "preloaded"
+		},
+		"return 10": func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+			return 10
+		},
+		"return 1": func(call func(...interface{}) interface{}, keys, args []string) interface{} {
+			return 1
+		},
+	}
+	for src, fn := range scripts {
+		server.RegisterScript(src, fn)
+	}
+}
+
 func TestEval(t *testing.T) {
 	rp, err := r.Eval("return {KEYS[1], KEYS[2], ARGV[1], ARGV[2]}", []string{"key1", "key2"}, []string{"arg1", "arg2"})
 	if err != nil {
@@ -80,3 +123,82 @@ func TestScriptKill(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestScript(t *testing.T) {
+	script := NewScript(1, "return {KEYS[1], ARGV[1]}")
+	if script.Hash() != "d006f1a90249474274c76f5be725b8f5804a346b" {
+		t.Error(script.Hash())
+	}
+	r.ScriptFlush()
+	rp, err := script.Run(r, "key", "arg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, err := rp.ListValue(); err != nil || len(l) != 2 || l[0] != "key" || l[1] != "arg" {
+		t.Error(l, err)
+	}
+	if err := script.Load(r); err != nil {
+		t.Error(err)
+	}
+	if rp, err := script.Run(r, "key", ""); err != nil || rp.Type != MultiReply {
+		t.Error(rp, err)
+	}
+	if _, err := script.Run(r); err == nil {
+		t.Fail()
+	}
+	variadic := NewScript(-1, "return #KEYS")
+	if rp, err := variadic.Run(r, 2, "a", "b", "c"); err != nil {
+		t.Error(err)
+	} else if n, err := rp.IntegerValue(); err != nil || n != 2 {
+		t.Error(n, err)
+	}
+	if rp, err := NewScript(0, "return redis.error_reply('failed')").Run(r); err != nil {
+		t.Error(err)
+	} else if rp.Type != ErrorReply || !strings.HasSuffix(rp.Error, "failed") {
+		t.Error(rp)
+	}
+}
+
+func TestScriptPreload(t *testing.T) {
+	script := NewScript(0, "return 'preloaded'")
+	r.ScriptFlush()
+	client, err := Dial(&DialConfig{Network: network, Address: address, Database: db, Password: password, Scripts: []*Script{script}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	if exists, err := client.ScriptExists(script.Hash()); err != nil || !exists[0] {
+		t.Error(exists, err)
+	}
+	p, err := client.Pipelining()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.RunScriptSha(script)
+	p.RunScript(NewScript(1, "return KEYS[1]"), "key")
+	rps, err := p.ReceiveAll()
+	p.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := rps[0].StringValue(); err != nil || s != "preloaded" {
+		t.Error(s, err)
+	}
+	if s, err := rps[1].StringValue(); err != nil || s != "key" {
+		t.Error(s, err)
+	}
+	tx, err := client.Transaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+	tx.RunScriptSha(script)
+	tx.RunScript(NewScript(0, "return 1"))
+	rps, err = tx.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rps) != 2 || rps[0].Type != BulkReply || rps[1].Integer != 1 {
+		t.Error(rps)
+	}
+}
@@ -0,0 +1,473 @@
+package goredis
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SentinelConfig is redis client connect to the master of a sentinel monitored group parameters.
+// Sentinels are the addresses(host:port) of the sentinels, MasterName is the name of the group,
+// SentinelPassword authenticates the connections to the sentinels by AUTH.
+// The other fields are used to dial the master and the replicas, see DialConfig.
+// If ReadFromReplicas is true, read-only commands are sent to the replicas of the master.
+// A PING is sent on the subscription to the sentinel every PingInterval(default 10s),
+// the subscription is rebuilt if nothing is received for twice of PingInterval.
+type SentinelConfig struct {
+	Sentinels        []string
+	MasterName       string
+	SentinelPassword string
+	Database         int
+	Username         string
+	Password         string
+	ClientName       string
+	TLSConfig        *tls.Config
+	Timeout          time.Duration
+	MaxIdle          int
+	MaxActive        int
+	WaitTimeout      time.Duration
+	IdleTimeout      time.Duration
+	MaxConnLifetime  time.Duration
+	TestOnBorrow     bool
+	Protocol         int
+	PingInterval     time.Duration
+	ReadFromReplicas bool
+	Scripts          []*Script
+}
+
+type redisSentinel struct {
+	sentinels    []string
+	masterName   string
+	password     string
+	timeout      time.Duration
+	pingInterval time.Duration
+
+	master      string
+	replicas    []string
+	pool        *connPool
+	replicaPool *connPool
+
+	// switchHooks are called after the master is switched, such as the resets of the client side caches
+	switchHooks map[int]func()
+	nextHook    int
+
+	conn   net.Conn
+	quit   chan struct{}
+	closed bool
+	mutex  sync.RWMutex
+}
+
+// DialSentinel new a redis client which asks the sentinels for the current master of cfg.MasterName.
+// The client subscribes to +switch-master on a sentinel,
+// when the master fails over, the connection pool is drained and rebuilt onto the new master.
+func DialSentinel(cfg *SentinelConfig) (*Redis, error) {
+	if cfg == nil || len(cfg.Sentinels) == 0 || cfg.MasterName == "" {
+		return nil, errors.New("sentinel addresses and master name required")
+	}
+	dial := &DialConfig{
+		Database:        cfg.Database,
+		Username:        cfg.Username,
+		Password:        cfg.Password,
+		ClientName:      cfg.ClientName,
+		TLSConfig:       cfg.TLSConfig,
+		Timeout:         cfg.Timeout,
+		MaxIdle:         cfg.MaxIdle,
+		MaxActive:       cfg.MaxActive,
+		WaitTimeout:     cfg.WaitTimeout,
+		IdleTimeout:     cfg.IdleTimeout,
+		MaxConnLifetime: cfg.MaxConnLifetime,
+		TestOnBorrow:    cfg.TestOnBorrow,
+		Protocol:        cfg.Protocol,
+		Scripts:         cfg.Scripts,
+	}
+	s := &redisSentinel{
+		sentinels:    append([]string(nil), cfg.Sentinels...),
+		masterName:   cfg.MasterName,
+		password:     cfg.SentinelPassword,
+		timeout:      cfg.Timeout,
+		pingInterval: cfg.PingInterval,
+		switchHooks:  make(map[int]func()),
+		quit:         make(chan struct{}),
+	}
+	if s.timeout == 0 {
+		s.timeout = DefaultTimeout
+	}
+	if s.pingInterval <= 0 {
+		s.pingInterval = 10 * time.Second
+	}
+	master, err := s.discoverMaster()
+	if err != nil {
+		return nil, err
+	}
+	s.master = master
+	dial.Address = master
+	r, err := newRedis(dial)
+	if err != nil {
+		return nil, err
+	}
+	r.sentinel = s
+	s.pool = r.pool
+	if cfg.ReadFromReplicas {
+		s.replicas, _ = s.discoverReplicas()
+		s.replicaPool = newConnPool(dial, func() (*connection, error) {
+			return r.dialAddress(s.replicaAddress())
+		})
+	}
+	conn, err := r.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	r.pool.Put(conn)
+	go s.watch()
+	return r, nil
+}
+
+func (s *redisSentinel) masterAddress() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.master
+}
+
+// replicaAddress returns a random healthy replica, or the master if there is none.
+func (s *redisSentinel) replicaAddress() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if len(s.replicas) == 0 {
+		return s.master
+	}
+	return s.replicas[rand.Intn(len(s.replicas))]
+}
+
+// command sends one command to the sentinels in turn until one of them replies,
+// the sentinel which replied is moved to the front of the list.
+func (s *redisSentinel) command(args ...interface{}) (*Reply, error) {
+	s.mutex.RLock()
+	sentinels := append([]string(nil), s.sentinels...)
+	s.mutex.RUnlock()
+	err := errors.New("no reachable sentinel")
+	for i, addr := range sentinels {
+		var rp *Reply
+		rp, err = s.commandOn(addr, args...)
+		if err != nil {
+			continue
+		}
+		if i > 0 {
+			s.mutex.Lock()
+			for j, a := range s.sentinels {
+				if a == addr {
+					copy(s.sentinels[1:j+1], s.sentinels[:j])
+					s.sentinels[0] = addr
+					break
+				}
+			}
+			s.mutex.Unlock()
+		}
+		return rp, nil
+	}
+	return nil, err
+}
+
+func (s *redisSentinel) commandOn(addr string, args ...interface{}) (*Reply, error) {
+	c, err := s.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Conn.Close()
+	c.Conn.SetDeadline(time.Now().Add(s.timeout))
+	rp, err := c.execute(nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	if rp.Type == ErrorReply {
+		return nil, errors.New(rp.Error)
+	}
+	return rp, nil
+}
+
+// dial connects to the sentinel of addr, and authenticates by the sentinel password if it is set.
+func (s *redisSentinel) dial(addr string) (*connection, error) {
+	conn, err := net.DialTimeout(DefaultNetwork, addr, s.timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &connection{Conn: conn, Reader: bufio.NewReader(conn)}
+	if s.password == "" {
+		return c, nil
+	}
+	conn.SetDeadline(time.Now().Add(s.timeout))
+	rp, err := c.execute(nil, "AUTH", s.password)
+	if err == nil && rp.Type == ErrorReply {
+		err = errors.New(rp.Error)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func (s *redisSentinel) discoverMaster() (string, error) {
+	rp, err := s.command("SENTINEL", "get-master-addr-by-name", s.masterName)
+	if err != nil {
+		return "", err
+	}
+	addr, err := rp.ListValue()
+	if err != nil {
+		return "", err
+	}
+	if len(addr) != 2 {
+		return "", errors.New("sentinel does not know master " + s.masterName)
+	}
+	return net.JoinHostPort(addr[0], addr[1]), nil
+}
+
+func (s *redisSentinel) discoverReplicas() ([]string, error) {
+	rp, err := s.command("SENTINEL", "slaves", s.masterName)
+	if err != nil {
+		return nil, err
+	}
+	multi, err := rp.MultiValue()
+	if err != nil {
+		return nil, err
+	}
+	var replicas []string
+	for _, item := range multi {
+		info, err := item.HashValue()
+		if err != nil {
+			return nil, err
+		}
+		flags := info["flags"]
+		if strings.Contains(flags, "s_down") || strings.Contains(flags, "o_down") ||
+			strings.Contains(flags, "disconnected") {
+			continue
+		}
+		replicas = append(replicas, net.JoinHostPort(info["ip"], info["port"]))
+	}
+	return replicas, nil
+}
+
+// switchMaster points the client to a new master and drains the connections to the old one.
+func (s *redisSentinel) switchMaster(addr string) {
+	s.mutex.Lock()
+	if s.master == addr {
+		s.mutex.Unlock()
+		return
+	}
+	s.master = addr
+	hooks := make([]func(), 0, len(s.switchHooks))
+	for _, f := range s.switchHooks {
+		hooks = append(hooks, f)
+	}
+	s.mutex.Unlock()
+	s.pool.Drain()
+	s.refreshReplicas()
+	for _, f := range hooks {
+		f()
+	}
+}
+
+// onSwitch adds f to be called after the master is switched, the returned function removes it.
+func (s *redisSentinel) onSwitch(f func()) (remove func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := s.nextHook
+	s.nextHook++
+	s.switchHooks[id] = f
+	return func() {
+		s.mutex.Lock()
+		delete(s.switchHooks, id)
+		s.mutex.Unlock()
+	}
+}
+
+func (s *redisSentinel) refreshReplicas() {
+	if s.replicaPool == nil {
+		return
+	}
+	replicas, err := s.discoverReplicas()
+	if err != nil {
+		return
+	}
+	s.mutex.Lock()
+	s.replicas = replicas
+	s.mutex.Unlock()
+	s.replicaPool.Drain()
+}
+
+// watch keeps a subscription to the sentinels until the client is closed,
+// the master is queried again every time the subscription is rebuilt
+// since a switch may be missed while disconnected.
+func (s *redisSentinel) watch() {
+	for {
+		s.subscribe()
+		select {
+		case <-s.quit:
+			return
+		case <-time.After(time.Second):
+		}
+		if master, err := s.discoverMaster(); err == nil {
+			s.switchMaster(master)
+		}
+	}
+}
+
+func (s *redisSentinel) subscribe() {
+	s.mutex.RLock()
+	sentinels := append([]string(nil), s.sentinels...)
+	s.mutex.RUnlock()
+	for _, addr := range sentinels {
+		c, err := s.dial(addr)
+		if err != nil {
+			continue
+		}
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			c.Conn.Close()
+			return
+		}
+		s.conn = c.Conn
+		s.mutex.Unlock()
+		s.receive(c)
+		c.Conn.Close()
+		return
+	}
+}
+
+// receive handles the messages of the subscription until the connection is broken.
+// A half-open connection is detected by the read deadline, which is pushed forward by the replies of PING.
+func (s *redisSentinel) receive(c *connection) {
+	args := []interface{}{"SUBSCRIBE", "+switch-master"}
+	if s.replicaPool != nil {
+		args = append(args, "+slave", "+sdown", "-sdown")
+	}
+	if err := c.SendCommand(args...); err != nil {
+		return
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.ping(c, stop)
+	for {
+		c.Conn.SetReadDeadline(time.Now().Add(2 * s.pingInterval))
+		rp, err := c.RecvReply()
+		if err != nil {
+			return
+		}
+		message, err := rp.ListValue()
+		if err != nil || len(message) != 3 || message[0] != "message" {
+			continue
+		}
+		fields := strings.Fields(message[2])
+		switch message[1] {
+		case "+switch-master":
+			// <master name> <oldip> <oldport> <newip> <newport>
+			if len(fields) == 5 && fields[0] == s.masterName {
+				s.switchMaster(net.JoinHostPort(fields[3], fields[4]))
+			}
+		default:
+			// <instance type> <name> <ip> <port> @ <master name> <master ip> <master port>
+			if len(fields) >= 6 && fields[0] == "slave" && fields[5] == s.masterName {
+				s.refreshReplicas()
+			}
+		}
+	}
+}
+
+func (s *redisSentinel) ping(c *connection, stop chan struct{}) {
+	ticker := time.NewTicker(s.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(s.timeout))
+			if err := c.SendCommand("PING"); err != nil {
+				c.Conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (s *redisSentinel) close() {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.quit)
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.mutex.Unlock()
+	if s.replicaPool != nil {
+		s.replicaPool.Close()
+	}
+}
+
+// readOnlyCommands are the commands which may be served by replicas.
+var readOnlyCommands = map[string]bool{
+	"BITCOUNT":         true,
+	"BITPOS":           true,
+	"DUMP":             true,
+	"EXISTS":           true,
+	"GET":              true,
+	"GETBIT":           true,
+	"GETRANGE":         true,
+	"HEXISTS":          true,
+	"HGET":             true,
+	"HGETALL":          true,
+	"HKEYS":            true,
+	"HLEN":             true,
+	"HMGET":            true,
+	"HSCAN":            true,
+	"HSTRLEN":          true,
+	"HVALS":            true,
+	"KEYS":             true,
+	"LINDEX":           true,
+	"LLEN":             true,
+	"LRANGE":           true,
+	"MGET":             true,
+	"PFCOUNT":          true,
+	"PTTL":             true,
+	"RANDOMKEY":        true,
+	"SCAN":             true,
+	"SCARD":            true,
+	"SDIFF":            true,
+	"SINTER":           true,
+	"SISMEMBER":        true,
+	"SMEMBERS":         true,
+	"SRANDMEMBER":      true,
+	"SSCAN":            true,
+	"STRLEN":           true,
+	"SUNION":           true,
+	"TTL":              true,
+	"TYPE":             true,
+	"ZCARD":            true,
+	"ZCOUNT":           true,
+	"ZLEXCOUNT":        true,
+	"ZRANGE":           true,
+	"ZRANGEBYLEX":      true,
+	"ZRANGEBYSCORE":    true,
+	"ZRANK":            true,
+	"ZREVRANGE":        true,
+	"ZREVRANGEBYSCORE": true,
+	"ZREVRANK":         true,
+	"ZSCAN":            true,
+	"ZSCORE":           true,
+}
+
+func isReadOnlyCommand(args []interface{}) bool {
+	if len(args) == 0 {
+		return false
+	}
+	return readOnlyCommands[strings.ToUpper(argString(args[0]))]
+}
@@ -0,0 +1,315 @@
+package goredis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serveFake accepts connections on l and answers every command with handle.
+func serveFake(l net.Listener, handle func(conn net.Conn, args []string) string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			c := &connection{Conn: conn, Reader: bufio.NewReader(conn)}
+			for {
+				rp, err := c.RecvReply()
+				if err != nil {
+					return
+				}
+				args, err := rp.ListValue()
+				if err != nil || len(args) == 0 {
+					return
+				}
+				if _, err := conn.Write([]byte(handle(conn, args))); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func bulkString(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+// fakeRedis is an in-process redis server which only knows PING, GET and SET.
+type fakeRedis struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	data     map[string]string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{listener: l, data: make(map[string]string)}
+	go serveFake(l, f.command)
+	return f
+}
+
+func (f *fakeRedis) Addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeRedis) Get(key string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.data[key]
+}
+
+func (f *fakeRedis) command(conn net.Conn, args []string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		value, ok := f.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulkString(value)
+	case "SET":
+		f.data[args[1]] = args[2]
+		return "+OK\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+// fakeSentinel is an in-process sentinel monitoring the group "mymaster".
+// If password is set, the commands other than AUTH are refused until the connection is authenticated.
+// If mute is true, PING is not answered, as if the connection were half-open.
+type fakeSentinel struct {
+	listener    net.Listener
+	mutex       sync.Mutex
+	master      string
+	replicas    []string
+	subscribers []net.Conn
+	password    string
+	authed      map[net.Conn]bool
+	mute        bool
+}
+
+func newFakeSentinel(t *testing.T, master string, replicas ...string) *fakeSentinel {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeSentinel{listener: l, master: master, replicas: replicas, authed: make(map[net.Conn]bool)}
+	go serveFake(l, f.command)
+	return f
+}
+
+func (f *fakeSentinel) Addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeSentinel) command(conn net.Conn, args []string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	command := strings.ToUpper(args[0])
+	if command == "AUTH" {
+		if len(args) != 2 || args[1] != f.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		f.authed[conn] = true
+		return "+OK\r\n"
+	}
+	if f.password != "" && !f.authed[conn] {
+		return "-NOAUTH Authentication required.\r\n"
+	}
+	switch command {
+	case "PING":
+		if f.mute {
+			return ""
+		}
+		return "*2\r\n" + bulkString("pong") + bulkString("")
+	case "SENTINEL":
+		if len(args) != 3 || args[2] != "mymaster" {
+			return "-ERR unknown command\r\n"
+		}
+		switch args[1] {
+		case "get-master-addr-by-name":
+			host, port, _ := net.SplitHostPort(f.master)
+			return "*2\r\n" + bulkString(host) + bulkString(port)
+		case "slaves":
+			reply := fmt.Sprintf("*%d\r\n", len(f.replicas))
+			for _, addr := range f.replicas {
+				host, port, _ := net.SplitHostPort(addr)
+				reply += "*6\r\n" + bulkString("ip") + bulkString(host) + bulkString("port") + bulkString(port) +
+					bulkString("flags") + bulkString("slave")
+			}
+			return reply
+		}
+	case "SUBSCRIBE":
+		f.subscribers = append(f.subscribers, conn)
+		var reply string
+		for i, channel := range args[1:] {
+			reply += "*3\r\n" + bulkString("subscribe") + bulkString(channel) + fmt.Sprintf(":%d\r\n", i+1)
+		}
+		return reply
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func (f *fakeSentinel) subscribed() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.subscribers) > 0
+}
+
+func (f *fakeSentinel) switchMaster(addr string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	oldHost, oldPort, _ := net.SplitHostPort(f.master)
+	newHost, newPort, _ := net.SplitHostPort(addr)
+	f.master = addr
+	payload := strings.Join([]string{"mymaster", oldHost, oldPort, newHost, newPort}, " ")
+	message := "*3\r\n" + bulkString("message") + bulkString("+switch-master") + bulkString(payload)
+	for _, conn := range f.subscribers {
+		conn.Write([]byte(message))
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("condition not reached")
+}
+
+func TestDialSentinel(t *testing.T) {
+	masterA, masterB := newFakeRedis(t), newFakeRedis(t)
+	sentinel := newFakeSentinel(t, masterA.Addr())
+	client, err := DialSentinel(&SentinelConfig{
+		Sentinels:  []string{"127.0.0.1:1", sentinel.Addr()},
+		MasterName: "mymaster",
+		Timeout:    time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	if err := client.SimpleSet("key", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if masterA.Get("key") != "a" {
+		t.Fail()
+	}
+	waitFor(t, sentinel.subscribed)
+	sentinel.switchMaster(masterB.Addr())
+	waitFor(t, func() bool {
+		return client.sentinel.masterAddress() == masterB.Addr()
+	})
+	if err := client.SimpleSet("key", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if masterA.Get("key") != "a" || masterB.Get("key") != "b" {
+		t.Fail()
+	}
+}
+
+func TestSentinelReplicas(t *testing.T) {
+	master, replica := newFakeRedis(t), newFakeRedis(t)
+	replica.data["key"] = "replica"
+	sentinel := newFakeSentinel(t, master.Addr(), replica.Addr())
+	client, err := DialSentinel(&SentinelConfig{
+		Sentinels:        []string{sentinel.Addr()},
+		MasterName:       "mymaster",
+		ReadFromReplicas: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	if err := client.SimpleSet("key", "master"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := client.Get("key"); err != nil {
+		t.Error(err)
+	} else if string(b) != "replica" {
+		t.Fail()
+	}
+	if master.Get("key") != "master" {
+		t.Fail()
+	}
+}
+
+func TestDialURLSentinel(t *testing.T) {
+	master := newFakeRedis(t)
+	sentinel := newFakeSentinel(t, master.Addr())
+	client, err := DialURL("sentinel://" + sentinel.Addr() + "/mymaster/0?timeout=1s&maxidle=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	if err := client.Ping(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSentinelConfig(t *testing.T) {
+	master := newFakeRedis(t)
+	sentinel := newFakeSentinel(t, master.Addr())
+	sentinel.password = "secret"
+	cfg := &SentinelConfig{
+		Sentinels:   []string{sentinel.Addr()},
+		MasterName:  "mymaster",
+		MaxActive:   2,
+		IdleTimeout: time.Minute,
+	}
+	if _, err := DialSentinel(cfg); err == nil {
+		t.Fatal("the sentinel password is not required")
+	}
+	cfg.SentinelPassword = "secret"
+	client, err := DialSentinel(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	if client.pool.MaxActive != 2 || client.pool.IdleTimeout != time.Minute || client.pool.WaitTimeout != DefaultTimeout {
+		t.Error(client.pool.MaxActive, client.pool.IdleTimeout, client.pool.WaitTimeout)
+	}
+	if err := client.Ping(); err != nil {
+		t.Error(err)
+	}
+	waitFor(t, sentinel.subscribed)
+}
+
+func TestSentinelHalfOpen(t *testing.T) {
+	masterA, masterB := newFakeRedis(t), newFakeRedis(t)
+	sentinel := newFakeSentinel(t, masterA.Addr())
+	client, err := DialSentinel(&SentinelConfig{
+		Sentinels:    []string{sentinel.Addr()},
+		MasterName:   "mymaster",
+		PingInterval: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.ClosePool()
+	waitFor(t, sentinel.subscribed)
+
+	// the switch is not published, it is only found by the subscription rebuilt after PING timed out
+	sentinel.mutex.Lock()
+	sentinel.mute = true
+	sentinel.master = masterB.Addr()
+	sentinel.mutex.Unlock()
+	waitFor(t, func() bool {
+		return client.sentinel.masterAddress() == masterB.Addr()
+	})
+}
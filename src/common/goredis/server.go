@@ -185,6 +185,24 @@ func (r *Redis) LastSave() (int64, error) {
 	return rp.IntegerValue()
 }
 
+// MemoryUsage returns the number of bytes that key and its value require to be stored in RAM,
+// samples is the number of sampled nested values, 0 for all of them and -1 for the default 5.
+// -1 is returned if key does not exist.
+func (r *Redis) MemoryUsage(key string, samples int) (int64, error) {
+	args := packArgs("MEMORY", "USAGE", key)
+	if samples >= 0 {
+		args = append(args, "SAMPLES", samples)
+	}
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return -1, err
+	}
+	if rp.Type == NilReply || rp.Type == BulkReply && rp.Bulk == nil {
+		return -1, nil
+	}
+	return rp.IntegerValue()
+}
+
 // MonitorCommand is a debugging command that streams back every command processed by the Redis server.
 type MonitorCommand struct {
 	redis *Redis
@@ -198,13 +216,16 @@ func (r *Redis) Monitor() (*MonitorCommand, error) {
 		return nil, err
 	}
 	if err := c.SendCommand("MONITOR"); err != nil {
+		r.pool.Discard(c)
 		return nil, err
 	}
 	rp, err := c.RecvReply()
 	if err != nil {
+		r.pool.Discard(c)
 		return nil, err
 	}
 	if err := rp.OKValue(); err != nil {
+		r.pool.Discard(c)
 		return nil, err
 	}
 	return &MonitorCommand{r, c}, nil
@@ -221,7 +242,9 @@ func (m *MonitorCommand) Receive() (string, error) {
 
 // Close closes current monitor command.
 func (m *MonitorCommand) Close() error {
-	return m.conn.SendCommand("QUIT")
+	err := m.conn.SendCommand("QUIT")
+	m.redis.pool.Discard(m.conn)
+	return err
 }
 
 // Save performs a synchronous save of the dataset
@@ -115,27 +115,47 @@ func TestLastSave(t *testing.T) {
 	}
 }
 
+func TestMemoryUsage(t *testing.T) {
+	r.Set("key", "value", 0, 0, false, false)
+	if n, err := r.MemoryUsage("key", -1); err != nil || n <= 0 {
+		t.Error(n, err)
+	}
+	r.Del("key")
+	if n, err := r.MemoryUsage("key", 0); err != nil || n != -1 {
+		t.Error(n, err)
+	}
+}
+
 func TestMonitor(t *testing.T) {
-	quit := false
 	m, err := r.Monitor()
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-	defer m.Close()
+	received := make(chan string, 1)
 	go func() {
+		defer close(received)
 		for {
-			if s, err := m.Receive(); err != nil {
-				if !quit {
-					t.Error(err)
-				}
-			} else if s == "" {
-				t.Fail()
+			s, err := m.Receive()
+			if err != nil {
+				// closed at the end of the test
+				return
+			}
+			select {
+			case received <- s:
+			default:
 			}
 		}
 	}()
-	time.Sleep(100 * time.Millisecond)
 	r.LPush("key", "value")
-	time.Sleep(100 * time.Microsecond)
+	select {
+	case s := <-received:
+		if s == "" {
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		t.Error("no command monitored")
+	}
+	m.Close()
 }
 
 func TestSave(t *testing.T) {
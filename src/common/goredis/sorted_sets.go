@@ -5,6 +5,31 @@ import (
 	"strconv"
 )
 
+// BZPopMax is the blocking variant of ZPOPMAX, which pops the member with the highest score
+// from the first non-empty sorted set of keys, with the given keys being checked in the order that they are given.
+// A timeout of zero can be used to block indefinitely.
+// Returns the key, the member and its score, or nil when no member could be popped and the timeout expired.
+func (r *Redis) BZPopMax(keys []string, timeout int) ([]string, error) {
+	return r.bzpop("BZPOPMAX", keys, timeout)
+}
+
+// BZPopMin is like BZPopMax, but pops the member with the lowest score.
+func (r *Redis) BZPopMin(keys []string, timeout int) ([]string, error) {
+	return r.bzpop("BZPOPMIN", keys, timeout)
+}
+
+func (r *Redis) bzpop(command string, keys []string, timeout int) ([]string, error) {
+	args := packArgs(command, keys, timeout)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	if rp.isNilMulti() {
+		return nil, nil
+	}
+	return rp.ListValue()
+}
+
 // ZAdd adds all the specified members with the specified scores to the sorted set stored at key.
 // If a specified member is already a member of the sorted set,
 // the score is updated and the element reinserted at the right position to ensure the correct ordering.
@@ -27,6 +52,33 @@ func (r *Redis) ZAdd(key string, pairs map[string]float64) (int64, error) {
 	return rp.IntegerValue()
 }
 
+// ZAddFlags is like ZAdd with the flags of ZADD:
+// NX only adds new members, XX only updates existing members,
+// GT and LT only update the score if the new score is greater or less than the current one,
+// CH returns the number of the changed members, the added ones and the updated ones.
+func (r *Redis) ZAddFlags(key string, pairs map[string]float64, flags ...string) (int64, error) {
+	args := packArgs("ZADD", key, flags)
+	for member, score := range pairs {
+		args = append(args, score, member)
+	}
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return 0, err
+	}
+	return rp.IntegerValue()
+}
+
+// ZAddIncr increments the score of member like ZIncrBy, by ZADD INCR with the flags NX, XX, GT or LT.
+// Bulk reply: the new score of member, or nil when the operation is aborted by the flags.
+func (r *Redis) ZAddIncr(key, member string, increment float64, flags ...string) ([]byte, error) {
+	args := packArgs("ZADD", key, flags, "INCR", increment, member)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	return rp.BytesValue()
+}
+
 // ZCard returns the sorted set cardinality (number of elements) of the sorted set stored at key.
 // Integer reply: the cardinality (number of elements) of the sorted set, or 0 if key does not exist.
 func (r *Redis) ZCard(key string) (int64, error) {
@@ -99,6 +151,26 @@ func (r *Redis) ZLexCount(key, min, max string) (int64, error) {
 	return rp.IntegerValue()
 }
 
+// ZPopMax removes and returns up to count members with the highest scores in the sorted set stored at key.
+// Multi-bulk reply: the popped members and their scores, like ZRANGE WITHSCORES.
+func (r *Redis) ZPopMax(key string, count int) ([]string, error) {
+	rp, err := r.ExecuteCommand("ZPOPMAX", key, count)
+	if err != nil {
+		return nil, err
+	}
+	return rp.ListValue()
+}
+
+// ZPopMin removes and returns up to count members with the lowest scores in the sorted set stored at key.
+// Multi-bulk reply: the popped members and their scores, like ZRANGE WITHSCORES.
+func (r *Redis) ZPopMin(key string, count int) ([]string, error) {
+	rp, err := r.ExecuteCommand("ZPOPMIN", key, count)
+	if err != nil {
+		return nil, err
+	}
+	return rp.ListValue()
+}
+
 // ZRange returns the specified range of elements in the sorted set stored at key.
 // The elements are considered to be ordered from the lowest to the highest score.
 // Lexicographical order is used for elements with equal score.
@@ -166,7 +238,7 @@ func (r *Redis) ZRank(key, member string) (int64, error) {
 	if rp.Type == IntegerReply {
 		return rp.Integer, nil
 	}
-	if rp.Type == BulkReply {
+	if rp.Type == BulkReply || rp.Type == NilReply {
 		return -1, nil
 	}
 	return -1, errors.New("ZRANK reply protocol error")
@@ -264,7 +336,7 @@ func (r *Redis) ZRevRank(key, member string) (int64, error) {
 	if rp.Type == IntegerReply {
 		return rp.Integer, nil
 	}
-	if rp.Type == BulkReply {
+	if rp.Type == BulkReply || rp.Type == NilReply {
 		return -1, nil
 	}
 	return -1, errors.New("ZREVRANK reply protocol error")
@@ -4,6 +4,21 @@ import (
 	"testing"
 )
 
+func TestBZPopMin(t *testing.T) {
+	r.Del("key", "key2")
+	result, err := r.BZPopMin([]string{"key", "key2"}, 1)
+	if err != nil || result != nil {
+		t.Error(result, err)
+	}
+	r.ZAdd("key2", map[string]float64{"one": 1, "two": 2})
+	if result, err := r.BZPopMin([]string{"key", "key2"}, 0); err != nil || len(result) != 3 || result[0] != "key2" || result[1] != "one" || result[2] != "1" {
+		t.Error(result, err)
+	}
+	if result, _ := r.BZPopMax([]string{"key", "key2"}, 0); len(result) != 3 || result[1] != "two" {
+		t.Error(result)
+	}
+}
+
 func TestZAdd(t *testing.T) {
 	r.Del("key")
 	pairs := map[string]float64{
@@ -21,6 +36,32 @@ func TestZAdd(t *testing.T) {
 	}
 }
 
+func TestZAddFlags(t *testing.T) {
+	r.Del("key")
+	r.ZAdd("key", map[string]float64{"one": 1, "two": 2})
+	if n, err := r.ZAddFlags("key", map[string]float64{"one": 10, "three": 3}, "NX"); err != nil || n != 1 {
+		t.Error(n, err)
+	}
+	if score, _ := r.ZScore("key", "one"); string(score) != "1" {
+		t.Error(string(score))
+	}
+	if n, _ := r.ZAddFlags("key", map[string]float64{"one": 0, "two": 20}, "GT", "CH"); n != 1 {
+		t.Error(n)
+	}
+	if n, _ := r.ZAddFlags("key", map[string]float64{"four": 4}, "XX"); n != 0 {
+		t.Error(n)
+	}
+	if score, err := r.ZAddIncr("key", "one", 1.5); err != nil || string(score) != "2.5" {
+		t.Error(string(score), err)
+	}
+	if score, err := r.ZAddIncr("key", "one", -1, "GT"); err != nil || score != nil {
+		t.Error(score, err)
+	}
+	if _, err := r.ZAddFlags("key", map[string]float64{"one": 1}, "NX", "XX"); err == nil {
+		t.Error("NX and XX accepted")
+	}
+}
+
 func TestZCard(t *testing.T) {
 	r.Del("key")
 	pairs := map[string]float64{
@@ -69,6 +110,20 @@ func TestZIncrBy(t *testing.T) {
 	}
 }
 
+func TestZPopMin(t *testing.T) {
+	r.Del("key")
+	r.ZAdd("key", map[string]float64{"one": 1, "two": 2, "three": 3})
+	if result, err := r.ZPopMin("key", 2); err != nil || len(result) != 4 || result[0] != "one" || result[3] != "2" {
+		t.Error(result, err)
+	}
+	if result, err := r.ZPopMax("key", 2); err != nil || len(result) != 2 || result[0] != "three" {
+		t.Error(result, err)
+	}
+	if result, err := r.ZPopMax("key", 1); err != nil || len(result) != 0 {
+		t.Error(result, err)
+	}
+}
+
 func TestZRange(t *testing.T) {
 	r.Del("key")
 	pairs := map[string]float64{
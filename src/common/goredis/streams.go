@@ -0,0 +1,705 @@
+package goredis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XMessage is an entry of a stream, the ID and the field value pairs.
+type XMessage struct {
+	ID     string
+	Values map[string]string
+}
+
+// XStream is the entries of one stream replied by XREAD and XREADGROUP.
+type XStream struct {
+	Stream   string
+	Messages []*XMessage
+}
+
+// XPendingSummary is the summary form reply of XPENDING.
+// Consumers is the number of pending messages of every consumer.
+type XPendingSummary struct {
+	Count     int64
+	Lowest    string
+	Highest   string
+	Consumers map[string]int64
+}
+
+// XPendingEntry is a pending message of the extended form reply of XPENDING.
+type XPendingEntry struct {
+	ID         string
+	Consumer   string
+	Idle       time.Duration
+	Deliveries int64
+}
+
+// XStreamInfo is the reply of XINFO STREAM.
+type XStreamInfo struct {
+	Length          int64
+	RadixTreeKeys   int64
+	RadixTreeNodes  int64
+	Groups          int64
+	LastGeneratedID string
+	FirstEntry      *XMessage
+	LastEntry       *XMessage
+}
+
+// XGroupInfo is an item of the reply of XINFO GROUPS.
+type XGroupInfo struct {
+	Name            string
+	Consumers       int64
+	Pending         int64
+	LastDeliveredID string
+}
+
+// XConsumerInfo is an item of the reply of XINFO CONSUMERS.
+type XConsumerInfo struct {
+	Name    string
+	Pending int64
+	Idle    time.Duration
+}
+
+// XAdd appends the entry values to the stream stored at key, the stream is created if it does not exist.
+// An empty id means "*", the ID is generated by the server.
+// If maxlen is greater than 0, the stream is trimmed to maxlen entries, approx uses "~" for efficient trimming.
+// Bulk reply: the ID of the added entry.
+func (r *Redis) XAdd(key, id string, maxlen int64, approx bool, values map[string]string) (string, error) {
+	args := packArgs("XADD", key)
+	if maxlen > 0 {
+		args = append(args, "MAXLEN")
+		if approx {
+			args = append(args, "~")
+		}
+		args = append(args, maxlen)
+	}
+	if id == "" {
+		id = "*"
+	}
+	args = append(args, id)
+	for field, value := range values {
+		args = append(args, field, value)
+	}
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return "", err
+	}
+	return rp.StringValue()
+}
+
+// XLen returns the number of entries inside a stream.
+func (r *Redis) XLen(key string) (int64, error) {
+	rp, err := r.ExecuteCommand("XLEN", key)
+	if err != nil {
+		return 0, err
+	}
+	return rp.IntegerValue()
+}
+
+// XDel removes the specified entries from a stream.
+// Integer reply: the number of entries actually deleted.
+func (r *Redis) XDel(key string, ids ...string) (int64, error) {
+	args := packArgs("XDEL", key, ids)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return 0, err
+	}
+	return rp.IntegerValue()
+}
+
+// XRange returns the entries of the stream with IDs between start and end,
+// "-" and "+" are the minimum and the maximum possible IDs.
+// If count is greater than 0, at most count entries are returned.
+func (r *Redis) XRange(key, start, end string, count int) ([]*XMessage, error) {
+	args := packArgs("XRANGE", key, start, end)
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseXMessages(rp)
+}
+
+// XRevRange is like XRange but returns the entries in reverse order,
+// so the end ID comes first.
+func (r *Redis) XRevRange(key, end, start string, count int) ([]*XMessage, error) {
+	args := packArgs("XREVRANGE", key, end, start)
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseXMessages(rp)
+}
+
+// XRead reads the entries with an ID greater than the given one from every stream of streams(key: id),
+// "$" means the entries added after the call.
+// If count is greater than 0, at most count entries are returned per stream.
+// A negative block does not block, block 0 blocks forever, otherwise it blocks at most block time.
+// If the block time is reached, nil is returned.
+func (r *Redis) XRead(streams map[string]string, count int, block time.Duration) ([]*XStream, error) {
+	args := packArgs("XREAD")
+	args = append(args, xReadArgs(streams, count, block)...)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseXStreams(rp)
+}
+
+// XReadGroup is like XRead but reads as consumer of group,
+// id ">" means the messages never delivered to any consumer of the group,
+// other IDs return the pending messages of the consumer.
+// If noack is true, the messages are not added to the pending entries list.
+func (r *Redis) XReadGroup(group, consumer string, streams map[string]string, count int, block time.Duration, noack bool) ([]*XStream, error) {
+	args := packArgs("XREADGROUP", "GROUP", group, consumer)
+	if noack {
+		args = append(args, "NOACK")
+	}
+	args = append(args, xReadArgs(streams, count, block)...)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseXStreams(rp)
+}
+
+func xReadArgs(streams map[string]string, count int, block time.Duration) []interface{} {
+	var args []interface{}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	if block >= 0 {
+		args = append(args, "BLOCK", int64(block/time.Millisecond))
+	}
+	args = append(args, "STREAMS")
+	ids := make([]interface{}, 0, len(streams))
+	for key, id := range streams {
+		args = append(args, key)
+		ids = append(ids, id)
+	}
+	return append(args, ids...)
+}
+
+// XGroupCreate creates the consumer group of the stream stored at key,
+// the group delivers the entries after id, "$" means the entries added from now on.
+// If mkstream is true, an empty stream is created if it does not exist.
+func (r *Redis) XGroupCreate(key, group, id string, mkstream bool) error {
+	args := packArgs("XGROUP", "CREATE", key, group, id)
+	if mkstream {
+		args = append(args, "MKSTREAM")
+	}
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return err
+	}
+	return rp.OKValue()
+}
+
+// XGroupDestroy destroys the consumer group, even if there are active consumers and pending messages.
+func (r *Redis) XGroupDestroy(key, group string) (bool, error) {
+	rp, err := r.ExecuteCommand("XGROUP", "DESTROY", key, group)
+	if err != nil {
+		return false, err
+	}
+	return rp.BoolValue()
+}
+
+// XGroupSetID sets the last delivered ID of the consumer group.
+func (r *Redis) XGroupSetID(key, group, id string) error {
+	rp, err := r.ExecuteCommand("XGROUP", "SETID", key, group, id)
+	if err != nil {
+		return err
+	}
+	return rp.OKValue()
+}
+
+// XGroupDelConsumer removes the consumer from the consumer group.
+// Integer reply: the number of pending messages that the consumer had.
+func (r *Redis) XGroupDelConsumer(key, group, consumer string) (int64, error) {
+	rp, err := r.ExecuteCommand("XGROUP", "DELCONSUMER", key, group, consumer)
+	if err != nil {
+		return 0, err
+	}
+	return rp.IntegerValue()
+}
+
+// XAck removes the messages from the pending entries list of the consumer group.
+// Integer reply: the number of messages successfully acknowledged.
+func (r *Redis) XAck(key, group string, ids ...string) (int64, error) {
+	args := packArgs("XACK", key, group, ids)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return 0, err
+	}
+	return rp.IntegerValue()
+}
+
+// XPending returns the summary of the pending messages of the consumer group.
+func (r *Redis) XPending(key, group string) (*XPendingSummary, error) {
+	rp, err := r.ExecuteCommand("XPENDING", key, group)
+	if err != nil {
+		return nil, err
+	}
+	multi, err := rp.MultiValue()
+	if err != nil {
+		return nil, err
+	}
+	if len(multi) != 4 {
+		return nil, errors.New("xpending protocol error")
+	}
+	summary := &XPendingSummary{Consumers: make(map[string]int64)}
+	if summary.Count, err = multi[0].IntegerValue(); err != nil {
+		return nil, err
+	}
+	if summary.Count == 0 {
+		return summary, nil
+	}
+	if summary.Lowest, err = multi[1].StringValue(); err != nil {
+		return nil, err
+	}
+	if summary.Highest, err = multi[2].StringValue(); err != nil {
+		return nil, err
+	}
+	for _, item := range multi[3].Multi {
+		pair, err := item.ListValue()
+		if err != nil {
+			return nil, err
+		}
+		if len(pair) != 2 {
+			return nil, errors.New("xpending protocol error")
+		}
+		n, err := strconv.ParseInt(pair[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		summary.Consumers[pair[0]] = n
+	}
+	return summary, nil
+}
+
+// XPendingRange returns the pending messages of the consumer group with IDs between start and end,
+// at most count messages are returned.
+// If consumer is not empty, only the messages of the consumer are returned.
+// If idle is greater than 0, only the messages idle for at least idle time are returned.
+func (r *Redis) XPendingRange(key, group, start, end string, count int, consumer string, idle time.Duration) ([]*XPendingEntry, error) {
+	args := packArgs("XPENDING", key, group)
+	if idle > 0 {
+		args = append(args, "IDLE", int64(idle/time.Millisecond))
+	}
+	args = append(args, start, end, count)
+	if consumer != "" {
+		args = append(args, consumer)
+	}
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	multi, err := rp.MultiValue()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*XPendingEntry, 0, len(multi))
+	for _, item := range multi {
+		if len(item.Multi) != 4 {
+			return nil, errors.New("xpending protocol error")
+		}
+		entry := &XPendingEntry{}
+		if entry.ID, err = item.Multi[0].StringValue(); err != nil {
+			return nil, err
+		}
+		if entry.Consumer, err = item.Multi[1].StringValue(); err != nil {
+			return nil, err
+		}
+		ms, err := item.Multi[2].IntegerValue()
+		if err != nil {
+			return nil, err
+		}
+		entry.Idle = time.Duration(ms) * time.Millisecond
+		if entry.Deliveries, err = item.Multi[3].IntegerValue(); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// XClaim changes the ownership of the pending messages idle for at least minIdle time to consumer,
+// the claimed messages are returned, messages deleted from the stream are skipped.
+func (r *Redis) XClaim(key, group, consumer string, minIdle time.Duration, ids ...string) ([]*XMessage, error) {
+	args := packArgs("XCLAIM", key, group, consumer, int64(minIdle/time.Millisecond), ids)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseXMessages(rp)
+}
+
+// XAutoClaim is like XClaim but claims at most count pending messages idle for at least minIdle time,
+// scanning from the start ID, "0-0" means the beginning.
+// The returned ID is the start of the next call, "0-0" when the whole pending entries list is scanned.
+func (r *Redis) XAutoClaim(key, group, consumer string, minIdle time.Duration, start string, count int) (string, []*XMessage, error) {
+	args := packArgs("XAUTOCLAIM", key, group, consumer, int64(minIdle/time.Millisecond), start)
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return "", nil, err
+	}
+	multi, err := rp.MultiValue()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(multi) < 2 {
+		return "", nil, errors.New("xautoclaim protocol error")
+	}
+	next, err := multi[0].StringValue()
+	if err != nil {
+		return "", nil, err
+	}
+	messages, err := parseXMessages(multi[1])
+	return next, messages, err
+}
+
+// XTrim trims the stream to at most maxlen entries, approx uses "~" for efficient trimming.
+// Integer reply: the number of entries deleted.
+func (r *Redis) XTrim(key string, maxlen int64, approx bool) (int64, error) {
+	args := packArgs("XTRIM", key, "MAXLEN")
+	if approx {
+		args = append(args, "~")
+	}
+	args = append(args, maxlen)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return 0, err
+	}
+	return rp.IntegerValue()
+}
+
+// XTrimMinID evicts the entries with IDs lower than minid, approx uses "~" for efficient trimming.
+// Integer reply: the number of entries deleted.
+func (r *Redis) XTrimMinID(key, minid string, approx bool) (int64, error) {
+	args := packArgs("XTRIM", key, "MINID")
+	if approx {
+		args = append(args, "~")
+	}
+	args = append(args, minid)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return 0, err
+	}
+	return rp.IntegerValue()
+}
+
+// XInfoStream returns the general information about the stream stored at key.
+func (r *Redis) XInfoStream(key string) (*XStreamInfo, error) {
+	rp, err := r.ExecuteCommand("XINFO", "STREAM", key)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := replyFields(rp)
+	if err != nil {
+		return nil, err
+	}
+	info := &XStreamInfo{
+		Length:         fieldInteger(fields, "length"),
+		RadixTreeKeys:  fieldInteger(fields, "radix-tree-keys"),
+		RadixTreeNodes: fieldInteger(fields, "radix-tree-nodes"),
+		Groups:         fieldInteger(fields, "groups"),
+	}
+	info.LastGeneratedID = fieldString(fields, "last-generated-id")
+	if info.FirstEntry, err = parseXMessage(fields["first-entry"]); err != nil {
+		return nil, err
+	}
+	if info.LastEntry, err = parseXMessage(fields["last-entry"]); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// XInfoGroups returns the consumer groups of the stream stored at key.
+func (r *Redis) XInfoGroups(key string) ([]*XGroupInfo, error) {
+	rp, err := r.ExecuteCommand("XINFO", "GROUPS", key)
+	if err != nil {
+		return nil, err
+	}
+	multi, err := rp.MultiValue()
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]*XGroupInfo, 0, len(multi))
+	for _, item := range multi {
+		fields, err := replyFields(item)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, &XGroupInfo{
+			Name:            fieldString(fields, "name"),
+			Consumers:       fieldInteger(fields, "consumers"),
+			Pending:         fieldInteger(fields, "pending"),
+			LastDeliveredID: fieldString(fields, "last-delivered-id"),
+		})
+	}
+	return groups, nil
+}
+
+// XInfoConsumers returns the consumers of the consumer group.
+func (r *Redis) XInfoConsumers(key, group string) ([]*XConsumerInfo, error) {
+	rp, err := r.ExecuteCommand("XINFO", "CONSUMERS", key, group)
+	if err != nil {
+		return nil, err
+	}
+	multi, err := rp.MultiValue()
+	if err != nil {
+		return nil, err
+	}
+	consumers := make([]*XConsumerInfo, 0, len(multi))
+	for _, item := range multi {
+		fields, err := replyFields(item)
+		if err != nil {
+			return nil, err
+		}
+		consumers = append(consumers, &XConsumerInfo{
+			Name:    fieldString(fields, "name"),
+			Pending: fieldInteger(fields, "pending"),
+			Idle:    time.Duration(fieldInteger(fields, "idle")) * time.Millisecond,
+		})
+	}
+	return consumers, nil
+}
+
+// replyFields converts a field value pairs reply to a map.
+func replyFields(rp *Reply) (map[string]*Reply, error) {
+	multi, err := rp.MultiValue()
+	if err != nil {
+		return nil, err
+	}
+	if len(multi)%2 != 0 {
+		return nil, errors.New("fields reply protocol error")
+	}
+	fields := make(map[string]*Reply, len(multi)/2)
+	for i := 0; i < len(multi); i += 2 {
+		name, err := multi[i].StringValue()
+		if err != nil {
+			if name, err = multi[i].StatusValue(); err != nil {
+				return nil, err
+			}
+		}
+		fields[name] = multi[i+1]
+	}
+	return fields, nil
+}
+
+func fieldInteger(fields map[string]*Reply, name string) int64 {
+	if rp, ok := fields[name]; ok {
+		i, _ := rp.IntegerValue()
+		return i
+	}
+	return 0
+}
+
+func fieldString(fields map[string]*Reply, name string) string {
+	if rp, ok := fields[name]; ok {
+		s, _ := rp.StringValue()
+		return s
+	}
+	return ""
+}
+
+// parseXMessage parses an [id, [field, value...]] entry, a nil entry returns nil.
+func parseXMessage(rp *Reply) (*XMessage, error) {
+	if rp == nil || rp.Type == NilReply || (rp.Type == MultiReply && rp.Multi == nil) {
+		return nil, nil
+	}
+	if !rp.isMulti() || len(rp.Multi) != 2 {
+		return nil, errors.New("stream entry protocol error")
+	}
+	id, err := rp.Multi[0].StringValue()
+	if err != nil {
+		return nil, err
+	}
+	values, err := rp.Multi[1].HashValue()
+	if err != nil {
+		return nil, err
+	}
+	return &XMessage{ID: id, Values: values}, nil
+}
+
+func parseXMessages(rp *Reply) ([]*XMessage, error) {
+	multi, err := rp.MultiValue()
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*XMessage, 0, len(multi))
+	for _, item := range multi {
+		message, err := parseXMessage(item)
+		if err != nil {
+			return nil, err
+		}
+		if message != nil {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// parseXStreams parses the reply of XREAD and XREADGROUP,
+// an array of [stream, entries] with RESP2, or a map of stream to entries with RESP3.
+func parseXStreams(rp *Reply) ([]*XStream, error) {
+	multi, err := rp.MultiValue()
+	if err != nil || multi == nil {
+		return nil, err
+	}
+	var pairs []*Reply
+	if rp.Type == MapReply {
+		pairs = multi
+	} else {
+		for _, item := range multi {
+			if !item.isMulti() || len(item.Multi) != 2 {
+				return nil, errors.New("xread protocol error")
+			}
+			pairs = append(pairs, item.Multi...)
+		}
+	}
+	streams := make([]*XStream, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		name, err := pairs[i].StringValue()
+		if err != nil {
+			return nil, err
+		}
+		messages, err := parseXMessages(pairs[i+1])
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, &XStream{Stream: name, Messages: messages})
+	}
+	return streams, nil
+}
+
+// StreamConsumer runs a consumer of a stream consumer group, see Redis.NewStreamConsumer.
+//
+// Count is the max number of messages read at a time, Block is the max time a read blocks.
+// The pending messages of other consumers idle for at least MinIdle time
+// are reclaimed by XAUTOCLAIM every ClaimInterval, a MinIdle of 0 disables reclaiming.
+type StreamConsumer struct {
+	Stream        string
+	Group         string
+	Name          string
+	Count         int
+	Block         time.Duration
+	MinIdle       time.Duration
+	ClaimInterval time.Duration
+
+	redis   *Redis
+	handler func(*XMessage) error
+}
+
+// NewStreamConsumer returns a consumer named name of the group of stream,
+// every message is passed to handler and acknowledged if handler returns nil,
+// otherwise it stays pending and is delivered again after it is reclaimed.
+func (r *Redis) NewStreamConsumer(stream, group, name string, handler func(*XMessage) error) *StreamConsumer {
+	return &StreamConsumer{
+		Stream:        stream,
+		Group:         group,
+		Name:          name,
+		Count:         10,
+		Block:         5 * time.Second,
+		MinIdle:       time.Minute,
+		ClaimInterval: 30 * time.Second,
+		redis:         r,
+		handler:       handler,
+	}
+}
+
+// Run creates the group if it does not exist, handles the pending messages of the consumer left
+// by a previous run, then consumes the new messages until ctx is done or a command fails.
+// The error of the failed command or ctx.Err() is returned.
+func (c *StreamConsumer) Run(ctx context.Context) error {
+	r := c.redis.WithContext(ctx)
+	if err := r.XGroupCreate(c.Stream, c.Group, "$", true); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	if err := c.consume(r, "0"); err != nil {
+		return err
+	}
+	var lastClaim time.Time
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if c.MinIdle > 0 && time.Since(lastClaim) >= c.ClaimInterval {
+			if err := c.reclaim(r); err != nil {
+				return err
+			}
+			lastClaim = time.Now()
+		}
+		if err := c.consume(r, ">"); err != nil {
+			return err
+		}
+	}
+}
+
+// consume reads from id ">" once, or the pending messages of the consumer until there is none.
+func (c *StreamConsumer) consume(r *Redis, id string) error {
+	block := c.Block
+	if id != ">" {
+		block = -1
+	}
+	for {
+		streams, err := r.XReadGroup(c.Group, c.Name, map[string]string{c.Stream: id}, c.Count, block, false)
+		if err != nil {
+			return err
+		}
+		if len(streams) == 0 || len(streams[0].Messages) == 0 {
+			return nil
+		}
+		messages := streams[0].Messages
+		if err := c.handle(r, messages); err != nil {
+			return err
+		}
+		if id == ">" {
+			return nil
+		}
+		id = messages[len(messages)-1].ID
+	}
+}
+
+// reclaim claims the stale pending messages of the group and handles them.
+func (c *StreamConsumer) reclaim(r *Redis) error {
+	start := "0-0"
+	for {
+		next, messages, err := r.XAutoClaim(c.Stream, c.Group, c.Name, c.MinIdle, start, c.Count)
+		if err != nil {
+			return err
+		}
+		if err := c.handle(r, messages); err != nil {
+			return err
+		}
+		if next == "0-0" || next == start {
+			return nil
+		}
+		start = next
+	}
+}
+
+func (c *StreamConsumer) handle(r *Redis, messages []*XMessage) error {
+	var acks []string
+	for _, message := range messages {
+		if c.handler(message) == nil {
+			acks = append(acks, message.ID)
+		}
+	}
+	if len(acks) == 0 {
+		return nil
+	}
+	_, err := r.XAck(c.Stream, c.Group, acks...)
+	return err
+}
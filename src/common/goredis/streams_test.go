@@ -0,0 +1,241 @@
+package goredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestXAdd(t *testing.T) {
+	r.Del("stream")
+	id, err := r.XAdd("stream", "1-1", 0, false, map[string]string{"name": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "1-1" {
+		t.Fail()
+	}
+	if id, err := r.XAdd("stream", "", 0, false, map[string]string{"name": "b"}); err != nil || id == "" {
+		t.Error(id, err)
+	}
+	if n, err := r.XLen("stream"); err != nil {
+		t.Error(err)
+	} else if n != 2 {
+		t.Fail()
+	}
+	if _, err := r.XAdd("stream", "1-0", 0, false, map[string]string{"name": "c"}); err == nil {
+		t.Fail()
+	}
+}
+
+func TestXRange(t *testing.T) {
+	r.Del("stream")
+	r.XAdd("stream", "1-1", 0, false, map[string]string{"name": "a"})
+	r.XAdd("stream", "2-1", 0, false, map[string]string{"name": "b"})
+	r.XAdd("stream", "3-1", 0, false, map[string]string{"name": "c"})
+	if messages, err := r.XRange("stream", "-", "+", 0); err != nil {
+		t.Error(err)
+	} else if len(messages) != 3 || messages[0].ID != "1-1" || messages[2].Values["name"] != "c" {
+		t.Fail()
+	}
+	if messages, err := r.XRange("stream", "2", "+", 1); err != nil {
+		t.Error(err)
+	} else if len(messages) != 1 || messages[0].ID != "2-1" {
+		t.Fail()
+	}
+	if messages, err := r.XRevRange("stream", "+", "-", 2); err != nil {
+		t.Error(err)
+	} else if len(messages) != 2 || messages[0].ID != "3-1" || messages[1].ID != "2-1" {
+		t.Fail()
+	}
+	if n, err := r.XDel("stream", "1-1", "9-9"); err != nil {
+		t.Error(err)
+	} else if n != 1 {
+		t.Fail()
+	}
+}
+
+func TestXRead(t *testing.T) {
+	r.Del("stream", "stream2")
+	r.XAdd("stream", "1-1", 0, false, map[string]string{"name": "a"})
+	r.XAdd("stream2", "1-1", 0, false, map[string]string{"name": "b"})
+	streams, err := r.XRead(map[string]string{"stream": "0", "stream2": "0"}, 10, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 2 {
+		t.Fatal(streams)
+	}
+	for _, stream := range streams {
+		if len(stream.Messages) != 1 || stream.Messages[0].ID != "1-1" {
+			t.Fail()
+		}
+	}
+	if streams, err := r.XRead(map[string]string{"stream": "$"}, 0, 50*time.Millisecond); err != nil {
+		t.Error(err)
+	} else if streams != nil {
+		t.Fail()
+	}
+}
+
+func TestXGroup(t *testing.T) {
+	r.Del("stream")
+	if err := r.XGroupCreate("stream", "group", "$", false); err == nil {
+		t.Fail()
+	}
+	if err := r.XGroupCreate("stream", "group", "0", true); err != nil {
+		t.Fatal(err)
+	}
+	r.XAdd("stream", "1-1", 0, false, map[string]string{"name": "a"})
+	r.XAdd("stream", "2-1", 0, false, map[string]string{"name": "b"})
+	streams, err := r.XReadGroup("group", "alice", map[string]string{"stream": ">"}, 1, -1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 1 || len(streams[0].Messages) != 1 || streams[0].Messages[0].ID != "1-1" {
+		t.Fatal(streams)
+	}
+	summary, err := r.XPending("stream", "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Count != 1 || summary.Lowest != "1-1" || summary.Consumers["alice"] != 1 {
+		t.Error(summary)
+	}
+	entries, err := r.XPendingRange("stream", "group", "-", "+", 10, "alice", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != "1-1" || entries[0].Consumer != "alice" || entries[0].Deliveries != 1 {
+		t.Error(entries)
+	}
+	if messages, err := r.XClaim("stream", "group", "bob", 0, "1-1"); err != nil {
+		t.Error(err)
+	} else if len(messages) != 1 || messages[0].Values["name"] != "a" {
+		t.Fail()
+	}
+	if n, err := r.XAck("stream", "group", "1-1"); err != nil {
+		t.Error(err)
+	} else if n != 1 {
+		t.Fail()
+	}
+	if err := r.XGroupSetID("stream", "group", "0"); err != nil {
+		t.Error(err)
+	}
+	if ok, err := r.XGroupDestroy("stream", "group"); err != nil {
+		t.Error(err)
+	} else if !ok {
+		t.Fail()
+	}
+}
+
+func TestXAutoClaim(t *testing.T) {
+	r.Del("stream")
+	r.XGroupCreate("stream", "group", "0", true)
+	r.XAdd("stream", "1-1", 0, false, map[string]string{"name": "a"})
+	r.XReadGroup("group", "alice", map[string]string{"stream": ">"}, 0, -1, false)
+	next, messages, err := r.XAutoClaim("stream", "group", "bob", 0, "0-0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != "0-0" || len(messages) != 1 || messages[0].ID != "1-1" {
+		t.Error(next, messages)
+	}
+	if consumers, err := r.XInfoConsumers("stream", "group"); err != nil {
+		t.Error(err)
+	} else if len(consumers) != 2 {
+		t.Error(consumers)
+	}
+}
+
+func TestXTrim(t *testing.T) {
+	r.Del("stream")
+	for _, id := range []string{"1-1", "2-1", "3-1"} {
+		r.XAdd("stream", id, 0, false, map[string]string{"name": id})
+	}
+	if n, err := r.XTrim("stream", 2, false); err != nil {
+		t.Error(err)
+	} else if n != 1 {
+		t.Fail()
+	}
+	if n, err := r.XTrimMinID("stream", "3", false); err != nil {
+		t.Error(err)
+	} else if n != 1 {
+		t.Fail()
+	}
+	if _, err := r.XAdd("stream", "4-1", 1, false, map[string]string{"name": "4-1"}); err != nil {
+		t.Error(err)
+	}
+	if n, _ := r.XLen("stream"); n != 1 {
+		t.Fail()
+	}
+}
+
+func TestXInfo(t *testing.T) {
+	r.Del("stream")
+	r.XAdd("stream", "1-1", 0, false, map[string]string{"name": "a"})
+	r.XAdd("stream", "2-1", 0, false, map[string]string{"name": "b"})
+	r.XGroupCreate("stream", "group", "0", false)
+	info, err := r.XInfoStream("stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Length != 2 || info.LastGeneratedID != "2-1" || info.Groups != 1 {
+		t.Error(info)
+	}
+	if info.FirstEntry == nil || info.FirstEntry.ID != "1-1" || info.LastEntry == nil || info.LastEntry.Values["name"] != "b" {
+		t.Fail()
+	}
+	if groups, err := r.XInfoGroups("stream"); err != nil {
+		t.Error(err)
+	} else if len(groups) != 1 || groups[0].Name != "group" {
+		t.Error(groups)
+	}
+}
+
+func TestStreamConsumer(t *testing.T) {
+	r.Del("stream")
+	r.XGroupCreate("stream", "group", "0", true)
+	r.XAdd("stream", "1-1", 0, false, map[string]string{"name": "stale"})
+	// delivered to a consumer which died before the ack
+	r.XReadGroup("group", "dead", map[string]string{"stream": ">"}, 0, -1, false)
+	r.XAdd("stream", "2-1", 0, false, map[string]string{"name": "fail"})
+	r.XAdd("stream", "3-1", 0, false, map[string]string{"name": "ok"})
+	time.Sleep(10 * time.Millisecond)
+
+	var mutex sync.Mutex
+	handled := make(map[string]int)
+	consumer := r.NewStreamConsumer("stream", "group", "worker", func(message *XMessage) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		handled[message.Values["name"]]++
+		if message.Values["name"] == "fail" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	consumer.Block = 20 * time.Millisecond
+	consumer.MinIdle = time.Millisecond
+	consumer.ClaimInterval = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- consumer.Run(ctx)
+	}()
+	waitFor(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return handled["stale"] == 1 && handled["fail"] == 1 && handled["ok"] == 1
+	})
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Error(err)
+	}
+	if entries, err := r.XPendingRange("stream", "group", "-", "+", 10, "", 0); err != nil {
+		t.Error(err)
+	} else if len(entries) != 1 || entries[0].ID != "2-1" || entries[0].Consumer != "worker" {
+		t.Error(entries)
+	}
+}
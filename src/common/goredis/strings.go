@@ -24,6 +24,35 @@ func (r *Redis) BitCount(key string, start, end int) (int64, error) {
 	return rp.IntegerValue()
 }
 
+// BitField treats a string as an array of bits, and runs the subcommands on it,
+// such as BitField("key", "INCRBY", "u8", "#0", 1, "GET", "i16", 8).
+// The subcommands GET, SET, INCRBY and OVERFLOW WRAP|SAT|FAIL are supported.
+// Returns the results of the GET, SET and INCRBY subcommands,
+// the result is nil if the write is not done for OVERFLOW FAIL.
+func (r *Redis) BitField(key string, subcommands ...interface{}) ([]*int64, error) {
+	args := packArgs("BITFIELD", key, subcommands)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	items, err := rp.MultiValue()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*int64, len(items))
+	for i, item := range items {
+		if item.Type == NilReply || item.Type == BulkReply && item.Bulk == nil {
+			continue
+		}
+		n, err := item.IntegerValue()
+		if err != nil {
+			return nil, err
+		}
+		result[i] = &n
+	}
+	return result, nil
+}
+
 // BitOp performs a bitwise operation between multiple keys (containing string values)
 // and store the result in the destination key.
 // The BITOP command supports four bitwise operations:
@@ -43,6 +72,19 @@ func (r *Redis) BitOp(operation, destkey string, keys ...string) (int64, error)
 	return rp.IntegerValue()
 }
 
+// BitPos returns the position of the first bit set to 1 or 0 in a string.
+// The optional positions are the start and end bytes of the range to look for.
+// -1 is returned if the bit is not found, looking for a 0 bit without an end
+// returns the first bit after the string if all the bits are set.
+func (r *Redis) BitPos(key string, bit int, positions ...int) (int64, error) {
+	args := packArgs("BITPOS", key, bit, positions)
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return 0, err
+	}
+	return rp.IntegerValue()
+}
+
 // Decr decrements the number stored at key by one.
 // If the key does not exist, it is set to 0 before performing the operation.
 // An error is returned if the key contains a value of the wrong type
@@ -91,6 +133,37 @@ func (r *Redis) GetBit(key string, offset int) (int64, error) {
 	return rp.IntegerValue()
 }
 
+// GetDel gets the value of key and deletes the key.
+// Bulk reply: the value of key, or nil when key does not exist.
+func (r *Redis) GetDel(key string) ([]byte, error) {
+	rp, err := r.ExecuteCommand("GETDEL", key)
+	if err != nil {
+		return nil, err
+	}
+	return rp.BytesValue()
+}
+
+// GetEx gets the value of key and sets its expiration in seconds or milliseconds,
+// or removes the expiration if persist is true, the expiration is unchanged if none of them is given.
+// Bulk reply: the value of key, or nil when key does not exist.
+func (r *Redis) GetEx(key string, seconds, milliseconds int, persist bool) ([]byte, error) {
+	args := packArgs("GETEX", key)
+	if seconds > 0 {
+		args = append(args, "EX", seconds)
+	}
+	if milliseconds > 0 {
+		args = append(args, "PX", milliseconds)
+	}
+	if persist {
+		args = append(args, "PERSIST")
+	}
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	return rp.BytesValue()
+}
+
 // GetRange returns the substring of the string value stored at key,
 // determined by the offsets start and end (both are inclusive).
 // Negative offsets can be used in order to provide an offset starting from the end of the string.
@@ -225,6 +298,37 @@ func (r *Redis) Set(key, value string, seconds, milliseconds int, mustExists, mu
 	return rp.OKValue()
 }
 
+// SetGet sets key like Set and returns the old value stored at key, nil if key did not exist.
+// The TTL of key is kept if keepTTL is true and no expiration is given.
+// An error is returned when key exists but does not hold a string value.
+func (r *Redis) SetGet(key, value string, seconds, milliseconds int, keepTTL bool) ([]byte, error) {
+	args := packArgs("SET", key, value)
+	if seconds > 0 {
+		args = append(args, "EX", seconds)
+	}
+	if milliseconds > 0 {
+		args = append(args, "PX", milliseconds)
+	}
+	if keepTTL && seconds <= 0 && milliseconds <= 0 {
+		args = append(args, "KEEPTTL")
+	}
+	args = append(args, "GET")
+	rp, err := r.ExecuteCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	return rp.BytesValue()
+}
+
+// SetKeepTTL sets key to hold the string value, keeping the TTL associated with key.
+func (r *Redis) SetKeepTTL(key, value string) error {
+	rp, err := r.ExecuteCommand("SET", key, value, "KEEPTTL")
+	if err != nil {
+		return err
+	}
+	return rp.OKValue()
+}
+
 // SimpleSet do SET key value, no other arguments.
 func (r *Redis) SimpleSet(key, value string) error {
 	return r.Set(key, value, 0, 0, false, false)
@@ -42,6 +42,27 @@ func TestBitCount(t *testing.T) {
 	}
 }
 
+func TestBitField(t *testing.T) {
+	r.Del("key")
+	result, err := r.BitField("key", "INCRBY", "u8", "#0", 255, "GET", "u8", 0, "SET", "i8", 8, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 3 || *result[0] != 255 || *result[1] != 255 || *result[2] != 0 {
+		t.Fatal(result)
+	}
+	result, err = r.BitField("key", "INCRBY", "u8", 0, 1, "OVERFLOW", "SAT", "INCRBY", "i8", 8, -200, "OVERFLOW", "FAIL", "INCRBY", "u8", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 3 || *result[0] != 0 || *result[1] != -128 || result[2] != nil {
+		t.Error(result)
+	}
+	if _, err := r.BitField("key", "GET", "u64", 0); err == nil {
+		t.Error("u64 accepted")
+	}
+}
+
 func TestBitOp(t *testing.T) {
 	r.Set("key", "value", 0, 0, false, false)
 	if _, err := r.BitOp("NOT", "key2", "key"); err != nil {
@@ -49,6 +70,27 @@ func TestBitOp(t *testing.T) {
 	}
 }
 
+func TestBitPos(t *testing.T) {
+	r.Set("key", "\xff\xf0\x00", 0, 0, false, false)
+	if n, err := r.BitPos("key", 0); err != nil || n != 12 {
+		t.Error(n, err)
+	}
+	if n, _ := r.BitPos("key", 1, 2); n != -1 {
+		t.Error(n)
+	}
+	if n, _ := r.BitPos("key", 0, 0, 0); n != -1 {
+		t.Error(n)
+	}
+	r.Set("key", "\xff", 0, 0, false, false)
+	if n, _ := r.BitPos("key", 0); n != 8 {
+		t.Error(n)
+	}
+	r.Del("key")
+	if n, _ := r.BitPos("key", 1); n != -1 {
+		t.Error(n)
+	}
+}
+
 func TestDecr(t *testing.T) {
 	r.Set("key", "10", 0, 0, false, false)
 	if n, err := r.Decr("key"); err != nil {
@@ -110,6 +152,34 @@ func TestGetBit(t *testing.T) {
 	}
 }
 
+func TestGetDel(t *testing.T) {
+	r.Set("key", "value", 0, 0, false, false)
+	if b, err := r.GetDel("key"); err != nil || string(b) != "value" {
+		t.Error(string(b), err)
+	}
+	if b, err := r.GetDel("key"); err != nil || b != nil {
+		t.Error(b, err)
+	}
+}
+
+func TestGetEx(t *testing.T) {
+	r.Set("key", "value", 0, 0, false, false)
+	if b, err := r.GetEx("key", 100, 0, false); err != nil || string(b) != "value" {
+		t.Error(string(b), err)
+	}
+	if ttl, _ := r.TTL("key"); ttl <= 0 {
+		t.Error(ttl)
+	}
+	r.GetEx("key", 0, 0, true)
+	if ttl, _ := r.TTL("key"); ttl != -1 {
+		t.Error(ttl)
+	}
+	r.Del("key")
+	if b, err := r.GetEx("key", 0, 100000, false); err != nil || b != nil {
+		t.Error(b, err)
+	}
+}
+
 func TestGetRange(t *testing.T) {
 	r.Set("key", "value", 0, 0, false, false)
 	s, err := r.GetRange("key", 0, -1)
@@ -255,6 +325,37 @@ func BenchmarkSet(b *testing.B) {
 	}
 }
 
+func TestSetGet(t *testing.T) {
+	r.Del("key")
+	if b, err := r.SetGet("key", "value", 100, 0, false); err != nil || b != nil {
+		t.Error(b, err)
+	}
+	if b, err := r.SetGet("key", "value2", 0, 0, true); err != nil || string(b) != "value" {
+		t.Error(string(b), err)
+	}
+	if ttl, _ := r.TTL("key"); ttl <= 0 {
+		t.Error(ttl)
+	}
+	r.Del("key")
+	r.LPush("key", "value")
+	if _, err := r.SetGet("key", "value", 0, 0, false); err == nil {
+		t.Error("set a list")
+	}
+}
+
+func TestSetKeepTTL(t *testing.T) {
+	r.Set("key", "value", 100, 0, false, false)
+	if err := r.SetKeepTTL("key", "value2"); err != nil {
+		t.Error(err)
+	}
+	if ttl, _ := r.TTL("key"); ttl <= 0 {
+		t.Error(ttl)
+	}
+	if b, _ := r.Get("key"); string(b) != "value2" {
+		t.Error(string(b))
+	}
+}
+
 func TestSetBit(t *testing.T) {
 	if _, err := r.SetBit("key", 7, 1); err != nil {
 		t.Error(err)
@@ -0,0 +1,364 @@
+package goredis
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Struct mapping of hashes.
+//
+// The exported fields of a struct are mapped to the hash fields by the "redis" tag,
+// the field name is used if there is no tag, and the tag "-" skips the field:
+//  type User struct {
+//  	Name    string    `redis:"name"`
+//  	Age     int       `redis:"age,omitempty"`
+//  	Created time.Time `redis:"created"`
+//  	Tags    []string  `redis:"tags"`
+//  	Cache   string    `redis:"-"`
+//  }
+// Strings, []byte, bools, integers and floats are stored as their text,
+// time.Time is stored in RFC3339 with nanoseconds,
+// a type implementing encoding.TextMarshaler and encoding.TextUnmarshaler is stored as its text,
+// other structs, maps, slices and arrays are stored as JSON.
+// With omitempty, a zero value is not written. Nil pointers are never written.
+
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var structFieldsCache sync.Map // map[reflect.Type][]*structField
+
+func structFields(t reflect.Type) []*structField {
+	if fields, ok := structFieldsCache.Load(t); ok {
+		return fields.([]*structField)
+	}
+	var fields []*structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("redis")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct && f.Type != timeType {
+			// the fields of an embedded struct are promoted
+			for _, sub := range structFields(f.Type) {
+				fields = append(fields, &structField{
+					name:      sub.name,
+					index:     append([]int{i}, sub.index...),
+					omitEmpty: sub.omitEmpty,
+				})
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, &structField{
+			name:      name,
+			index:     []int{i},
+			omitEmpty: strings.Contains(opts, "omitempty"),
+		})
+	}
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func structValue(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return rv, errors.New("nil struct pointer")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return rv, fmt.Errorf("%T is not a struct", v)
+	}
+	return rv, nil
+}
+
+// structArgs returns the field value pairs of the struct v.
+func structArgs(v interface{}) ([]interface{}, error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil, err
+	}
+	var args []interface{}
+	for _, f := range structFields(rv.Type()) {
+		fv, ok := fieldByIndex(rv, f.index, false)
+		if !ok {
+			continue
+		}
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		s, err := formatField(fv)
+		if err != nil {
+			return nil, fmt.Errorf("hash field %s: %v", f.name, err)
+		}
+		args = append(args, f.name, s)
+	}
+	if len(args) == 0 {
+		return nil, errors.New("struct has no field to set")
+	}
+	return args, nil
+}
+
+// fieldByIndex follows the index through embedded struct pointers,
+// nil pointers are allocated if alloc is true.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return v, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).IsZero()
+		}
+	}
+	return false
+}
+
+func formatField(v reflect.Value) (string, error) {
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return "1", nil
+		}
+		return "0", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return "", fmt.Errorf("unsupported type %s", v.Type())
+	}
+	b, err := json.Marshal(v.Interface())
+	return string(b), err
+}
+
+// scanStruct sets the fields of the struct pointer v by the hash field value pairs,
+// the hash fields which are not mapped are ignored.
+func scanStruct(hash map[string]string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("%T is not a struct pointer", v)
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("%T is not a struct pointer", v)
+	}
+	for _, f := range structFields(rv.Type()) {
+		s, ok := hash[f.name]
+		if !ok {
+			continue
+		}
+		fv, _ := fieldByIndex(rv, f.index, true)
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+			fv = fv.Elem()
+		}
+		if err := parseField(s, fv); err != nil {
+			return fmt.Errorf("hash field %s: cannot convert %q to %s: %v", f.name, s, fv.Type(), err)
+		}
+	}
+	return nil
+}
+
+func parseField(s string, v reflect.Value) error {
+	if v.Type() == timeType {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return errors.New("unsupported type")
+	}
+	return json.Unmarshal([]byte(s), v.Addr().Interface())
+}
+
+// StructValue indicates redis reply a hash, such as HGETALL, which is scanned into the struct pointer v.
+// It is useful for the replies of Pipelined and Transaction.
+func (rp *Reply) StructValue(v interface{}) error {
+	hash, err := rp.HashValue()
+	if err != nil {
+		return err
+	}
+	return scanStruct(hash, v)
+}
+
+// HSetStruct sets the fields of the hash stored at key by the fields of the struct v.
+func (r *Redis) HSetStruct(key string, v interface{}) error {
+	args, err := structArgs(v)
+	if err != nil {
+		return err
+	}
+	rp, err := r.ExecuteCommand(append([]interface{}{"HMSET", key}, args...)...)
+	if err != nil {
+		return err
+	}
+	return rp.OKValue()
+}
+
+// HGetAllStruct scans all the fields of the hash stored at key into the struct pointer v.
+// If the key does not exist, v is not changed and false is returned.
+func (r *Redis) HGetAllStruct(key string, v interface{}) (bool, error) {
+	rp, err := r.ExecuteCommand("HGETALL", key)
+	if err != nil {
+		return false, err
+	}
+	hash, err := rp.HashValue()
+	if err != nil {
+		return false, err
+	}
+	if len(hash) == 0 {
+		return false, nil
+	}
+	return true, scanStruct(hash, v)
+}
+
+// HSetStruct sends HMSET of the fields of the struct v in the pipeline.
+func (p *Pipelined) HSetStruct(key string, v interface{}) error {
+	args, err := structArgs(v)
+	if err != nil {
+		return err
+	}
+	return p.Command(append([]interface{}{"HMSET", key}, args...)...)
+}
+
+// HGetAllStruct sends HGETALL in the pipeline, the reply can be scanned by Reply.StructValue.
+func (p *Pipelined) HGetAllStruct(key string) error {
+	return p.Command("HGETALL", key)
+}
+
+// HSetStruct queues HMSET of the fields of the struct v in the transaction.
+func (t *Transaction) HSetStruct(key string, v interface{}) error {
+	args, err := structArgs(v)
+	if err != nil {
+		return err
+	}
+	return t.queue(append([]interface{}{"HMSET", key}, args...)...)
+}
+
+// HGetAllStruct queues HGETALL in the transaction, the reply of Exec can be scanned by Reply.StructValue.
+func (t *Transaction) HGetAllStruct(key string) error {
+	return t.Command("HGETALL", key)
+}
@@ -0,0 +1,133 @@
+package goredis
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type structBase struct {
+	ID int64 `redis:"id"`
+}
+
+type structUser struct {
+	structBase
+	Name     string         `redis:"name"`
+	Nick     string         `redis:"nick,omitempty"`
+	Age      uint8          `redis:"age"`
+	Score    float64        `redis:"score"`
+	Admin    bool           `redis:"admin"`
+	Avatar   []byte         `redis:"avatar"`
+	Created  time.Time      `redis:"created"`
+	Tags     []string       `redis:"tags"`
+	Extra    map[string]int `redis:"extra"`
+	Addr     net.IP         `redis:"addr"`
+	Rank     *int           `redis:"rank"`
+	Untagged string
+	Ignored  string `redis:"-"`
+	internal string
+}
+
+func TestHSetStruct(t *testing.T) {
+	r.Del("key")
+	rank := 3
+	user := &structUser{
+		structBase: structBase{ID: 7},
+		Name:       "alice",
+		Age:        30,
+		Score:      1.5,
+		Admin:      true,
+		Avatar:     []byte{0, 1, 2},
+		Created:    time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+		Tags:       []string{"a", "b"},
+		Extra:      map[string]int{"x": 1},
+		Addr:       net.ParseIP("10.0.0.1"),
+		Rank:       &rank,
+		Untagged:   "u",
+		Ignored:    "i",
+		internal:   "n",
+	}
+	if err := r.HSetStruct("key", user); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := r.HGetAll("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash["id"] != "7" || hash["admin"] != "1" || hash["tags"] != `["a","b"]` || hash["addr"] != "10.0.0.1" ||
+		hash["Untagged"] != "u" || hash["created"] != "2020-01-02T03:04:05.000000006Z" || hash["rank"] != "3" {
+		t.Error(hash)
+	}
+	if _, ok := hash["nick"]; ok {
+		t.Fail()
+	}
+	if _, ok := hash["Ignored"]; ok {
+		t.Fail()
+	}
+	var got structUser
+	if ok, err := r.HGetAllStruct("key", &got); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if got.ID != 7 || got.Name != "alice" || got.Age != 30 || got.Score != 1.5 || !got.Admin ||
+		string(got.Avatar) != "\x00\x01\x02" || !got.Created.Equal(user.Created) || len(got.Tags) != 2 ||
+		got.Extra["x"] != 1 || !got.Addr.Equal(user.Addr) || got.Rank == nil || *got.Rank != 3 ||
+		got.Untagged != "u" || got.Ignored != "" {
+		t.Errorf("%+v", got)
+	}
+	if ok, err := r.HGetAllStruct("nokey", &got); err != nil || ok {
+		t.Error(ok, err)
+	}
+}
+
+func TestHGetAllStructMismatch(t *testing.T) {
+	r.Del("key")
+	r.HSet("key", "age", "old")
+	var user structUser
+	_, err := r.HGetAllStruct("key", &user)
+	if err == nil || !strings.Contains(err.Error(), "hash field age") {
+		t.Error(err)
+	}
+	if _, err := r.HGetAllStruct("key", user); err == nil {
+		t.Fail()
+	}
+	if err := r.HSetStruct("key", 1); err == nil {
+		t.Fail()
+	}
+	if err := r.HSetStruct("key", struct{ C chan int }{}); err == nil {
+		t.Fail()
+	}
+}
+
+func TestStructPipelineTransaction(t *testing.T) {
+	r.Del("key")
+	p, err := r.Pipelining()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.HSetStruct("key", &structUser{Name: "bob"})
+	p.HGetAllStruct("key")
+	rps, err := p.ReceiveAll()
+	p.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var user structUser
+	if err := rps[1].StructValue(&user); err != nil || user.Name != "bob" {
+		t.Error(user, err)
+	}
+	tx, err := r.Transaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+	tx.HSetStruct("key", &structUser{Name: "carol"})
+	tx.HGetAllStruct("key")
+	rps, err = tx.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rps[1].StructValue(&user); err != nil || user.Name != "carol" {
+		t.Error(user, err)
+	}
+}
@@ -0,0 +1,271 @@
+package goredis
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"common/goredis/internal/backoff"
+)
+
+// SubscriberConfig is the parameters of a Subscriber.
+// The connection is rebuilt with an exponential backoff between MinBackoff and MaxBackoff.
+// If PingInterval is greater than 0, a PING is sent every PingInterval,
+// and the connection is considered dead if nothing is received for PingInterval plus the client timeout.
+// Messages is the buffer size of the messages channel.
+// OnConnect is called after every (re)subscription, OnDisconnect is called with the error which broke the connection.
+type SubscriberConfig struct {
+	MinBackoff   time.Duration
+	MaxBackoff   time.Duration
+	PingInterval time.Duration
+	Messages     int
+	OnConnect    func()
+	OnDisconnect func(err error)
+}
+
+// Subscriber is a PubSub which reconnects and subscribes all its channels and patterns again
+// when the connection is broken.
+type Subscriber struct {
+	redis *Redis
+	cfg   SubscriberConfig
+
+	mutex    sync.Mutex
+	pubsub   *PubSub
+	channels map[string]bool
+	patterns map[string]bool
+	closed   bool
+
+	messages chan *Message
+	quit     chan struct{}
+	done     chan struct{}
+}
+
+// ErrSubscriberClosed is returned by the methods of a closed Subscriber.
+var ErrSubscriberClosed = errors.New("subscriber closed")
+
+// Subscriber new a Subscriber which runs in background until Close.
+// The received messages are sent to the channel of Messages.
+// If cfg is nil, the default backoff is 100ms to 10s, and PING is sent every 30s.
+func (r *Redis) Subscriber(cfg *SubscriberConfig) *Subscriber {
+	s := &Subscriber{
+		redis:    r,
+		channels: make(map[string]bool),
+		patterns: make(map[string]bool),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if cfg != nil {
+		s.cfg = *cfg
+	} else {
+		s.cfg.PingInterval = 30 * time.Second
+	}
+	if s.cfg.MinBackoff <= 0 {
+		s.cfg.MinBackoff = 100 * time.Millisecond
+	}
+	if s.cfg.MaxBackoff < s.cfg.MinBackoff {
+		s.cfg.MaxBackoff = 10 * time.Second
+	}
+	if s.cfg.Messages <= 0 {
+		s.cfg.Messages = 100
+	}
+	s.messages = make(chan *Message, s.cfg.Messages)
+	go s.run()
+	return s
+}
+
+// Messages returns the channel of the received messages, including the subscribe confirmations.
+// It is closed after Close.
+func (s *Subscriber) Messages() <-chan *Message {
+	return s.messages
+}
+
+// Channels returns the channels to subscribe.
+func (s *Subscriber) Channels() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return mapKeys(s.channels)
+}
+
+// Patterns returns the patterns to subscribe.
+func (s *Subscriber) Patterns() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return mapKeys(s.patterns)
+}
+
+// Subscribe channel [channel ...]
+// The channels are subscribed again after reconnecting.
+func (s *Subscriber) Subscribe(channels ...string) error {
+	return s.command(s.channels, true, "SUBSCRIBE", channels)
+}
+
+// PSubscribe pattern [pattern ...]
+// The patterns are subscribed again after reconnecting.
+func (s *Subscriber) PSubscribe(patterns ...string) error {
+	return s.command(s.patterns, true, "PSUBSCRIBE", patterns)
+}
+
+// UnSubscribe channel [channel ...]
+func (s *Subscriber) UnSubscribe(channels ...string) error {
+	return s.command(s.channels, false, "UNSUBSCRIBE", channels)
+}
+
+// PUnSubscribe pattern [pattern ...]
+func (s *Subscriber) PUnSubscribe(patterns ...string) error {
+	return s.command(s.patterns, false, "PUNSUBSCRIBE", patterns)
+}
+
+// command records the subscription and sends it if connected,
+// a send failure is left to the receiving goroutine which reconnects.
+func (s *Subscriber) command(set map[string]bool, add bool, name string, items []string) error {
+	if len(items) == 0 {
+		return errors.New("no channel or pattern")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return ErrSubscriberClosed
+	}
+	for _, item := range items {
+		if add {
+			set[item] = true
+		} else {
+			delete(set, item)
+		}
+	}
+	if s.pubsub != nil {
+		s.pubsub.conn.SendCommand(packArgs(name, items)...)
+	}
+	return nil
+}
+
+// Close unsubscribes everything and closes the connection, the messages channel is closed too.
+func (s *Subscriber) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return ErrSubscriberClosed
+	}
+	s.closed = true
+	close(s.quit)
+	if s.pubsub != nil {
+		s.pubsub.conn.Conn.Close()
+	}
+	s.mutex.Unlock()
+	<-s.done
+	return nil
+}
+
+func (s *Subscriber) run() {
+	defer close(s.done)
+	defer close(s.messages)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-s.quit:
+				return
+			case <-time.After(backoff.Exponential(s.cfg.MinBackoff, s.cfg.MaxBackoff, attempt-1)):
+			}
+		}
+		p, err := s.connect()
+		if err == ErrSubscriberClosed {
+			return
+		}
+		if err != nil {
+			if s.cfg.OnDisconnect != nil {
+				s.cfg.OnDisconnect(err)
+			}
+			continue
+		}
+		attempt = 0
+		if s.cfg.OnConnect != nil {
+			s.cfg.OnConnect()
+		}
+		err = s.receive(p)
+		s.mutex.Lock()
+		s.pubsub = nil
+		closed := s.closed
+		s.mutex.Unlock()
+		p.Close()
+		if closed {
+			return
+		}
+		if s.cfg.OnDisconnect != nil {
+			s.cfg.OnDisconnect(err)
+		}
+	}
+}
+
+// connect gets a new connection and subscribes all the channels and patterns.
+func (s *Subscriber) connect() (*PubSub, error) {
+	p, err := s.redis.PubSub()
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		p.Close()
+		return nil, ErrSubscriberClosed
+	}
+	if len(s.channels) > 0 {
+		err = p.Subscribe(mapKeys(s.channels)...)
+	}
+	if err == nil && len(s.patterns) > 0 {
+		err = p.PSubscribe(mapKeys(s.patterns)...)
+	}
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	s.pubsub = p
+	return p, nil
+}
+
+func (s *Subscriber) receive(p *PubSub) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	if s.cfg.PingInterval > 0 {
+		go s.ping(p, stop)
+	}
+	for {
+		if s.cfg.PingInterval > 0 {
+			p.conn.Conn.SetReadDeadline(time.Now().Add(s.cfg.PingInterval + s.redis.timeout))
+		}
+		m, err := p.ReceiveMessage()
+		if err != nil {
+			return err
+		}
+		if m.Kind == "pong" {
+			continue
+		}
+		select {
+		case s.messages <- m:
+		case <-s.quit:
+			return ErrSubscriberClosed
+		}
+	}
+}
+
+func (s *Subscriber) ping(p *PubSub, stop chan struct{}) {
+	ticker := time.NewTicker(s.cfg.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.mutex.Lock()
+			p.Ping("")
+			s.mutex.Unlock()
+		}
+	}
+}
+
+func mapKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
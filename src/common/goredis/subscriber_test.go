@@ -0,0 +1,106 @@
+package goredis
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubscriber(t *testing.T) {
+	var connects, disconnects int32
+	sub := r.Subscriber(&SubscriberConfig{
+		MinBackoff: 10 * time.Millisecond,
+		OnConnect: func() {
+			atomic.AddInt32(&connects, 1)
+		},
+		OnDisconnect: func(err error) {
+			atomic.AddInt32(&disconnects, 1)
+		},
+	})
+	if err := sub.Subscribe("channel"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.PSubscribe("news.*"); err != nil {
+		t.Fatal(err)
+	}
+	receive := func(kind string) *Message {
+		for {
+			select {
+			case m := <-sub.Messages():
+				if m.Kind == kind {
+					return m
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("no " + kind + " received")
+			}
+		}
+	}
+	receive("psubscribe")
+	r.Publish("channel", "one")
+	if m := receive("message"); m.Channel != "channel" || m.Payload != "one" {
+		t.Error(m)
+	}
+	r.Publish("news.china", "two")
+	if m := receive("pmessage"); m.Pattern != "news.*" || m.Channel != "news.china" || m.Payload != "two" {
+		t.Error(m)
+	}
+
+	// break the connection, the subscriptions should be rebuilt
+	sub.mutex.Lock()
+	sub.pubsub.conn.Conn.Close()
+	sub.mutex.Unlock()
+	waitFor(t, func() bool {
+		return atomic.LoadInt32(&connects) == 2 && atomic.LoadInt32(&disconnects) == 1
+	})
+	receive("psubscribe")
+	r.Publish("channel", "three")
+	if m := receive("message"); m.Payload != "three" {
+		t.Error(m)
+	}
+
+	if err := sub.UnSubscribe("channel"); err != nil {
+		t.Error(err)
+	}
+	if m := receive("unsubscribe"); m.Channel != "channel" {
+		t.Error(m)
+	}
+	if channels := sub.Channels(); len(channels) != 0 {
+		t.Error(channels)
+	}
+	if err := sub.Close(); err != nil {
+		t.Error(err)
+	}
+	for range sub.Messages() {
+	}
+	if err := sub.Subscribe("channel"); err != ErrSubscriberClosed {
+		t.Error(err)
+	}
+}
+
+func TestSubscriberPing(t *testing.T) {
+	l := hangingServer(t)
+	defer l.Close()
+	redis, err := Dial(&DialConfig{Address: l.Addr().String(), Timeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redis.ClosePool()
+	disconnected := make(chan error, 10)
+	sub := redis.Subscriber(&SubscriberConfig{
+		PingInterval: 20 * time.Millisecond,
+		MinBackoff:   time.Second,
+		OnDisconnect: func(err error) {
+			disconnected <- err
+		},
+	})
+	defer sub.Close()
+	sub.Subscribe("channel")
+	select {
+	case err := <-disconnected:
+		if err == nil {
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		t.Error("dead connection not detected")
+	}
+}
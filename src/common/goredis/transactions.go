@@ -2,6 +2,20 @@ package goredis
 
 import (
 	"errors"
+	"fmt"
+	"time"
+
+	"common/goredis/internal/backoff"
+)
+
+// ErrTxAborted is returned when EXEC is aborted because a watched key was changed.
+var ErrTxAborted = errors.New("transaction aborted")
+
+// Default retries of Redis.Watch.
+const (
+	DefaultWatchRetries    = 10
+	DefaultWatchMinBackoff = time.Millisecond
+	DefaultWatchMaxBackoff = 100 * time.Millisecond
 )
 
 // Transaction doc: http://redis.io/topics/transactions
@@ -10,86 +24,89 @@ import (
 // so everything you can do with a Redis transaction, you can also do with a script,
 // and usually the script will be both simpler and faster.
 type Transaction struct {
-	redis *Redis
-	conn  *connection
+	redis  *Redis
+	conn   *connection
+	broken bool
 }
 
 // Transaction new a *transaction from *redis
+// If *redis is a WithContext view, every command of the transaction is bounded by the context.
 func (r *Redis) Transaction() (*Transaction, error) {
-	c, err := r.pool.Get()
+	c, err := r.pool.GetContext(r.ctx)
 	if err != nil {
 		return nil, err
 	}
-	if err := c.SendCommand("MULTI"); err != nil {
-		r.pool.Put(c)
+	if _, err := c.execute(r.ctx, "MULTI"); err != nil {
+		r.pool.Discard(c)
 		return nil, err
 	}
-	if _, err := c.RecvReply(); err != nil {
-		r.pool.Put(c)
-		return nil, err
-	}
-	return &Transaction{r, c}, nil
+	return &Transaction{redis: r, conn: c}, nil
 }
 
 // Close closes the transaction, put the under connection back for reuse
+// The connection is closed instead if a network error happened.
 func (t *Transaction) Close() {
-	t.redis.pool.Put(t.conn)
+	if t.broken {
+		t.redis.pool.Discard(t.conn)
+	} else {
+		t.redis.pool.Put(t.conn)
+	}
+}
+
+func (t *Transaction) execute(args ...interface{}) (*Reply, error) {
+	rp, err := t.conn.execute(t.redis.ctx, args...)
+	if err != nil {
+		t.broken = true
+	}
+	return rp, err
 }
 
 // Discard flushes all previously queued commands in a transaction
 // and restores the connection state to normal.
 // If WATCH was used, DISCARD unwatches all keys.
 func (t *Transaction) Discard() error {
-	if err := t.conn.SendCommand("DISCARD"); err != nil {
-		return err
-	}
-	_, err := t.conn.RecvReply()
+	_, err := t.execute("DISCARD")
 	return err
 }
 
 // Watch marks the given keys to be watched for conditional execution of a transaction.
 func (t *Transaction) Watch(keys ...string) error {
 	args := packArgs("WATCH", keys)
-	if err := t.conn.SendCommand(args...); err != nil {
-		return err
-	}
-	_, err := t.conn.RecvReply()
+	_, err := t.execute(args...)
 	return err
 }
 
 // UnWatch flushes all the previously watched keys for a transaction.
 // If you call EXEC or DISCARD, there's no need to manually call UNWATCH.
 func (t *Transaction) UnWatch() error {
-	if err := t.conn.SendCommand("UNWATCH"); err != nil {
-		return err
-	}
-	_, err := t.conn.RecvReply()
+	_, err := t.execute("UNWATCH")
 	return err
 }
 
 // Exec executes all previously queued commands in a transaction
 // and restores the connection state to normal.
 // When using WATCH, EXEC will execute commands only if the watched keys were not modified,
-// allowing for a check-and-set mechanism.
+// allowing for a check-and-set mechanism, ErrTxAborted is returned otherwise.
 func (t *Transaction) Exec() ([]*Reply, error) {
-	if err := t.conn.SendCommand("EXEC"); err != nil {
-		return nil, err
-	}
-	rp, err := t.conn.RecvReply()
+	rp, err := t.execute("EXEC")
 	if err != nil {
 		return nil, err
 	}
+	if rp.isNilMulti() {
+		return nil, ErrTxAborted
+	}
 	return rp.MultiValue()
 }
 
 // Command send raw redis command to redis server
 // and redis will return QUEUED back
 func (t *Transaction) Command(args ...interface{}) error {
-	args2 := packArgs(args...)
-	if err := t.conn.SendCommand(args2...); err != nil {
-		return err
-	}
-	rp, err := t.conn.RecvReply()
+	return t.queue(packArgs(args...)...)
+}
+
+// queue sends the command as is, unlike Command empty strings are kept.
+func (t *Transaction) queue(args ...interface{}) error {
+	rp, err := t.execute(args...)
 	if err != nil {
 		return err
 	}
@@ -102,3 +119,129 @@ func (t *Transaction) Command(args ...interface{}) error {
 	}
 	return nil
 }
+
+// WatchConfig is the retry config of Redis.Watch.
+// The transaction is retried up to MaxRetries times if it is aborted,
+// with an exponential backoff between MinBackoff and MaxBackoff.
+// A negative MaxRetries disables the retries.
+type WatchConfig struct {
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// WithWatchConfig returns a view of the client whose Watch retries by cfg,
+// the zero fields of cfg take the default values.
+func (r *Redis) WithWatchConfig(cfg *WatchConfig) *Redis {
+	c := WatchConfig{}
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = DefaultWatchRetries
+	}
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = DefaultWatchMinBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = DefaultWatchMaxBackoff
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		c.MaxBackoff = c.MinBackoff
+	}
+	r2 := *r
+	r2.watch = &c
+	return &r2
+}
+
+// Tx is the connection of a Redis.Watch, on which the keys are watched.
+// The commands of the embedded Redis are sent on the connection,
+// so the values read by them are the ones checked by EXEC.
+// The writes are queued in a TxPipeline of Tx and sent by its Exec.
+type Tx struct {
+	*Redis
+	conn   *connection
+	broken bool
+}
+
+func (t *Tx) execute(args ...interface{}) (*Reply, error) {
+	rp, err := t.conn.execute(t.ctx, args...)
+	if err != nil {
+		t.broken = true
+	}
+	return rp, err
+}
+
+// Watch implements the optimistic locking of WATCH, MULTI and EXEC.
+// The keys are watched on a connection, and fn runs with the Tx of the connection,
+// fn reads the keys by Tx and queues the writes in a TxPipeline of Tx:
+//
+//	err := client.Watch(func(tx *Tx) error {
+//		n, err := tx.Get("key")
+//		if err != nil {
+//			return err
+//		}
+//		p := tx.TxPipeline()
+//		p.Set("key", next(n), 0, 0, false, false)
+//		return p.Exec()
+//	}, "key")
+//
+// If fn returns ErrTxAborted, which means a watched key was changed before EXEC,
+// fn runs again after a backoff, up to the retries of WithWatchConfig, DefaultWatchRetries by default.
+// Other errors of fn are returned as is.
+// For a cluster client, the keys must be in the same slot.
+func (r *Redis) Watch(fn func(tx *Tx) error, keys ...string) error {
+	cfg := r.watch
+	if cfg == nil {
+		cfg = r.WithWatchConfig(nil).watch
+	}
+	for attempt := 0; ; attempt++ {
+		err := r.watchOnce(fn, keys)
+		if !errors.Is(err, ErrTxAborted) || cfg.MaxRetries < 0 || attempt >= cfg.MaxRetries {
+			return err
+		}
+		if err := sleepContext(r.ctx, backoff.Exponential(cfg.MinBackoff, cfg.MaxBackoff, attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Redis) watchOnce(fn func(tx *Tx) error, keys []string) error {
+	pool := r.pool
+	if r.cluster != nil && len(keys) > 0 {
+		slot := KeySlot(keys[0])
+		node := r.cluster.slotNode(slot)
+		if node == nil {
+			return fmt.Errorf("no cluster node serves slot %d", slot)
+		}
+		pool = node.pool
+	}
+	c, err := pool.GetContext(r.ctx)
+	if err != nil {
+		return err
+	}
+	view := *r
+	tx := &Tx{Redis: &view, conn: c}
+	view.tx = tx
+	defer func() {
+		// the keys are still watched if fn did not run EXEC
+		if !tx.broken {
+			tx.execute("UNWATCH")
+		}
+		if tx.broken {
+			pool.Discard(c)
+		} else {
+			pool.Put(c)
+		}
+	}()
+	if len(keys) > 0 {
+		rp, err := tx.execute(packArgs("WATCH", keys)...)
+		if err != nil {
+			return err
+		}
+		if err := rp.OKValue(); err != nil {
+			return err
+		}
+	}
+	return fn(tx)
+}
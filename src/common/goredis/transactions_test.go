@@ -1,6 +1,9 @@
 package goredis
 
 import (
+	"errors"
+	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -68,3 +71,59 @@ func TestDiscard(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestRedisWatch(t *testing.T) {
+	r.Del("counter")
+	client := r.WithWatchConfig(&WatchConfig{MaxRetries: 1000})
+	incr := func(tx *Tx) error {
+		value, err := tx.Get("counter")
+		if err != nil {
+			return err
+		}
+		n, _ := strconv.Atoi(string(value))
+		p := tx.TxPipeline()
+		p.Set("counter", strconv.Itoa(n+1), 0, 0, false, false)
+		return p.Exec()
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := client.Watch(incr, "counter"); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if value, _ := r.Get("counter"); string(value) != "50" {
+		t.Error(string(value))
+	}
+}
+
+func TestRedisWatchAborted(t *testing.T) {
+	calls := 0
+	modify := func(tx *Tx) error {
+		calls++
+		if _, err := tx.Get("key"); err != nil {
+			return err
+		}
+		r.Incr("key")
+		p := tx.TxPipeline()
+		p.Set("key", "value", 0, 0, false, false)
+		return p.Exec()
+	}
+	if err := r.WithWatchConfig(&WatchConfig{MaxRetries: -1}).Watch(modify, "key"); err != ErrTxAborted || calls != 1 {
+		t.Error(err, calls)
+	}
+	calls = 0
+	if err := r.WithWatchConfig(&WatchConfig{MaxRetries: 2}).Watch(modify, "key"); err != ErrTxAborted || calls != 3 {
+		t.Error(err, calls)
+	}
+	failed := errors.New("failed")
+	if err := r.Watch(func(tx *Tx) error { return failed }, "key"); err != failed {
+		t.Error(err)
+	}
+}
@@ -1,6 +1,7 @@
 package gotcp
 
 import (
+	"crypto/tls"
 	"mae_proj/MAE/common/logging"
 	"net"
 	"sync"
@@ -44,6 +45,21 @@ func (s *Client) Start(hostAndPort string) bool {
 	return true
 }
 
+// DialTLS starts service over TLS by config, the handshake is done before OnConnect.
+// For mutual TLS, config.Certificates has the client certificate.
+func (s *Client) DialTLS(hostAndPort string, config *tls.Config) bool {
+	dialer := &net.Dialer{Timeout: defaultHandshakeTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", hostAndPort, config)
+	if err != nil {
+		logging.Error("DialTLS failed,hostAndPort=%s,err=%v", hostAndPort, err)
+		return false
+	}
+
+	s.Conn = newConn(conn, s.cw)
+	s.Conn.Do()
+	return true
+}
+
 // Stop stops service
 func (s *Client) Stop() {
 	close(s.cw.exitChan)
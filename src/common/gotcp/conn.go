@@ -2,6 +2,8 @@ package gotcp
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"io"
 
@@ -18,32 +20,45 @@ var (
 	ErrConnClosing   = errors.New("use of closed network connection")
 	ErrWriteBlocking = errors.New("write packet was blocking")
 	ErrReadBlocking  = errors.New("read packet was blocking")
+	ErrSlowConsumer  = errors.New("send queue of slow consumer is full")
 )
 
 const defaultBufferSize = 16 * 1024
 const defaultOutputBufferTimeout = 250 * time.Millisecond
+const defaultHandshakeTimeout = 10 * time.Second
+const defaultReadTimeout = 180 * time.Second
+const defaultWriteTimeout = 20 * time.Second
 
 // Conn exposes a set of callbacks for the various events that occur on a connection
 type Conn struct {
 	Owner                interface{}
 	srv                  *ConnWraper
-	conn                 *net.TCPConn  // the raw connection
+	conn                 net.Conn      // the raw connection, *net.TCPConn or *tls.Conn
 	extraData            string        // to save extra data
 	closeOnce            sync.Once     // close the conn, once, per instance
 	closeFlag            int32         // close flag
 	closeChan            chan struct{} // close chanel
+	readStopped          chan struct{} //读循环为Shutdown停止后关闭，不再有新收到的包
+	handled              chan struct{} //读循环停止后收到的包都交给OnMessage后关闭
 	packetSendChan       chan Packet   // packet send chanel
+	sendSignal           chan struct{} //AsyncWritePacket入队后通知写循环
 	packetReceiveChan    chan Packet   // packeet receive chanel
 	tickTime             int64         //上次心跳时间
+	handling             int32         //正在处理的包数，Shutdown等它为0
+	sending              int32         //发送队列里和正在写入Writer的包数
+	dropped              uint64        //发送队列满时丢弃的包数
 	needHeartBeat        bool
 	hbSendInterval       int64 //每隔多久发一次心跳，同时检测是否超时
 	hbTimeout            int64
 	UnCompleteReadBuffer []byte
+	resyncing            bool //StreamProtocol正在丢弃数据找下一个header，一次重新同步只记一次
 	Reader               *bufio.Reader
 	Writer               *bufio.Writer
 	OutputBufferTimeout  time.Duration
 	LenBuf               [4]byte
 	LenSlice             []byte
+	attrMutex            sync.RWMutex
+	attrs                map[string]interface{} // the attributes set by SetAttr
 	sync.RWMutex
 }
 
@@ -62,12 +77,20 @@ type ConnCallback interface {
 }
 
 // newConn returns a wrapper of raw conn
-func newConn(conn *net.TCPConn, srv *ConnWraper) *Conn {
+func newConn(conn net.Conn, srv *ConnWraper) *Conn {
+	//写循环在锁内非阻塞地取发送队列，所以队列至少要有一个位置
+	sendLimit := srv.config.PacketSendChanLimit
+	if sendLimit < 1 {
+		sendLimit = 1
+	}
 	c := &Conn{
 		srv:                 srv,
 		conn:                conn,
 		closeChan:           make(chan struct{}),
-		packetSendChan:      make(chan Packet, srv.config.PacketSendChanLimit),
+		readStopped:         make(chan struct{}),
+		handled:             make(chan struct{}),
+		packetSendChan:      make(chan Packet, sendLimit),
+		sendSignal:          make(chan struct{}, 1),
 		packetReceiveChan:   make(chan Packet, srv.config.PacketReceiveChanLimit),
 		tickTime:            time.Now().Unix(),
 		needHeartBeat:       srv.needHeartBeat,
@@ -82,7 +105,7 @@ func newConn(conn *net.TCPConn, srv *ConnWraper) *Conn {
 }
 
 func (c *Conn) ResetTick() {
-	c.tickTime = time.Now().Unix()
+	atomic.StoreInt64(&c.tickTime, time.Now().Unix())
 }
 
 // GetExtraData gets the extra data from the Conn
@@ -100,17 +123,99 @@ func (c *Conn) PutExtraData(data string) {
 	c.extraData = data
 }
 
-// GetRawConn returns the raw net.TCPConn from the Conn
-func (c *Conn) GetRawConn() *net.TCPConn {
+// SetAttr sets the attribute key to value
+func (c *Conn) SetAttr(key string, value interface{}) {
+	c.attrMutex.Lock()
+	defer c.attrMutex.Unlock()
+	if c.attrs == nil {
+		c.attrs = make(map[string]interface{})
+	}
+	c.attrs[key] = value
+}
+
+// GetAttr returns the attribute key, false if it is not set
+func (c *Conn) GetAttr(key string) (interface{}, bool) {
+	c.attrMutex.RLock()
+	defer c.attrMutex.RUnlock()
+	value, ok := c.attrs[key]
+	return value, ok
+}
+
+// DelAttr deletes the attribute key
+func (c *Conn) DelAttr(key string) {
+	c.attrMutex.Lock()
+	defer c.attrMutex.Unlock()
+	delete(c.attrs, key)
+}
+
+// GetAttrString returns the attribute key, false if it is not set or not a string
+func (c *Conn) GetAttrString(key string) (string, bool) {
+	value, _ := c.GetAttr(key)
+	s, ok := value.(string)
+	return s, ok
+}
+
+// GetAttrInt64 returns the attribute key, false if it is not set or not an int64
+func (c *Conn) GetAttrInt64(key string) (int64, bool) {
+	value, _ := c.GetAttr(key)
+	n, ok := value.(int64)
+	return n, ok
+}
+
+// GetAttrBool returns the attribute key, false if it is not set or not a bool
+func (c *Conn) GetAttrBool(key string) (bool, bool) {
+	value, _ := c.GetAttr(key)
+	b, ok := value.(bool)
+	return b, ok
+}
+
+// GetRawConn returns the raw connection from the Conn, a *net.TCPConn or a *tls.Conn
+func (c *Conn) GetRawConn() net.Conn {
 	return c.conn
 }
 
+// ConnectionState returns the TLS state of the Conn, false if it is not a TLS connection
+func (c *Conn) ConnectionState() (tls.ConnectionState, bool) {
+	tlsConn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	return tlsConn.ConnectionState(), true
+}
+
+// PeerCertificates returns the certificates sent by the peer, the leaf first,
+// nil if it is not a TLS connection or the peer has no certificate
+func (c *Conn) PeerCertificates() []*x509.Certificate {
+	state, ok := c.ConnectionState()
+	if !ok {
+		return nil
+	}
+	return state.PeerCertificates
+}
+
+// PeerIdentity returns the identity of the peer certificate of mutual TLS,
+// the common name, or the first DNS name if the common name is empty, "" if the peer has no certificate
+func (c *Conn) PeerIdentity() string {
+	certs := c.PeerCertificates()
+	if len(certs) == 0 {
+		return ""
+	}
+	if certs[0].Subject.CommonName != "" {
+		return certs[0].Subject.CommonName
+	}
+	if len(certs[0].DNSNames) > 0 {
+		return certs[0].DNSNames[0]
+	}
+	return ""
+}
+
 // Close closes the connection
 func (c *Conn) Close() {
 	c.closeOnce.Do(func() {
 		atomic.StoreInt32(&c.closeFlag, 1)
 		close(c.closeChan)
 		c.conn.Close()
+		c.srv.untrack(c)
 		c.srv.callback.OnClose(c)
 	})
 }
@@ -120,6 +225,36 @@ func (c *Conn) IsClosed() bool {
 	return atomic.LoadInt32(&c.closeFlag) == 1
 }
 
+// drained reports whether the read loop is stopped by Shutdown, and every received packet is handled,
+// including the handlers of RPC
+func (c *Conn) drained() bool {
+	select {
+	case <-c.handled:
+		return atomic.LoadInt32(&c.handling) == 0
+	default:
+		return false
+	}
+}
+
+// Dropped returns the number of the packets dropped by the overflow of the send queue
+func (c *Conn) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// drop counts a packet dropped
+func (c *Conn) drop() {
+	atomic.AddUint64(&c.dropped, 1)
+	atomic.AddUint64(&c.srv.dropped, 1)
+}
+
+// flush writes the buffered data of Writer before deadline, no deadline if it is zero
+func (c *Conn) flush(deadline time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+	c.conn.SetWriteDeadline(deadline)
+	return c.Writer.Flush()
+}
+
 // AsyncReadPacket async reads a packet, this method will never block
 func (c *Conn) AsyncReadPacket(timeout time.Duration) (Packet, error) {
 	if c.IsClosed() {
@@ -149,17 +284,24 @@ func (c *Conn) AsyncReadPacket(timeout time.Duration) (Packet, error) {
 	}
 }
 
+// SyncWritePacket writes p and flushes it at once, the packets queued by AsyncWritePacket before are written first,
+// so the packets of both are written in the order of the calls.
 //同步发送，异步发送太慢
 func (c *Conn) SyncWritePacket(p Packet) error {
 	if c.IsClosed() {
 		return ErrConnClosing
 	}
-	c.conn.SetWriteDeadline(time.Now().Add(time.Second * 20))
 	packetstr := p.Serialize()
 
 	c.Lock()
-	_, err := c.Writer.Write(packetstr)
-	c.Writer.Flush()
+	c.conn.SetWriteDeadline(time.Now().Add(c.srv.config.writeTimeout()))
+	err := c.writeQueued()
+	if err == nil {
+		_, err = c.Writer.Write(packetstr)
+	}
+	if err == nil {
+		err = c.Writer.Flush()
+	}
 	c.Unlock()
 	if err != nil {
 		logging.Error("con  SyncWritePacket write found a error: %v", err)
@@ -168,49 +310,100 @@ func (c *Conn) SyncWritePacket(p Packet) error {
 	return nil
 }
 
-// AsyncWritePacket async writes a packet, this method will never block
+// AsyncWritePacket queues a packet which is written by the write loop,
+// it never blocks on the connection but may wait for the room of the send queue of Config.PacketSendChanLimit.
+// When the queue is full, Config.SendOverflow decides:
+// OverflowBlock waits for timeout, or Config.WriteTimeOut if timeout is 0, and returns ErrWriteBlocking;
+// OverflowDropOldest drops the oldest queued packet; OverflowDisconnect closes the connection and returns ErrSlowConsumer.
+// The dropped packets are counted by Dropped.
+//
+// OverflowBlock is the default, so a caller which must not block waits up to WriteTimeOut for a slow consumer
+// unless it passes a short timeout or uses another policy. ConnManager.Broadcast never waits.
 func (c *Conn) AsyncWritePacket(p Packet, timeout time.Duration) error {
+	return c.notify(c.enqueue(p, timeout, true))
+}
+
+// offerPacket queues p as AsyncWritePacket does but never waits, a full queue under OverflowBlock drops p
+func (c *Conn) offerPacket(p Packet) error {
+	return c.notify(c.enqueue(p, 0, false))
+}
+
+// notify wakes up the write loop if a packet is queued without error
+func (c *Conn) notify(err error) error {
+	if err == nil {
+		select {
+		case c.sendSignal <- struct{}{}:
+		default:
+		}
+	}
+	return err
+}
+
+// enqueue puts p in the send queue by the overflow policy, OverflowBlock waits for the room only if wait is true
+func (c *Conn) enqueue(p Packet, timeout time.Duration, wait bool) error {
 	if c.IsClosed() {
 		return ErrConnClosing
 	}
 
-	c.conn.SetWriteDeadline(time.Now().Add(time.Second * 20))
-	packetstr := p.Serialize()
-
-	//写到缓冲区而已
-	c.Lock()
-	_, err := c.Writer.Write(packetstr)
-	c.Unlock()
-
-	if err != nil {
-		logging.Error("con  AsyncWritePacket write found a error: %v", err)
-		return err
+	atomic.AddInt32(&c.sending, 1)
+	select {
+	case c.packetSendChan <- p:
+		return nil
+	default:
 	}
 
-	return nil
-	/*
-		if timeout == 0 {
+	switch c.srv.config.SendOverflow {
+	case OverflowDropOldest:
+		for {
 			select {
 			case c.packetSendChan <- p:
 				return nil
-
-				//default:
-				//return ErrWriteBlocking
+			default:
 			}
-
-		} else {
 			select {
-			case c.packetSendChan <- p:
-				return nil
-
-			case <-c.closeChan:
-				return ErrConnClosing
-
-			case <-time.After(timeout):
+			case <-c.packetSendChan:
+				atomic.AddInt32(&c.sending, -1)
+				c.drop()
+			default:
+				//没有缓冲的队列，丢弃p
+				atomic.AddInt32(&c.sending, -1)
+				c.drop()
 				return ErrWriteBlocking
 			}
 		}
-	*/
+
+	case OverflowDisconnect:
+		atomic.AddInt32(&c.sending, -1)
+		c.drop()
+		logging.Error("conn %s send queue is full, close the slow consumer", c.GetExtraData())
+		c.Close()
+		return ErrSlowConsumer
+
+	default:
+		if !wait {
+			atomic.AddInt32(&c.sending, -1)
+			c.drop()
+			return ErrWriteBlocking
+		}
+		if timeout <= 0 {
+			timeout = c.srv.config.writeTimeout()
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case c.packetSendChan <- p:
+			return nil
+
+		case <-c.closeChan:
+			atomic.AddInt32(&c.sending, -1)
+			return ErrConnClosing
+
+		case <-timer.C:
+			atomic.AddInt32(&c.sending, -1)
+			c.drop()
+			return ErrWriteBlocking
+		}
+	}
 }
 
 // Do it
@@ -218,7 +411,15 @@ func (c *Conn) Do() {
 	if !c.srv.callback.OnConnect(c) {
 		return
 	}
+	c.start()
+}
+
+// start starts the loops of the connection after OnConnect
+func (c *Conn) start() {
 	//c.conn.SetDeadline(time.Now().Add(time.Second * 30))
+	//在启动前Add，Stop的Wait才不会漏掉
+	c.srv.waitGroup.Add(4)
+	c.srv.track(c)
 	go c.handleLoop()
 	go c.readStickPackLoop()
 	//go c.readLoop()
@@ -227,10 +428,15 @@ func (c *Conn) Do() {
 }
 
 func (c *Conn) readStickPackLoop() {
-	c.srv.waitGroup.Add(1)
+	draining := false
 	defer func() {
 		//recover()
-		c.Close()
+		if draining {
+			//Shutdown处理完收到的包后再关闭连接
+			close(c.readStopped)
+		} else {
+			c.Close()
+		}
 		c.srv.waitGroup.Done()
 	}()
 
@@ -246,9 +452,20 @@ func (c *Conn) readStickPackLoop() {
 		case <-c.closeChan:
 			return
 
+		case <-c.srv.draining:
+			draining = true
+			return
+
+		default:
+		}
+		c.conn.SetReadDeadline(time.Now().Add(c.srv.config.readTimeout()))
+		//设置deadline后再检查，Shutdown在close(draining)后设置的过去的deadline不会被上面的覆盖
+		select {
+		case <-c.srv.draining:
+			draining = true
+			return
 		default:
 		}
-		c.conn.SetReadDeadline(time.Now().Add(time.Second * 180))
 
 		err := c.srv.protocol.Unpack(c, c.packetReceiveChan)
 
@@ -348,8 +565,23 @@ func (c *Conn) writeLoop() {
 	}
 }
 
+// writeQueued writes the packets of the send queue to Writer, c is locked
+func (c *Conn) writeQueued() error {
+	for {
+		select {
+		case p := <-c.packetSendChan:
+			_, err := c.Writer.Write(p.Serialize())
+			atomic.AddInt32(&c.sending, -1)
+			if err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
 func (c *Conn) writeStickPacketLoop() {
-	c.srv.waitGroup.Add(1)
 	defer func() {
 		//recover()
 		c.Close()
@@ -357,6 +589,7 @@ func (c *Conn) writeStickPacketLoop() {
 	}()
 
 	outputBufferTicker := time.NewTicker(c.OutputBufferTimeout)
+	defer outputBufferTicker.Stop()
 	for {
 		select {
 		case <-c.srv.exitChan:
@@ -364,42 +597,36 @@ func (c *Conn) writeStickPacketLoop() {
 
 		case <-c.closeChan:
 			return
+
+		case <-c.sendSignal:
+			//在锁内取出队列写到缓冲区，队列空了才写入对端，
+			//SyncWritePacket也在锁内先写队列，同步包不会超过先入队的异步包
+			c.Lock()
+			c.conn.SetWriteDeadline(time.Now().Add(c.srv.config.writeTimeout()))
+			err := c.writeQueued()
+			if err == nil {
+				err = c.Writer.Flush()
+			}
+			c.Unlock()
+			if err != nil {
+				logging.Error("conn writeStickPacketLoop write failed,err=%s", err.Error())
+				return
+			}
+
 		case <-outputBufferTicker.C: //每隔一段时间写入对端
 			c.Lock()
+			c.conn.SetWriteDeadline(time.Now().Add(c.srv.config.writeTimeout()))
 			err := c.Writer.Flush()
 			c.Unlock()
 			if err != nil {
 				logging.Error("conn writeStickPacketLoop fFlush failed,err=%s", err.Error())
 				return
 			}
-
-			/*
-				case p := <-c.packetSendChan:
-					c.conn.SetWriteDeadline(time.Now().Add(time.Second * 180))
-					packetstr := p.Serialize()
-
-					//写到缓冲区而已
-					c.Lock()
-					_, err := c.Writer.Write(packetstr)
-					c.Unlock()
-					if e, ok := err.(net.Error); ok && e.Timeout() {
-						//l4g.Info("con read found a timeout error, i can do")
-						c.packetSendChan <- p //写回去
-						continue
-					}
-					// This was a timeout
-
-					if err != nil {
-						logging.Info("con write found a error: %v", err)
-						return
-					}
-			*/
 		}
 	}
 }
 
 func (c *Conn) heartbeatLoop() {
-	c.srv.waitGroup.Add(1)
 	defer func() {
 		//recover()
 		c.srv.waitGroup.Done()
@@ -419,9 +646,10 @@ func (c *Conn) heartbeatLoop() {
 			return
 		case <-timercheck.C:
 			curTime := time.Now().Unix()
-			//logging.Debug("conn %s timeout,curTime=%d,tickTime=%d,hbTimeout=%d", c.GetExtraData(), int(curTime), int(c.tickTime), c.hbTimeout)
-			if curTime >= c.tickTime+c.hbTimeout {
-				logging.Error("conn %s timeout,curTime=%d,tickTime=%d,hbTimeout=%d,", c.GetExtraData(), int(curTime), int(c.tickTime), c.hbTimeout)
+			tickTime := atomic.LoadInt64(&c.tickTime)
+			//logging.Debug("conn %s timeout,curTime=%d,tickTime=%d,hbTimeout=%d", c.GetExtraData(), int(curTime), int(tickTime), c.hbTimeout)
+			if curTime >= tickTime+c.hbTimeout {
+				logging.Error("conn %s timeout,curTime=%d,tickTime=%d,hbTimeout=%d,", c.GetExtraData(), int(curTime), int(tickTime), c.hbTimeout)
 				c.Close()
 				return
 			}
@@ -431,7 +659,6 @@ func (c *Conn) heartbeatLoop() {
 }
 
 func (c *Conn) handleLoop() {
-	c.srv.waitGroup.Add(1)
 	defer func() {
 		//recover()
 		c.Close()
@@ -446,11 +673,32 @@ func (c *Conn) handleLoop() {
 		case <-c.closeChan:
 			return
 
+		case <-c.readStopped:
+			//读循环已停止，处理完队列里剩下的包，Shutdown等handled关闭
+			for len(c.packetReceiveChan) > 0 {
+				if !c.handle(<-c.packetReceiveChan) {
+					return
+				}
+			}
+			close(c.handled)
+			select {
+			case <-c.srv.exitChan:
+			case <-c.closeChan:
+			}
+			return
+
 		case p := <-c.packetReceiveChan:
 			//logging.Debug("receive msg:%s", string(p.Serialize()))
-			if !c.srv.callback.OnMessage(c, p) {
+			if !c.handle(p) {
 				return
 			}
 		}
 	}
 }
+
+// handle passes a received packet to OnMessage
+func (c *Conn) handle(p Packet) bool {
+	atomic.AddInt32(&c.handling, 1)
+	defer atomic.AddInt32(&c.handling, -1)
+	return c.srv.callback.OnMessage(c, p)
+}
@@ -0,0 +1,183 @@
+package gotcp
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newQueueConn creates a connection whose loops are not started, so its send queue is never drained
+func newQueueConn(policy OverflowPolicy) (*Conn, net.Conn) {
+	p1, p2 := net.Pipe()
+	cw := &ConnWraper{
+		config:    &Config{PacketSendChanLimit: 2, SendOverflow: policy},
+		callback:  &streamCallback{},
+		protocol:  NewStreamProtocol(0),
+		exitChan:  make(chan struct{}),
+		waitGroup: &sync.WaitGroup{},
+	}
+	return newConn(p1, cw), p2
+}
+
+func TestAsyncWritePacketOverflow(t *testing.T) {
+	c, peer := newQueueConn(OverflowBlock)
+	defer peer.Close()
+	for _, body := range []string{"a", "b"} {
+		if err := c.AsyncWritePacket(NewStreamFrame([]byte(body)), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.AsyncWritePacket(NewStreamFrame([]byte("c")), 20*time.Millisecond); err != ErrWriteBlocking {
+		t.Error(err)
+	}
+	if c.Dropped() != 1 || c.srv.dropped != 1 {
+		t.Error(c.Dropped(), c.srv.dropped)
+	}
+	c.Close()
+	if err := c.AsyncWritePacket(NewStreamFrame([]byte("d")), 0); err != ErrConnClosing {
+		t.Error(err)
+	}
+
+	c, peer = newQueueConn(OverflowDropOldest)
+	defer peer.Close()
+	for _, body := range []string{"a", "b", "c"} {
+		if err := c.AsyncWritePacket(NewStreamFrame([]byte(body)), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Dropped() != 1 {
+		t.Error(c.Dropped())
+	}
+	for _, body := range []string{"b", "c"} {
+		if p := <-c.packetSendChan; string(p.(*StreamPacket).GetBody()) != body {
+			t.Errorf("%q, want %q", p.(*StreamPacket).GetBody(), body)
+		}
+	}
+
+	c, peer = newQueueConn(OverflowDisconnect)
+	defer peer.Close()
+	for _, body := range []string{"a", "b"} {
+		if err := c.AsyncWritePacket(NewStreamFrame([]byte(body)), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.AsyncWritePacket(NewStreamFrame([]byte("c")), 0); err != ErrSlowConsumer {
+		t.Error(err)
+	}
+	if !c.IsClosed() || c.Dropped() != 1 {
+		t.Error(c.IsClosed(), c.Dropped())
+	}
+}
+
+func TestSyncWritePacketOrder(t *testing.T) {
+	c, peer := newQueueConn(OverflowBlock)
+	defer peer.Close()
+	for _, body := range []string{"a", "b"} {
+		if err := c.AsyncWritePacket(NewStreamFrame([]byte(body)), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- c.SyncWritePacket(NewStreamFrame([]byte("c")))
+	}()
+	// the queued packets are written before the sync one
+	p := NewStreamProtocol(0)
+	for _, body := range []string{"a", "b", "c"} {
+		pack, err := p.readFrame(peer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(pack.GetBody()) != body {
+			t.Errorf("%q, want %q", pack.GetBody(), body)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&c.sending); n != 0 || len(c.packetSendChan) != 0 {
+		t.Error(n, len(c.packetSendChan))
+	}
+}
+
+func TestAsyncWritePacket(t *testing.T) {
+	addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{PacketSendChanLimit: 4, PacketReceiveChanLimit: 16, WriteTimeOut: 1, SendOverflow: OverflowDisconnect}
+	server := NewServer(config, &streamCallback{echo: true}, NewStreamProtocol(0), 60, 120)
+	go server.Start(listener, 100*time.Millisecond)
+	defer server.Stop()
+
+	// the packets are written in order
+	cb := &streamCallback{messages: make(chan []byte, 16)}
+	client := NewClient(&Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}, cb, NewStreamProtocol(0))
+	if !client.Start(listener.Addr().String()) {
+		t.Fatal("client not started")
+	}
+	defer client.Stop()
+	for i := 0; i < 10; i++ {
+		if err := client.Conn.AsyncWritePacket(NewStreamFrame([]byte{byte(i)}), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		select {
+		case message := <-cb.messages:
+			if !bytes.Equal(message, []byte{byte(i)}) {
+				t.Errorf("%d: %q", i, message)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no echo")
+		}
+	}
+
+	// a client which never reads is disconnected when the send queue is full
+	raw, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	var slow *Conn
+	waitFor(t, "not connected", func() bool {
+		for _, c := range server.Conns() {
+			if c.GetRawConn().RemoteAddr().String() == raw.LocalAddr().String() {
+				slow = c
+			}
+		}
+		return slow != nil
+	})
+	body := bytes.Repeat([]byte("x"), 64*1024)
+	start := time.Now()
+	for err == nil {
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("the slow consumer is not disconnected")
+		}
+		err = slow.AsyncWritePacket(NewStreamFrame(body), 0)
+	}
+	if err != ErrSlowConsumer && err != ErrConnClosing {
+		t.Error(err)
+	}
+	if !slow.IsClosed() || server.Dropped() == 0 {
+		t.Error(slow.IsClosed(), server.Dropped())
+	}
+}
+
+func TestConfigTimeout(t *testing.T) {
+	config := &Config{}
+	if config.readTimeout() != defaultReadTimeout || config.writeTimeout() != defaultWriteTimeout {
+		t.Error(config.readTimeout(), config.writeTimeout())
+	}
+	config = &Config{ReadTimeOut: 30, WriteTimeOut: 5}
+	if config.readTimeout() != 30*time.Second || config.writeTimeout() != 5*time.Second {
+		t.Error(config.readTimeout(), config.writeTimeout())
+	}
+}
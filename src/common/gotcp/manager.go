@@ -0,0 +1,245 @@
+package gotcp
+
+import (
+	"sync"
+)
+
+type managedConn struct {
+	id     string
+	groups map[string]struct{}
+}
+
+// ConnManager is a ConnCallback which keeps the live connections, it is used as the callback of Server.
+// A connection is registered after OnConnect of the callback returns true, and unregistered before OnClose,
+// it may be bound to an ID, such as the user ID after login, and join any groups, such as rooms.
+type ConnManager struct {
+	callback ConnCallback
+
+	mutex  sync.RWMutex
+	conns  map[*Conn]*managedConn
+	ids    map[string]*Conn
+	groups map[string]map[*Conn]struct{}
+}
+
+// NewConnManager creates a ConnManager, callback receives the events of the connections, it may be nil
+func NewConnManager(callback ConnCallback) *ConnManager {
+	return &ConnManager{
+		callback: callback,
+		conns:    make(map[*Conn]*managedConn),
+		ids:      make(map[string]*Conn),
+		groups:   make(map[string]map[*Conn]struct{}),
+	}
+}
+
+func (m *ConnManager) OnConnect(c *Conn) bool {
+	if m.callback != nil && !m.callback.OnConnect(c) {
+		return false
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	//OnConnect里已经Close的连接不再加入
+	if !c.IsClosed() {
+		m.conns[c] = &managedConn{groups: make(map[string]struct{})}
+	}
+	return true
+}
+
+func (m *ConnManager) OnMessage(c *Conn, p Packet) bool {
+	if m.callback == nil {
+		return true
+	}
+	return m.callback.OnMessage(c, p)
+}
+
+func (m *ConnManager) OnClose(c *Conn) {
+	m.mutex.Lock()
+	if mc, ok := m.conns[c]; ok {
+		if mc.id != "" {
+			delete(m.ids, mc.id)
+		}
+		for group := range mc.groups {
+			m.leave(group, c)
+		}
+		delete(m.conns, c)
+	}
+	m.mutex.Unlock()
+	if m.callback != nil {
+		m.callback.OnClose(c)
+	}
+}
+
+// Bind binds c to id and returns the connection bound to id before, such as the old login of a user, nil if none.
+// The old ID of c is unbound. ErrConnClosing is returned if c is not registered.
+func (m *ConnManager) Bind(c *Conn, id string) (*Conn, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	mc, ok := m.conns[c]
+	if !ok {
+		return nil, ErrConnClosing
+	}
+	if mc.id == id {
+		return nil, nil
+	}
+	if mc.id != "" {
+		delete(m.ids, mc.id)
+	}
+	old := m.ids[id]
+	if old != nil {
+		m.conns[old].id = ""
+	}
+	mc.id = id
+	m.ids[id] = c
+	return old, nil
+}
+
+// Unbind unbinds the connection of id, and returns it, nil if none
+func (m *ConnManager) Unbind(id string) *Conn {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	c := m.ids[id]
+	if c != nil {
+		delete(m.ids, id)
+		m.conns[c].id = ""
+	}
+	return c
+}
+
+// Get returns the connection bound to id, nil if none
+func (m *ConnManager) Get(id string) *Conn {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.ids[id]
+}
+
+// ID returns the ID of c, "" if it is not bound
+func (m *ConnManager) ID(c *Conn) string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if mc, ok := m.conns[c]; ok {
+		return mc.id
+	}
+	return ""
+}
+
+// Conns returns the registered connections
+func (m *ConnManager) Conns() []*Conn {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	conns := make([]*Conn, 0, len(m.conns))
+	for c := range m.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// Count returns the number of the registered connections
+func (m *ConnManager) Count() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return len(m.conns)
+}
+
+// Join adds c to group, false if c is not registered
+func (m *ConnManager) Join(group string, c *Conn) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	mc, ok := m.conns[c]
+	if !ok {
+		return false
+	}
+	mc.groups[group] = struct{}{}
+	members := m.groups[group]
+	if members == nil {
+		members = make(map[*Conn]struct{})
+		m.groups[group] = members
+	}
+	members[c] = struct{}{}
+	return true
+}
+
+// Leave removes c from group
+func (m *ConnManager) Leave(group string, c *Conn) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if mc, ok := m.conns[c]; ok {
+		delete(mc.groups, group)
+	}
+	m.leave(group, c)
+}
+
+// leave removes c from the members of group, the empty group is removed
+func (m *ConnManager) leave(group string, c *Conn) {
+	members := m.groups[group]
+	delete(members, c)
+	if len(members) == 0 {
+		delete(m.groups, group)
+	}
+}
+
+// Members returns the connections of group
+func (m *ConnManager) Members(group string) []*Conn {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	members := m.groups[group]
+	conns := make([]*Conn, 0, len(members))
+	for c := range members {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// Groups returns the groups c joined
+func (m *ConnManager) Groups(c *Conn) []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	mc, ok := m.conns[c]
+	if !ok {
+		return nil
+	}
+	groups := make([]string, 0, len(mc.groups))
+	for group := range mc.groups {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// Send writes p to the connection bound to id, ErrConnClosing if none
+func (m *ConnManager) Send(id string, p Packet) error {
+	c := m.Get(id)
+	if c == nil {
+		return ErrConnClosing
+	}
+	return c.SyncWritePacket(p)
+}
+
+// Broadcast queues p to all the registered connections as AsyncWritePacket does but never waits, p is serialized once.
+// A connection whose send queue is full drops p under OverflowBlock, which is counted by Dropped.
+// It returns the number of the connections queued.
+func (m *ConnManager) Broadcast(p Packet) int {
+	return writeAll(m.Conns(), p)
+}
+
+// Multicast queues p to the connections of group as Broadcast does.
+// It returns the number of the connections queued.
+func (m *ConnManager) Multicast(group string, p Packet) int {
+	return writeAll(m.Members(group), p)
+}
+
+// serializedPacket is a packet serialized already
+type serializedPacket []byte
+
+func (p serializedPacket) Serialize() []byte {
+	return p
+}
+
+// writeAll queues p to conns without waiting, so a connection whose send queue is full does not delay the others
+func writeAll(conns []*Conn, p Packet) int {
+	data := serializedPacket(p.Serialize())
+	n := 0
+	for _, c := range conns {
+		if c.offerPacket(data) == nil {
+			n++
+		}
+	}
+	return n
+}
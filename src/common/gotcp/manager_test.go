@@ -0,0 +1,220 @@
+package gotcp
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loginCallback binds a connection by the message "id group", and replies "ok"
+type loginCallback struct {
+	manager *ConnManager
+}
+
+func (cb *loginCallback) OnConnect(c *Conn) bool {
+	return true
+}
+
+func (cb *loginCallback) OnMessage(c *Conn, p Packet) bool {
+	fields := strings.Fields(string(p.(*StreamPacket).GetBody()))
+	old, err := cb.manager.Bind(c, fields[0])
+	if err != nil {
+		return false
+	}
+	if old != nil {
+		old.Close()
+	}
+	cb.manager.Join(fields[1], c)
+	c.SetAttr("group", fields[1])
+	return c.SyncWritePacket(NewStreamFrame([]byte("ok"))) == nil
+}
+
+func (cb *loginCallback) OnClose(c *Conn) {
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	for i := 0; !cond(); i++ {
+		if i == 500 {
+			t.Fatal(what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConnManager(t *testing.T) {
+	addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}
+	cb := &loginCallback{}
+	manager := NewConnManager(cb)
+	cb.manager = manager
+	server := NewServer(config, manager, NewStreamProtocol(0), 60, 120)
+	go server.Start(listener, 100*time.Millisecond)
+	defer server.Stop()
+
+	clients := make(map[string]*Client)
+	messages := make(map[string]chan []byte)
+	login := func(name, id, group string) {
+		if clients[name] == nil {
+			messages[name] = make(chan []byte, 16)
+			clients[name] = NewClient(config, &streamCallback{messages: messages[name]}, NewStreamProtocol(0))
+			if !clients[name].Start(listener.Addr().String()) {
+				t.Fatal("client not started")
+			}
+		}
+		if err := clients[name].Conn.SyncWritePacket(NewStreamFrame([]byte(id + " " + group))); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, messages[name], "ok")
+	}
+	login("a", "a", "red")
+	login("b", "b", "red")
+	login("c", "c", "blue")
+	defer func() {
+		for _, client := range clients {
+			client.Stop()
+		}
+	}()
+
+	if n := manager.Count(); n != 3 {
+		t.Error(n)
+	}
+	a := manager.Get("a")
+	if a == nil || manager.ID(a) != "a" {
+		t.Fatal(a)
+	}
+	if group, ok := a.GetAttrString("group"); !ok || group != "red" {
+		t.Error(group, ok)
+	}
+	if groups := manager.Groups(a); len(groups) != 1 || groups[0] != "red" {
+		t.Error(groups)
+	}
+	if n := manager.Multicast("red", NewStreamFrame([]byte("hi red"))); n != 2 {
+		t.Error(n)
+	}
+	if n := manager.Broadcast(NewStreamFrame([]byte("hi all"))); n != 3 {
+		t.Error(n)
+	}
+	if err := manager.Send("c", NewStreamFrame([]byte("hi c"))); err != nil {
+		t.Error(err)
+	}
+	if err := manager.Send("nobody", NewStreamFrame(nil)); err != ErrConnClosing {
+		t.Error(err)
+	}
+	expect(t, messages["a"], "hi red", "hi all")
+	expect(t, messages["b"], "hi red", "hi all")
+	expect(t, messages["c"], "hi all", "hi c")
+
+	// c logins as a, the old connection of a is closed
+	login("c", "a", "red")
+	waitFor(t, "the old connection is not unregistered", func() bool { return manager.Count() == 2 })
+	if c := manager.Get("a"); c == nil || c == a {
+		t.Error("a is not bound to the new connection")
+	}
+	if manager.Get("c") != nil {
+		t.Error("c is still bound")
+	}
+	if n := len(manager.Members("red")); n != 2 {
+		t.Error(n)
+	}
+
+	clients["b"].Stop()
+	delete(clients, "b")
+	waitFor(t, "b is not unregistered", func() bool { return manager.Get("b") == nil })
+	if members := manager.Members("red"); len(members) != 1 || manager.ID(members[0]) != "a" {
+		t.Error(members)
+	}
+	manager.Leave("red", manager.Get("a"))
+	if members := manager.Members("red"); len(members) != 0 {
+		t.Error(members)
+	}
+	if groups := manager.Groups(manager.Get("a")); len(groups) != 1 || groups[0] != "blue" {
+		t.Error(groups)
+	}
+	if c := manager.Unbind("a"); c == nil || manager.Get("a") != nil || manager.ID(c) != "" {
+		t.Error("a is not unbound")
+	}
+}
+
+func expect(t *testing.T, messages chan []byte, bodies ...string) {
+	for _, body := range bodies {
+		select {
+		case message := <-messages:
+			if string(message) != body {
+				t.Errorf("%q, want %q", message, body)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %q", body)
+		}
+	}
+}
+
+func TestConnAttrs(t *testing.T) {
+	p1, p2 := net.Pipe()
+	defer p2.Close()
+	c := newConn(p1, &ConnWraper{config: &Config{}})
+	if _, ok := c.GetAttr("missing"); ok {
+		t.Error("missing attribute")
+	}
+	c.SetAttr("name", "player")
+	c.SetAttr("level", int64(3))
+	c.SetAttr("vip", true)
+	if s, ok := c.GetAttrString("name"); !ok || s != "player" {
+		t.Error(s, ok)
+	}
+	if n, ok := c.GetAttrInt64("level"); !ok || n != 3 {
+		t.Error(n, ok)
+	}
+	if b, ok := c.GetAttrBool("vip"); !ok || !b {
+		t.Error(b, ok)
+	}
+	if _, ok := c.GetAttrInt64("name"); ok {
+		t.Error("a string is an int64")
+	}
+	c.DelAttr("name")
+	if _, ok := c.GetAttrString("name"); ok {
+		t.Error("the attribute is not deleted")
+	}
+}
+
+func TestBroadcastSlowConsumer(t *testing.T) {
+	manager := NewConnManager(nil)
+	slow, slowPeer := newQueueConn(OverflowBlock)
+	defer slowPeer.Close()
+	fast, fastPeer := newQueueConn(OverflowBlock)
+	defer fastPeer.Close()
+	for _, body := range []string{"a", "b"} {
+		if err := slow.AsyncWritePacket(NewStreamFrame([]byte(body)), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manager.OnConnect(slow)
+	manager.OnConnect(fast)
+
+	// the full queue of slow does not delay the broadcast, and its packet is dropped
+	start := time.Now()
+	if n := manager.Broadcast(NewStreamFrame([]byte("hi"))); n != 1 {
+		t.Error(n)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Error("the broadcast is blocked by the slow consumer for", d)
+	}
+	if slow.Dropped() != 1 || fast.Dropped() != 0 {
+		t.Error(slow.Dropped(), fast.Dropped())
+	}
+	select {
+	case p := <-fast.packetSendChan:
+		if string(p.Serialize()) != string(DoPacket([]byte("hi"))) {
+			t.Errorf("%q", p.Serialize())
+		}
+	default:
+		t.Error("not queued to fast")
+	}
+}
@@ -9,7 +9,7 @@ type Packet interface {
 }
 
 type Protocol interface {
-	ReadPacket(conn *net.TCPConn) (Packet, error)
+	ReadPacket(conn net.Conn) (Packet, error)
 	Unpack(c *Conn, readerChannel chan Packet) error
 	GetHeatBeatData() Packet
 }
@@ -0,0 +1,322 @@
+package gotcp
+
+import (
+	"crypto/tls"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"mae_proj/MAE/common/logging"
+)
+
+// Errors of ReconnectingClient
+var (
+	ErrNotConnected   = errors.New("client is not connected")
+	ErrSendBufferFull = errors.New("send buffer of disconnected client is full")
+	ErrClientStopped  = errors.New("client is stopped")
+)
+
+// Default backoff of ReconnectingClient
+const (
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+	DefaultJitter     = 0.2
+)
+
+// ClientState is the state of a ReconnectingClient
+type ClientState int32
+
+const (
+	StateConnecting   ClientState = iota // dialing the server
+	StateConnected                       // OnConnect returned true
+	StateDisconnected                    // waiting for the backoff to redial
+	StateStopped                         // Stop was called
+)
+
+func (s ClientState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateStopped:
+		return "stopped"
+	}
+	return "unknown"
+}
+
+// ReconnectConfig is the configuration of ReconnectingClient
+type ReconnectConfig struct {
+	MinBackoff     time.Duration     // the first backoff after a failure, DefaultMinBackoff if 0
+	MaxBackoff     time.Duration     // the backoff doubles until MaxBackoff, DefaultMaxBackoff if 0
+	Jitter         float64           // a random part of the backoff, from 0 to 1, DefaultJitter if 0
+	DialTimeout    time.Duration     // defaultHandshakeTimeout if 0
+	TLSConfig      *tls.Config       // dial TLS if it is not nil
+	SendBufferSize int               // the number of the packets buffered while disconnected, 0 means no buffer
+	OnStateChange  func(ClientState) // called on every state change, in the reconnecting goroutine
+}
+
+// ReconnectingClient is a Client which redials with exponential backoff and jitter when the connection is lost.
+// OnConnect is called again for every new connection, OnClose for every lost one.
+type ReconnectingClient struct {
+	cw       *ConnWraper
+	callback ConnCallback
+	config   ReconnectConfig
+	closed   chan *Conn
+
+	mutex   sync.Mutex
+	conn    *Conn
+	state   ClientState
+	buffer  []Packet
+	stopped bool
+}
+
+// NewReconnectingClient creates a ReconnectingClient, Start starts it
+func NewReconnectingClient(config *Config, callback ConnCallback, protocol Protocol, rc *ReconnectConfig) *ReconnectingClient {
+	c := &ReconnectingClient{
+		callback: callback,
+		closed:   make(chan *Conn, 1),
+		state:    StateDisconnected,
+	}
+	if rc != nil {
+		c.config = *rc
+	}
+	if c.config.MinBackoff <= 0 {
+		c.config.MinBackoff = DefaultMinBackoff
+	}
+	if c.config.MaxBackoff <= 0 {
+		c.config.MaxBackoff = DefaultMaxBackoff
+	}
+	if c.config.MaxBackoff < c.config.MinBackoff {
+		c.config.MaxBackoff = c.config.MinBackoff
+	}
+	if c.config.Jitter <= 0 || c.config.Jitter > 1 {
+		c.config.Jitter = DefaultJitter
+	}
+	if c.config.DialTimeout <= 0 {
+		c.config.DialTimeout = defaultHandshakeTimeout
+	}
+	c.cw = &ConnWraper{
+		config:    config,
+		callback:  &reconnectCallback{c},
+		protocol:  protocol,
+		exitChan:  make(chan struct{}),
+		waitGroup: &sync.WaitGroup{},
+	}
+	return c
+}
+
+// reconnectCallback passes the events to the callback of the client, and notices the lost current connection
+type reconnectCallback struct {
+	client *ReconnectingClient
+}
+
+func (cb *reconnectCallback) OnConnect(c *Conn) bool {
+	return cb.client.callback.OnConnect(c)
+}
+
+func (cb *reconnectCallback) OnMessage(c *Conn, p Packet) bool {
+	return cb.client.callback.OnMessage(c, p)
+}
+
+func (cb *reconnectCallback) OnClose(c *Conn) {
+	cb.client.callback.OnClose(c)
+	//connect里没成为当前连接就关闭的不通知，没有waitClose等它，会塞满closed
+	if cb.client.Conn() != c {
+		return
+	}
+	select {
+	case cb.client.closed <- c:
+	case <-cb.client.cw.exitChan:
+	}
+}
+
+// Start starts dialing hostAndPort in a goroutine, and keeps the connection until Stop
+func (c *ReconnectingClient) Start(hostAndPort string) {
+	c.cw.waitGroup.Add(1)
+	go c.run(hostAndPort)
+}
+
+// Stop closes the connection and stops reconnecting, the buffered packets are dropped
+func (c *ReconnectingClient) Stop() {
+	c.mutex.Lock()
+	if c.stopped {
+		c.mutex.Unlock()
+		return
+	}
+	c.stopped = true
+	conn := c.conn
+	c.conn = nil
+	c.buffer = nil
+	c.mutex.Unlock()
+	close(c.cw.exitChan)
+	if conn != nil {
+		conn.Close()
+	}
+	c.cw.waitGroup.Wait()
+	c.setState(StateStopped)
+}
+
+// Conn returns the current connection, nil if disconnected
+func (c *ReconnectingClient) Conn() *Conn {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.conn
+}
+
+// State returns the current state
+func (c *ReconnectingClient) State() ClientState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.state
+}
+
+// WritePacket writes p to the current connection by SyncWritePacket,
+// or buffers it while disconnected, the buffered packets are written in order after OnConnect of the next connection.
+// ErrSendBufferFull is returned if the buffer is full, ErrNotConnected if there is no buffer.
+func (c *ReconnectingClient) WritePacket(p Packet) error {
+	c.mutex.Lock()
+	if c.stopped {
+		c.mutex.Unlock()
+		return ErrClientStopped
+	}
+	if conn := c.conn; conn != nil && !conn.IsClosed() {
+		c.mutex.Unlock()
+		return conn.SyncWritePacket(p)
+	}
+	defer c.mutex.Unlock()
+	if c.config.SendBufferSize <= 0 {
+		return ErrNotConnected
+	}
+	if len(c.buffer) >= c.config.SendBufferSize {
+		return ErrSendBufferFull
+	}
+	c.buffer = append(c.buffer, p)
+	return nil
+}
+
+func (c *ReconnectingClient) run(hostAndPort string) {
+	defer c.cw.waitGroup.Done()
+	backoff := c.config.MinBackoff
+	for {
+		c.setState(StateConnecting)
+		if conn := c.connect(hostAndPort); conn != nil {
+			backoff = c.config.MinBackoff
+			if !c.waitClose(conn) {
+				return
+			}
+			c.mutex.Lock()
+			if c.conn == conn {
+				c.conn = nil
+			}
+			c.mutex.Unlock()
+		}
+		c.setState(StateDisconnected)
+		timer := time.NewTimer(c.jitter(backoff))
+		select {
+		case <-timer.C:
+		case <-c.cw.exitChan:
+			timer.Stop()
+			return
+		}
+		if backoff *= 2; backoff > c.config.MaxBackoff {
+			backoff = c.config.MaxBackoff
+		}
+	}
+}
+
+// connect dials hostAndPort and starts the connection, nil if failed
+func (c *ReconnectingClient) connect(hostAndPort string) *Conn {
+	var raw net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: c.config.DialTimeout}
+	if c.config.TLSConfig != nil {
+		raw, err = tls.DialWithDialer(dialer, "tcp", hostAndPort, c.config.TLSConfig)
+	} else {
+		raw, err = dialer.Dial("tcp", hostAndPort)
+	}
+	if err != nil {
+		logging.Info("ReconnectingClient dial %s failed: %v", hostAndPort, err)
+		return nil
+	}
+	conn := newConn(raw, c.cw)
+	if !c.callback.OnConnect(conn) {
+		logging.Info("ReconnectingClient OnConnect of %s returned false", hostAndPort)
+		raw.Close()
+		return nil
+	}
+
+	// the buffered packets are written before the connection is used by WritePacket, to keep the order,
+	// they are taken out of the lock, so WritePacket buffers the packets meanwhile and they are written next round
+	for {
+		c.mutex.Lock()
+		if c.stopped {
+			c.mutex.Unlock()
+			conn.Close()
+			return nil
+		}
+		buffer := c.buffer
+		c.buffer = nil
+		if len(buffer) == 0 {
+			c.conn = conn
+			// started in the lock, so Stop waits for the loops
+			conn.start()
+			c.mutex.Unlock()
+			break
+		}
+		c.mutex.Unlock()
+		for i, p := range buffer {
+			if err := conn.SyncWritePacket(p); err != nil {
+				//没写出的包放回缓冲区，下一个连接再写
+				c.mutex.Lock()
+				if !c.stopped {
+					c.buffer = append(buffer[i:], c.buffer...)
+				}
+				c.mutex.Unlock()
+				conn.Close()
+				return nil
+			}
+		}
+	}
+	c.setState(StateConnected)
+	return conn
+}
+
+// waitClose waits for OnClose of conn, false if the client is stopped
+func (c *ReconnectingClient) waitClose(conn *Conn) bool {
+	for {
+		select {
+		case closed := <-c.closed:
+			if closed == conn {
+				return true
+			}
+		case <-c.cw.exitChan:
+			return false
+		}
+	}
+}
+
+// jitter returns d reduced by a random part of Jitter
+func (c *ReconnectingClient) jitter(d time.Duration) time.Duration {
+	if n := int64(float64(d) * c.config.Jitter); n > 0 {
+		d -= time.Duration(rand.Int63n(n))
+	}
+	return d
+}
+
+func (c *ReconnectingClient) setState(state ClientState) {
+	c.mutex.Lock()
+	if c.state == state || c.state == StateStopped {
+		c.mutex.Unlock()
+		return
+	}
+	c.state = state
+	c.mutex.Unlock()
+	if c.config.OnStateChange != nil {
+		c.config.OnStateChange(state)
+	}
+}
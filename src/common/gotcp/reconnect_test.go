@@ -0,0 +1,223 @@
+package gotcp
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func startStreamServer(t *testing.T, address string) (*Server, string) {
+	addr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(&Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}, &streamCallback{echo: true}, NewStreamProtocol(0), 1, 10)
+	go server.Start(listener, 50*time.Millisecond)
+	return server, listener.Addr().String()
+}
+
+type connectCallback struct {
+	connects chan *Conn
+	streamCallback
+}
+
+func (cb *connectCallback) OnConnect(c *Conn) bool {
+	cb.connects <- c
+	return true
+}
+
+func waitConnect(t *testing.T, cb *connectCallback) {
+	select {
+	case <-cb.connects:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not connected")
+	}
+}
+
+func waitMessage(t *testing.T, cb *connectCallback, body string) {
+	select {
+	case message := <-cb.messages:
+		if !bytes.Equal(message, []byte(body)) {
+			t.Errorf("%q, want %q", message, body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no message %q", body)
+	}
+}
+
+func TestReconnectingClient(t *testing.T) {
+	server, addr := startStreamServer(t, "127.0.0.1:0")
+	states := make(chan ClientState, 64)
+	cb := &connectCallback{connects: make(chan *Conn, 4), streamCallback: streamCallback{messages: make(chan []byte, 16)}}
+	client := NewReconnectingClient(&Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}, cb, NewStreamProtocol(0), &ReconnectConfig{
+		MinBackoff:     10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		SendBufferSize: 2,
+		OnStateChange: func(state ClientState) {
+			states <- state
+		},
+	})
+	client.Start(addr)
+	waitConnect(t, cb)
+	if err := client.WritePacket(NewStreamFrame([]byte("one"))); err != nil {
+		t.Fatal(err)
+	}
+	waitMessage(t, cb, "one")
+
+	server.Stop()
+	for i := 0; client.State() == StateConnected; i++ {
+		if i == 100 {
+			t.Fatal("the lost connection is not noticed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if client.Conn() != nil {
+		t.Error("connection of a disconnected client")
+	}
+	for _, body := range []string{"two", "three"} {
+		if err := client.WritePacket(NewStreamFrame([]byte(body))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.WritePacket(NewStreamFrame([]byte("four"))); err != ErrSendBufferFull {
+		t.Error(err)
+	}
+
+	server, _ = startStreamServer(t, addr)
+	defer server.Stop()
+	waitConnect(t, cb)
+	waitMessage(t, cb, "two")
+	waitMessage(t, cb, "three")
+	if client.State() != StateConnected || client.Conn() == nil {
+		t.Error(client.State())
+	}
+
+	client.Stop()
+	if err := client.WritePacket(NewStreamFrame([]byte("five"))); err != ErrClientStopped {
+		t.Error(err)
+	}
+	close(states)
+	var seen []ClientState
+	for state := range states {
+		seen = append(seen, state)
+	}
+	if len(seen) < 5 || seen[0] != StateConnecting || seen[1] != StateConnected || seen[len(seen)-1] != StateStopped {
+		t.Error(seen)
+	}
+}
+
+func TestReconnectingClientBackoff(t *testing.T) {
+	client := NewReconnectingClient(&Config{}, &streamCallback{}, NewStreamProtocol(0), &ReconnectConfig{MinBackoff: time.Second, Jitter: 0.5})
+	for i := 0; i < 100; i++ {
+		if d := client.jitter(time.Second); d <= 500*time.Millisecond || d > time.Second {
+			t.Fatal(d)
+		}
+	}
+	if client.config.MaxBackoff != DefaultMaxBackoff {
+		t.Error(client.config.MaxBackoff)
+	}
+	if err := client.WritePacket(NewStreamFrame(nil)); err != ErrNotConnected {
+		t.Error(err)
+	}
+}
+
+// blockingConnectCallback blocks OnConnect until release is closed, and counts OnClose
+type blockingConnectCallback struct {
+	connects chan *Conn
+	release  chan struct{}
+	closes   chan *Conn
+	streamCallback
+}
+
+func (cb *blockingConnectCallback) OnConnect(c *Conn) bool {
+	cb.connects <- c
+	<-cb.release
+	return true
+}
+
+func (cb *blockingConnectCallback) OnClose(c *Conn) {
+	cb.closes <- c
+}
+
+func TestReconnectingClientStopInOnConnect(t *testing.T) {
+	server, addr := startStreamServer(t, "127.0.0.1:0")
+	defer server.Stop()
+	cb := &blockingConnectCallback{connects: make(chan *Conn, 1), release: make(chan struct{}), closes: make(chan *Conn, 1)}
+	client := NewReconnectingClient(&Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}, cb, NewStreamProtocol(0), nil)
+	client.Start(addr)
+	var conn *Conn
+	select {
+	case conn = <-cb.connects:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not connected")
+	}
+	stopped := make(chan struct{})
+	go func() {
+		client.Stop()
+		close(stopped)
+	}()
+	waitFor(t, "not stopped", func() bool {
+		client.mutex.Lock()
+		defer client.mutex.Unlock()
+		return client.stopped
+	})
+	close(cb.release)
+	// the connection accepted by OnConnect is closed by OnClose
+	select {
+	case c := <-cb.closes:
+		if c != conn {
+			t.Error("OnClose of another connection")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no OnClose")
+	}
+	<-stopped
+	if !conn.IsClosed() || client.Conn() != nil {
+		t.Error(conn.IsClosed(), client.Conn())
+	}
+}
+
+// failingConnectCallback closes the raw connection in OnConnect for the first failures connections,
+// so the writes of the send buffer on them fail
+type failingConnectCallback struct {
+	failures int32
+	connectCallback
+}
+
+func (cb *failingConnectCallback) OnConnect(c *Conn) bool {
+	if atomic.AddInt32(&cb.failures, -1) >= 0 {
+		c.GetRawConn().Close()
+	}
+	return cb.connectCallback.OnConnect(c)
+}
+
+func TestReconnectingClientFlushFailure(t *testing.T) {
+	server, addr := startStreamServer(t, "127.0.0.1:0")
+	defer server.Stop()
+	cb := &failingConnectCallback{failures: 2, connectCallback: connectCallback{
+		connects:       make(chan *Conn, 4),
+		streamCallback: streamCallback{messages: make(chan []byte, 16)},
+	}}
+	client := NewReconnectingClient(&Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}, cb, NewStreamProtocol(0), &ReconnectConfig{
+		MinBackoff:     10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		SendBufferSize: 2,
+	})
+	defer client.Stop()
+	if err := client.WritePacket(NewStreamFrame([]byte("one"))); err != nil {
+		t.Fatal(err)
+	}
+	client.Start(addr)
+	// the buffer is kept over the two failed connections and written on the third
+	for i := 0; i < 3; i++ {
+		waitConnect(t, &cb.connectCallback)
+	}
+	waitMessage(t, &cb.connectCallback, "one")
+	waitFor(t, "not connected", func() bool { return client.State() == StateConnected && client.Conn() != nil })
+}
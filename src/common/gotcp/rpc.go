@@ -0,0 +1,291 @@
+package gotcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"mae_proj/MAE/common/logging"
+)
+
+// Errors of RPC
+var (
+	ErrNotProtoMessage = errors.New("rpc message is not a proto.Message")
+	ErrUnknownMethod   = errors.New("rpc method is not registered")
+)
+
+// DefaultCallTimeout is the timeout of Call if the context has no deadline and RPC.CallTimeout is 0
+const DefaultCallTimeout = 10 * time.Second
+
+// the kinds of the RPC messages
+const (
+	rpcRequest byte = iota + 1
+	rpcResponse
+	rpcError
+)
+
+// rpcMagic and rpcVersion start every RPC message, so a packet of the callback is not taken for one
+const (
+	rpcMagic   = "\x00RPC"
+	rpcVersion = 1
+)
+
+// the magic, the version, the kind, the little endian sequence ID and method ID in front of the body
+const rpcHeadLength = len(rpcMagic) + 10
+
+// Codec encodes the bodies of the RPC messages
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// ProtoCodec is the Codec of protobuf, the default of RPC
+type ProtoCodec struct{}
+
+func (ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	return proto.Marshal(m)
+}
+
+func (ProtoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// RPCError is the error returned by the handler of the peer
+type RPCError struct {
+	Method  uint32
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc method %d: %s", e.Method, e.Message)
+}
+
+// HandlerFunc serves a request decoded into the message of newRequest, and returns the response.
+// ctx is canceled when the connection is closed.
+type HandlerFunc func(ctx context.Context, c *Conn, req interface{}) (interface{}, error)
+
+type rpcHandler struct {
+	newRequest func() interface{}
+	serve      HandlerFunc
+}
+
+type rpcCall struct {
+	conn *Conn
+	done chan *StreamPacket
+}
+
+// RPC is a ConnCallback of request and response over StreamProtocol, it is used as the callback of Server or Client.
+// Every request has a sequence ID which its response has, so a connection may have many calls in flight.
+// The requests are dispatched to the handlers by method ID, each one in a goroutine.
+// The packets which are not RPC messages, not starting with the magic and version of RPC, are passed to the callback of NewRPC.
+type RPC struct {
+	Codec       Codec         // ProtoCodec by default
+	CallTimeout time.Duration // DefaultCallTimeout if 0
+
+	callback ConnCallback
+	seq      uint32
+
+	mutex    sync.RWMutex
+	handlers map[uint32]rpcHandler
+	calls    map[uint32]*rpcCall
+}
+
+// NewRPC creates a RPC, callback receives the events of the connections and the packets which are not RPC messages, it may be nil
+func NewRPC(callback ConnCallback) *RPC {
+	return &RPC{
+		Codec:    ProtoCodec{},
+		callback: callback,
+		handlers: make(map[uint32]rpcHandler),
+		calls:    make(map[uint32]*rpcCall),
+	}
+}
+
+// Handle registers the handler of method, newRequest returns the message to decode a request into,
+// such as func() interface{} { return new(pb.LoginRequest) }
+func (r *RPC) Handle(method uint32, newRequest func() interface{}, handler HandlerFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.handlers[method] = rpcHandler{newRequest: newRequest, serve: handler}
+}
+
+// Call sends req to method of c and decodes the response into resp, which may be nil to drop it.
+// It waits until the response, the deadline of ctx, or CallTimeout if ctx has no deadline,
+// or the connection is closed.
+func (r *RPC) Call(ctx context.Context, c *Conn, method uint32, req, resp interface{}) error {
+	body, err := r.Codec.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := r.CallTimeout
+		if timeout <= 0 {
+			timeout = DefaultCallTimeout
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	seq := atomic.AddUint32(&r.seq, 1)
+	call := &rpcCall{conn: c, done: make(chan *StreamPacket, 1)}
+	r.mutex.Lock()
+	r.calls[seq] = call
+	r.mutex.Unlock()
+	defer func() {
+		r.mutex.Lock()
+		delete(r.calls, seq)
+		r.mutex.Unlock()
+	}()
+
+	if err := c.SyncWritePacket(newRPCPacket(rpcRequest, seq, method, body)); err != nil {
+		return err
+	}
+	select {
+	case p := <-call.done:
+		kind, _, _, body := parseRPCPacket(p)
+		if kind == rpcError {
+			return &RPCError{Method: method, Message: string(body)}
+		}
+		if resp == nil {
+			return nil
+		}
+		return r.Codec.Unmarshal(body, resp)
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closeChan:
+		return ErrConnClosing
+	}
+}
+
+func (r *RPC) OnConnect(c *Conn) bool {
+	if r.callback == nil {
+		return true
+	}
+	return r.callback.OnConnect(c)
+}
+
+func (r *RPC) OnMessage(c *Conn, p Packet) bool {
+	pack, ok := p.(*StreamPacket)
+	if !ok {
+		return r.passMessage(c, p)
+	}
+	kind, seq, method, _ := parseRPCPacket(pack)
+	switch kind {
+	case rpcRequest:
+		r.mutex.RLock()
+		handler, ok := r.handlers[method]
+		r.mutex.RUnlock()
+		if !ok {
+			logging.Error("rpc method %d is not registered", method)
+			return c.SyncWritePacket(newRPCPacket(rpcError, seq, method, []byte(ErrUnknownMethod.Error()))) == nil
+		}
+		//handler在goroutine里执行，才能在handler里Call同一个连接
+		c.srv.waitGroup.Add(1)
+		atomic.AddInt32(&c.handling, 1)
+		go func() {
+			defer func() {
+				atomic.AddInt32(&c.handling, -1)
+				c.srv.waitGroup.Done()
+			}()
+			r.serve(c, handler, pack)
+		}()
+		return true
+	case rpcResponse, rpcError:
+		r.mutex.Lock()
+		call, ok := r.calls[seq]
+		if ok && call.conn == c {
+			delete(r.calls, seq)
+		}
+		r.mutex.Unlock()
+		if !ok || call.conn != c {
+			logging.Info("rpc response %d of method %d is late or unknown", seq, method)
+			return true
+		}
+		call.done <- pack
+		return true
+	}
+	return r.passMessage(c, p)
+}
+
+func (r *RPC) OnClose(c *Conn) {
+	if r.callback != nil {
+		r.callback.OnClose(c)
+	}
+}
+
+// passMessage passes a packet which is not a RPC message to the callback
+func (r *RPC) passMessage(c *Conn, p Packet) bool {
+	if r.callback == nil {
+		logging.Error("rpc drops a packet which is not a rpc message")
+		return true
+	}
+	return r.callback.OnMessage(c, p)
+}
+
+// serve runs the handler of a request and writes the response
+func (r *RPC) serve(c *Conn, handler rpcHandler, pack *StreamPacket) {
+	_, seq, method, body := parseRPCPacket(pack)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.closeChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var resp interface{}
+	req := handler.newRequest()
+	err := r.Codec.Unmarshal(body, req)
+	if err == nil {
+		resp, err = handler.serve(ctx, c, req)
+	}
+	if err == nil {
+		body, err = r.Codec.Marshal(resp)
+	}
+	kind := rpcResponse
+	if err != nil {
+		kind, body = rpcError, []byte(err.Error())
+	}
+	if err := c.SyncWritePacket(newRPCPacket(kind, seq, method, body)); err != nil {
+		logging.Info("rpc response %d of method %d is not sent: %v", seq, method, err)
+	}
+}
+
+// newRPCPacket creates the frame of a RPC message
+func newRPCPacket(kind byte, seq, method uint32, body []byte) *StreamPacket {
+	data := make([]byte, rpcHeadLength+len(body))
+	n := copy(data, rpcMagic)
+	data[n] = rpcVersion
+	data[n+1] = kind
+	copy(data[n+2:n+6], UInt32ToBytes(seq))
+	copy(data[n+6:n+10], UInt32ToBytes(method))
+	copy(data[rpcHeadLength:], body)
+	return NewStreamFrame(data)
+}
+
+// parseRPCPacket returns the header and the body of a RPC message, the kind is 0 if it is not a RPC message
+func parseRPCPacket(p *StreamPacket) (kind byte, seq, method uint32, body []byte) {
+	data := p.GetBody()
+	if len(data) < rpcHeadLength || string(data[:len(rpcMagic)]) != rpcMagic {
+		return 0, 0, 0, nil
+	}
+	n := len(rpcMagic)
+	if data[n] != rpcVersion || data[n+1] < rpcRequest || data[n+1] > rpcError {
+		return 0, 0, 0, nil
+	}
+	return data[n+1], BytesToUInt32(data[n+2 : n+6]), BytesToUInt32(data[n+6 : n+10]), data[rpcHeadLength:]
+}
@@ -0,0 +1,181 @@
+package gotcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+type echoMessage struct {
+	Text string `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	N    int32  `protobuf:"varint,2,opt,name=n,proto3" json:"n,omitempty"`
+}
+
+func (m *echoMessage) Reset()         { *m = echoMessage{} }
+func (m *echoMessage) String() string { return proto.CompactTextString(m) }
+func (*echoMessage) ProtoMessage()    {}
+
+func newEchoMessage() interface{} {
+	return new(echoMessage)
+}
+
+const (
+	methodEcho uint32 = iota + 1
+	methodWait
+	methodFail
+	methodCallBack
+)
+
+func startRPCServer(t *testing.T, rpc *RPC) (*Server, string) {
+	addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(&Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}, rpc, NewStreamProtocol(0), 1, 10)
+	go server.Start(listener, 100*time.Millisecond)
+	return server, listener.Addr().String()
+}
+
+func TestParseRPCPacket(t *testing.T) {
+	kind, seq, method, body := parseRPCPacket(newRPCPacket(rpcResponse, 7, 9, []byte("body")))
+	if kind != rpcResponse || seq != 7 || method != 9 || string(body) != "body" {
+		t.Error(kind, seq, method, body)
+	}
+	data := newRPCPacket(rpcRequest, 1, 1, nil).GetBody()
+	data[len(rpcMagic)]++
+	if kind, _, _, _ := parseRPCPacket(NewStreamFrame(data)); kind != 0 {
+		t.Error("parsed a message of another version")
+	}
+	if kind, _, _, _ := parseRPCPacket(NewStreamFrame([]byte(rpcMagic))); kind != 0 {
+		t.Error("parsed a truncated header")
+	}
+}
+
+func TestRPC(t *testing.T) {
+	serverRPC := NewRPC(&streamCallback{echo: true})
+	serverRPC.Handle(methodEcho, newEchoMessage, func(ctx context.Context, c *Conn, req interface{}) (interface{}, error) {
+		m := req.(*echoMessage)
+		return &echoMessage{Text: m.Text, N: m.N + 1}, nil
+	})
+	serverRPC.Handle(methodWait, newEchoMessage, func(ctx context.Context, c *Conn, req interface{}) (interface{}, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+			return req, nil
+		}
+	})
+	serverRPC.Handle(methodFail, newEchoMessage, func(ctx context.Context, c *Conn, req interface{}) (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+	serverRPC.Handle(methodCallBack, newEchoMessage, func(ctx context.Context, c *Conn, req interface{}) (interface{}, error) {
+		resp := new(echoMessage)
+		err := serverRPC.Call(ctx, c, methodEcho, req, resp)
+		return resp, err
+	})
+	server, addr := startRPCServer(t, serverRPC)
+	defer server.Stop()
+
+	cb := &streamCallback{messages: make(chan []byte, 16)}
+	clientRPC := NewRPC(cb)
+	clientRPC.Handle(methodEcho, newEchoMessage, func(ctx context.Context, c *Conn, req interface{}) (interface{}, error) {
+		m := req.(*echoMessage)
+		return &echoMessage{Text: "client " + m.Text, N: m.N * 2}, nil
+	})
+	client := NewClient(&Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}, clientRPC, NewStreamProtocol(0))
+	if !client.Start(addr) {
+		t.Fatal("client not started")
+	}
+	defer client.Stop()
+	conn := client.Conn
+
+	// the calls in flight on a connection
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp := new(echoMessage)
+			if err := clientRPC.Call(context.Background(), conn, methodEcho, &echoMessage{Text: fmt.Sprint(i), N: int32(i)}, resp); err != nil {
+				t.Error(err)
+				return
+			}
+			if resp.Text != fmt.Sprint(i) || resp.N != int32(i+1) {
+				t.Error(i, resp)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	resp := new(echoMessage)
+	if err := clientRPC.Call(context.Background(), conn, methodCallBack, &echoMessage{Text: "back", N: 3}, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "client back" || resp.N != 6 {
+		t.Error(resp)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := clientRPC.Call(ctx, conn, methodWait, &echoMessage{}, nil); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+	clientRPC.CallTimeout = 50 * time.Millisecond
+	if err := clientRPC.Call(context.Background(), conn, methodWait, &echoMessage{}, nil); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+
+	err := clientRPC.Call(context.Background(), conn, methodFail, &echoMessage{}, nil)
+	if e, ok := err.(*RPCError); !ok || e.Method != methodFail || e.Message != "failed" {
+		t.Error(err)
+	}
+	err = clientRPC.Call(context.Background(), conn, 99, &echoMessage{}, nil)
+	if e, ok := err.(*RPCError); !ok || e.Message != ErrUnknownMethod.Error() {
+		t.Error(err)
+	}
+	if err := clientRPC.Call(context.Background(), conn, methodEcho, "not a message", nil); err != ErrNotProtoMessage {
+		t.Error(err)
+	}
+
+	// the packets which are not RPC messages are passed to the callback,
+	// including the ones which look like a RPC message of the old header without the magic
+	for _, body := range []string{"plain", "\x01\x01\x00\x00\x00\x01\x00\x00\x00body"} {
+		if err := conn.SyncWritePacket(NewStreamFrame([]byte(body))); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case message := <-cb.messages:
+			if string(message) != body {
+				t.Errorf("%q", message)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no echo")
+		}
+	}
+
+	clientRPC.CallTimeout = 0
+	done := make(chan error)
+	go func() {
+		done <- clientRPC.Call(context.Background(), conn, methodWait, &echoMessage{}, nil)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+	select {
+	case err := <-done:
+		if err != ErrConnClosing {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the call is not ended by Close")
+	}
+}
@@ -3,17 +3,47 @@ package gotcp
 //根据https://github.com/whiskerman/gotcp 修改
 
 import (
+	"context"
+	"crypto/tls"
 	"mae_proj/MAE/common/logging"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// the interval of Shutdown checking the idle connections
+const shutdownPollInterval = 10 * time.Millisecond
+
 type Config struct {
-	PacketSendChanLimit    uint32 // the limit of packet send channel
-	PacketReceiveChanLimit uint32 // the limit of packet receive channel
-	ReadTimeOut            uint32
-	WriteTimeOut           uint32
+	PacketSendChanLimit    uint32         // the limit of packet send channel
+	PacketReceiveChanLimit uint32         // the limit of packet receive channel
+	ReadTimeOut            uint32         // the read deadline in seconds, 180 if 0
+	WriteTimeOut           uint32         // the write deadline in seconds, 20 if 0
+	SendOverflow           OverflowPolicy // what AsyncWritePacket does when the packet send channel is full
+}
+
+// OverflowPolicy is the policy of AsyncWritePacket when the send queue is full
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // wait for the room with a timeout
+	OverflowDropOldest                       // drop the oldest queued packet
+	OverflowDisconnect                       // close the slow consumer
+)
+
+func (c *Config) readTimeout() time.Duration {
+	if c.ReadTimeOut == 0 {
+		return defaultReadTimeout
+	}
+	return time.Duration(c.ReadTimeOut) * time.Second
+}
+
+func (c *Config) writeTimeout() time.Duration {
+	if c.WriteTimeOut == 0 {
+		return defaultWriteTimeout
+	}
+	return time.Duration(c.WriteTimeOut) * time.Second
 }
 
 type ConnWraper struct {
@@ -21,14 +51,27 @@ type ConnWraper struct {
 	callback       ConnCallback    // message callbacks in connection
 	protocol       Protocol        // customize packet protocol
 	exitChan       chan struct{}   // notify all goroutines to shutdown
+	draining       chan struct{}   // closed by Shutdown to stop the read loops, nil for a client
 	waitGroup      *sync.WaitGroup // wait for all goroutines
 	needHeartBeat  bool
 	hbSendInterval int64 //每隔多少秒发一次心跳，同时检测是否超时
 	hbTimeout      int64 //超时时间，单位秒
+	connsMutex     sync.Mutex
+	conns          map[*Conn]struct{} // the live connections of a server, nil for a client
+	dropped        uint64             // the packets dropped by the overflow of the send queues
+	connecting     int32              //已accept还没track的连接数，包括在OnConnect里的，Shutdown等它为0
 }
 
 type Server struct {
-	cw *ConnWraper
+	// Goodbye returns the packet sent to a connection before it is closed by Shutdown, nothing is sent if it is nil or returns nil
+	Goodbye func(*Conn) Packet
+
+	cw           *ConnWraper
+	mutex        sync.Mutex
+	listener     *net.TCPListener
+	stopOnce     sync.Once
+	drainOnce    sync.Once
+	shuttingDown int32
 }
 
 // NewServer creates a server
@@ -39,22 +82,61 @@ func NewServer(config *Config, callback ConnCallback, protocol Protocol, hbSendI
 			callback:       callback,
 			protocol:       protocol,
 			exitChan:       make(chan struct{}),
+			draining:       make(chan struct{}),
 			waitGroup:      &sync.WaitGroup{},
 			needHeartBeat:  true,
 			hbSendInterval: hbSendInterval,
 			hbTimeout:      hbTimeout,
-			
+			conns:          make(map[*Conn]struct{}),
 		},
 	}
 }
 
 // Start starts service
 func (s *Server) Start(listener *net.TCPListener, acceptTimeout time.Duration) {
+	s.accept(listener, acceptTimeout, func(conn *net.TCPConn) {
+		newConn(conn, s.cw).Do()
+	})
+}
+
+// StartTLS starts service over TLS by config, the handshake is done before OnConnect.
+// Mutual TLS is enabled by config.ClientAuth, such as tls.RequireAndVerifyClientCert with config.ClientCAs,
+// then Conn.PeerIdentity returns the identity of the client certificate.
+func (s *Server) StartTLS(listener *net.TCPListener, acceptTimeout time.Duration, config *tls.Config) {
+	s.accept(listener, acceptTimeout, func(conn *net.TCPConn) {
+		tlsConn := tls.Server(conn, config)
+		if err := handshake(tlsConn); err != nil {
+			logging.Info("tls handshake with %s failed: %v", conn.RemoteAddr(), err)
+			tlsConn.Close()
+			return
+		}
+		newConn(tlsConn, s.cw).Do()
+	})
+}
+
+// handshake runs the TLS handshake in defaultHandshakeTimeout
+func handshake(conn *tls.Conn) error {
+	conn.SetDeadline(time.Now().Add(defaultHandshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	return conn.SetDeadline(time.Time{})
+}
+
+// accept accepts the connections of listener until Stop, and serves each of them by serve in a goroutine
+func (s *Server) accept(listener *net.TCPListener, acceptTimeout time.Duration, serve func(*net.TCPConn)) {
 	s.cw.waitGroup.Add(1)
 	defer func() {
 		listener.Close()
 		s.cw.waitGroup.Done()
 	}()
+	s.mutex.Lock()
+	s.listener = listener
+	s.mutex.Unlock()
+	//Stop或Shutdown在Start之前调用
+	if s.isStopping() {
+		return
+	}
 
 	for {
 		select {
@@ -72,17 +154,212 @@ func (s *Server) Start(listener *net.TCPListener, acceptTimeout time.Duration) {
 			continue
 			// This was a timeout
 		} else if err != nil {
+			if s.isStopping() {
+				return
+			}
 			logging.Info("listener accepttcp continue and found a error: %v", err)
 			return
 			// This was an error, but not a timeout
 		}
 
-		go newConn(conn, s.cw).Do()
+		//在锁内检查并计数，closeListener返回后Shutdown一定能看到还在OnConnect里的连接
+		s.mutex.Lock()
+		if s.isStopping() {
+			s.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		atomic.AddInt32(&s.cw.connecting, 1)
+		s.mutex.Unlock()
+
+		//serve也计入waitGroup，Stop时新连接的Add才不会和Wait并发
+		s.cw.waitGroup.Add(1)
+		go func() {
+			defer func() {
+				//serve返回时连接已经track，或者没被OnConnect接受
+				atomic.AddInt32(&s.cw.connecting, -1)
+				s.cw.waitGroup.Done()
+			}()
+			serve(conn)
+		}()
 	}
 }
 
-// Stop stops service
+// Stop stops service, the connections are closed at once
 func (s *Server) Stop() {
-	close(s.cw.exitChan)
+	s.closeListener()
+	s.stop()
+	s.cw.waitGroup.Wait()
+}
+
+// Shutdown stops accepting and reading at once, and closes every connection when it is idle,
+// which has no received packet waiting for or in OnMessage, or in a handler of RPC.
+// The connections still in OnConnect are waited for, and closed in the same way after it.
+// The Goodbye packet is sent and the buffered data of Conn.Writer is flushed before closing,
+// every connection in its own goroutine and within WriteTimeOut or the deadline of ctx, whichever is earlier.
+// When ctx is done, the remaining connections are closed as Stop does, and ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeListener()
+	s.drain()
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	var closers sync.WaitGroup
+	closing := make(map[*Conn]struct{})
+	for {
+		conns := s.Conns()
+		for _, c := range conns {
+			if _, ok := closing[c]; ok || !c.drained() {
+				continue
+			}
+			closing[c] = struct{}{}
+			//每个连接并发flush，卡住的对端不会挡住其它连接
+			closers.Add(1)
+			go func(c *Conn, deadline time.Time) {
+				defer closers.Done()
+				s.closeIdle(c, deadline)
+			}(c, s.flushDeadline(ctx))
+		}
+		if len(conns) == 0 && atomic.LoadInt32(&s.cw.connecting) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			//剩下的连接并发flush，最多等shutdownPollInterval，然后全部关闭
+			deadline := time.Now().Add(shutdownPollInterval)
+			var flushers sync.WaitGroup
+			for _, c := range s.Conns() {
+				if _, ok := closing[c]; !ok {
+					flushers.Add(1)
+					go func(c *Conn) {
+						defer flushers.Done()
+						c.flush(deadline)
+					}(c)
+				}
+			}
+			flushed := make(chan struct{})
+			go func() {
+				flushers.Wait()
+				close(flushed)
+			}()
+			select {
+			case <-flushed:
+			case <-time.After(shutdownPollInterval):
+			}
+			for _, c := range s.Conns() {
+				c.Close()
+			}
+			s.stop()
+			closers.Wait()
+			<-flushed
+			s.cw.waitGroup.Wait()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	closers.Wait()
+	s.stop()
 	s.cw.waitGroup.Wait()
+	return nil
+}
+
+// flushDeadline returns the deadline of a flush on shutdown, WriteTimeOut from now but no later than the deadline of ctx
+func (s *Server) flushDeadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(s.cw.config.writeTimeout())
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	return deadline
+}
+
+// Dropped returns the number of the packets dropped by the overflow of the send queues of all the connections
+func (s *Server) Dropped() uint64 {
+	return atomic.LoadUint64(&s.cw.dropped)
+}
+
+// Conns returns the live connections, which OnConnect accepted and are not closed
+func (s *Server) Conns() []*Conn {
+	s.cw.connsMutex.Lock()
+	defer s.cw.connsMutex.Unlock()
+	conns := make([]*Conn, 0, len(s.cw.conns))
+	for c := range s.cw.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// closeIdle sends the Goodbye packet, flushes the connection before deadline and closes it
+func (s *Server) closeIdle(c *Conn, deadline time.Time) {
+	var p Packet
+	if s.Goodbye != nil {
+		p = s.Goodbye(c)
+	}
+	c.Lock()
+	//Goodbye写入Writer时也可能阻塞，所以先设置deadline
+	c.conn.SetWriteDeadline(deadline)
+	//handler异步发送的包还在队列里，先于Goodbye写出
+	err := c.writeQueued()
+	if err == nil && p != nil {
+		_, err = c.Writer.Write(p.Serialize())
+	}
+	if err == nil {
+		err = c.Writer.Flush()
+	}
+	c.Unlock()
+	if err != nil {
+		logging.Info("conn flush before shutdown failed: %v", err)
+	}
+	c.Close()
+}
+
+func (s *Server) isStopping() bool {
+	return atomic.LoadInt32(&s.shuttingDown) == 1
+}
+
+// closeListener stops accepting, the accepting goroutine returns at once
+func (s *Server) closeListener() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	atomic.StoreInt32(&s.shuttingDown, 1)
+	if s.listener != nil {
+		s.listener.Close()
+	}
+}
+
+// drain stops the read loops, the started connections are woken up from reading by a past read deadline
+func (s *Server) drain() {
+	s.drainOnce.Do(func() {
+		close(s.cw.draining)
+		for _, c := range s.Conns() {
+			c.conn.SetReadDeadline(time.Now())
+		}
+	})
+}
+
+func (s *Server) stop() {
+	s.stopOnce.Do(func() {
+		close(s.cw.exitChan)
+	})
+}
+
+// track adds a started connection to the live connections of a server
+func (cw *ConnWraper) track(c *Conn) {
+	if cw.conns == nil {
+		return
+	}
+	cw.connsMutex.Lock()
+	defer cw.connsMutex.Unlock()
+	//在OnConnect里已经Close的连接不再加入
+	if !c.IsClosed() {
+		cw.conns[c] = struct{}{}
+	}
+}
+
+// untrack removes a closed connection
+func (cw *ConnWraper) untrack(c *Conn) {
+	if cw.conns == nil {
+		return
+	}
+	cw.connsMutex.Lock()
+	defer cw.connsMutex.Unlock()
+	delete(cw.conns, c)
 }
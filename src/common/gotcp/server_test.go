@@ -0,0 +1,305 @@
+package gotcp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// slowCallback echoes every packet by AsyncWritePacket after delay, or blocks until the connection is closed if delay is 0
+type slowCallback struct {
+	handling chan struct{}
+	delay    time.Duration
+}
+
+func (cb *slowCallback) OnConnect(c *Conn) bool {
+	return true
+}
+
+func (cb *slowCallback) OnMessage(c *Conn, p Packet) bool {
+	cb.handling <- struct{}{}
+	if cb.delay == 0 {
+		<-c.closeChan
+		return false
+	}
+	time.Sleep(cb.delay)
+	return c.AsyncWritePacket(p, 0) == nil
+}
+
+func (cb *slowCallback) OnClose(c *Conn) {
+}
+
+// startShutdownServer starts a server with Goodbye, and connects to it by a raw connection, config may be nil
+func startShutdownServer(t *testing.T, callback ConnCallback, config *Config) (*Server, net.Conn) {
+	addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config == nil {
+		config = &Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}
+	}
+	server := NewServer(config, callback, NewStreamProtocol(0), 60, 120)
+	server.Goodbye = func(c *Conn) Packet {
+		return NewStreamFrame([]byte("bye"))
+	}
+	// Shutdown does not wait for the accept timeout
+	go server.Start(listener, time.Minute)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; len(server.Conns()) == 0; i++ {
+		if i == 100 {
+			t.Fatal("no live connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return server, conn
+}
+
+func TestServerShutdown(t *testing.T) {
+	callback := &slowCallback{handling: make(chan struct{}, 1), delay: 200 * time.Millisecond}
+	server, conn := startShutdownServer(t, callback, nil)
+	defer conn.Close()
+	addr := conn.RemoteAddr().String()
+
+	if _, err := conn.Write(DoPacket([]byte("slow"))); err != nil {
+		t.Fatal(err)
+	}
+	<-callback.handling
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Error("shutdown took", d)
+	}
+	if conns := server.Conns(); len(conns) != 0 {
+		t.Error(conns)
+	}
+	if c, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		c.Close()
+		t.Error("accepted after shutdown")
+	}
+
+	// the reply of the handler is flushed before the goodbye packet
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	p := NewStreamProtocol(0)
+	for _, body := range []string{"slow", "bye"} {
+		pack, err := p.readFrame(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(pack.GetBody()) != body {
+			t.Errorf("%q, want %q", pack.GetBody(), body)
+		}
+	}
+	if _, err := p.readFrame(conn); err != io.EOF {
+		t.Error("the connection is not closed:", err)
+	}
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	callback := &slowCallback{handling: make(chan struct{}, 1)}
+	server, conn := startShutdownServer(t, callback, nil)
+	defer conn.Close()
+
+	if _, err := conn.Write(DoPacket([]byte("block"))); err != nil {
+		t.Fatal(err)
+	}
+	<-callback.handling
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+	if conns := server.Conns(); len(conns) != 0 {
+		t.Error(conns)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.Copy(io.Discard, conn); err != nil {
+		t.Error("the connection is not closed:", err)
+	}
+	// Stop after Shutdown does nothing
+	server.Stop()
+}
+
+func TestServerShutdownStalledPeer(t *testing.T) {
+	config := &Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16, WriteTimeOut: 1}
+	server, stalled := startShutdownServer(t, &streamCallback{}, config)
+	defer stalled.Close()
+	healthy, err := net.Dial("tcp", stalled.RemoteAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer healthy.Close()
+	waitFor(t, "no live connection", func() bool { return len(server.Conns()) == 2 })
+	// the goodbye of the stalled peer, which never reads, is larger than the socket buffers
+	big := NewStreamFrame(bytes.Repeat([]byte("x"), 32*1024*1024))
+	server.Goodbye = func(c *Conn) Packet {
+		if c.GetRawConn().RemoteAddr().String() == stalled.LocalAddr().String() {
+			return big
+		}
+		return NewStreamFrame([]byte("bye"))
+	}
+
+	start := time.Now()
+	done := make(chan error)
+	go func() {
+		done <- server.Shutdown(context.Background())
+	}()
+	// the healthy connection is closed while the stalled one is flushing
+	healthy.SetReadDeadline(time.Now().Add(5 * time.Second))
+	p := NewStreamProtocol(0)
+	if pack, err := p.readFrame(healthy); err != nil || string(pack.GetBody()) != "bye" {
+		t.Fatal(pack, err)
+	}
+	if _, err := p.readFrame(healthy); err != io.EOF {
+		t.Error("the connection is not closed:", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Error("the healthy connection is closed in", d)
+	}
+	// a ctx without deadline does not flush forever, the flush ends by WriteTimeOut
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown is blocked by the stalled peer")
+	}
+}
+
+// gateCallback blocks OnConnect and OnMessage until their channels are closed, and echoes every packet by AsyncWritePacket
+type gateCallback struct {
+	connects chan struct{}
+	connect  chan struct{}
+	handling chan struct{}
+	message  chan struct{}
+}
+
+func (cb *gateCallback) OnConnect(c *Conn) bool {
+	cb.connects <- struct{}{}
+	<-cb.connect
+	return true
+}
+
+func (cb *gateCallback) OnMessage(c *Conn, p Packet) bool {
+	cb.handling <- struct{}{}
+	<-cb.message
+	return c.AsyncWritePacket(p, 0) == nil
+}
+
+func (cb *gateCallback) OnClose(c *Conn) {
+}
+
+func TestServerShutdownInOnConnect(t *testing.T) {
+	addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback := &gateCallback{connects: make(chan struct{}, 1), connect: make(chan struct{}), handling: make(chan struct{}, 4), message: make(chan struct{})}
+	close(callback.message)
+	server := NewServer(&Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}, callback, NewStreamProtocol(0), 60, 120)
+	server.Goodbye = func(c *Conn) Packet {
+		return NewStreamFrame([]byte("bye"))
+	}
+	go server.Start(listener, time.Minute)
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	<-callback.connects
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Shutdown(context.Background())
+	}()
+	select {
+	case err := <-done:
+		t.Fatal("shutdown returned while OnConnect is running:", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(callback.connect)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown is blocked")
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	p := NewStreamProtocol(0)
+	if pack, err := p.readFrame(conn); err != nil || string(pack.GetBody()) != "bye" {
+		t.Fatal(pack, err)
+	}
+	if _, err := p.readFrame(conn); err != io.EOF {
+		t.Error("the connection is not closed:", err)
+	}
+}
+
+func TestServerShutdownReceived(t *testing.T) {
+	callback := &gateCallback{connects: make(chan struct{}, 1), connect: make(chan struct{}), handling: make(chan struct{}, 4), message: make(chan struct{})}
+	close(callback.connect)
+	server, conn := startShutdownServer(t, callback, nil)
+	defer conn.Close()
+
+	// the second packet waits in the receive queue while the first is in OnMessage
+	for _, body := range []string{"one", "two"} {
+		if _, err := conn.Write(DoPacket([]byte(body))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-callback.handling
+	c := server.Conns()[0]
+	waitFor(t, "the second packet is not received", func() bool { return len(c.packetReceiveChan) == 1 })
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Shutdown(context.Background())
+	}()
+	waitFor(t, "the read loop is not stopped", func() bool {
+		select {
+		case <-c.readStopped:
+			return true
+		default:
+			return false
+		}
+	})
+	close(callback.message)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	// the packets received before Shutdown are handled and their replies flushed before the goodbye packet
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	p := NewStreamProtocol(0)
+	for _, body := range []string{"one", "two", "bye"} {
+		pack, err := p.readFrame(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(pack.GetBody()) != body {
+			t.Errorf("%q, want %q", pack.GetBody(), body)
+		}
+	}
+	if _, err := p.readFrame(conn); err != io.EOF {
+		t.Error("the connection is not closed:", err)
+	}
+}
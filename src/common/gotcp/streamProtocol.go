@@ -0,0 +1,196 @@
+package gotcp
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync/atomic"
+
+	"mae_proj/MAE/common/logging"
+)
+
+// DefaultMaxFrameSize is the max body length of a frame of StreamProtocol if MaxFrameSize is 0.
+const DefaultMaxFrameSize = 4 * 1024 * 1024
+
+// the length of the header and the length field in front of the body
+const frameHeadLength = ConstHeaderLength + ConstSaveDataLength
+
+// StreamProtocol is the Protocol of the frames made by DoPacket:
+// the header SeanCommu, the little endian length of the body, the body and the CheckECC of all of them.
+//
+// A frame whose length is out of range or whose checksum is wrong is dropped,
+// and the stream is resynchronized at the next header, a resync is logged and counted once.
+// The received frames are *StreamPacket, every frame resets the heartbeat tick of the connection,
+// and the empty frames are heartbeats which are not passed to OnMessage.
+type StreamProtocol struct {
+	MaxFrameSize int // the max length of a body, DefaultMaxFrameSize if 0
+
+	corrupted uint64
+}
+
+// NewStreamProtocol creates a StreamProtocol with the max body length, DefaultMaxFrameSize if 0.
+func NewStreamProtocol(maxFrameSize int) *StreamProtocol {
+	return &StreamProtocol{MaxFrameSize: maxFrameSize}
+}
+
+func (p *StreamProtocol) maxFrameSize() int {
+	if p.MaxFrameSize <= 0 {
+		return DefaultMaxFrameSize
+	}
+	return p.MaxFrameSize
+}
+
+// Corrupted returns the number of the resyncs, each one after a corrupt frame or garbage.
+func (p *StreamProtocol) Corrupted() uint64 {
+	return atomic.LoadUint64(&p.corrupted)
+}
+
+// GetHeatBeatData returns an empty frame.
+func (p *StreamProtocol) GetHeatBeatData() Packet {
+	return NewStreamFrame(nil)
+}
+
+// Unpack reads the buffered data of c.Reader, or waits for it,
+// and sends the complete frames to readerChannel, the rest is kept in c.UnCompleteReadBuffer.
+func (p *StreamProtocol) Unpack(c *Conn, readerChannel chan Packet) error {
+	if _, err := c.Reader.Peek(1); err != nil {
+		return err
+	}
+	data, _ := c.Reader.Peek(c.Reader.Buffered())
+	buffer := append(c.UnCompleteReadBuffer, data...)
+	c.Reader.Discard(len(data))
+
+	var frames []*StreamPacket
+	rest := p.decode(buffer, &c.resyncing, func(pack *StreamPacket) {
+		frames = append(frames, pack)
+	})
+	c.UnCompleteReadBuffer = append(buffer[:0], rest...)
+
+	for _, pack := range frames {
+		c.ResetTick()
+		if len(pack.GetBody()) == 0 {
+			continue
+		}
+		select {
+		case readerChannel <- pack:
+		case <-c.closeChan:
+			return ErrConnClosing
+		}
+	}
+	return nil
+}
+
+// decode passes the complete frames of buffer to emit, and returns the bytes left,
+// which are an incomplete frame, or the tail of the garbage which may be the start of a header.
+// resyncing keeps whether the stream is resynchronizing across the calls, until the next frame.
+func (p *StreamProtocol) decode(buffer []byte, resyncing *bool, emit func(*StreamPacket)) []byte {
+	header := []byte(ConstHeader)
+	for {
+		i := bytes.Index(buffer, header)
+		if i < 0 {
+			if keep := int(ConstHeaderLength) - 1; len(buffer) > keep {
+				p.drop(resyncing, "drops %d bytes before a header", len(buffer)-keep)
+				buffer = buffer[len(buffer)-keep:]
+			}
+			return buffer
+		}
+		if i > 0 {
+			p.drop(resyncing, "drops %d bytes before a header", i)
+			buffer = buffer[i:]
+		}
+		if len(buffer) < int(frameHeadLength) {
+			return buffer
+		}
+		length := int(BytesToInt(buffer[ConstHeaderLength:frameHeadLength]))
+		if length < 0 || length > p.maxFrameSize() {
+			p.drop(resyncing, "drops a frame of length %d", length)
+			buffer = buffer[1:]
+			continue
+		}
+		size := int(frameHeadLength) + length + int(ConstEndCheckECCLength)
+		if len(buffer) < size {
+			return buffer
+		}
+		frame := buffer[:size]
+		if CheckECC(frame[:size-int(ConstEndCheckECCLength)]) != BytesToUInt32(frame[size-int(ConstEndCheckECCLength):]) {
+			p.drop(resyncing, "drops a frame of length %d by the checksum", length)
+			buffer = buffer[1:]
+			continue
+		}
+		*resyncing = false
+		emit(newStreamFrame(append([]byte(nil), frame...)))
+		buffer = buffer[size:]
+	}
+}
+
+// drop logs and counts the corrupt frame or garbage which starts a resync,
+// the rest dropped before the next frame is neither logged nor counted again.
+func (p *StreamProtocol) drop(resyncing *bool, format string, v ...interface{}) {
+	if *resyncing {
+		return
+	}
+	*resyncing = true
+	logging.Error("gotcp StreamProtocol "+format+", resynchronizing", v...)
+	atomic.AddUint64(&p.corrupted, 1)
+}
+
+// ReadPacket reads a frame from conn without buffering, the corrupt frames are skipped.
+func (p *StreamProtocol) ReadPacket(conn net.Conn) (Packet, error) {
+	return p.readFrame(conn)
+}
+
+func (p *StreamProtocol) readFrame(r io.Reader) (*StreamPacket, error) {
+	resyncing := false
+	head := make([]byte, frameHeadLength)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	for {
+		if string(head[:ConstHeaderLength]) != ConstHeader {
+			p.drop(&resyncing, "drops the bytes before a header")
+			copy(head, head[1:])
+			if _, err := io.ReadFull(r, head[len(head)-1:]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		length := int(BytesToInt(head[ConstHeaderLength:]))
+		if length < 0 || length > p.maxFrameSize() {
+			p.drop(&resyncing, "drops a frame of length %d", length)
+			copy(head, head[1:])
+			if _, err := io.ReadFull(r, head[len(head)-1:]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		frame := make([]byte, len(head)+length+int(ConstEndCheckECCLength))
+		copy(frame, head)
+		if _, err := io.ReadFull(r, frame[len(head):]); err != nil {
+			return nil, err
+		}
+		sum := len(frame) - int(ConstEndCheckECCLength)
+		if CheckECC(frame[:sum]) == BytesToUInt32(frame[sum:]) {
+			return newStreamFrame(frame), nil
+		}
+		p.drop(&resyncing, "drops a frame of length %d by the checksum", length)
+		//和decode一样从header后一个字节重新同步，被丢弃的帧里可能有完整的帧
+		r = io.MultiReader(bytes.NewReader(frame[1:]), r)
+		if _, err := io.ReadFull(r, head); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// NewStreamFrame creates a packet of StreamProtocol, whose Serialize returns the frame of body made by DoPacket.
+func NewStreamFrame(body []byte) *StreamPacket {
+	return newStreamFrame(DoPacket(body))
+}
+
+// newStreamFrame creates a packet of a complete frame.
+func newStreamFrame(frame []byte) *StreamPacket {
+	length := len(frame) - int(frameHeadLength) - int(ConstEndCheckECCLength)
+	return &StreamPacket{
+		buff:  frame[frameHeadLength : int(frameHeadLength)+length],
+		frame: frame,
+	}
+}
@@ -0,0 +1,225 @@
+package gotcp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func decodeAll(p *StreamProtocol, data []byte) ([][]byte, []byte) {
+	var bodies [][]byte
+	resyncing := false
+	rest := p.decode(data, &resyncing, func(pack *StreamPacket) {
+		bodies = append(bodies, pack.GetBody())
+	})
+	return bodies, rest
+}
+
+func TestStreamProtocolDecode(t *testing.T) {
+	long := bytes.Repeat([]byte("0123456789"), 25)
+	corrupt := DoPacket([]byte("corrupt"))
+	corrupt[len(corrupt)-1]++
+	tooLarge := DoPacket(bytes.Repeat([]byte("x"), 400))
+	tests := []struct {
+		data      []byte
+		bodies    []string
+		rest      int
+		corrupted uint64
+	}{
+		{DoPacket([]byte("hello")), []string{"hello"}, 0, 0},
+		{append(DoPacket([]byte("a")), DoPacket([]byte("b"))...), []string{"a", "b"}, 0, 0},
+		{DoPacket(long), []string{string(long)}, 0, 0},
+		{DoPacket([]byte("hello"))[:10], nil, 10, 0},
+		{append([]byte("garbage"), DoPacket([]byte("a"))...), []string{"a"}, 0, 1},
+		{append(corrupt, DoPacket([]byte("a"))...), []string{"a"}, 0, 1},
+		{append(tooLarge, DoPacket([]byte("a"))...), []string{"a"}, 0, 1},
+		{append(append(corrupt, "garbage"...), corrupt...), nil, 8, 1},
+		{[]byte("garbage without header"), nil, 8, 1},
+		{[]byte("xxxxSeanCo"), nil, 8, 1},
+	}
+	for i, test := range tests {
+		p := NewStreamProtocol(300)
+		bodies, rest := decodeAll(p, test.data)
+		if len(bodies) != len(test.bodies) {
+			t.Errorf("%d: %q", i, bodies)
+			continue
+		}
+		for j := range bodies {
+			if string(bodies[j]) != test.bodies[j] {
+				t.Errorf("%d: %q", i, bodies)
+			}
+		}
+		if len(rest) != test.rest {
+			t.Errorf("%d: rest %q", i, rest)
+		}
+		if p.Corrupted() != test.corrupted {
+			t.Errorf("%d: corrupted %d", i, p.Corrupted())
+		}
+	}
+
+	// a resync across the reads is counted once, and ends at the next frame
+	p := NewStreamProtocol(0)
+	resyncing := false
+	emit := func(pack *StreamPacket) {}
+	rest := p.decode([]byte("garbage without header"), &resyncing, emit)
+	rest = p.decode(append(rest, "more garbage"...), &resyncing, emit)
+	p.decode(append(append(rest, DoPacket([]byte("a"))...), "garbage after the frame"...), &resyncing, emit)
+	if p.Corrupted() != 2 {
+		t.Errorf("corrupted %d", p.Corrupted())
+	}
+}
+
+func TestStreamProtocolReadPacket(t *testing.T) {
+	corrupt := DoPacket([]byte("corrupt"))
+	corrupt[len(corrupt)-1]++
+	var data []byte
+	data = append(data, "garbage"...)
+	data = append(data, corrupt...)
+	data = append(data, DoPacket([]byte("hello"))...)
+	p := NewStreamProtocol(0)
+	pack, err := p.readFrame(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pack.GetBody()) != "hello" || !bytes.Equal(pack.Serialize(), DoPacket([]byte("hello"))) {
+		t.Errorf("%q", pack.Serialize())
+	}
+	if p.Corrupted() != 1 {
+		t.Errorf("corrupted %d", p.Corrupted())
+	}
+	if _, err := p.readFrame(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Error("read a truncated frame")
+	}
+
+	// the frame is found inside a corrupt frame which claims it
+	outer := DoPacket(DoPacket([]byte("inner")))
+	outer[len(outer)-1]++
+	if pack, err := p.readFrame(bytes.NewReader(outer)); err != nil || string(pack.GetBody()) != "inner" {
+		t.Error(pack, err)
+	}
+	if bodies, _ := decodeAll(p, outer); len(bodies) != 1 || string(bodies[0]) != "inner" {
+		t.Errorf("%q", bodies)
+	}
+}
+
+func TestCheckECC(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 25)
+	saved := append([]byte(nil), data...)
+	CheckECC(data)
+	if !bytes.Equal(data, saved) {
+		t.Error("CheckECC modified the data")
+	}
+}
+
+type streamCallback struct {
+	messages chan []byte
+	echo     bool
+}
+
+func (cb *streamCallback) OnConnect(c *Conn) bool {
+	return true
+}
+
+func (cb *streamCallback) OnMessage(c *Conn, p Packet) bool {
+	body := p.(*StreamPacket).GetBody()
+	if cb.echo {
+		return c.SyncWritePacket(p) == nil
+	}
+	cb.messages <- body
+	return true
+}
+
+func (cb *streamCallback) OnClose(c *Conn) {
+}
+
+func TestStreamProtocol(t *testing.T) {
+	addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}
+	server := NewServer(config, &streamCallback{echo: true}, NewStreamProtocol(0), 1, 10)
+	go server.Start(listener, 100*time.Millisecond)
+	defer server.Stop()
+
+	cb := &streamCallback{messages: make(chan []byte, 16)}
+	client := NewClient(config, cb, NewStreamProtocol(0))
+	if !client.Start(listener.Addr().String()) {
+		t.Fatal("client not started")
+	}
+	defer client.Stop()
+
+	client.Conn.GetRawConn().Write([]byte("garbage"))
+	long := bytes.Repeat([]byte("0123456789"), 10000)
+	for _, body := range [][]byte{[]byte("hello"), long, []byte("world")} {
+		if err := client.Conn.SyncWritePacket(NewStreamFrame(body)); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case message := <-cb.messages:
+			if !bytes.Equal(message, body) {
+				t.Errorf("%q", message)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no echo")
+		}
+	}
+}
+
+func FuzzStreamProtocolDecode(f *testing.F) {
+	f.Add(DoPacket([]byte("hello")), uint(3))
+	f.Add(append([]byte("garbageSeanCommu\x01\x00\x00\x00"), DoPacket([]byte("a"))...), uint(20))
+	f.Add(append(DoPacket(bytes.Repeat([]byte("x"), 300)), DoPacket(nil)...), uint(100))
+	f.Fuzz(func(t *testing.T, data []byte, split uint) {
+		p := NewStreamProtocol(1024)
+		bodies, rest := decodeAll(p, data)
+		for _, body := range bodies {
+			if !bytes.Contains(data, DoPacket(body)) {
+				t.Fatalf("body %q is not a frame of the data", body)
+			}
+		}
+		if len(rest) > int(frameHeadLength)+1024+int(ConstEndCheckECCLength) {
+			t.Fatalf("%d bytes left", len(rest))
+		}
+
+		// the frames are the same however the data is split
+		n := int(split % uint(len(data)+1))
+		bodies2, rest2 := decodeAll(p, data[:n:n])
+		more, rest2 := decodeAll(p, append(rest2, data[n:]...))
+		bodies2 = append(bodies2, more...)
+		if len(bodies2) != len(bodies) || !bytes.Equal(rest2, rest) {
+			t.Fatalf("split at %d: %q %q, whole: %q %q", n, bodies2, rest2, bodies, rest)
+		}
+		for i := range bodies {
+			if !bytes.Equal(bodies[i], bodies2[i]) {
+				t.Fatalf("split at %d: %q, whole: %q", n, bodies2, bodies)
+			}
+		}
+	})
+}
+
+func FuzzStreamProtocolResync(f *testing.F) {
+	f.Add([]byte("garbage"), []byte("hello"))
+	f.Add([]byte("SeanComm"), []byte{})
+	f.Add([]byte("\x00\x01\x02SeanCom"), bytes.Repeat([]byte("x"), 300))
+	f.Fuzz(func(t *testing.T, garbage, body []byte) {
+		if bytes.Contains(garbage, []byte(ConstHeader)) || len(body) > 1024 {
+			return
+		}
+		data := append(append([]byte(nil), garbage...), DoPacket(body)...)
+		p := NewStreamProtocol(1024)
+		bodies, rest := decodeAll(p, data)
+		if len(bodies) != 1 || !bytes.Equal(bodies[0], body) || len(rest) != 0 {
+			t.Fatalf("%q %q", bodies, rest)
+		}
+		pack, err := p.readFrame(bytes.NewReader(data))
+		if err != nil || !bytes.Equal(pack.GetBody(), body) {
+			t.Fatalf("%q %v", pack, err)
+		}
+	})
+}
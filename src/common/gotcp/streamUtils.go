@@ -37,10 +37,14 @@ func init() {
 }
 
 type StreamPacket struct {
-	buff []byte
+	buff  []byte
+	frame []byte // the whole frame of StreamProtocol, nil for a raw packet
 }
 
 func (this *StreamPacket) Serialize() []byte {
+	if this.frame != nil {
+		return this.frame
+	}
 	return this.buff
 }
 
@@ -70,7 +74,9 @@ func GetUniq() int {
 
 func CheckECC(data []byte) uint32 {
 	if len(data) > 200 {
-		tmpdata := append(data[:100], data[len(data)-100:]...)
+		//拷贝一份，不能覆盖data
+		tmpdata := make([]byte, 0, 200)
+		tmpdata = append(append(tmpdata, data[:100]...), data[len(data)-100:]...)
 		return adler32.Checksum(tmpdata)
 	} else {
 		return adler32.Checksum(data)
@@ -0,0 +1,192 @@
+package gotcp
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// testCA issues throwaway certificates for the TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gotcp test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+type tlsCallback struct {
+	identities chan string
+	closed     chan struct{}
+	streamCallback
+}
+
+func (cb *tlsCallback) OnConnect(c *Conn) bool {
+	if cb.identities != nil {
+		cb.identities <- c.PeerIdentity()
+	}
+	return true
+}
+
+func (cb *tlsCallback) OnClose(c *Conn) {
+	close(cb.closed)
+}
+
+func newTLSCallback() *tlsCallback {
+	return &tlsCallback{
+		identities:     make(chan string, 4),
+		closed:         make(chan struct{}),
+		streamCallback: streamCallback{messages: make(chan []byte, 16)},
+	}
+}
+
+func startTLSServer(t *testing.T, callback ConnCallback, config *tls.Config) (*Server, string) {
+	addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(&Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}, callback, NewStreamProtocol(0), 1, 10)
+	go server.StartTLS(listener, 100*time.Millisecond, config)
+	return server, listener.Addr().String()
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCB := newTLSCallback()
+	serverCB.echo = true
+	server, addr := startTLSServer(t, serverCB, &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "server", x509.ExtKeyUsageServerAuth)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	})
+	defer server.Stop()
+
+	cb := newTLSCallback()
+	client := NewClient(&Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}, cb, NewStreamProtocol(0))
+	if !client.DialTLS(addr, &tls.Config{
+		RootCAs:      ca.pool,
+		Certificates: []tls.Certificate{ca.issue(t, "player-1", x509.ExtKeyUsageClientAuth)},
+	}) {
+		t.Fatal("client not started")
+	}
+	defer client.Stop()
+
+	select {
+	case identity := <-serverCB.identities:
+		if identity != "player-1" {
+			t.Error(identity)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not connected")
+	}
+	if identity := <-cb.identities; identity != "server" {
+		t.Error(identity)
+	}
+	if state, ok := client.Conn.ConnectionState(); !ok || !state.HandshakeComplete {
+		t.Error(state, ok)
+	}
+
+	body := []byte("hello over tls")
+	if err := client.Conn.SyncWritePacket(NewStreamFrame(body)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case message := <-cb.messages:
+		if !bytes.Equal(message, body) {
+			t.Errorf("%q", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no echo")
+	}
+}
+
+func TestTLSWithoutClientCert(t *testing.T) {
+	ca := newTestCA(t)
+	serverCB := newTLSCallback()
+	server, addr := startTLSServer(t, serverCB, &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "server", x509.ExtKeyUsageServerAuth)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	})
+	defer server.Stop()
+
+	cb := newTLSCallback()
+	client := NewClient(&Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}, cb, NewStreamProtocol(0))
+	if client.DialTLS(addr, &tls.Config{RootCAs: ca.pool}) {
+		// the client finishes the handshake of TLS 1.3 before the server checks its certificate
+		defer client.Stop()
+		select {
+		case <-cb.closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the connection without a client certificate is not closed")
+		}
+	}
+	select {
+	case identity := <-serverCB.identities:
+		t.Errorf("connected %q", identity)
+	default:
+	}
+
+	client = NewClient(&Config{PacketSendChanLimit: 16, PacketReceiveChanLimit: 16}, newTLSCallback(), NewStreamProtocol(0))
+	if client.DialTLS(addr, &tls.Config{}) {
+		t.Error("connected to an unknown CA")
+	}
+}